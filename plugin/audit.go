@@ -0,0 +1,44 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// sensitiveDisplayAttrs marks fields holding tokens or credentials. Vault's audit devices record an HMAC of the
+// request & response fields, unless the mount is tuned to list them in 'audit_non_hmac_request_keys' or
+// 'audit_non_hmac_response_keys'; the plugin never declares its fields as non-HMAC.
+var sensitiveDisplayAttrs = &framework.DisplayAttributes{Sensitive: true}
+
+// tokenResponses documents the response of operations issuing a token in the named field.
+func tokenResponses(field string, description string) map[int][]framework.Response {
+	return map[int][]framework.Response{
+		http.StatusOK: {{
+			Description: "OK",
+			Fields: map[string]*framework.FieldSchema{
+				field: {
+					Type:         framework.TypeString,
+					Description:  description,
+					DisplayAttrs: sensitiveDisplayAttrs,
+				},
+			},
+		}},
+	}
+}
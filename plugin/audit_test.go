@@ -0,0 +1,74 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAuditSensitiveFields(t *testing.T) {
+	b, _ := getTestBackend(t)
+
+	sensitive := map[string][]string{
+		"sign/":           {keyDPoPProof},
+		"token-exchange/": {keySubjectToken, keyActorToken},
+		"verify":          {keyToken},
+		"introspect":      {keyToken},
+		"revoke":          {keyToken},
+		"config":          {keyTransitToken, keyAWSKMSSecretKey, keyGCPKMSCredentials, keyAzureKVClientSecret, keyPKCS11PIN, keyOPAToken},
+	}
+
+	for prefix, fields := range sensitive {
+		found := false
+		for _, path := range b.Paths {
+			if !strings.HasPrefix(path.Pattern, prefix) {
+				continue
+			}
+			found = true
+			for _, field := range fields {
+				schema, ok := path.Fields[field]
+				if !ok || schema.DisplayAttrs == nil || !schema.DisplayAttrs.Sensitive {
+					t.Errorf("field %s of %s should be sensitive", field, path.Pattern)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no path %s", prefix)
+		}
+	}
+
+	issuing := map[string]string{"sign/": "token", "token-exchange/": "access_token"}
+	for prefix, field := range issuing {
+		for _, path := range b.Paths {
+			if !strings.HasPrefix(path.Pattern, prefix) {
+				continue
+			}
+			responses := path.Operations[logical.UpdateOperation].Properties().Responses[http.StatusOK]
+			if len(responses) != 1 || responses[0].Fields[field] == nil || !responses[0].Fields[field].DisplayAttrs.Sensitive {
+				t.Errorf("response field %s of %s should be sensitive", field, path.Pattern)
+			}
+		}
+	}
+
+	if !b.Secrets[0].Fields["token"].DisplayAttrs.Sensitive {
+		t.Error("token secret should be sensitive")
+	}
+}
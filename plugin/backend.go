@@ -19,12 +19,15 @@ package jwtsecrets
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 	"gopkg.in/square/go-jose.v2"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,17 +38,47 @@ const (
 	configPath  = "config"
 	mainKeyName = "main"
 
+	// Prefix of the keyrings isolated to a single role
+	roleKeyringPrefix = "role/"
+
 	// Minimum cache size for transit backend
 	minCacheSize = 10
 )
 
+// publicKeyPaths are the paths publishing public key material & token statuses, served without a token by default.
+var publicKeyPaths = []string{
+	"jwks", "jwks/*", ".well-known/openid-configuration", statusListPathPrefix + "*",
+	issuersPath + "+/jwks", issuersPath + "+/.well-known/openid-configuration", "keys/" + keysPEMName,
+}
+
+// sealWrapStoragePaths are the storage paths holding private key material & credentials, seal wrapped by
+// capable seals; keysutil stores keyrings under "policy/" and their key versions under "archive/".
+var sealWrapStoragePaths = []string{"policy/", "archive/", configPath}
+
 type backend struct {
 	*framework.Backend
-	id               string
-	lockManager      *keysutil.LockManager
-	cachedConfig     *Config
-	cachedConfigLock *sync.RWMutex
-	idGen            uniqueIdGenerator
+	id                 string
+	lockManager        *keysutil.LockManager
+	cachedConfig       *Config
+	cachedSigner       externalSigner
+	cachedConfigLock   *sync.RWMutex
+	cachedRoles        roleCache
+	idGen              uniqueIdGenerator
+	jtiCounterLock     sync.Mutex
+	nonceLock          sync.Mutex
+	issuanceLock       sync.Mutex
+	activeTokensLock   sync.Mutex
+	signatureCountLock sync.Mutex
+	statusListLock     sync.Mutex
+	statusListTokens   statusListTokens
+	apiAddr            string
+	issuanceRates      issuanceRates
+	roleUsage          roleUsage
+	roleStatsLock      sync.Mutex
+	redactionSalt      *salt.Salt
+	redactionSaltLock  sync.Mutex
+	issuerKeysCache    issuerKeysCache
+	keyPregenerator    keyPregenerator
 }
 
 // Factory returns a new backend as logical.Backend.
@@ -54,6 +87,9 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 	if err != nil {
 		return nil, err
 	}
+	if err := b.loadSpecialPaths(ctx, conf.StorageView); err != nil {
+		return nil, err
+	}
 	if err := b.Setup(ctx, conf); err != nil {
 		return nil, err
 	}
@@ -72,19 +108,44 @@ func createBackend(conf *logical.BackendConfig) (*backend, error) {
 	b.id = conf.BackendUUID
 	b.cachedConfigLock = new(sync.RWMutex)
 	b.idGen = friendlyIdGenerator{}
+	b.apiAddr = os.Getenv(apiAddrEnv)
 
 	b.Backend = &framework.Backend{
 		BackendType: logical.TypeLogical,
 		Help:        strings.TrimSpace(backendHelp),
 		PathsSpecial: &logical.Paths{
-			Unauthenticated: []string{"jwks"},
+			Unauthenticated: append([]string{}, publicKeyPaths...),
+			SealWrapStorage: append([]string{}, sealWrapStoragePaths...),
 		},
 		Paths: framework.PathAppend(
 			pathRole(&b),
+			pathRoleExport(&b),
+			pathRoleTemplates(&b),
+			pathJwks(&b),
+			// Precedes the key set paths, which would match the PEM bundle's path
+			[]*framework.Path{pathKeysPEM(&b)},
+			pathKeys(&b),
+			pathIssuers(&b),
+			pathIssuances(&b),
+			pathSecret(&b),
 			[]*framework.Path{
 				pathConfig(&b),
-				pathJwks(&b),
+				pathRoleClone(&b),
+				pathRoleStats(&b),
+				pathDiscovery(&b),
+				pathKeysCertificate(&b),
 				pathSign(&b),
+				pathSignPayload(&b),
+				pathVerify(&b),
+				pathDecode(&b),
+				pathIntrospect(&b),
+				pathRevoke(&b),
+				pathTidy(&b),
+				pathStatus(&b),
+				pathExport(&b),
+				pathImport(&b),
+				pathTokenExchange(&b),
+				pathStatusList(&b),
 			},
 		),
 		Secrets: []*framework.Secret{
@@ -98,8 +159,41 @@ func createBackend(conf *logical.BackendConfig) (*backend, error) {
 	return &b, nil
 }
 
+// loadSpecialPaths applies the stored configuration to the special paths. Vault only
+// reads them when the backend is mounted, so changes require a plugin reload.
+func (b *backend) loadSpecialPaths(ctx context.Context, stg logical.Storage) error {
+	if stg == nil {
+		return nil
+	}
+
+	rawConfig, err := stg.Get(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	if rawConfig == nil {
+		return nil
+	}
+
+	conf := &Config{}
+	if err := json.Unmarshal(rawConfig.Value, conf); err != nil {
+		// Falls back to the default configuration, as getConfig does
+		return nil
+	}
+
+	if conf.AuthenticatedKeys {
+		b.PathsSpecial.Unauthenticated = nil
+	}
+
+	return nil
+}
+
 func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
 
+	// Migrate before loading the config, which is reset when it cannot be decoded
+	if err := b.migrateStorage(ctx, req.Storage); err != nil {
+		return err
+	}
+
 	if _, err := b.getConfig(ctx, req.Storage); err != nil {
 		return err
 	}
@@ -116,12 +210,20 @@ func (b *backend) periodic(ctx context.Context, req *logical.Request) error {
 		return err
 	}
 
-	policy, err := b.getPolicy(ctx, req.Storage, config, req.MountPoint)
-	if err != nil {
+	if err := b.persistRoleStats(ctx, req.Storage); err != nil {
 		return err
 	}
 
-	return b.pruneKeyVersions(ctx, req.Storage, policy, config, req.MountPoint)
+	if !config.DisablePeriodicTidy {
+		if _, err := b.tidy(ctx, req.Storage, config, req.MountPoint); err != nil {
+			return err
+		}
+	}
+
+	return b.forEachKeyring(ctx, req.Storage, config, req.MountPoint, func(policy *keysutil.Policy, _ *Config) error {
+		emitKeyAge(policy, req.MountPoint)
+		return nil
+	})
 }
 
 func (b *backend) invalidate(_ context.Context, key string) {
@@ -136,6 +238,17 @@ func (b *backend) invalidate(_ context.Context, key string) {
 		b.cachedConfigLock.Lock()
 		defer b.cachedConfigLock.Unlock()
 		b.cachedConfig = nil
+		b.cachedSigner = nil
+		b.cachedRoles.clear()
+		b.statusListTokens.clear()
+	case strings.HasPrefix(key, keyStorageRolePath+"/"), strings.HasPrefix(key, roleTemplatesPath), strings.HasPrefix(key, issuersPath):
+		b.cachedRoles.clear()
+	case strings.HasPrefix(key, statusListsPath):
+		b.statusListTokens.clear()
+	case key == redactionSaltPath:
+		b.redactionSaltLock.Lock()
+		defer b.redactionSaltLock.Unlock()
+		b.redactionSalt = nil
 	}
 }
 
@@ -144,11 +257,16 @@ func (b *backend) clean(_ context.Context) {
 }
 
 func (b *backend) getPolicy(ctx context.Context, stg logical.Storage, config *Config, mount string) (*keysutil.Policy, error) {
+	return b.getKeyringPolicy(ctx, stg, config, mainKeyName, mount)
+}
+
+// getKeyringPolicy returns the policy holding the keys of the named keyring, creating it if necessary.
+func (b *backend) getKeyringPolicy(ctx context.Context, stg logical.Storage, config *Config, name string, mount string) (*keysutil.Policy, error) {
 
 	polReq := keysutil.PolicyRequest{
 		Upsert:               true,
 		Storage:              stg,
-		Name:                 mainKeyName,
+		Name:                 name,
 		Derived:              false,
 		Convergent:           false,
 		Exportable:           false,
@@ -175,6 +293,13 @@ func (b *backend) getPolicy(ctx context.Context, stg logical.Storage, config *Co
 		polReq.KeyType = keysutil.KeyType_ECDSA_P384
 	case jose.ES512:
 		polReq.KeyType = keysutil.KeyType_ECDSA_P521
+	case jose.EdDSA:
+		polReq.KeyType = keysutil.KeyType_ED25519
+	case jose.HS256, jose.HS384, jose.HS512:
+		polReq.KeyType = keysutil.KeyType_HMAC
+		polReq.KeySize = hmacKeySizes[config.SignatureAlgorithm]
+	case ES256K:
+		polReq.KeyType = secp256k1KeyType
 	default:
 		err = errutil.InternalError{Err: "unknown/unsupported signature algorithm"}
 	}
@@ -188,6 +313,14 @@ func (b *backend) getPolicy(ctx context.Context, stg logical.Storage, config *Co
 		return nil, err
 	}
 
+	// AES-256 keyrings only hold secp256k1 keys when the configuration says so
+	if policy.Type == secp256k1KeyType && !config.Secp256k1Keys {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("keyring '%s' holds %s keys, which aren't configured as secp256k1 keys", name, policy.Type)}
+	}
+
+	// The keyring's next key is generated ahead of its rotation
+	b.keyPregenerator.prepare(polReq.KeyType)
+
 	if err := b.rotateIfNecessary(ctx, stg, policy, config, mount); err != nil {
 		return nil, err
 	}
@@ -195,32 +328,124 @@ func (b *backend) getPolicy(ctx context.Context, stg logical.Storage, config *Co
 	return policy, nil
 }
 
-func (b *backend) rotateIfNecessary(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, config *Config, mount string) error {
+// roleKeyringName returns the name of the keyring isolated to the role.
+func roleKeyringName(roleName string) string {
+	return roleKeyringPrefix + roleName
+}
+
+// listRoleKeyrings returns the names of all keyrings isolated to a role.
+func (b *backend) listRoleKeyrings(ctx context.Context, stg logical.Storage) ([]string, error) {
+	entries, err := stg.List(ctx, "policy/"+roleKeyringPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyrings := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keyrings = append(keyrings, roleKeyringName(entry))
+	}
+
+	return keyrings, nil
+}
+
+// deleteKeyring deletes the named keyring, and all of its keys, if it exists.
+func (b *backend) deleteKeyring(ctx context.Context, stg logical.Storage, name string) error {
+	polReq := keysutil.PolicyRequest{
+		Upsert:  false,
+		Storage: stg,
+		Name:    name,
+	}
+
+	policy, _, err := b.lockManager.GetPolicy(ctx, polReq, rand.Reader)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return nil
+	}
+
 	policy.Lock(true)
-	defer policy.Unlock()
+	policy.DeletionAllowed = true
+	err = policy.Persist(ctx, stg)
+	policy.Unlock()
+	if err != nil {
+		return err
+	}
 
-	latestKey, ok := policy.Keys[strconv.Itoa(policy.LatestVersion)]
-	if !ok {
+	if err := b.lockManager.DeletePolicy(ctx, stg, name); err != nil {
+		return err
+	}
+
+	return stg.Delete(ctx, signatureCountsPath+name)
+}
+
+// getLocalPolicy returns the policy holding locally generated keys. When an external signer is
+// configured no local keys are generated; the policy is only returned if it already exists
+// (e.g. from before a migration), otherwise nil is returned.
+func (b *backend) getLocalPolicy(ctx context.Context, stg logical.Storage, config *Config, mount string) (*keysutil.Policy, error) {
+	if config.usesLocalKeys() {
+		return b.getPolicy(ctx, stg, config, mount)
+	}
+
+	polReq := keysutil.PolicyRequest{
+		Upsert:  false,
+		Storage: stg,
+		Name:    mainKeyName,
+	}
+
+	policy, _, err := b.lockManager.GetPolicy(ctx, polReq, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (b *backend) rotateIfNecessary(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, config *Config, mount string) error {
+
+	// Checked with a shared lock first; every sign request checks, so an exclusive lock would serialize them
+	policy.Lock(false)
+	due := rotationDue(policy, config, time.Now())
+	policy.Unlock()
+
+	if !due {
 		return nil
 	}
 
-	if latestKey.CreationTime.Add(config.KeyRotationPeriod).After(time.Now()) {
+	policy.Lock(true)
+	defer policy.Unlock()
+
+	// Recheck after exclusive lock, another request may have rotated
+	if !rotationDue(policy, config, time.Now()) {
 		return nil
 	}
 
-	err := policy.Rotate(ctx, stg, rand.Reader)
+	err := b.rotatePolicy(ctx, stg, policy)
 	if err != nil {
 		return err
 	}
 
 	b.lockManager.InvalidatePolicy(policy.Name)
 
-	b.Logger().Info(fmt.Sprintf("Key Rotated: mount=%s", mount))
+	b.Logger().Info(fmt.Sprintf("Key Rotated: mount=%s, keyring=%s", mount, policy.Name))
+
+	emitKeyRotation(policy.Name, mount, rotationReasonScheduled)
 
 	return nil
 }
 
-func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, config *Config, mount string) error {
+// rotationDue checks if the latest key of the policy has reached the end of its rotation period. The caller
+// must hold a lock on the policy.
+func rotationDue(policy *keysutil.Policy, config *Config, now time.Time) bool {
+	latestKey, ok := policy.Keys[strconv.Itoa(policy.LatestVersion)]
+	if !ok {
+		return false
+	}
+
+	return !latestKey.CreationTime.Add(config.KeyRotationPeriod).After(now)
+}
+
+func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, config *Config, mount string) (int, error) {
 
 	logger := b.Logger()
 
@@ -238,7 +463,8 @@ func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, pol
 			continue
 		}
 
-		keyExpiresAt := keyVersion.CreationTime.Add(config.KeyRotationPeriod).Add(config.TokenTTL)
+		// Pre-published keys start signing, and so retire, after their pre-publish period
+		keyExpiresAt := keyVersion.CreationTime.Add(config.KeyRotationPeriod).Add(config.KeyPrePublishPeriod).Add(config.TokenTTL)
 
 		if logger.IsDebug() {
 			logger.Debug(
@@ -259,7 +485,7 @@ func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, pol
 
 	if unexpiredVersion == policy.MinAvailableVersion {
 		policy.Unlock()
-		return nil
+		return 0, nil
 	}
 
 	policy.Unlock()
@@ -268,7 +494,7 @@ func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, pol
 
 	// Recheck after exclusive lock
 	if unexpiredVersion == policy.MinAvailableVersion {
-		return nil
+		return 0, nil
 	}
 
 	// Ensure that cache doesn't get corrupted in error cases
@@ -278,10 +504,13 @@ func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, pol
 	policy.MinAvailableVersion = unexpiredVersion
 	policy.MinDecryptionVersion = unexpiredVersion
 
+	removedKeys := trimKeyVersions(policy)
+
 	if err := policy.Persist(ctx, stg); err != nil {
 		policy.MinAvailableVersion = previousMinAvailableVersion
 		policy.MinDecryptionVersion = previousMinDecryptionVersion
-		return err
+		restoreKeyVersions(policy, removedKeys)
+		return 0, err
 	}
 
 	logger.Info(
@@ -294,7 +523,7 @@ func (b *backend) pruneKeyVersions(ctx context.Context, stg logical.Storage, pol
 		),
 	)
 
-	return nil
+	return len(removedKeys), nil
 }
 
 const backendHelp = `
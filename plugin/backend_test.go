@@ -18,14 +18,18 @@ package jwtsecrets
 
 import (
 	"context"
+	"crypto/rand"
 	"github.com/go-test/deep"
 	"github.com/google/uuid"
 	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-func getTestBackend(t *testing.T) (*backend, *logical.Storage) {
+func getTestBackend(t testing.TB) (*backend, *logical.Storage) {
 
 	config := logical.TestBackendConfig()
 	config.StorageView = new(logical.InmemStorage)
@@ -211,7 +215,7 @@ func TestPrune(t *testing.T) {
 
 	time.Sleep(config.KeyRotationPeriod + config.TokenTTL + 1)
 
-	err = b.pruneKeyVersions(context.Background(), *storage, policy, config, "test")
+	_, err = b.pruneKeyVersions(context.Background(), *storage, policy, config, "test")
 	if err != nil {
 		t.Fatalf("%s\n", err)
 	}
@@ -247,3 +251,162 @@ func TestPrune(t *testing.T) {
 		t.Error("jwks key count", diff)
 	}
 }
+
+func TestPrePublish(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	_, err := writeConfig(b, storage, map[string]interface{}{
+		keyRotationDuration:   "1h",
+		keyPrePublishDuration: "10m",
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	signedKid := func() string {
+		signer, err := b.getSigner(context.Background(), *storage, config, mainKeyName, "test", &jose.SignerOptions{})
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		jws, err := signer.Sign([]byte("{}"))
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		return jws.Signatures[0].Protected.KeyID
+	}
+
+	// The only key signs immediately
+	if diff := deep.Equal(createKeyId(b.id, policy.Name, 1), signedKid()); diff != nil {
+		t.Error("signing key", diff)
+	}
+
+	if err := policy.Rotate(context.Background(), *storage, rand.Reader); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// The new key is published but does not sign until its pre-publish period has passed
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 2); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+	if diff := deep.Equal(createKeyId(b.id, policy.Name, 1), signedKid()); diff != nil {
+		t.Error("signing key", diff)
+	}
+
+	policy.Lock(false)
+	activeVersion := signingKeyVersion(policy, config.KeyPrePublishPeriod, time.Now().Add(config.KeyPrePublishPeriod))
+	policy.Unlock()
+
+	if diff := deep.Equal(activeVersion, 2); diff != nil {
+		t.Error("signing key version after pre-publish period", diff)
+	}
+
+	// Neither the active nor the upcoming key can be deleted
+	if resp, err := deleteKey(b, storage, createKeyId(b.id, policy.Name, 1)); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting the active key should have failed")
+	}
+	if resp, err := deleteKey(b, storage, createKeyId(b.id, policy.Name, 2)); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting the upcoming key should have failed")
+	}
+}
+
+func TestConcurrentRotation(t *testing.T) {
+	b, storage := getTestBackend(t)
+	b.idGen = friendlyIdGenerator{}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyRotationDuration: "1s"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	// Requests racing to rotate the due key rotate it once
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.getPolicy(context.Background(), *storage, config, "test"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	policy, err = b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(2, policy.LatestVersion); diff != nil {
+		t.Error("policy latest version", diff)
+	}
+}
+
+func TestSealWrapStorage(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := policy.Rotate(context.Background(), *storage, rand.Reader); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	keys, err := logical.CollectKeys(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Each seal wrapped path must hold the stored keys & configuration
+	for _, path := range b.SpecialPaths().SealWrapStorage {
+		found := false
+		for _, key := range keys {
+			found = found || strings.HasPrefix(key, path)
+		}
+		if !found {
+			t.Errorf("no storage entries under seal wrapped path '%s': %v", path, keys)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// CBOR major types (RFC 8949).
+const (
+	cborUnsigned   = 0
+	cborNegative   = 1
+	cborByteString = 2
+	cborTextString = 3
+	cborArray      = 4
+	cborMap        = 5
+	cborTagged     = 6
+	cborSimple     = 7
+)
+
+// cborTag is a tagged CBOR data item.
+type cborTag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// cborEncode encodes the value using the deterministic CBOR encoding (RFC 8949 §4.2). Values produced
+// by decoding JSON are supported, along with integers, byte strings, integer keyed maps & tags.
+func cborEncode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cborEncodeTo(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func cborEncodeTo(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case int:
+		cborEncodeInt(buf, int64(v))
+	case int64:
+		cborEncodeInt(buf, v)
+	case jwt.NumericDate:
+		cborEncodeInt(buf, int64(v))
+	case uint64:
+		cborEncodeHead(buf, cborUnsigned, v)
+	case float64:
+		// Integral numbers, as decoded from JSON, are encoded as integers
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			cborEncodeInt(buf, int64(v))
+		} else {
+			buf.WriteByte(cborSimple<<5 | 27)
+			_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+		}
+	case string:
+		cborEncodeHead(buf, cborTextString, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		cborEncodeHead(buf, cborByteString, uint64(len(v)))
+		buf.Write(v)
+	case []interface{}:
+		cborEncodeHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := cborEncodeTo(buf, item); err != nil {
+				return err
+			}
+		}
+	case []string:
+		cborEncodeHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := cborEncodeTo(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		entries := make(map[interface{}]interface{}, len(v))
+		for key, item := range v {
+			entries[key] = item
+		}
+		return cborEncodeMap(buf, entries)
+	case map[interface{}]interface{}:
+		return cborEncodeMap(buf, v)
+	case cborTag:
+		cborEncodeHead(buf, cborTagged, v.Number)
+		return cborEncodeTo(buf, v.Content)
+	default:
+		return fmt.Errorf("cannot encode %T as CBOR", value)
+	}
+	return nil
+}
+
+// cborEncodeMap encodes the map with its entries sorted by the bytewise order of their encoded keys.
+func cborEncodeMap(buf *bytes.Buffer, entries map[interface{}]interface{}) error {
+	type encodedEntry struct {
+		key   []byte
+		value interface{}
+	}
+
+	encoded := make([]encodedEntry, 0, len(entries))
+	for key, value := range entries {
+		encodedKey, err := cborEncode(key)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, encodedEntry{key: encodedKey, value: value})
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i].key, encoded[j].key) < 0
+	})
+
+	cborEncodeHead(buf, cborMap, uint64(len(encoded)))
+	for _, entry := range encoded {
+		buf.Write(entry.key)
+		if err := cborEncodeTo(buf, entry.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cborEncodeInt(buf *bytes.Buffer, value int64) {
+	if value < 0 {
+		cborEncodeHead(buf, cborNegative, uint64(-(value + 1)))
+	} else {
+		cborEncodeHead(buf, cborUnsigned, uint64(value))
+	}
+}
+
+// cborEncodeHead encodes the initial byte, and argument, of a data item using the shortest form.
+func cborEncodeHead(buf *bytes.Buffer, major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buf.WriteByte(major<<5 | byte(argument))
+	case argument <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(argument))
+	case argument <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(argument))
+	case argument <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(argument))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		_ = binary.Write(buf, binary.BigEndian, argument)
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestCBOREncode(t *testing.T) {
+	// Test vectors from RFC 8949 Appendix A
+	vectors := []struct {
+		value    interface{}
+		expected string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{float64(100), "1864"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"", "60"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]interface{}{}, "80"},
+		{[]interface{}{1, []interface{}{2, 3}, []string{"4", "5"}}, "83018202038261346135"},
+		{map[interface{}]interface{}{1: 2, 3: 4}, "a201020304"},
+		{map[string]interface{}{"a": 1, "b": []interface{}{2, 3}}, "a26161016162820203"},
+		{cborTag{Number: 1, Content: 1363896240}, "c11a514b67b0"},
+		// Keys sort by their encoding; shorter & integer keys first
+		{map[interface{}]interface{}{"aa": 1, "b": 2, 10: 3, -1: 4}, "a40a03200461620262616101"},
+	}
+
+	for _, vector := range vectors {
+		encoded, err := cborEncode(vector.value)
+		if err != nil {
+			t.Fatalf("%v: %s\n", vector.value, err)
+		}
+		if diff := deep.Equal(vector.expected, hex.EncodeToString(encoded)); diff != nil {
+			t.Error(vector.value, diff)
+		}
+	}
+
+	if _, err := cborEncode(struct{}{}); err == nil {
+		t.Error("unsupported type should have failed")
+	}
+}
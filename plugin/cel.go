@@ -0,0 +1,140 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+var (
+	policyEnvOnce sync.Once
+	policyEnv     *cel.Env
+	policyEnvErr  error
+)
+
+// policyExpressionEnv returns the CEL (https://github.com/google/cel-spec) environment policy expressions are
+// compiled in; declaring the token's 'claims' and the 'request'.
+func policyExpressionEnv() (*cel.Env, error) {
+	policyEnvOnce.Do(func() {
+		policyEnv, policyEnvErr = cel.NewEnv(
+			cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("request", cel.MapType(cel.StringType, cel.StringType)),
+			cel.CrossTypeNumericComparisons(true),
+		)
+	})
+	return policyEnv, policyEnvErr
+}
+
+// compilePolicyExpression parses & type checks the CEL expression, which must produce a boolean, returning the
+// program evaluating it.
+func compilePolicyExpression(expression string) (cel.Program, error) {
+	env, err := policyExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("expression produces %s, not bool", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+// evaluatePolicyExpression evaluates the role's policy expression against the claims of the token and the
+// request, returning an error when the token must not be issued.
+func evaluatePolicyExpression(req *logical.Request, roleName string, role *Role, claims map[string]interface{}) error {
+	program := role.policyProgram
+	if program == nil {
+		var err error
+		if program, err = compilePolicyExpression(role.PolicyExpression); err != nil {
+			return fmt.Errorf("invalid policy expression: %w", err)
+		}
+	}
+
+	result, _, err := program.Eval(map[string]interface{}{
+		"claims": policyValue(claims),
+		"request": map[string]string{
+			"role":         roleName,
+			"entity_id":    req.EntityID,
+			"display_name": req.DisplayName,
+			"mount_point":  req.MountPoint,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("policy expression failed: %v", err)
+	}
+	if allowed, ok := result.Value().(bool); !ok || !allowed {
+		return fmt.Errorf("denied by the role's policy expression")
+	}
+
+	return nil
+}
+
+// policyValue converts the value of a claim to the CEL value of its JSON encoding; integral numbers (e.g. the
+// 'exp' claim) are ints, other numbers are doubles.
+func policyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case jwt.NumericDate:
+		return int64(v)
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number
+		}
+		if number, err := v.Float64(); err == nil {
+			return policyValue(number)
+		}
+		return v.String()
+	case int:
+		return int64(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = item
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = policyValue(item)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			values[key] = policyValue(item)
+		}
+		return values
+	default:
+		return value
+	}
+}
@@ -0,0 +1,105 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestEvaluatePolicyExpression(t *testing.T) {
+	req := &logical.Request{EntityID: "", DisplayName: "tester", MountPoint: "jwt/"}
+	claims := map[string]interface{}{
+		"sub":    "svc-ship",
+		"aud":    []string{"planet-express", "mom-corp"},
+		"exp":    json.Number("1700003600"),
+		"iat":    jwt.NumericDate(1700000000),
+		"nbf":    float64(1700000000),
+		"ratio":  0.5,
+		"crew":   map[string]interface{}{"captain": "leela", "size": 3},
+		"orders": []interface{}{"deliver", "return"},
+	}
+
+	evaluate := func(expression string) error {
+		program, err := compilePolicyExpression(expression)
+		if err != nil {
+			t.Fatalf("%s: %s", expression, err)
+		}
+		return evaluatePolicyExpression(req, "tester", &Role{PolicyExpression: expression, policyProgram: program}, claims)
+	}
+
+	allowed := []string{
+		`true`,
+		`claims.sub == "svc-ship"`,
+		`claims.sub.startsWith("svc-") && !claims.sub.endsWith("-test")`,
+		`claims["sub"].contains("ship")`,
+		`claims.sub.matches("^svc-[a-z]+$")`,
+		`"mom-corp" in claims.aud && "captain" in claims.crew`,
+		`claims.exp - claims.iat <= 3600 && claims.nbf == claims.iat`,
+		`claims.ratio < 1 && claims.crew.size == 3`,
+		`size(claims.orders) == 2 && claims.orders[0] == "deliver"`,
+		`has(claims.crew) && !has(claims.jti)`,
+		`claims.aud.exists(a, a.startsWith("mom-"))`,
+		`request.role == "tester" && request.entity_id == "" && request.mount_point == "jwt/"`,
+		`claims.missing == "x" || true`,
+	}
+	for _, expression := range allowed {
+		if err := evaluate(expression); err != nil {
+			t.Errorf("%s: %s", expression, err)
+		}
+	}
+
+	denied := []string{
+		`false`,
+		`claims.sub == "bender"`,
+		`"boxy" in claims.aud`,
+		`claims.aud.all(a, a.startsWith("mom-"))`,
+		`claims.missing == "x"`,
+		`claims.orders[5] == "deliver"`,
+	}
+	for _, expression := range denied {
+		if err := evaluate(expression); err == nil {
+			t.Errorf("%s should have been denied", expression)
+		}
+	}
+
+	// roles loaded without a compiled program compile the expression when evaluated
+	if err := evaluatePolicyExpression(req, "tester", &Role{PolicyExpression: `claims.sub == "svc-ship"`}, claims); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompilePolicyExpression(t *testing.T) {
+	invalid := []string{
+		``,
+		`claims.sub ==`,
+		`claims.sub == "unterminated`,
+		`(claims.sub == "x"`,
+		`claims.sub`,
+		`request.role + 1 == 2`,
+		`unknown.field == 1`,
+		`claims.sub.shout()`,
+	}
+	for _, expression := range invalid {
+		if _, err := compilePolicyExpression(expression); err == nil {
+			t.Errorf("%s should have failed", expression)
+		}
+	}
+}
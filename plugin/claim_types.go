@@ -0,0 +1,141 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Supported types of claim declarations.
+const (
+	ClaimTypeString      = "string"
+	ClaimTypeNumber      = "number"
+	ClaimTypeBool        = "bool"
+	ClaimTypeStringArray = "string-array"
+)
+
+var AllowedClaimTypes = []string{ClaimTypeString, ClaimTypeNumber, ClaimTypeBool, ClaimTypeStringArray}
+
+// coerceClaims coerces the claims to their declared types (claim name to type), failing for claims that cannot
+// be represented as their type. Numbers & booleans are accepted as strings (and vice versa); single strings are
+// accepted as string arrays.
+func coerceClaims(claims map[string]interface{}, types map[string]string) error {
+	for name, claimType := range types {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+
+		coerced, ok := coerceClaim(value, claimType)
+		if !ok {
+			return fmt.Errorf("'%s' claim was %T, not %s", name, value, claimType)
+		}
+		claims[name] = coerced
+	}
+	return nil
+}
+
+func coerceClaim(value interface{}, claimType string) (interface{}, bool) {
+	switch claimType {
+	case ClaimTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case json.Number:
+			return v.String(), true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case int:
+			return strconv.Itoa(v), true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+
+	case ClaimTypeNumber:
+		switch v := value.(type) {
+		case float64, int, int64:
+			return v, true
+		case json.Number:
+			return numberValue(v)
+		case string:
+			// Only JSON numbers are accepted, excluding forms like 'Inf' or hex
+			decoder := json.NewDecoder(bytes.NewReader([]byte(v)))
+			decoder.UseNumber()
+			var number interface{}
+			if err := decoder.Decode(&number); err != nil || decoder.More() {
+				return nil, false
+			}
+			if n, ok := number.(json.Number); ok && n.String() == v {
+				return numberValue(n)
+			}
+		}
+
+	case ClaimTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			switch v {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			}
+		}
+
+	case ClaimTypeStringArray:
+		switch v := value.(type) {
+		case string:
+			return []interface{}{v}, true
+		case []string:
+			array := make([]interface{}, len(v))
+			for i, item := range v {
+				array[i] = item
+			}
+			return array, true
+		case []interface{}:
+			array := make([]interface{}, len(v))
+			for i, item := range v {
+				coerced, ok := coerceClaim(item, ClaimTypeString)
+				if !ok {
+					return nil, false
+				}
+				array[i] = coerced
+			}
+			return array, true
+		}
+	}
+
+	return nil, false
+}
+
+// numberValue converts the number to an integer, or a float; tokens are serialized with go-jose's JSON encoder,
+// which does not encode json.Number values as numbers.
+func numberValue(number json.Number) (interface{}, bool) {
+	if integer, err := number.Int64(); err == nil {
+		return integer, true
+	}
+	if float, err := number.Float64(); err == nil {
+		return float, true
+	}
+	return nil, false
+}
@@ -0,0 +1,76 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestCoerceClaims(t *testing.T) {
+	types := map[string]string{
+		"tenant_id": ClaimTypeNumber,
+		"account":   ClaimTypeString,
+		"admin":     ClaimTypeBool,
+		"groups":    ClaimTypeStringArray,
+		"regions":   ClaimTypeStringArray,
+	}
+
+	claims := map[string]interface{}{
+		"tenant_id": "42",
+		"account":   json.Number("1729"),
+		"admin":     "false",
+		"groups":    "crew",
+		"regions":   []interface{}{"earth", 3},
+		"other":     "12",
+	}
+	if err := coerceClaims(claims, types); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	expected := map[string]interface{}{
+		"tenant_id": int64(42),
+		"account":   "1729",
+		"admin":     false,
+		"groups":    []interface{}{"crew"},
+		"regions":   []interface{}{"earth", "3"},
+		"other":     "12",
+	}
+	if diff := deep.Equal(expected, claims); diff != nil {
+		t.Error(diff)
+	}
+
+	invalid := map[string]interface{}{
+		ClaimTypeNumber:      "0x2a",
+		ClaimTypeString:      map[string]interface{}{"id": 1},
+		ClaimTypeBool:        "yes",
+		ClaimTypeStringArray: []interface{}{"earth", []interface{}{"mars"}},
+	}
+	for claimType, value := range invalid {
+		if err := coerceClaims(map[string]interface{}{"claim": value}, map[string]string{"claim": claimType}); err == nil {
+			t.Errorf("%v should not have coerced to %s", value, claimType)
+		}
+	}
+
+	for _, value := range []string{"Inf", "NaN", "42 ", "1_000", "4 2"} {
+		if _, ok := coerceClaim(value, ClaimTypeNumber); ok {
+			t.Errorf("%s should not have coerced to a number", value)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Supported rules for conflicts when deep merging object claims provided by both the role and the sign request.
+const (
+	// ClaimMergeRole resolves conflicting values with the role's value.
+	ClaimMergeRole = "role"
+
+	// ClaimMergeRequest resolves conflicting values with the request's value.
+	ClaimMergeRequest = "request"
+
+	// ClaimMergeReject fails requests with conflicting values.
+	ClaimMergeReject = "reject"
+)
+
+var AllowedClaimMergeRules = []string{ClaimMergeRole, ClaimMergeRequest, ClaimMergeReject}
+
+// mergeClaim deep merges the object claim of the role with the object claim of the request. Keys of nested
+// objects are merged recursively; other values (including arrays) conflict unless equal, and are resolved
+// according to the rule.
+func mergeClaim(name string, roleValue interface{}, requestValue interface{}, rule string) (interface{}, error) {
+	if _, ok := requestValue.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("'%s' claim was %T, not an object", name, requestValue)
+	}
+	return mergeClaimValues(name, roleValue, requestValue, rule)
+}
+
+func mergeClaimValues(path string, roleValue interface{}, requestValue interface{}, rule string) (interface{}, error) {
+	roleObject, roleOk := roleValue.(map[string]interface{})
+	requestObject, requestOk := requestValue.(map[string]interface{})
+
+	if roleOk && requestOk {
+		merged := make(map[string]interface{}, len(roleObject)+len(requestObject))
+		for key, value := range requestObject {
+			merged[key] = value
+		}
+		for key, value := range roleObject {
+			if existing, ok := merged[key]; ok {
+				var err error
+				if value, err = mergeClaimValues(path+"."+key, value, existing, rule); err != nil {
+					return nil, err
+				}
+			}
+			merged[key] = value
+		}
+		return merged, nil
+	}
+
+	if reflect.DeepEqual(roleValue, requestValue) {
+		return roleValue, nil
+	}
+
+	switch rule {
+	case ClaimMergeRole:
+		return roleValue, nil
+	case ClaimMergeRequest:
+		return requestValue, nil
+	default:
+		return nil, fmt.Errorf("'%s' claim conflicts with the role's value", path)
+	}
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestMergeClaim(t *testing.T) {
+	roleValue := map[string]interface{}{
+		"env":  "prod",
+		"ship": map[string]interface{}{"name": "planet-express", "crew": []interface{}{"leela", "fry"}},
+	}
+	requestValue := map[string]interface{}{
+		"env":     "dev",
+		"request": "delivery",
+		"ship":    map[string]interface{}{"crew": []interface{}{"bender"}, "cargo": "slurm"},
+	}
+
+	merged, err := mergeClaim("context", roleValue, requestValue, ClaimMergeRole)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	expected := map[string]interface{}{
+		"env":     "prod",
+		"request": "delivery",
+		"ship":    map[string]interface{}{"name": "planet-express", "crew": []interface{}{"leela", "fry"}, "cargo": "slurm"},
+	}
+	if diff := deep.Equal(expected, merged); diff != nil {
+		t.Error(diff)
+	}
+
+	merged, err = mergeClaim("context", roleValue, requestValue, ClaimMergeRequest)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	expected = map[string]interface{}{
+		"env":     "dev",
+		"request": "delivery",
+		"ship":    map[string]interface{}{"name": "planet-express", "crew": []interface{}{"bender"}, "cargo": "slurm"},
+	}
+	if diff := deep.Equal(expected, merged); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := mergeClaim("context", roleValue, requestValue, ClaimMergeReject); err == nil {
+		t.Error("conflicting values should have failed")
+	}
+
+	merged, err = mergeClaim("context", roleValue, map[string]interface{}{"env": "prod", "request": "delivery"}, ClaimMergeReject)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("delivery", merged.(map[string]interface{})["request"]); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := mergeClaim("context", roleValue, "delivery", ClaimMergeRole); err == nil {
+		t.Error("non-object request value should have failed")
+	}
+}
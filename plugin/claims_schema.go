@@ -0,0 +1,375 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemaKeywords are the supported JSON Schema validation keywords.
+var schemaKeywords = []string{"type", "enum", "const", "properties", "required", "additionalProperties", "items", "minItems", "maxItems", "minLength", "maxLength", "pattern", "minimum", "maximum"}
+
+// schemaAnnotations are JSON Schema keywords that don't affect validation.
+var schemaAnnotations = []string{"$id", "$comment", "title", "description", "default", "examples"}
+
+// schemaDialects are the JSON Schema drafts ('$schema') whose semantics the supported keywords have.
+var schemaDialects = []string{"http://json-schema.org/draft-07/schema", "https://json-schema.org/draft/2019-09/schema", "https://json-schema.org/draft/2020-12/schema"}
+
+// claimsSchema is a compiled JSON Schema (https://json-schema.org) that claims must satisfy. The validation
+// keywords for types, enums, objects, arrays, strings & numbers are supported; schemas using other keywords
+// (e.g. '$ref' or 'oneOf') are rejected, rather than silently ignored.
+type claimsSchema struct {
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties           map[string]*claimsSchema
+	required             []string
+	additionalProperties *claimsSchema
+	denyAdditional       bool
+
+	items    *claimsSchema
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum *float64
+	maximum *float64
+}
+
+// parseClaimsSchema parses and compiles the JSON Schema document.
+func parseClaimsSchema(document string) (*claimsSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(document), &raw); err != nil {
+		return nil, fmt.Errorf("invalid claims schema: %w", err)
+	}
+
+	schema, err := compileClaimsSchema(raw, "#")
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+func compileClaimsSchema(raw interface{}, path string) (*claimsSchema, error) {
+	definition, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", path)
+	}
+
+	schema := &claimsSchema{}
+
+	for keyword, value := range definition {
+		var err error
+		switch keyword {
+		case "type":
+			schema.types, err = schemaTypes(value)
+		case "enum":
+			enum, ok := value.([]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an array")
+			}
+			schema.enum = enum
+		case "const":
+			schema.constant, schema.hasConst = value, true
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			schema.properties = make(map[string]*claimsSchema, len(properties))
+			for property, propertySchema := range properties {
+				if schema.properties[property], err = compileClaimsSchema(propertySchema, path+"/properties/"+property); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			schema.required, err = schemaStrings(value)
+		case "additionalProperties":
+			if allowed, ok := value.(bool); ok {
+				schema.denyAdditional = !allowed
+			} else if schema.additionalProperties, err = compileClaimsSchema(value, path+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		case "items":
+			if schema.items, err = compileClaimsSchema(value, path+"/items"); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			schema.minItems, err = schemaCount(value)
+		case "maxItems":
+			schema.maxItems, err = schemaCount(value)
+		case "minLength":
+			schema.minLength, err = schemaCount(value)
+		case "maxLength":
+			schema.maxLength, err = schemaCount(value)
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			schema.pattern, err = regexp.Compile(pattern)
+		case "minimum":
+			schema.minimum, err = schemaNumber(value)
+		case "maximum":
+			schema.maximum, err = schemaNumber(value)
+		case "$schema":
+			dialect, _ := value.(string)
+			if !stringInSlice(strings.TrimSuffix(dialect, "#"), schemaDialects) {
+				err = fmt.Errorf("unsupported dialect, must be one of %s", strings.Join(schemaDialects, ", "))
+			}
+		default:
+			if !stringInSlice(keyword, schemaAnnotations) {
+				err = fmt.Errorf("unsupported keyword, must be one of %s", strings.Join(schemaKeywords, ", "))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", path, keyword, err)
+		}
+	}
+
+	return schema, nil
+}
+
+// validate checks the value satisfies the schema.
+func (s *claimsSchema) validate(value interface{}, path string) error {
+	value = normalizeJSON(value)
+
+	if len(s.types) > 0 && !s.hasType(value) {
+		return fmt.Errorf("%s must be of type %s", path, strings.Join(s.types, " or "))
+	}
+
+	if s.hasConst && !reflect.DeepEqual(normalizeJSON(s.constant), value) {
+		return fmt.Errorf("%s must be %v", path, s.constant)
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if reflect.DeepEqual(normalizeJSON(allowed), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, s.enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.validateObject(v, path)
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			return fmt.Errorf("%s must have at least %d items", path, *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			return fmt.Errorf("%s must have at most %d items", path, *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			return fmt.Errorf("%s must be at least %d characters", path, *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return fmt.Errorf("%s must be at most %d characters", path, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%s must match the pattern %s", path, s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			return fmt.Errorf("%s must be at most %v", path, *s.maximum)
+		}
+	}
+
+	return nil
+}
+
+func (s *claimsSchema) validateObject(object map[string]interface{}, path string) error {
+	for _, property := range s.required {
+		if _, ok := object[property]; !ok {
+			return fmt.Errorf("%s requires '%s'", path, property)
+		}
+	}
+
+	// Validate in a stable order, reporting the same error for the same claims
+	properties := make([]string, 0, len(object))
+	for property := range object {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		propertyPath := path + "." + property
+		if propertySchema, ok := s.properties[property]; ok {
+			if err := propertySchema.validate(object[property], propertyPath); err != nil {
+				return err
+			}
+		} else if s.denyAdditional {
+			return fmt.Errorf("%s is not permitted", propertyPath)
+		} else if s.additionalProperties != nil {
+			if err := s.additionalProperties.validate(object[property], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *claimsSchema) hasType(value interface{}) bool {
+	for _, schemaType := range s.types {
+		switch value := value.(type) {
+		case nil:
+			if schemaType == "null" {
+				return true
+			}
+		case bool:
+			if schemaType == "boolean" {
+				return true
+			}
+		case string:
+			if schemaType == "string" {
+				return true
+			}
+		case float64:
+			if schemaType == "number" || (schemaType == "integer" && value == math.Trunc(value)) {
+				return true
+			}
+		case []interface{}:
+			if schemaType == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if schemaType == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeJSON converts the numbers of the value, as decoded by Vault (json.Number) or provided natively, to
+// float64s; as decoded by encoding/json.
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		number, err := v.Float64()
+		if err != nil {
+			return value
+		}
+		return number
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = normalizeJSON(item)
+		}
+		return normalized
+	case []string:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = item
+		}
+		return normalized
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized[key] = normalizeJSON(item)
+		}
+		return normalized
+	default:
+		return value
+	}
+}
+
+var schemaTypeNames = []string{"null", "boolean", "string", "number", "integer", "array", "object"}
+
+func schemaTypes(value interface{}) ([]string, error) {
+	if schemaType, ok := value.(string); ok {
+		value = []interface{}{schemaType}
+	}
+	types, err := schemaStrings(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, schemaType := range types {
+		if !stringInSlice(schemaType, schemaTypeNames) {
+			return nil, fmt.Errorf("unknown type '%s'", schemaType)
+		}
+	}
+	return types, nil
+}
+
+func schemaStrings(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+	strs := make([]string, len(items))
+	for i, item := range items {
+		if strs[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+	}
+	return strs, nil
+}
+
+func schemaCount(value interface{}) (*int, error) {
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(number)
+	return &count, nil
+}
+
+func schemaNumber(value interface{}) (*float64, error) {
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &number, nil
+}
@@ -0,0 +1,94 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testClaimsSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["deployment"],
+	"properties": {
+		"sub": {"type": "string", "pattern": "^svc-"},
+		"deployment": {
+			"type": "object",
+			"required": ["env", "replicas"],
+			"additionalProperties": false,
+			"properties": {
+				"env": {"enum": ["staging", "prod"]},
+				"replicas": {"type": "integer", "minimum": 1, "maximum": 10},
+				"regions": {"type": "array", "minItems": 1, "items": {"type": "string", "maxLength": 12}}
+			}
+		}
+	}
+}`
+
+func TestClaimsSchema(t *testing.T) {
+	schema, err := parseClaimsSchema(testClaimsSchema)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	valid := []map[string]interface{}{
+		{"deployment": map[string]interface{}{"env": "prod", "replicas": 3}},
+		{"sub": "svc-ship", "deployment": map[string]interface{}{"env": "staging", "replicas": json.Number("1"), "regions": []interface{}{"us-east-1"}}},
+	}
+	for _, claims := range valid {
+		if err := schema.validate(claims, "claims"); err != nil {
+			t.Errorf("%v: %s", claims, err)
+		}
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing required":  {"sub": "svc-ship"},
+		"pattern":           {"sub": "bender", "deployment": map[string]interface{}{"env": "prod", "replicas": 3}},
+		"enum":              {"deployment": map[string]interface{}{"env": "dev", "replicas": 3}},
+		"integer":           {"deployment": map[string]interface{}{"env": "prod", "replicas": 1.5}},
+		"maximum":           {"deployment": map[string]interface{}{"env": "prod", "replicas": 11}},
+		"type":              {"deployment": map[string]interface{}{"env": "prod", "replicas": "3"}},
+		"additional":        {"deployment": map[string]interface{}{"env": "prod", "replicas": 3, "owner": "leela"}},
+		"min items":         {"deployment": map[string]interface{}{"env": "prod", "replicas": 3, "regions": []interface{}{}}},
+		"nested max length": {"deployment": map[string]interface{}{"env": "prod", "replicas": 3, "regions": []interface{}{"omicron-persei-8"}}},
+	}
+	for name, claims := range invalid {
+		if err := schema.validate(claims, "claims"); err == nil {
+			t.Errorf("%s should have failed", name)
+		}
+	}
+}
+
+func TestParseClaimsSchema(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`[]`,
+		`{"type": "text"}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"properties": {"sub": {"$ref": "#/$defs/sub"}}}`,
+		`{"pattern": "("}`,
+		`{"minLength": -1}`,
+		`{"type": "string", "format": "email"}`,
+		`{"$schema": "http://json-schema.org/draft-04/schema#"}`,
+	}
+	for _, document := range invalid {
+		if _, err := parseClaimsSchema(document); err == nil {
+			t.Errorf("%s should have failed", document)
+		}
+	}
+}
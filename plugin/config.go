@@ -18,7 +18,6 @@ package jwtsecrets
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/json"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
@@ -39,16 +38,42 @@ const (
 	DefaultAudiencePattern    = ".*"
 	DefaultSubjectPattern     = ".*"
 	DefaultMaxAudiences       = -1
+	DefaultSignerType         = SignerTypeLocal
+	DefaultKeyIDStrategy      = KeyIDStrategyHash
+	DefaultJTIStrategy        = JTIStrategyFriendly
+	DefaultIssuerMode         = IssuerModeManual
+	DefaultSubjectTemplate    = "{{identity.entity.id}}"
 )
 
+// Supported key id (kid) strategies.
+const (
+	// KeyIDStrategyHash derives the kid from a hash of the backend id, key name and version.
+	KeyIDStrategyHash = "hash"
+
+	// KeyIDStrategyThumbprint uses the RFC 7638 (SHA-256) JWK thumbprint of the public key as the kid.
+	KeyIDStrategyThumbprint = "thumbprint"
+
+	// KeyIDStrategyCounter uses the configured prefix followed by the key version as the kid.
+	KeyIDStrategyCounter = "counter"
+)
+
+var AllowedKeyIDStrategies = []string{KeyIDStrategyHash, KeyIDStrategyThumbprint, KeyIDStrategyCounter}
+
 // DefaultAllowedClaims is the default value for the AllowedClaims config option.
 // By default, only the 'sub' and 'aud' claims can be set by the caller.
 var DefaultAllowedClaims = []string{"sub", "aud"}
 
-var ReservedClaims = []string{"iss", "exp", "nbf", "iat", "jti"}
-var ReservedHeaders = []string{"kid", "alg", "enc", "zip", "crit"}
+var ReservedClaims = []string{"iss", "exp", "nbf", "iat", "jti", "status"}
+
+// ReservedHeaders are generated by the backend, or controlled by other options (e.g. the role's 'token_type'),
+// and cannot be set by roles.
+var ReservedHeaders = []string{"kid", "alg", "enc", "zip", "crit", "typ", "b64"}
+
+var AllowedSignatureAlgorithmNames = []string{string(jose.ES256), string(jose.ES384), string(jose.ES512), string(jose.RS256), string(jose.RS384), string(jose.RS512), string(jose.EdDSA), string(jose.HS256), string(jose.HS384), string(jose.HS512), string(ES256K)}
 
-var AllowedSignatureAlgorithmNames = []string{string(jose.ES256), string(jose.ES384), string(jose.ES512), string(jose.RS256), string(jose.RS384), string(jose.RS512)}
+// NonFIPSSignatureAlgorithmNames are the allowed signature algorithms which aren't FIPS approved, requiring
+// the AllowNonFIPSAlgorithms config option.
+var NonFIPSSignatureAlgorithmNames = []string{string(ES256K)}
 var AllowedRSAKeyBits = []int{2048, 3072, 4096}
 
 // Config holds all configuration for the backend.
@@ -59,21 +84,51 @@ type Config struct {
 	// RSAKeyBits is size of generated RSA keys; only used when SignatureAlgorithm is one of the supported RSA algorithms.
 	RSAKeyBits int
 
+	// Secp256k1Keys marks the local keyrings as holding secp256k1 keys, stored as AES-256 keys (see secp256k1KeyType).
+	// Set once the keyrings sign with ES256K, and kept as keys generated before a change of key format remain.
+	Secp256k1Keys bool `json:"secp256k1_keys"`
+
 	// KeyRotationPeriod is how frequently a new key is created.
 	KeyRotationPeriod time.Duration
 
+	// KeyPrePublishPeriod is how long a new key is published in the JWKS before it is used to sign tokens.
+	KeyPrePublishPeriod time.Duration
+
+	// MaxSignaturesPerKey is the number of signatures after which local keys are rotated, in addition to the key
+	// rotation period; unlimited when zero.
+	MaxSignaturesPerKey int `json:"max_signatures_per_key"`
+
 	// TokenTTL defines how long a token is valid for after being signed.
 	TokenTTL time.Duration
 
+	// MaxTokenTTL caps the lifetime of tokens, including those of roles; defaults to the mount's max lease TTL when zero.
+	MaxTokenTTL time.Duration
+
 	// SetIat defines if the backend sets the 'iat' claim or not.
 	SetIAT bool
 
 	// SetJTI defines if the backend generates and sets the 'jti' claim or not.
 	SetJTI bool
 
+	// JTIStrategy defines how token ids (jti) are generated; one of AllowedJTIStrategies.
+	JTIStrategy string
+
 	// SetNBF defines if the backend sets the 'nbf' claim. If true, the claim will be set to the same as the 'iat' claim.
 	SetNBF bool
 
+	// ClockSkew back-dates the 'iat' & 'nbf' claims, tolerating verifiers with clocks behind the backend's.
+	ClockSkew time.Duration
+
+	// ResponseWrapTTL response wraps sign responses with the TTL, unless callers request wrapping; disabled when zero.
+	ResponseWrapTTL time.Duration `json:"response_wrap_ttl"`
+
+	// JWKSCacheTTL is how long verifiers can cache the JWKS (Cache-Control max-age); caching is disabled when zero.
+	JWKSCacheTTL time.Duration `json:"jwks_cache_ttl"`
+
+	// DiscoveryMetadata defines additional fields of the discovery document (e.g. 'token_endpoint'), overriding the
+	// generated ones that aren't reserved.
+	DiscoveryMetadata map[string]interface{} `json:"discovery_metadata"`
+
 	// AudiencePattern defines a regular expression (https://golang.org/pkg/regexp/) which must be matched by any incoming 'aud' claims.
 	// If the audience claim is an array, each element in the array must match the pattern.
 	AudiencePattern string
@@ -84,17 +139,88 @@ type Config struct {
 	// MaxAudiences defines the maximum number of strings in the 'aud' claim.
 	MaxAudiences int
 
+	// AllowedAudiences defines the audiences ('aud' claim) tokens can have, when not empty. This restriction is
+	// in addition to the audience pattern.
+	AllowedAudiences []string `json:"allowed_audiences"`
+
+	// AllowedACRValues defines the values the OIDC 'acr' claim can have, when not empty.
+	AllowedACRValues []string `json:"allowed_acr_values"`
+
+	// AllowedAMRValues defines the values the OIDC 'amr' claim can contain, when not empty.
+	AllowedAMRValues []string `json:"allowed_amr_values"`
+
 	// AllowedClaims defines which claims can be defined on the role or provided to the sign request to be set on the JWT.
 	AllowedClaims []string
 
 	// allowedClaimsMap is used to easily check if a claim is in the allowed claim set.
 	allowedClaimsMap map[string]bool
 
+	// DefaultClaims defines claim values set on every issued JWT, unless provided by the role or the sign request.
+	DefaultClaims map[string]interface{} `json:"default_claims"`
+
+	// RedactedClaims defines claims whose values are replaced by an HMAC in error messages & issuance records, keeping
+	// personal data (e.g. emails) out of audit logs.
+	RedactedClaims []string `json:"redacted_claims"`
+
 	// AllowedHeaders defines which headers can be defined on the role or provided to the sign request to be set on the JWT.
 	AllowedHeaders []string
 
 	// allowedHeadersMap is used to easily check if a header is in the allowed header set.
 	allowedHeadersMap map[string]bool
+
+	// SignerType defines where signing keys are held and signatures produced; one of AllowedSignerTypes.
+	SignerType string
+
+	// Transit configures the Transit signer; only used when SignerType is SignerTypeTransit.
+	Transit *TransitConfig
+
+	// AWSKMS configures the AWS KMS signer; only used when SignerType is SignerTypeAWSKMS.
+	AWSKMS *AWSKMSConfig
+
+	// GCPKMS configures the Cloud KMS signer; only used when SignerType is SignerTypeGCPKMS.
+	GCPKMS *GCPKMSConfig
+
+	// AzureKV configures the Azure Key Vault signer; only used when SignerType is SignerTypeAzureKV.
+	AzureKV *AzureKeyVaultConfig
+
+	// PKCS11 configures the PKCS#11 signer; only used when SignerType is SignerTypePKCS11.
+	PKCS11 *PKCS11Config
+
+	// IssuanceLogSize is the number of most recently issued tokens recorded for incident response; disabled when zero.
+	IssuanceLogSize int `json:"issuance_log_size"`
+
+	// LogSignDecisions logs the decisions of sign requests (e.g. the restriction rejecting a claim) at debug level.
+	LogSignDecisions bool `json:"log_sign_decisions"`
+
+	// OPA configures an Open Policy Agent check every token must pass before being signed; disabled when nil.
+	OPA *OPAConfig
+
+	// KeyIDStrategy defines how key ids (kid) are generated; one of AllowedKeyIDStrategies.
+	KeyIDStrategy string
+
+	// KeyIDPrefix is prepended to the key version to form key ids; only used when KeyIDStrategy is KeyIDStrategyCounter.
+	KeyIDPrefix string
+
+	// Issuer is the issuer identifier published in the OpenID discovery document.
+	Issuer string
+
+	// IssuerMode defines how the mount's issuer is determined; one of AllowedIssuerModes.
+	IssuerMode string
+
+	// StrictIssuer requires issuers of the config & roles to be absolute https URLs, removing trailing slashes.
+	StrictIssuer bool
+
+	// AuthenticatedKeys requires a token to read the JWKS & discovery document; applied when the plugin is (re)loaded.
+	AuthenticatedKeys bool
+
+	// DisableLeases returns signed tokens without a lease; revoking a token's lease revokes the token.
+	DisableLeases bool
+
+	// DisablePeriodicTidy disables removing expired state (see 'tidy') periodically.
+	DisablePeriodicTidy bool `json:"disable_periodic_tidy"`
+
+	// AllowNonFIPSAlgorithms allows the signature algorithms of NonFIPSSignatureAlgorithmNames.
+	AllowNonFIPSAlgorithms bool `json:"allow_non_fips_algorithms"`
 }
 
 func (b *backend) getConfig(ctx context.Context, stg logical.Storage) (*Config, error) {
@@ -144,7 +270,71 @@ func (b *backend) getConfig(ctx context.Context, stg logical.Storage) (*Config,
 
 func (c *Config) copy() *Config {
 	cc := *c
-	return &cc
+	if c.Transit != nil {
+		transit := *c.Transit
+		cc.Transit = &transit
+	}
+	if c.AWSKMS != nil {
+		awsKMS := *c.AWSKMS
+		cc.AWSKMS = &awsKMS
+	}
+	if c.GCPKMS != nil {
+		gcpKMS := *c.GCPKMS
+		cc.GCPKMS = &gcpKMS
+	}
+	if c.AzureKV != nil {
+		azureKV := *c.AzureKV
+		cc.AzureKV = &azureKV
+	}
+	if c.PKCS11 != nil {
+		pkcs11 := *c.PKCS11
+		cc.PKCS11 = &pkcs11
+	}
+	if c.OPA != nil {
+		opa := *c.OPA
+		cc.OPA = &opa
+	}
+	cc.DiscoveryMetadata = copyValues(c.DiscoveryMetadata)
+	cc.DefaultClaims = copyValues(c.DefaultClaims)
+	cc.AllowedAudiences = copyStrings(c.AllowedAudiences)
+	cc.AllowedACRValues = copyStrings(c.AllowedACRValues)
+	cc.AllowedAMRValues = copyStrings(c.AllowedAMRValues)
+	cc.AllowedClaims = copyStrings(c.AllowedClaims)
+	cc.AllowedHeaders = copyStrings(c.AllowedHeaders)
+	cc.RedactedClaims = copyStrings(c.RedactedClaims)
+	return cc.cache()
+}
+
+// copyStrings returns a copy of the slice, preserving nil slices.
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+// copyValues returns a deep copy of the map, including maps & arrays nested in it; preserving nil maps.
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	copied, _ := mapStrings(values, func(value string) (string, error) {
+		return value, nil
+	})
+	return copied.(map[string]interface{})
+}
+
+// usesLocalKeys checks if the configuration signs with keys generated and stored by the plugin.
+func (c *Config) usesLocalKeys() bool {
+	return c.SignerType == "" || c.SignerType == SignerTypeLocal
+}
+
+// maxTokenTTL returns the maximum lifetime of tokens; the configured maximum, or the mount's max lease TTL.
+func (b *backend) maxTokenTTL(config *Config) time.Duration {
+	if config.MaxTokenTTL > 0 {
+		return config.MaxTokenTTL
+	}
+	return b.System().MaxLeaseTTL()
 }
 
 func (b *backend) saveConfig(ctx context.Context, stg logical.Storage, config *Config, mount string) error {
@@ -160,13 +350,30 @@ func (b *backend) saveConfig(ctx context.Context, stg logical.Storage, config *C
 		return err
 	}
 
-	if !keyFormatChanged {
+	if !keyFormatChanged || !config.usesLocalKeys() {
 		return nil
 	}
 
 	b.Logger().Info("Key Format Rotation")
 
-	policy, err := b.getPolicy(ctx, stg, config, mount)
+	keyrings, err := b.listRoleKeyrings(ctx, stg)
+	if err != nil {
+		return err
+	}
+
+	for _, keyring := range append([]string{mainKeyName}, keyrings...) {
+		if err := b.rotateKeyFormat(ctx, stg, config, keyring, mount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotateKeyFormat rotates the keyring to a new key matching the configured key format.
+func (b *backend) rotateKeyFormat(ctx context.Context, stg logical.Storage, config *Config, keyring string, mount string) error {
+
+	policy, err := b.getKeyringPolicy(ctx, stg, config, keyring, mount)
 	if err != nil {
 		return err
 	}
@@ -192,6 +399,13 @@ func (b *backend) saveConfig(ctx context.Context, stg logical.Storage, config *C
 		policy.Type = keysutil.KeyType_ECDSA_P384
 	case jose.ES512:
 		policy.Type = keysutil.KeyType_ECDSA_P521
+	case jose.EdDSA:
+		policy.Type = keysutil.KeyType_ED25519
+	case jose.HS256, jose.HS384, jose.HS512:
+		policy.Type = keysutil.KeyType_HMAC
+		policy.KeySize = hmacKeySizes[config.SignatureAlgorithm]
+	case ES256K:
+		policy.Type = secp256k1KeyType
 	default:
 		err = errutil.InternalError{Err: "unknown/unsupported signature algorithm"}
 	}
@@ -200,13 +414,23 @@ func (b *backend) saveConfig(ctx context.Context, stg logical.Storage, config *C
 		return nil
 	}
 
-	defer b.lockManager.InvalidatePolicy(mainKeyName)
+	defer b.lockManager.InvalidatePolicy(keyring)
 
-	return policy.Rotate(ctx, stg, rand.Reader)
+	if err := b.rotatePolicy(ctx, stg, policy); err != nil {
+		return err
+	}
+
+	emitKeyRotation(keyring, mount, rotationReasonKeyFormat)
+
+	return nil
 }
 
 func (b *backend) saveConfigUnlocked(ctx context.Context, stg logical.Storage, config *Config) error {
 
+	if config.SignatureAlgorithm == ES256K {
+		config.Secp256k1Keys = true
+	}
+
 	entry, err := logical.StorageEntryJSON(configPath, config)
 	if err != nil {
 		return err
@@ -216,6 +440,9 @@ func (b *backend) saveConfigUnlocked(ctx context.Context, stg logical.Storage, c
 	}
 
 	b.cachedConfig = config.cache()
+	b.cachedSigner = nil
+	b.cachedRoles.clear()
+	b.statusListTokens.clear()
 
 	return nil
 }
@@ -229,6 +456,9 @@ func (b *backend) clearConfig(ctx context.Context, stg logical.Storage) error {
 	}
 
 	b.cachedConfig = nil
+	b.cachedSigner = nil
+	b.cachedRoles.clear()
+	b.statusListTokens.clear()
 
 	return nil
 }
@@ -250,9 +480,18 @@ func DefaultConfig(sys logical.SystemView) *Config {
 	c.SubjectPattern = DefaultSubjectPattern
 	c.MaxAudiences = DefaultMaxAudiences
 	c.AllowedClaims = DefaultAllowedClaims
+	c.SignerType = DefaultSignerType
+	c.KeyIDStrategy = DefaultKeyIDStrategy
+	c.JTIStrategy = DefaultJTIStrategy
+	c.IssuerMode = DefaultIssuerMode
 	return c
 }
 
+// hasIssuer returns whether the mount has an issuer; configured, or derived in the 'auto' issuer mode.
+func (c *Config) hasIssuer() bool {
+	return c.Issuer != "" || c.IssuerMode == IssuerModeAuto
+}
+
 func (c *Config) cache() *Config {
 	c.allowedClaimsMap = makeAllowedClaimsMap(c.AllowedClaims)
 	c.allowedHeadersMap = makeAllowedClaimsMap(c.AllowedHeaders)
@@ -0,0 +1,56 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// Confirmation methods of the 'cnf' claim of sender-constrained tokens.
+const (
+	// confirmationCertificateThumbprint binds tokens to a client certificate (RFC 8705).
+	confirmationCertificateThumbprint = "x5t#S256"
+)
+
+// certificateThumbprint returns the base64url encoded SHA-256 thumbprint of the PEM encoded certificate.
+func certificateThumbprint(rawCertificate string) (string, error) {
+	block, _ := pem.Decode([]byte(rawCertificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("client certificate must be a PEM encoded certificate")
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	thumbprint := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:]), nil
+}
+
+// validateThumbprint checks the thumbprint is a base64url encoded (without padding) SHA-256 hash.
+func validateThumbprint(thumbprint string) error {
+	hash, err := base64.RawURLEncoding.DecodeString(thumbprint)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("thumbprint must be a base64url encoded SHA-256 hash")
+	}
+	return nil
+}
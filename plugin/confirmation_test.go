@@ -0,0 +1,117 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+// testCertificate returns a PEM encoded self-signed certificate and its SHA-256 thumbprint.
+func testCertificate(t *testing.T) (string, string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	thumbprint := sha256.Sum256(der)
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return string(certificate), base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
+
+func TestCertificateThumbprint(t *testing.T) {
+	certificate, expected := testCertificate(t)
+
+	thumbprint, err := certificateThumbprint(certificate)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(expected, thumbprint); diff != nil {
+		t.Error(diff)
+	}
+	if err := validateThumbprint(thumbprint); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := certificateThumbprint("not a certificate"); err == nil {
+		t.Error("invalid certificate should have failed")
+	}
+	for _, thumbprint := range []string{"", "abc", expected + "=", base64.StdEncoding.EncodeToString(make([]byte, 32))} {
+		if err := validateThumbprint(thumbprint); err == nil {
+			t.Errorf("'%s' should have failed", thumbprint)
+		}
+	}
+}
+
+func TestSignCertificateBinding(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyRequireCertificateBinding: true}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	certificate, thumbprint := testCertificate(t)
+	expected := map[string]interface{}{confirmationCertificateThumbprint: thumbprint}
+
+	for _, data := range []map[string]interface{}{{keyClientCertificate: certificate}, {keyCertificateThumbprint: thumbprint}} {
+		resp, err := signData(b, storage, "tester", data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		if diff := deep.Equal(expected, unsafeClaims(t, resp.Data["token"].(string))["cnf"]); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	denied := []map[string]interface{}{
+		{},
+		{keyClientCertificate: "invalid"},
+		{keyCertificateThumbprint: "invalid"},
+		{keyClientCertificate: certificate, keyCertificateThumbprint: thumbprint},
+	}
+	for _, data := range denied {
+		if resp, err := signData(b, storage, "tester", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%v should have failed", data)
+		}
+	}
+}
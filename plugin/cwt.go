@@ -0,0 +1,119 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// TokenFormatCWT issues CBOR Web Tokens (RFC 8392) signed as COSE_Sign1 messages.
+const TokenFormatCWT = "cwt"
+
+// COSE_Sign1 tag & header parameters (RFC 9052).
+const (
+	coseSign1Tag     = 18
+	coseHeaderAlg    = 1
+	coseHeaderKid    = 4
+	coseSign1Context = "Signature1"
+)
+
+// coseAlgorithms maps the supported signature algorithms to their COSE algorithm identifiers.
+var coseAlgorithms = map[jose.SignatureAlgorithm]int{
+	jose.ES256: -7,
+	jose.ES384: -35,
+	jose.ES512: -36,
+	jose.EdDSA: -8,
+	jose.RS256: -257,
+	jose.RS384: -258,
+	jose.RS512: -259,
+	ES256K:     -47,
+}
+
+// cwtClaimKeys maps the registered JWT claims to their CWT claim keys; other claims keep their names.
+var cwtClaimKeys = map[string]int{
+	"iss": 1,
+	"sub": 2,
+	"aud": 3,
+	"exp": 4,
+	"nbf": 5,
+	"iat": 6,
+	"cti": 7,
+}
+
+// signCWT signs the claims of a JWT as a CWT, returning the base64url encoded COSE_Sign1 message. The
+// signing key's id is included in the protected header, allowing the key to be located in the JWKS.
+func signCWT(signer inputSigner, algorithm jose.SignatureAlgorithm, claims map[string]interface{}) (string, error) {
+	coseAlgorithm, ok := coseAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported COSE algorithm %s", algorithm)
+	}
+
+	payload, err := cborEncode(cwtClaims(claims))
+	if err != nil {
+		return "", err
+	}
+
+	var protected []byte
+
+	signature, err := signer.SignInput(func(kid string) ([]byte, error) {
+		protected, err = cborEncode(map[interface{}]interface{}{
+			coseHeaderAlg: coseAlgorithm,
+			coseHeaderKid: []byte(kid),
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Sig_structure, with no external additional authenticated data
+		return cborEncode([]interface{}{coseSign1Context, protected, []byte{}, payload})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	message, err := cborEncode(cborTag{
+		Number:  coseSign1Tag,
+		Content: []interface{}{protected, map[interface{}]interface{}{}, payload, signature},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(message), nil
+}
+
+// cwtClaims converts the claims of a JWT to those of a CWT; registered claims use their integer keys, and
+// the JWT id is carried as the CWT id.
+func cwtClaims(claims map[string]interface{}) map[interface{}]interface{} {
+	converted := make(map[interface{}]interface{}, len(claims))
+	for claim, value := range claims {
+		if claim == "jti" {
+			claim = "cti"
+			if jti, ok := value.(string); ok {
+				value = []byte(jti)
+			}
+		}
+		if key, ok := cwtClaimKeys[claim]; ok {
+			converted[key] = value
+		} else {
+			converted[claim] = value
+		}
+	}
+	return converted
+}
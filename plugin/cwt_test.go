@@ -0,0 +1,204 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// cborDecode decodes the data items produced by cborEncode; integers are decoded as int64.
+func cborDecode(t *testing.T, data []byte) (interface{}, []byte) {
+	t.Helper()
+
+	major, info, data := data[0]>>5, data[0]&0x1f, data[1:]
+
+	var argument uint64
+	switch {
+	case info < 24:
+		argument = uint64(info)
+	case info == 24:
+		argument, data = uint64(data[0]), data[1:]
+	case info == 25:
+		argument, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26:
+		argument, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27:
+		argument, data = binary.BigEndian.Uint64(data), data[8:]
+	}
+
+	switch major {
+	case cborUnsigned:
+		return int64(argument), data
+	case cborNegative:
+		return -1 - int64(argument), data
+	case cborByteString:
+		return data[:argument], data[argument:]
+	case cborTextString:
+		return string(data[:argument]), data[argument:]
+	case cborArray:
+		items := make([]interface{}, argument)
+		for i := range items {
+			items[i], data = cborDecode(t, data)
+		}
+		return items, data
+	case cborMap:
+		entries := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key interface{}
+			key, data = cborDecode(t, data)
+			entries[key], data = cborDecode(t, data)
+		}
+		return entries, data
+	case cborTagged:
+		var content interface{}
+		content, data = cborDecode(t, data)
+		return cborTag{Number: argument, Content: content}, data
+	default:
+		switch info {
+		case 20:
+			return false, data
+		case 21:
+			return true, data
+		case 22:
+			return nil, data
+		}
+	}
+
+	t.Fatalf("unsupported CBOR item %d/%d", major, info)
+	return nil, nil
+}
+
+func TestSignCWT(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	signData := map[string]interface{}{
+		keyClaims: map[string]interface{}{"sub": "Zapp Brannigan", "aud": "Nimbus"},
+		keyFormat: TokenFormatCWT,
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       signData,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := base64.RawURLEncoding.DecodeString(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	decoded, rest := cborDecode(t, token)
+	if len(rest) != 0 {
+		t.Fatalf("trailing data after COSE_Sign1 message")
+	}
+
+	tag, ok := decoded.(cborTag)
+	if !ok || tag.Number != coseSign1Tag {
+		t.Fatalf("token is not a tagged COSE_Sign1 message: %#v", decoded)
+	}
+
+	message := tag.Content.([]interface{})
+	protected, payload, signature := message[0].([]byte), message[2].([]byte), message[3].([]byte)
+
+	header, _ := cborDecode(t, protected)
+	headers := header.(map[interface{}]interface{})
+	if diff := deep.Equal(int64(-7), headers[int64(coseHeaderAlg)]); diff != nil {
+		t.Error("alg", diff)
+	}
+
+	keys, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	kid := string(headers[int64(coseHeaderKid)].([]byte))
+	matchingKeys := keys.Key(kid)
+	if len(matchingKeys) != 1 {
+		t.Fatalf("no published key with id '%s'", kid)
+	}
+
+	publicKey, ok := matchingKeys[0].Key.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("published key is %T, not ecdsa", matchingKeys[0].Key)
+	}
+
+	sigStructure, err := cborEncode([]interface{}{coseSign1Context, protected, []byte{}, payload})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	digest := sha256.Sum256(sigStructure)
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		t.Fatal("invalid COSE signature")
+	}
+
+	rawClaims, _ := cborDecode(t, payload)
+	claims := rawClaims.(map[interface{}]interface{})
+
+	if diff := deep.Equal("tester.example.com", claims[int64(1)]); diff != nil {
+		t.Error("iss", diff)
+	}
+	if diff := deep.Equal("Zapp Brannigan", claims[int64(2)]); diff != nil {
+		t.Error("sub", diff)
+	}
+	if diff := deep.Equal("Nimbus", claims[int64(3)]); diff != nil {
+		t.Error("aud", diff)
+	}
+	if exp, ok := claims[int64(4)].(int64); !ok || time.Unix(exp, 0).Before(time.Now()) {
+		t.Errorf("exp is invalid: %#v", claims[int64(4)])
+	}
+	if _, ok := claims[int64(7)].([]byte); !ok {
+		t.Errorf("cti is not a byte string: %#v", claims[int64(7)])
+	}
+
+	// Claims are restricted identically to JWTs
+	signData[keyClaims] = map[string]interface{}{"foo": "bar"}
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("disallowed claim should have failed")
+	}
+}
+
+func TestCWTClaims(t *testing.T) {
+	claims := cwtClaims(map[string]interface{}{"iss": "tester.example.com", "jti": "abc", "email": "zapp@example.com"})
+
+	expected := map[interface{}]interface{}{1: "tester.example.com", 7: []byte("abc"), "email": "zapp@example.com"}
+	if diff := deep.Equal(expected, claims); diff != nil {
+		t.Error(diff)
+	}
+}
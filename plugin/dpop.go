@@ -0,0 +1,111 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// DefaultDPoPProofMaxAge is the maximum age of DPoP proofs, when not configured by the role.
+const DefaultDPoPProofMaxAge = time.Minute
+
+const (
+	// confirmationJWKThumbprint binds tokens to the public key of a DPoP proof (RFC 9449).
+	confirmationJWKThumbprint = "jkt"
+
+	// dpopProofType is the required 'typ' header of DPoP proofs.
+	dpopProofType = "dpop+jwt"
+)
+
+// dpopProofClaims are the claims required of DPoP proofs.
+type dpopProofClaims struct {
+	ID       string           `json:"jti"`
+	Method   string           `json:"htm"`
+	URI      string           `json:"htu"`
+	IssuedAt *jwt.NumericDate `json:"iat"`
+}
+
+// jwkThumbprint returns the base64url encoded RFC 7638 (SHA-256) thumbprint of the public key.
+func jwkThumbprint(key *jose.JSONWebKey) (string, error) {
+	if key == nil || !key.Valid() || !key.IsPublic() {
+		return "", fmt.Errorf("key must be a public JWK")
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// parseDPoPKey parses the JSON encoded public JWK tokens are bound to.
+func parseDPoPKey(rawKey string) (*jose.JSONWebKey, error) {
+	var key jose.JSONWebKey
+	if err := json.Unmarshal([]byte(rawKey), &key); err != nil {
+		return nil, fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	return &key, nil
+}
+
+// verifyDPoPProof verifies the DPoP proof is signed by its embedded public key and was issued within
+// maxAge of now, returning the public key.
+func verifyDPoPProof(proof string, maxAge time.Duration, now time.Time) (*jose.JSONWebKey, error) {
+	token, err := jwt.ParseSigned(proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, fmt.Errorf("invalid DPoP proof, must have a single signature")
+	}
+
+	header := token.Headers[0]
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != dpopProofType {
+		return nil, fmt.Errorf("invalid DPoP proof, 'typ' header must be '%s'", dpopProofType)
+	}
+	if header.Algorithm == "" || header.Algorithm == "none" || strings.HasPrefix(header.Algorithm, "HS") {
+		return nil, fmt.Errorf("invalid DPoP proof, 'alg' header must be an asymmetric algorithm")
+	}
+
+	key := header.JSONWebKey
+	if key == nil || !key.Valid() || !key.IsPublic() {
+		return nil, fmt.Errorf("invalid DPoP proof, 'jwk' header must be a public key")
+	}
+
+	var claims dpopProofClaims
+	if err := token.Claims(key, &claims); err != nil {
+		return nil, fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+	if claims.ID == "" || claims.Method == "" || claims.URI == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("invalid DPoP proof, 'jti', 'htm', 'htu' & 'iat' claims are required")
+	}
+
+	age := now.Sub(claims.IssuedAt.Time())
+	if age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("DPoP proof is not fresh, must be issued within %s", maxAge)
+	}
+
+	return key, nil
+}
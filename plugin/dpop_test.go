@@ -0,0 +1,132 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testDPoPProof returns a DPoP proof issued at iat, signed by key with the given 'typ' header.
+func testDPoPProof(t *testing.T, key *ecdsa.PrivateKey, typ jose.ContentType, iat time.Time) string {
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{EmbedJWK: true}).WithType(typ))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	claims := map[string]interface{}{"jti": "proof-1", "htm": "POST", "htu": "https://api.example.com/ships", "iat": iat.Unix()}
+	proof, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	return proof
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	now := time.Now()
+
+	publicKey, err := verifyDPoPProof(testDPoPProof(t, key, dpopProofType, now), time.Minute, now)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(&key.PublicKey, publicKey.Key); diff != nil {
+		t.Error(diff)
+	}
+
+	invalid := map[string]string{
+		"stale":    testDPoPProof(t, key, dpopProofType, now.Add(-2*time.Minute)),
+		"future":   testDPoPProof(t, key, dpopProofType, now.Add(2*time.Minute)),
+		"type":     testDPoPProof(t, key, "JWT", now),
+		"unsigned": "invalid",
+	}
+	for name, proof := range invalid {
+		if _, err := verifyDPoPProof(proof, time.Minute, now); err == nil {
+			t.Errorf("%s proof should have failed", name)
+		}
+	}
+}
+
+func TestSignDPoPBinding(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	publicKey := jose.JSONWebKey{Key: &key.PublicKey}
+	thumbprint, err := jwkThumbprint(&publicKey)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	rawPublicKey, err := json.Marshal(publicKey)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	expected := map[string]interface{}{confirmationJWKThumbprint: thumbprint}
+	for _, data := range []map[string]interface{}{{keyDPoPProof: testDPoPProof(t, key, dpopProofType, time.Now())}, {keyDPoPKey: string(rawPublicKey)}} {
+		resp, err := signData(b, storage, "tester", data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		if diff := deep.Equal(expected, unsafeClaims(t, resp.Data["token"].(string))["cnf"]); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	roleData[keyRequireDPoPProof] = true
+	roleData[keyDPoPProofMaxAge] = "30s"
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyDPoPProof: testDPoPProof(t, key, dpopProofType, time.Now())}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	denied := []map[string]interface{}{
+		{},
+		{keyDPoPKey: string(rawPublicKey)},
+		{keyDPoPProof: testDPoPProof(t, key, dpopProofType, time.Now().Add(-time.Minute))},
+		{keyDPoPProof: testDPoPProof(t, key, dpopProofType, time.Now()), keyDPoPKey: string(rawPublicKey)},
+	}
+	for _, data := range denied {
+		if resp, err := signData(b, storage, "tester", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%v should have failed", data)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DefaultContentEncryption is the default content encryption of encrypted tokens.
+const DefaultContentEncryption = string(jose.A256GCM)
+
+// Key management algorithms supported for encrypting tokens, mapped to whether they require an RSA key.
+var encryptionAlgorithms = map[string]bool{
+	string(jose.RSA_OAEP):       true,
+	string(jose.RSA_OAEP_256):   true,
+	string(jose.ECDH_ES):        false,
+	string(jose.ECDH_ES_A128KW): false,
+	string(jose.ECDH_ES_A192KW): false,
+	string(jose.ECDH_ES_A256KW): false,
+}
+
+// Content encryption algorithms supported for encrypting tokens.
+var contentEncryptions = map[string]bool{
+	string(jose.A128GCM):       true,
+	string(jose.A192GCM):       true,
+	string(jose.A256GCM):       true,
+	string(jose.A128CBC_HS256): true,
+	string(jose.A192CBC_HS384): true,
+	string(jose.A256CBC_HS512): true,
+}
+
+// tokenEncryption encrypts signed tokens to a recipient, producing nested JWTs.
+type tokenEncryption struct {
+	key               *jose.JSONWebKey
+	algorithm         jose.KeyAlgorithm
+	contentEncryption jose.ContentEncryption
+}
+
+// validateEncryptionAlgorithms checks the key management & content encryption algorithms are supported; either
+// may be empty to use the default.
+func validateEncryptionAlgorithms(algorithm string, contentEncryption string) error {
+	if _, ok := encryptionAlgorithms[algorithm]; algorithm != "" && !ok {
+		return fmt.Errorf("unsupported encryption algorithm '%s'", algorithm)
+	}
+	if contentEncryption != "" && !contentEncryptions[contentEncryption] {
+		return fmt.Errorf("unsupported content encryption '%s'", contentEncryption)
+	}
+	return nil
+}
+
+// newTokenEncryption returns an encryption to the recipient public key, provided as a JWK or PEM encoded
+// public key or certificate. When no algorithm is provided, the algorithm of the JWK or the default
+// algorithm for the key type is used.
+func newTokenEncryption(rawKey string, algorithm string, contentEncryption string) (*tokenEncryption, error) {
+	if err := validateEncryptionAlgorithms(algorithm, contentEncryption); err != nil {
+		return nil, err
+	}
+
+	key, err := parseEncryptionKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	var isRSA bool
+	var defaultAlgorithm jose.KeyAlgorithm
+	switch key.Key.(type) {
+	case *rsa.PublicKey:
+		isRSA, defaultAlgorithm = true, jose.RSA_OAEP_256
+	case *ecdsa.PublicKey:
+		isRSA, defaultAlgorithm = false, jose.ECDH_ES_A256KW
+	default:
+		return nil, fmt.Errorf("unsupported encryption key type %T", key.Key)
+	}
+
+	algorithm = firstNonEmpty(algorithm, key.Algorithm, string(defaultAlgorithm))
+	if requiresRSA, ok := encryptionAlgorithms[algorithm]; !ok || requiresRSA != isRSA {
+		return nil, fmt.Errorf("encryption algorithm '%s' not supported by the encryption key", algorithm)
+	}
+
+	return &tokenEncryption{
+		key:               key,
+		algorithm:         jose.KeyAlgorithm(algorithm),
+		contentEncryption: jose.ContentEncryption(firstNonEmpty(contentEncryption, DefaultContentEncryption)),
+	}, nil
+}
+
+// encrypt encrypts the signed token, returning the compact serialization of the JWE.
+func (e *tokenEncryption) encrypt(token string) (string, error) {
+	encrypter, err := jose.NewEncrypter(
+		e.contentEncryption,
+		jose.Recipient{Algorithm: e.algorithm, Key: e.key.Key, KeyID: e.key.KeyID},
+		(&jose.EncrypterOptions{}).WithContentType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := encrypter.Encrypt([]byte(token))
+	if err != nil {
+		return "", err
+	}
+
+	return encrypted.CompactSerialize()
+}
+
+// parseEncryptionKey parses a public key provided as a JWK or PEM encoded public key or certificate.
+func parseEncryptionKey(rawKey string) (*jose.JSONWebKey, error) {
+	rawKey = strings.TrimSpace(rawKey)
+
+	if strings.HasPrefix(rawKey, "{") {
+		var key jose.JSONWebKey
+		if err := json.Unmarshal([]byte(rawKey), &key); err != nil {
+			return nil, err
+		}
+		if !key.IsPublic() {
+			key = key.Public()
+		}
+		return &key, nil
+	}
+
+	block, _ := pem.Decode([]byte(rawKey))
+	if block == nil {
+		return nil, fmt.Errorf("expected a JWK or PEM encoded key")
+	}
+
+	var publicKey interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var certificate *x509.Certificate
+		certificate, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			publicKey = certificate.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unexpected PEM block '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &jose.JSONWebKey{Key: publicKey}, nil
+}
@@ -0,0 +1,204 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func decryptToken(t *testing.T, token string, privateKey interface{}) map[string]interface{} {
+
+	encrypted, err := jose.ParseEncrypted(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("JWT", encrypted.Header.ExtraHeaders[jose.HeaderContentType]); diff != nil {
+		t.Error("cty", diff)
+	}
+
+	nested, err := jwt.ParseSignedAndEncrypted(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	signed, err := nested.Decrypt(privateKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	var claims map[string]interface{}
+	if err := signed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return claims
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	pkix, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	jwk, err := json.Marshal(jose.JSONWebKey{Key: rsaKey, KeyID: "recipient"})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	formats := map[string]string{
+		"pkix":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix})),
+		"pkcs1": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})),
+		"cert":  issueCertificate(t, &rsaKey.PublicKey),
+		"jwk":   string(jwk),
+	}
+
+	for name, rawKey := range formats {
+		key, err := parseEncryptionKey(rawKey)
+		if err != nil {
+			t.Fatalf("%s: %s\n", name, err)
+		}
+		if !rsaKey.PublicKey.Equal(key.Key) {
+			t.Error(name, "public key mismatch")
+		}
+	}
+
+	if _, err := parseEncryptionKey("not-a-key"); err == nil {
+		t.Error("parsing an invalid key should have failed")
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	ecJwk, err := json.Marshal(jose.JSONWebKey{Key: &ecKey.PublicKey})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	encryption, err := newTokenEncryption(string(ecJwk), "", "")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(jose.ECDH_ES_A256KW, encryption.algorithm); diff != nil {
+		t.Error("default algorithm", diff)
+	}
+	if diff := deep.Equal(jose.A256GCM, encryption.contentEncryption); diff != nil {
+		t.Error("default content encryption", diff)
+	}
+
+	if _, err := newTokenEncryption(string(ecJwk), string(jose.RSA_OAEP_256), ""); err == nil {
+		t.Error("algorithm not supported by the key should have failed")
+	}
+}
+
+func TestSignEncrypted(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/tester",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyIssuer:        "tester.example.com",
+			keyEncryptionKey: issueCertificate(t, &rsaKey.PublicKey),
+		},
+		MountPoint: "test",
+	}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+
+	claims := decryptToken(t, token, rsaKey)
+	if diff := deep.Equal("Zapp Brannigan", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+
+	// A key provided with the request overrides the role's key
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	ecJwk, err := json.Marshal(jose.JSONWebKey{Key: &ecKey.PublicKey})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	signReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign/tester",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyClaims:        map[string]interface{}{"sub": "Zapp Brannigan"},
+			keyEncryptionKey: string(ecJwk),
+		},
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), signReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	claims = decryptToken(t, resp.Data["token"].(string), ecKey)
+	if diff := deep.Equal("Zapp Brannigan", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"encryption key":       {keyEncryptionKey: "not-a-key"},
+		"encryption algorithm": {keyEncryptionAlgorithm: "A128KW"},
+		"content encryption":   {keyContentEncryption: "A256CTR"},
+		"algorithm mismatch":   {keyEncryptionAlgorithm: string(jose.ECDH_ES)},
+	}
+
+	for name, data := range invalid {
+		req.Operation = logical.UpdateOperation
+		req.Data = data
+		if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "write should have failed")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const keyErrorCode = "error_code"
+
+// Stable codes of error responses, for automation to branch on; error messages are prose and can change. Errors
+// without a specific code have the code of their class; ErrorCodeInvalidRequest, ErrorCodePermissionDenied,
+// ErrorCodeRateLimited or ErrorCodeInternal.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodePermissionDenied = "permission_denied"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeInternal         = "error"
+
+	ErrorCodeUnknownRole          = "unknown_role"
+	ErrorCodeRoleNotIssuable      = "role_not_issuable"
+	ErrorCodeClaimNotAllowed      = "claim_not_allowed"
+	ErrorCodeParameterNotAllowed  = "parameter_not_allowed"
+	ErrorCodeSubPatternMismatch   = "sub_pattern_mismatch"
+	ErrorCodeAudPatternMismatch   = "aud_pattern_mismatch"
+	ErrorCodeAudNotAllowed        = "aud_not_allowed"
+	ErrorCodeTooManyAudiences     = "too_many_audiences"
+	ErrorCodeClaimPatternMismatch = "claim_pattern_mismatch"
+	ErrorCodeTTLExceedsMax        = "ttl_exceeds_max"
+	ErrorCodeNonceReused          = "nonce_reused"
+	ErrorCodeAlgorithmNotAllowed  = "algorithm_not_allowed"
+	ErrorCodePolicyDenied         = "policy_denied"
+	ErrorCodePolicyUnavailable    = "policy_unavailable"
+)
+
+// codedErrorResponse returns an error response with the code. Codes are held by the 'data' of error responses,
+// which Vault returns along with the error; error responses hold no other fields.
+func codedErrorResponse(code string, format string, args ...interface{}) *logical.Response {
+	resp := logical.ErrorResponse(format, args...)
+	setErrorCode(resp, code)
+	return resp
+}
+
+// setErrorCode sets the code of an error response.
+func setErrorCode(resp *logical.Response, code string) {
+	data, ok := resp.Data["data"].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+		resp.Data["data"] = data
+	}
+	data[keyErrorCode] = code
+}
+
+// errorClassCode returns the code of the class of an error; the code of error responses without a specific code.
+func errorClassCode(err error) string {
+	if err == nil {
+		// Error responses without an error are invalid requests
+		return ErrorCodeInvalidRequest
+	}
+	return failureReason(err)
+}
+
+// HandleRequest handles requests as the framework backend, adding the code of their class to error responses
+// without a code; every error response has an 'error_code'.
+func (b *backend) HandleRequest(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	resp, err := b.Backend.HandleRequest(ctx, req)
+	if resp.IsError() && resp.Data["data"] == nil {
+		setErrorCode(resp, errorClassCode(err))
+	}
+	return resp, err
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// errorCode returns the code of an error response, if any.
+func errorCode(resp *logical.Response) string {
+	data, _ := resp.Data["data"].(map[string]interface{})
+	code, _ := data[keyErrorCode].(string)
+	return code
+}
+
+func TestErrorCodes(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	config := map[string]interface{}{
+		keyAllowedClaims: []string{"sub", "aud", "team"},
+		keyMaxTokenTTL:   "1h",
+	}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:           "tester.example.com",
+		keySubjectPattern:   "^svc-",
+		keyAudiencePattern:  "^api-",
+		keyAllowedAudiences: []string{"api-nimbus"},
+		keyClaimPatterns:    map[string]interface{}{"team": "^payments$"},
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	failures := map[string]struct {
+		role string
+		data map[string]interface{}
+		code string
+	}{
+		"unknown role":          {"unknown", map[string]interface{}{}, ErrorCodeUnknownRole},
+		"claim not allowed":     {"tester", map[string]interface{}{keyClaims: map[string]interface{}{"email": "fry@planetexpress.com"}}, ErrorCodeClaimNotAllowed},
+		"sub pattern mismatch":  {"tester", map[string]interface{}{keyClaims: map[string]interface{}{"sub": "fry"}}, ErrorCodeSubPatternMismatch},
+		"aud pattern mismatch":  {"tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "nimbus"}}, ErrorCodeAudPatternMismatch},
+		"aud not allowed":       {"tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "api-planetexpress"}}, ErrorCodeAudNotAllowed},
+		"claim pattern":         {"tester", map[string]interface{}{keyClaims: map[string]interface{}{"team": "delivery"}}, ErrorCodeClaimPatternMismatch},
+		"ttl exceeds max":       {"tester", map[string]interface{}{keyTTL: "2h"}, ErrorCodeTTLExceedsMax},
+		"parameter not allowed": {"tester", map[string]interface{}{keyParameters: map[string]interface{}{"team": "payments"}}, ErrorCodeParameterNotAllowed},
+		"invalid request":       {"tester", map[string]interface{}{keyTTL: "soon"}, ErrorCodeInvalidRequest},
+	}
+	for name, failure := range failures {
+		resp, err := signData(b, storage, failure.role, failure.data)
+		if err == nil && !resp.IsError() {
+			t.Errorf("%s: expected failure, got resp:%#v", name, resp)
+			continue
+		}
+		if !resp.IsError() {
+			t.Errorf("%s: expected error response, got resp:%#v", name, resp)
+			continue
+		}
+		if diff := deep.Equal(failure.code, errorCode(resp)); diff != nil {
+			t.Error(name, diff)
+		}
+	}
+
+	// Error responses of other paths have the code of their class
+	resp, err := writeRoleData(b, storage, "invalid", map[string]interface{}{keyTTL: "soon"})
+	if err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v", resp)
+	}
+	if diff := deep.Equal(ErrorCodeInvalidRequest, errorCode(resp)); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Parameters of sign requests populating the claims of GitHub Actions style tokens; each populates the claim
+// of the same name.
+const (
+	githubRepositoryParameter     = "repository"
+	githubRefParameter            = "ref"
+	githubSHAParameter            = "sha"
+	githubWorkflowParameter       = "workflow"
+	githubJobWorkflowRefParameter = "job_workflow_ref"
+	githubActorParameter          = "actor"
+	githubEventNameParameter      = "event_name"
+	githubRunIDParameter          = "run_id"
+	githubEnvironmentParameter    = "environment"
+)
+
+// githubActionsParameters are the parameters of GitHub Actions style tokens.
+var githubActionsParameters = []string{
+	githubRepositoryParameter, githubRefParameter, githubSHAParameter, githubWorkflowParameter,
+	githubJobWorkflowRefParameter, githubActorParameter, githubEventNameParameter, githubRunIDParameter,
+	githubEnvironmentParameter,
+}
+
+// githubActionsRequiredParameters must be provided for every GitHub Actions style token.
+var githubActionsRequiredParameters = []string{githubRepositoryParameter, githubRefParameter, githubWorkflowParameter}
+
+// githubActionsParameterRegexes match the values of the parameters with a well-known format; other parameters
+// can't be empty, or contain ':' which delimits the parts of the subject.
+var githubActionsParameterRegexes = map[string]*regexp.Regexp{
+	githubRepositoryParameter:     regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`),
+	githubRefParameter:            regexp.MustCompile(`^refs/(heads|tags|pull)/[^\s:]+$`),
+	githubSHAParameter:            regexp.MustCompile(`^[0-9a-f]{40}$`),
+	githubJobWorkflowRefParameter: regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+/\.github/workflows/[^@\s]+@refs/[^\s:]+$`),
+	githubRunIDParameter:          regexp.MustCompile(`^[0-9]+$`),
+}
+
+// githubActionsClaims returns the claims of GitHub Actions OIDC tokens populated from the parameters of the sign
+// request; along with the derived 'repository_owner', 'ref_type' & 'sub' claims. Claims are restricted by the
+// role's claim patterns, like any other claims.
+func githubActionsClaims(_ *Role, parameters map[string]string) (map[string]interface{}, error) {
+	for _, parameter := range githubActionsRequiredParameters {
+		if _, ok := parameters[parameter]; !ok {
+			return nil, fmt.Errorf("parameter %s is required by the %s token profile", parameter, TokenProfileGitHubActions)
+		}
+	}
+
+	claims := map[string]interface{}{}
+	for _, parameter := range githubActionsParameters {
+		value, ok := parameters[parameter]
+		if !ok {
+			continue
+		}
+		if regex, ok := githubActionsParameterRegexes[parameter]; ok && !regex.MatchString(value) {
+			return nil, fmt.Errorf("parameter %s is not a valid GitHub Actions %s", parameter, parameter)
+		}
+		if value == "" || strings.Contains(value, ":") {
+			return nil, fmt.Errorf("parameter %s can't be empty or contain ':'", parameter)
+		}
+		claims[parameter] = value
+	}
+
+	repository := parameters[githubRepositoryParameter]
+	ref := parameters[githubRefParameter]
+
+	claims["repository_owner"] = strings.SplitN(repository, "/", 2)[0]
+
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		claims["ref_type"] = "branch"
+	case strings.HasPrefix(ref, "refs/tags/"):
+		claims["ref_type"] = "tag"
+	}
+
+	// Subjects follow GitHub's default format
+	switch environment, ok := parameters[githubEnvironmentParameter]; {
+	case ok:
+		claims["sub"] = fmt.Sprintf("repo:%s:environment:%s", repository, environment)
+	case parameters[githubEventNameParameter] == "pull_request":
+		claims["sub"] = fmt.Sprintf("repo:%s:pull_request", repository)
+	default:
+		claims["sub"] = fmt.Sprintf("repo:%s:ref:%s", repository, ref)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestGitHubActionsProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{
+		keyIssuer:       "https://ci.example.com",
+		keyTokenProfile: TokenProfileGitHubActions,
+	}
+
+	// Repositories must be restricted
+	if resp, err := writeProfileRole(b, storage, "ci", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role without repository pattern should have failed")
+	}
+
+	roleData[keyClaimPatterns] = map[string]interface{}{
+		githubRepositoryParameter:     "^planet-express/",
+		githubJobWorkflowRefParameter: `^planet-express/workflows/\.github/workflows/deploy\.yml@refs/heads/main$`,
+	}
+
+	if resp, err := writeProfileRole(b, storage, "ci", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	parameters := func() map[string]interface{} {
+		return map[string]interface{}{
+			githubRepositoryParameter:     "planet-express/ship",
+			githubRefParameter:            "refs/heads/main",
+			githubSHAParameter:            "e4d7f1b0c2a3958b6f0d1c2e3a4b5c6d7e8f9a0b",
+			githubWorkflowParameter:       "deploy",
+			githubJobWorkflowRefParameter: "planet-express/workflows/.github/workflows/deploy.yml@refs/heads/main",
+			githubRunIDParameter:          "42",
+		}
+	}
+
+	// signed signs a token of the role with the parameters, returning its claims
+	signed := func(parameters map[string]interface{}) map[string]interface{} {
+		resp, err := signData(b, storage, "ci", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "sts.amazonaws.com"}, keyParameters: parameters})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return unsafeClaims(t, resp.Data["token"].(string))
+	}
+
+	claims := signed(parameters())
+
+	expected := map[string]interface{}{
+		"sub":              "repo:planet-express/ship:ref:refs/heads/main",
+		"repository":       "planet-express/ship",
+		"repository_owner": "planet-express",
+		"ref":              "refs/heads/main",
+		"ref_type":         "branch",
+		"sha":              "e4d7f1b0c2a3958b6f0d1c2e3a4b5c6d7e8f9a0b",
+		"workflow":         "deploy",
+		"job_workflow_ref": "planet-express/workflows/.github/workflows/deploy.yml@refs/heads/main",
+		"run_id":           "42",
+	}
+	for claim, value := range expected {
+		if diff := deep.Equal(value, claims[claim]); diff != nil {
+			t.Error(claim, diff)
+		}
+	}
+
+	environment := parameters()
+	environment[githubEnvironmentParameter] = "production"
+	claims = signed(environment)
+	if diff := deep.Equal("repo:planet-express/ship:environment:production", claims["sub"]); diff != nil {
+		t.Error("environment sub", diff)
+	}
+
+	pullRequest := parameters()
+	pullRequest[githubRefParameter] = "refs/pull/7/merge"
+	pullRequest[githubEventNameParameter] = "pull_request"
+	claims = signed(pullRequest)
+	if diff := deep.Equal("repo:planet-express/ship:pull_request", claims["sub"]); diff != nil {
+		t.Error("pull request sub", diff)
+	}
+	if _, ok := claims["ref_type"]; ok {
+		t.Error("pull request refs have no ref type")
+	}
+
+	invalid := map[string]func(p map[string]interface{}){
+		"missing workflow":   func(p map[string]interface{}) { delete(p, githubWorkflowParameter) },
+		"foreign repository": func(p map[string]interface{}) { p[githubRepositoryParameter] = "mom-corp/ship" },
+		"invalid repository": func(p map[string]interface{}) { p[githubRepositoryParameter] = "planet-express" },
+		"invalid ref":        func(p map[string]interface{}) { p[githubRefParameter] = "main" },
+		"invalid sha":        func(p map[string]interface{}) { p[githubSHAParameter] = "main" },
+		"foreign workflow": func(p map[string]interface{}) {
+			p[githubJobWorkflowRefParameter] = "planet-express/ship/.github/workflows/deploy.yml@refs/heads/main"
+		},
+		"delimiter in environment": func(p map[string]interface{}) { p[githubEnvironmentParameter] = "prod:ref" },
+		"unknown parameter":        func(p map[string]interface{}) { p["runner"] = "self-hosted" },
+	}
+
+	for name, modify := range invalid {
+		p := parameters()
+		modify(p)
+		if resp, err := signData(b, storage, "ci", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "sts.amazonaws.com"}, keyParameters: p}); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "sign should have failed")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// hmacKeySizes are the sizes, in bytes, of the shared secrets generated for the HMAC signature
+// algorithms; RFC 7518 requires secrets at least the size of the hash output.
+var hmacKeySizes = map[jose.SignatureAlgorithm]int{
+	jose.HS256: 32,
+	jose.HS384: 48,
+	jose.HS512: 64,
+}
+
+// isHMACAlgorithm checks if the signature algorithm signs with a shared secret.
+func isHMACAlgorithm(alg jose.SignatureAlgorithm) bool {
+	_, ok := hmacKeySizes[alg]
+	return ok
+}
+
+// signHMAC computes the MAC of the input with the shared secret of the key version.
+func (ps *PolicySigner) signHMAC(keyVersion int, input []byte) ([]byte, error) {
+	// Asymmetric keys carry an internal HMAC key, which must never sign tokens
+	if ps.Policy.Type != keysutil.KeyType_HMAC {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("keyring has no shared secret for %s", ps.SignatureAlgorithm)}
+	}
+
+	hash, err := signatureHash(ps.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ps.Policy.HMACKey(keyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(hash.New, secret)
+
+	// According to documentation, Write() on hash never fails
+	_, _ = mac.Write(input)
+
+	return mac.Sum(nil), nil
+}
+
+// keyEntrySecret returns the shared secret of a policy key entry generated for an HMAC signature
+// algorithm, or nil for other keys; keysutil makes HMAC keys their own HMAC key.
+func keyEntrySecret(key keysutil.KeyEntry) []byte {
+	if len(key.Key) == 0 || !bytes.Equal(key.Key, key.HMACKey) {
+		return nil
+	}
+	return key.Key
+}
+
+// policySecretKeys returns the JSON Web Keys for each available version of the policy's shared secrets. They
+// are never published, but verify tokens signed by the plugin. No algorithm is set, as secrets outlive changes
+// between the HMAC algorithms, and symmetric keys are only usable with them.
+func (b *backend) policySecretKeys(policy *keysutil.Policy, config *Config) []jose.JSONWebKey {
+	policy.Lock(false)
+	defer policy.Unlock()
+
+	var keys []jose.JSONWebKey
+	for version := policy.MinDecryptionVersion; version <= policy.LatestVersion; version++ {
+
+		key, ok := policy.Keys[strconv.Itoa(version)]
+		if !ok {
+			continue
+		}
+
+		secret := keyEntrySecret(key)
+		if secret == nil {
+			continue
+		}
+
+		keys = append(keys, jose.JSONWebKey{
+			Key:   secret,
+			KeyID: localKeyId(b.id, config, policy, version),
+			Use:   "sig",
+		})
+	}
+
+	return keys
+}
@@ -0,0 +1,108 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestHMACSigning(t *testing.T) {
+	for _, alg := range []jose.SignatureAlgorithm{jose.HS256, jose.HS384, jose.HS512} {
+		t.Run(string(alg), func(t *testing.T) {
+			b, storage := getTestBackend(t)
+
+			if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: string(alg)}); err != nil {
+				t.Fatalf("%s\n", err)
+			}
+
+			if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+				t.Fatalf("%s\n", err)
+			}
+
+			token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+
+			parsed, err := jwt.ParseSigned(token)
+			if err != nil {
+				t.Fatalf("%s\n", err)
+			}
+			if parsed.Headers[0].Algorithm != string(alg) {
+				t.Errorf("expected alg %s, got %s", alg, parsed.Headers[0].Algorithm)
+			}
+
+			// Shared secrets are never published
+			jwks, err := FetchJWKS(b, storage)
+			if err != nil {
+				t.Fatalf("%s\n", err)
+			}
+			if len(jwks.Keys) != 0 {
+				t.Errorf("expected no published keys, got %d", len(jwks.Keys))
+			}
+
+			resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+			if resp.Data["valid"] != true {
+				t.Errorf("expected token to verify, got %#v", resp.Data)
+			}
+			if resp.Data["kid"] != parsed.Headers[0].KeyID {
+				t.Errorf("expected kid %s, got %v", parsed.Headers[0].KeyID, resp.Data["kid"])
+			}
+		})
+	}
+}
+
+func TestHMACKeyFormatRotation(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	ecToken := signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "HS256"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	hmacToken := signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	// Keys generated before the change are published with the algorithm they signed with
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != string(jose.ES256) {
+		t.Errorf("expected the previous ES256 key to remain published, got %#v", jwks.Keys)
+	}
+
+	for _, token := range []string{ecToken, hmacToken} {
+		resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+		if resp.Data["valid"] != true {
+			t.Errorf("expected token to verify, got %#v", resp.Data)
+		}
+	}
+}
+
+func TestHMACKeySetRejected(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeKeySet(b, storage, "legacy", map[string]interface{}{keySignatureAlgorithm: "HS256"})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("expected key set with an HMAC algorithm to be rejected")
+	}
+}
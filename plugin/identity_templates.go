@@ -0,0 +1,144 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/vault/sdk/helper/identitytpl"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// identityTemplatePattern matches Vault identity template directives.
+var identityTemplatePattern = regexp.MustCompile(`{{\s*identity\.`)
+
+// identityTemplates resolves Vault identity templates (e.g. '{{identity.entity.name}}') in role values against
+// the entity of the requesting token. The entity is only looked up when a value contains a template.
+type identityTemplates struct {
+	system   logical.SystemView
+	entityID string
+
+	loaded bool
+	entity *logical.Entity
+	groups []*logical.Group
+}
+
+func newIdentityTemplates(system logical.SystemView, entityID string) *identityTemplates {
+	return &identityTemplates{system: system, entityID: entityID}
+}
+
+// resolve resolves the templates of the value's strings, including those nested in maps & arrays.
+func (t *identityTemplates) resolve(value interface{}) (interface{}, error) {
+	return mapStrings(value, t.resolveString)
+}
+
+// resolveString resolves the templates of the string.
+func (t *identityTemplates) resolveString(value string) (string, error) {
+	if !hasIdentityTemplate(value) {
+		return value, nil
+	}
+
+	if err := t.load(); err != nil {
+		return "", err
+	}
+
+	_, resolved, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+		String: value,
+		Entity: t.entity,
+		Groups: t.groups,
+		Mode:   identitytpl.ACLTemplating,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error resolving template '%s': %w", value, err)
+	}
+
+	return resolved, nil
+}
+
+func (t *identityTemplates) load() error {
+	if t.loaded {
+		return nil
+	}
+
+	if t.entityID == "" {
+		return identitytpl.ErrNoEntityAttachedToToken
+	}
+
+	var err error
+	if t.entity, err = t.system.EntityInfo(t.entityID); err != nil {
+		return fmt.Errorf("error looking up entity: %w", err)
+	}
+	if t.groups, err = t.system.GroupsForEntity(t.entityID); err != nil {
+		return fmt.Errorf("error looking up entity groups: %w", err)
+	}
+
+	t.loaded = true
+	return nil
+}
+
+// hasIdentityTemplate checks if the value contains identity templates; templated values are validated once resolved.
+func hasIdentityTemplate(value string) bool {
+	return identityTemplatePattern.MatchString(value)
+}
+
+// validateIdentityTemplates checks the identity templates of the value's strings are well-formed.
+func validateIdentityTemplates(value interface{}) error {
+	_, err := mapStrings(value, func(value string) (string, error) {
+		if !hasIdentityTemplate(value) {
+			return value, nil
+		}
+		_, _, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			String:            value,
+			ValidityCheckOnly: true,
+			Mode:              identitytpl.ACLTemplating,
+		})
+		if err != nil {
+			return "", fmt.Errorf("invalid template '%s': %w", value, err)
+		}
+		return value, nil
+	})
+	return err
+}
+
+// mapStrings maps the value's strings, including those nested in maps & arrays.
+func mapStrings(value interface{}, fn func(string) (string, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []interface{}:
+		mapped := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if mapped[i], err = mapStrings(item, fn); err != nil {
+				return nil, err
+			}
+		}
+		return mapped, nil
+	case map[string]interface{}:
+		mapped := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			var err error
+			if mapped[key], err = mapStrings(item, fn); err != nil {
+				return nil, err
+			}
+		}
+		return mapped, nil
+	default:
+		return value, nil
+	}
+}
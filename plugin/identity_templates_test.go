@@ -0,0 +1,199 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestIdentityTemplates(t *testing.T) {
+	system := &logical.StaticSystemView{
+		EntityVal: &logical.Entity{
+			ID:       "entity-1",
+			Name:     "leela",
+			Metadata: map[string]string{"team": "delivery"},
+		},
+		GroupsVal: []*logical.Group{{ID: "group-1", Name: "crew"}},
+	}
+
+	templates := newIdentityTemplates(system, "entity-1")
+
+	resolved, err := templates.resolve(map[string]interface{}{
+		"name":   "{{identity.entity.name}}",
+		"teams":  []interface{}{"{{identity.entity.metadata.team}}", "staff"},
+		"group":  "{{identity.groups.names.crew.id}}",
+		"nested": map[string]interface{}{"path": "teams/{{identity.entity.metadata.team}}"},
+		"count":  float64(3),
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	expected := map[string]interface{}{
+		"name":   "leela",
+		"teams":  []interface{}{"delivery", "staff"},
+		"group":  "group-1",
+		"nested": map[string]interface{}{"path": "teams/delivery"},
+		"count":  float64(3),
+	}
+	if diff := deep.Equal(expected, resolved); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := templates.resolveString("{{identity.entity.metadata.rank}}"); err == nil {
+		t.Error("missing metadata should have failed")
+	}
+
+	// Templates require an entity
+	if _, err := newIdentityTemplates(system, "").resolveString("{{identity.entity.name}}"); err == nil {
+		t.Error("template without entity should have failed")
+	}
+	if resolved, err := newIdentityTemplates(system, "").resolveString("leela"); err != nil || resolved != "leela" {
+		t.Errorf("untemplated value was %s (%v)", resolved, err)
+	}
+
+	if err := validateIdentityTemplates(map[string]interface{}{"name": "{{identity.entity.name"}); err == nil {
+		t.Error("unbalanced template should have failed")
+	}
+}
+
+func TestSignIdentityTemplates(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "entity-1",
+		Name:     "leela",
+		Metadata: map[string]string{"team": "delivery"},
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "team"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	claims := map[string]interface{}{"team": "{{identity.entity.metadata.team}}"}
+	if err := writeRole(b, storage, "tester", "https://{{identity.entity.metadata.team}}.example.com", claims, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "test",
+		EntityID:   "entity-1",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("delivery", decoded["team"]); diff != nil {
+		t.Error("team", diff)
+	}
+	if diff := deep.Equal("https://delivery.example.com", decoded["iss"]); diff != nil {
+		t.Error("iss", diff)
+	}
+
+	// Tokens without an entity can't use the role
+	req.EntityID = ""
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("sign without an entity should have failed")
+	}
+}
+
+func TestSignEntityBoundSubject(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{ID: "entity-1", Name: "leela"}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"aud"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyBindSubjectToEntity: true, keySubjectTemplate: "leela"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("untemplated subject template should have failed")
+	}
+
+	delete(roleData, keySubjectTemplate)
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyClaims: map[string]interface{}{"sub": "bender"}},
+		MountPoint: "test",
+		EntityID:   "entity-1",
+	}
+
+	signedSubject := func() string {
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		token, err := jwt.ParseSigned(resp.Data["token"].(string))
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+
+		var decoded jwt.Claims
+		if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		return decoded.Subject
+	}
+
+	// Caller provided subjects are ignored
+	if diff := deep.Equal("entity-1", signedSubject()); diff != nil {
+		t.Error("sub", diff)
+	}
+
+	roleData[keySubjectTemplate] = "workload:{{identity.entity.name}}"
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal("workload:leela", signedSubject()); diff != nil {
+		t.Error("sub", diff)
+	}
+
+	req.EntityID = ""
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("sign without an entity should have failed")
+	}
+}
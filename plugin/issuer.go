@@ -0,0 +1,142 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// namespaceHeader is the request header identifying the Vault namespace; passed to plugins when configured
+// as a passthrough request header of the mount.
+const namespaceHeader = "X-Vault-Namespace"
+
+// apiAddrEnv is the environment variable holding the API address of the cluster (Vault's 'api_addr'); plugins
+// inherit it from the Vault server, or it can be set when registering the plugin ('-env').
+const apiAddrEnv = "VAULT_API_ADDR"
+
+// Supported issuer modes.
+const (
+	// IssuerModeManual uses the configured issuer.
+	IssuerModeManual = "manual"
+
+	// IssuerModeAuto derives the issuer from the API address of the cluster and the mount path.
+	IssuerModeAuto = "auto"
+)
+
+var AllowedIssuerModes = []string{IssuerModeManual, IssuerModeAuto}
+
+// issuerPlaceholderPattern matches the mount & namespace placeholders of issuers.
+var issuerPlaceholderPattern = regexp.MustCompile(`{{\s*(mount_path|namespace)\s*}}`)
+
+// issuerTemplatePattern matches the templates & placeholders of issuers.
+var issuerTemplatePattern = regexp.MustCompile(`{{[^}]*}}`)
+
+// normalizeStrictIssuer checks the issuer is an absolute https URL, without a query or fragment, returning it
+// without trailing slashes; OIDC validators compare issuers exactly with those of discovery documents. Templates
+// & placeholders are checked as if resolved to a valid host or path segment.
+func normalizeStrictIssuer(issuer string) (string, error) {
+	issuer = strings.TrimRight(issuer, "/")
+
+	issuerURL, err := url.Parse(issuerTemplatePattern.ReplaceAllString(issuer, "x"))
+	if err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" || issuerURL.User != nil ||
+		issuerURL.RawQuery != "" || issuerURL.Fragment != "" || strings.HasSuffix(issuer, "?") || strings.Contains(issuer, "#") {
+		return "", fmt.Errorf("issuer must be an absolute https url, without a query or fragment")
+	}
+
+	return issuer, nil
+}
+
+// resolveIssuer resolves the placeholders (e.g. '{{mount_path}}') of the issuer, and the identity templates
+// between them; each part is resolved once, so resolved values are never interpreted as templates.
+func resolveIssuer(issuer string, req *logical.Request, templates *identityTemplates) (string, error) {
+	var resolved strings.Builder
+
+	last := 0
+	for _, match := range issuerPlaceholderPattern.FindAllStringSubmatchIndex(issuer, -1) {
+		part, err := templates.resolveString(issuer[last:match[0]])
+		if err != nil {
+			return "", err
+		}
+		resolved.WriteString(part)
+		resolved.WriteString(issuerPlaceholder(issuer[match[2]:match[3]], req))
+		last = match[1]
+	}
+
+	part, err := templates.resolveString(issuer[last:])
+	if err != nil {
+		return "", err
+	}
+	resolved.WriteString(part)
+
+	return resolved.String(), nil
+}
+
+// issuerPlaceholder returns the value of the placeholder for the request; paths are without surrounding slashes,
+// and the namespace is empty for the root namespace.
+func issuerPlaceholder(name string, req *logical.Request) string {
+	switch name {
+	case "mount_path":
+		return strings.Trim(req.MountPoint, "/")
+	case "namespace":
+		return strings.Trim(requestHeader(req, namespaceHeader), "/")
+	}
+	return ""
+}
+
+// stripIssuerPlaceholders removes the placeholders of the issuer, leaving any templates to be validated.
+func stripIssuerPlaceholders(issuer string) string {
+	return issuerPlaceholderPattern.ReplaceAllString(issuer, "")
+}
+
+// validateConfigIssuer checks the config's issuer only contains placeholders, not templates.
+func validateConfigIssuer(issuer string) error {
+	if hasTemplate(stripIssuerPlaceholders(issuer)) {
+		return fmt.Errorf("only the '{{mount_path}}' & '{{namespace}}' placeholders are supported")
+	}
+	return nil
+}
+
+// autoIssuer returns the issuer derived from the API address of the cluster; the URL of the mount's API path
+// (e.g. https://vault.example.com/v1/<namespace>/<mount>), like the issuers of Vault's identity tokens.
+func autoIssuer(apiAddr string, req *logical.Request) (string, error) {
+	if apiAddr == "" {
+		return "", fmt.Errorf("the API address of the cluster is unknown, '%s' must be set for the plugin", apiAddrEnv)
+	}
+
+	segments := []string{strings.TrimRight(apiAddr, "/"), "v1"}
+	for _, placeholder := range []string{"namespace", "mount_path"} {
+		if value := issuerPlaceholder(placeholder, req); value != "" {
+			segments = append(segments, value)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// mountIssuer returns the issuer of the mount resolved for the request; derived from the API address of the
+// cluster in the 'auto' issuer mode, otherwise the configured issuer (empty when not configured).
+func (b *backend) mountIssuer(config *Config, req *logical.Request) (string, error) {
+	if config.IssuerMode == IssuerModeAuto {
+		return autoIssuer(b.apiAddr, req)
+	}
+	return resolveIssuer(config.Issuer, req, newIdentityTemplates(b.System(), ""))
+}
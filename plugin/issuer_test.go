@@ -0,0 +1,255 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestResolveIssuer(t *testing.T) {
+	system := &logical.StaticSystemView{EntityVal: &logical.Entity{ID: "entity-1", Name: "leela"}}
+
+	req := &logical.Request{
+		MountPoint: "jwt/",
+		Headers:    map[string][]string{"x-vault-namespace": {"planet-express/"}},
+	}
+
+	issuer, err := resolveIssuer("https://vault.example.com/v1/{{namespace}}/{{ mount_path }}/{{identity.entity.name}}", req, newIdentityTemplates(system, "entity-1"))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/planet-express/jwt/leela", issuer); diff != nil {
+		t.Error(diff)
+	}
+
+	// The root namespace is empty
+	req.Headers = nil
+	issuer, err = resolveIssuer("https://vault.example.com/v1/{{namespace}}", req, newIdentityTemplates(system, ""))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/", issuer); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := resolveIssuer("https://{{identity.entity.name}}/{{mount_path}}", req, newIdentityTemplates(system, "")); err == nil {
+		t.Error("template without entity should have failed")
+	}
+}
+
+func TestSignIssuerPlaceholders(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	for _, issuer := range []string{"https://vault.example.com/{{.mount}}", "https://vault.example.com/{{identity.entity.name}"} {
+		roleData := map[string]interface{}{keyIssuer: issuer}
+		if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("role with issuer %s should have failed", issuer)
+		}
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "https://vault.example.com/v1/{{mount_path}}"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "jwt-staging/",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("https://vault.example.com/v1/jwt-staging", decoded.Issuer); diff != nil {
+		t.Error("iss", diff)
+	}
+}
+
+func TestNormalizeStrictIssuer(t *testing.T) {
+	valid := map[string]string{
+		"https://vault.example.com/v1/jwt/":                               "https://vault.example.com/v1/jwt",
+		"https://vault.example.com":                                       "https://vault.example.com",
+		"https://vault.example.com:8200/v1/{{namespace}}/{{mount_path}}/": "https://vault.example.com:8200/v1/{{namespace}}/{{mount_path}}",
+		"https://{{identity.entity.name}}.example.com//":                  "https://{{identity.entity.name}}.example.com",
+	}
+	for issuer, expected := range valid {
+		normalized, err := normalizeStrictIssuer(issuer)
+		if err != nil {
+			t.Errorf("%s: %s", issuer, err)
+			continue
+		}
+		if diff := deep.Equal(expected, normalized); diff != nil {
+			t.Error(issuer, diff)
+		}
+	}
+
+	invalid := []string{
+		"vault.example.com",
+		"http://vault.example.com",
+		"/v1/jwt",
+		"https://",
+		"https://vault.example.com/v1/jwt?tenant=1",
+		"https://vault.example.com/v1/jwt#jwks",
+		"https://admin@vault.example.com",
+	}
+	for _, issuer := range invalid {
+		if _, err := normalizeStrictIssuer(issuer); err == nil {
+			t.Errorf("%s should have failed", issuer)
+		}
+	}
+}
+
+func TestStrictIssuer(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyStrictIssuer: true, keyIssuer: "vault.example.com"}); err == nil {
+		t.Error("config with relative issuer should have failed")
+	}
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{keyStrictIssuer: true, keyIssuer: "https://vault.example.com/v1/jwt/"})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/jwt", resp.Data[keyIssuer]); diff != nil {
+		t.Error(diff)
+	}
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("role with relative issuer should have failed")
+	}
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "https://tester.example.com/"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("https://tester.example.com", resp.Data[keyIssuer]); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestAutoIssuer(t *testing.T) {
+	req := &logical.Request{
+		MountPoint: "jwt/",
+		Headers:    map[string][]string{"x-vault-namespace": {"planet-express/"}},
+	}
+
+	issuer, err := autoIssuer("https://vault.example.com:8200/", req)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com:8200/v1/planet-express/jwt", issuer); diff != nil {
+		t.Error(diff)
+	}
+
+	// The root namespace is omitted
+	req.Headers = nil
+	issuer, err = autoIssuer("https://vault.example.com:8200", req)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com:8200/v1/jwt", issuer); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := autoIssuer("", req); err == nil {
+		t.Error("missing api address should have failed")
+	}
+}
+
+func TestAutoIssuerMode(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuerMode: "derived"}); err == nil {
+		t.Error("unknown issuer mode should have failed")
+	}
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuerMode: IssuerModeAuto, keyIssuer: "https://vault.example.com/v1/jwt"}); err == nil {
+		t.Error("issuer with the auto issuer mode should have failed")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuerMode: IssuerModeAuto}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// The discovery document requires the api address
+	if _, err := fetchDiscovery(b, storage); err == nil {
+		t.Error("discovery without an api address should have failed")
+	}
+
+	b.apiAddr = "https://vault.example.com:8200"
+
+	discovery, err := fetchDiscovery(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("https://vault.example.com:8200/v1/test", discovery["issuer"]); diff != nil {
+		t.Error("issuer", diff)
+	}
+
+	// Roles can be created without an issuer, signing with the derived issuer
+	req := &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "roles/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "test",
+	}
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if err := writeRole(b, storage, "other", "https://other.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("https://vault.example.com:8200/v1/test", unsafeClaims(t, signToken(t, b, storage, "tester", map[string]interface{}{}))["iss"]); diff != nil {
+		t.Error("derived iss", diff)
+	}
+	if diff := deep.Equal("https://other.example.com", unsafeClaims(t, signToken(t, b, storage, "other", map[string]interface{}{}))["iss"]); diff != nil {
+		t.Error("role iss", diff)
+	}
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(IssuerModeAuto, resp.Data[keyIssuerMode]); diff != nil {
+		t.Error("issuer mode", diff)
+	}
+}
@@ -0,0 +1,158 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Supported token id (jti) strategies.
+const (
+	// JTIStrategyFriendly generates friendly-id encoded, time based, UUIDs.
+	JTIStrategyFriendly = "friendly"
+
+	// JTIStrategyUUID generates random (version 4) UUIDs.
+	JTIStrategyUUID = "uuid"
+
+	// JTIStrategyULID generates ULIDs; lexicographically sortable by issuance time.
+	JTIStrategyULID = "ulid"
+
+	// JTIStrategyRandom generates 128-bit random ids, hex encoded.
+	JTIStrategyRandom = "random"
+
+	// JTIStrategyCounter generates ids from a monotonic counter, persisted in storage.
+	JTIStrategyCounter = "counter"
+)
+
+// AllowedJTIStrategies are the supported token id (jti) strategies.
+var AllowedJTIStrategies = []string{JTIStrategyFriendly, JTIStrategyUUID, JTIStrategyULID, JTIStrategyRandom, JTIStrategyCounter}
+
+const jtiCounterPath = "jti-counter"
+
+// crockfordBase32 is the alphabet of ULIDs.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generateJTI generates a token id using the configured strategy.
+func (b *backend) generateJTI(ctx context.Context, stg logical.Storage, config *Config) (string, error) {
+	switch config.JTIStrategy {
+	case JTIStrategyUUID:
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	case JTIStrategyULID:
+		return newULID(time.Now())
+	case JTIStrategyRandom:
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(id), nil
+	case JTIStrategyCounter:
+		return b.nextJTICounter(ctx, stg)
+	default:
+		return b.idGen.id()
+	}
+}
+
+// previewJTI generates a unique token id like generateJTI, without advancing the persisted counter; the id of
+// tokens that are never issued (e.g. dry runs).
+func (b *backend) previewJTI(ctx context.Context, stg logical.Storage, config *Config) (string, error) {
+	if config.JTIStrategy != JTIStrategyCounter {
+		return b.generateJTI(ctx, stg, config)
+	}
+
+	b.jtiCounterLock.Lock()
+	defer b.jtiCounterLock.Unlock()
+
+	counter, err := b.getJTICounter(ctx, stg)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(counter+1, 10), nil
+}
+
+// getJTICounter returns the persisted token id counter.
+func (b *backend) getJTICounter(ctx context.Context, stg logical.Storage) (uint64, error) {
+	var counter uint64
+
+	entry, err := stg.Get(ctx, jtiCounterPath)
+	if err != nil {
+		return 0, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&counter); err != nil {
+			return 0, err
+		}
+	}
+
+	return counter, nil
+}
+
+// nextJTICounter increments the persisted token id counter, returning the new value.
+func (b *backend) nextJTICounter(ctx context.Context, stg logical.Storage) (string, error) {
+	b.jtiCounterLock.Lock()
+	defer b.jtiCounterLock.Unlock()
+
+	counter, err := b.getJTICounter(ctx, stg)
+	if err != nil {
+		return "", err
+	}
+
+	counter++
+
+	entry, err := logical.StorageEntryJSON(jtiCounterPath, counter)
+	if err != nil {
+		return "", err
+	}
+	if err := stg.Put(ctx, entry); err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(counter, 10), nil
+}
+
+// newULID generates a ULID; a 48-bit millisecond timestamp followed by 80 random bits, Crockford base32 encoded.
+func newULID(now time.Time) (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:2], uint16(now.UnixMilli()>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(now.UnixMilli()))
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits encode to 26 characters, the first holding the 3 most significant bits
+	encoded := make([]byte, 26)
+	high, low := binary.BigEndian.Uint64(id[0:8]), binary.BigEndian.Uint64(id[8:16])
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = crockfordBase32[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(encoded), nil
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestNewULID(t *testing.T) {
+	// Timestamp of the ULID specification's example, 01ARYZ6S41TSV4RRFFQ69G5FAV
+	id, err := newULID(time.UnixMilli(1469918176385))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal(26, len(id)); diff != nil {
+		t.Error("length", diff)
+	}
+	if !strings.HasPrefix(id, "01ARYZ6S41") {
+		t.Errorf("unexpected timestamp encoding: %s", id)
+	}
+
+	// Later ULIDs sort after earlier ones
+	later, err := newULID(time.UnixMilli(1469918176386))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if later <= id {
+		t.Errorf("%s does not sort after %s", later, id)
+	}
+}
+
+func TestGenerateJTI(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	patterns := map[string]string{
+		JTIStrategyUUID:     `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		JTIStrategyULID:     `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`,
+		JTIStrategyRandom:   `^[0-9a-f]{32}$`,
+		JTIStrategyFriendly: `^1$`,
+	}
+
+	for strategy, pattern := range patterns {
+		config := &Config{JTIStrategy: strategy}
+
+		id, err := b.generateJTI(context.Background(), *storage, config)
+		if err != nil {
+			t.Fatalf("%s: %s\n", strategy, err)
+		}
+		if matched, _ := regexp.MatchString(pattern, id); !matched {
+			t.Errorf("%s: unexpected id %s", strategy, id)
+		}
+	}
+
+	config := &Config{JTIStrategy: JTIStrategyCounter}
+	for _, expected := range []string{"1", "2", "3"} {
+		id, err := b.generateJTI(context.Background(), *storage, config)
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		if diff := deep.Equal(expected, id); diff != nil {
+			t.Error("counter", diff)
+		}
+	}
+}
+
+func TestJTIStrategyConfig(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyJTIStrategy: "sequential"}); err == nil {
+		t.Errorf("unknown strategy should have failed: %#v", resp)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyJTIStrategy: JTIStrategyULID}); err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	claims := map[string]interface{}{}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, claims["jti"].(string)); !matched {
+		t.Errorf("jti is not a ULID: %v", claims["jti"])
+	}
+}
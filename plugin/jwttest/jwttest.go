@@ -0,0 +1,201 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package jwttest runs the JWT secrets engine in memory, so clients & Vault policies using its tokens can be
+// integration tested without a Vault server.
+//
+//	backend := jwttest.New(t)
+//	backend.WriteConfig(map[string]interface{}{"allowed_claims": []string{"sub"}})
+//	backend.WriteRole("my-role", map[string]interface{}{"issuer": "https://example.com"})
+//	token := backend.Sign("my-role", map[string]interface{}{"sub": "svc-1"})
+//	claims := backend.Verify(token)
+package jwttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	jwtsecrets "github.com/outfoxx/vault-plugin-secrets-jwt/plugin"
+)
+
+// MountPoint is the mount point of the secrets engine, as seen by its requests.
+const MountPoint = "jwt/"
+
+// Backend is a JWT secrets engine running in memory. Its helpers fail the test when requests fail; Request
+// returns failures, to test them.
+type Backend struct {
+	// Backend is the secrets engine.
+	Backend logical.Backend
+
+	// Storage is the in-memory storage of the secrets engine.
+	Storage logical.Storage
+
+	t testing.TB
+}
+
+// New returns a JWT secrets engine running in memory, with the default config & no roles.
+func New(t testing.TB) *Backend {
+	t.Helper()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = new(logical.InmemStorage)
+	config.BackendUUID = uuid.New().String()
+
+	backend, err := jwtsecrets.Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unable to create backend: %v", err)
+	}
+
+	return &Backend{Backend: backend, Storage: config.StorageView, t: t}
+}
+
+// Request handles a request for the operation on the path (e.g. "sign/my-role"), returning the response & error as
+// the secrets engine returns them to Vault.
+func (b *Backend) Request(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	req := &logical.Request{
+		Operation:  operation,
+		Path:       path,
+		Storage:    b.Storage,
+		Data:       data,
+		MountPoint: MountPoint,
+	}
+
+	return b.Backend.HandleRequest(context.Background(), req)
+}
+
+// mustRequest handles a request, failing the test when it fails.
+func (b *Backend) mustRequest(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	b.t.Helper()
+
+	resp, err := b.Request(operation, path, data)
+	if err != nil || resp.IsError() {
+		b.t.Fatalf("%s %s failed: err:%v resp:%v", operation, path, err, resp.Error())
+	}
+
+	return resp
+}
+
+// WriteConfig updates the fields of the config.
+func (b *Backend) WriteConfig(data map[string]interface{}) {
+	b.t.Helper()
+	b.mustRequest(logical.UpdateOperation, "config", data)
+}
+
+// WriteRole creates or replaces the named role, with the fields.
+func (b *Backend) WriteRole(name string, data map[string]interface{}) {
+	b.t.Helper()
+	b.mustRequest(logical.CreateOperation, "roles/"+name, data)
+}
+
+// Sign signs a token of the role with the claims, returning the token.
+func (b *Backend) Sign(role string, claims map[string]interface{}) string {
+	b.t.Helper()
+
+	data := map[string]interface{}{}
+	if claims != nil {
+		data["claims"] = claims
+	}
+
+	resp := b.SignResponse(role, data)
+
+	token, ok := resp.Data["token"].(string)
+	if !ok {
+		b.t.Fatalf("sign/%s returned no token: %v", role, resp.Data)
+	}
+
+	return token
+}
+
+// SignResponse signs a token of the role with the fields of a sign request (e.g. "claims" & "ttl"), returning the
+// response; its "token" and metadata.
+func (b *Backend) SignResponse(role string, data map[string]interface{}) *logical.Response {
+	b.t.Helper()
+	return b.mustRequest(logical.UpdateOperation, "sign/"+role, data)
+}
+
+// JWKS returns the published keys of the mount; verifying the tokens of roles without an isolated keyring.
+func (b *Backend) JWKS() *jose.JSONWebKeySet {
+	b.t.Helper()
+	return b.fetchJWKS("jwks")
+}
+
+// RoleJWKS returns the published keys of the role; verifying its tokens when it has an isolated keyring.
+func (b *Backend) RoleJWKS(role string) *jose.JSONWebKeySet {
+	b.t.Helper()
+	return b.fetchJWKS("jwks/" + role)
+}
+
+func (b *Backend) fetchJWKS(path string) *jose.JSONWebKeySet {
+	b.t.Helper()
+
+	resp := b.mustRequest(logical.ReadOperation, path, nil)
+
+	body, ok := resp.Data[logical.HTTPRawBody].([]byte)
+	if !ok {
+		b.t.Fatalf("%s returned no keys: %v", path, resp.Data)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		b.t.Fatalf("%s returned invalid keys: %v", path, err)
+	}
+
+	return &jwks
+}
+
+// Verify verifies the signature of the token with the keys of the mount, returning its claims. Expiration &
+// other claims are not validated.
+func (b *Backend) Verify(token string) map[string]interface{} {
+	b.t.Helper()
+
+	claims, err := VerifyWith(token, b.JWKS())
+	if err != nil {
+		b.t.Fatalf("%v", err)
+	}
+
+	return claims
+}
+
+// VerifyWith verifies the signature of the token with the key of the key set identified by its 'kid' header,
+// returning its claims.
+func VerifyWith(token string, jwks *jose.JSONWebKeySet) (map[string]interface{}, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	if len(parsed.Headers) == 0 {
+		return nil, fmt.Errorf("token has no signature")
+	}
+	keys := jwks.Key(parsed.Headers[0].KeyID)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key '%s' in key set", parsed.Headers[0].KeyID)
+	}
+
+	claims := map[string]interface{}{}
+	if err := parsed.Claims(keys[0], &claims); err != nil {
+		return nil, fmt.Errorf("token does not verify: %w", err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,65 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwttest_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/outfoxx/vault-plugin-secrets-jwt/plugin/jwttest"
+)
+
+func TestBackend(t *testing.T) {
+	backend := jwttest.New(t)
+
+	backend.WriteConfig(map[string]interface{}{"allowed_claims": []string{"sub", "aud"}})
+	backend.WriteRole("tester", map[string]interface{}{
+		"issuer":          "https://tester.example.com",
+		"claims":          map[string]interface{}{"aud": "nimbus"},
+		"subject_pattern": "^svc-",
+	})
+
+	token := backend.Sign("tester", map[string]interface{}{"sub": "svc-delivery"})
+
+	claims := backend.Verify(token)
+	expected := map[string]interface{}{"iss": "https://tester.example.com", "sub": "svc-delivery", "aud": "nimbus"}
+	for claim, value := range expected {
+		if claims[claim] != value {
+			t.Errorf("expected '%s' claim %v, got %v", claim, value, claims[claim])
+		}
+	}
+
+	// Failures are returned by requests
+	resp, err := backend.Request(logical.UpdateOperation, "sign/tester", map[string]interface{}{
+		"claims": map[string]interface{}{"sub": "fry"},
+	})
+	if err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v", resp)
+	}
+
+	// Tokens of isolated keyrings only verify with the keys of their role
+	backend.WriteRole("isolated", map[string]interface{}{"issuer": "https://isolated.example.com", "isolated_keyring": true})
+	token = backend.Sign("isolated", nil)
+
+	if _, err := jwttest.VerifyWith(token, backend.JWKS()); err == nil {
+		t.Error("token of isolated keyring verified with the keys of the mount")
+	}
+	if _, err := jwttest.VerifyWith(token, backend.RoleJWKS("isolated")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,147 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// rsaKeyBits are the sizes of the RSA key types, whose keys are pre-generated.
+var rsaKeyBits = map[keysutil.KeyType]int{
+	keysutil.KeyType_RSA2048: 2048,
+	keysutil.KeyType_RSA3072: 3072,
+	keysutil.KeyType_RSA4096: 4096,
+}
+
+// keyPregenerator generates the next RSA key of each key type in the background, ahead of rotation, so
+// rotating a keyring imports a ready key instead of stalling signing while a key is generated. Other key
+// types generate quickly and are generated by rotation.
+type keyPregenerator struct {
+	lock       sync.Mutex
+	keys       map[keysutil.KeyType][]byte
+	generating map[keysutil.KeyType]bool
+	pending    sync.WaitGroup
+}
+
+// prepare starts generating a key of the type in the background, unless one is ready or being generated.
+func (g *keyPregenerator) prepare(keyType keysutil.KeyType) {
+	bits, ok := rsaKeyBits[keyType]
+	if !ok {
+		return
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.keys[keyType] != nil || g.generating[keyType] {
+		return
+	}
+	if g.generating == nil {
+		g.generating = map[keysutil.KeyType]bool{}
+	}
+	g.generating[keyType] = true
+
+	g.pending.Add(1)
+	go func() {
+		defer g.pending.Done()
+
+		// Failures are left to rotation, which generates keys that aren't ready
+		key, err := generatePKCS8RSAKey(bits)
+
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		g.generating[keyType] = false
+		if err == nil {
+			if g.keys == nil {
+				g.keys = map[keysutil.KeyType][]byte{}
+			}
+			g.keys[keyType] = key
+		}
+	}()
+}
+
+// take returns the ready key of the type, PKCS#8 encoded, or nil when none is ready; generating the next.
+func (g *keyPregenerator) take(keyType keysutil.KeyType) []byte {
+	g.lock.Lock()
+	key := g.keys[keyType]
+	delete(g.keys, keyType)
+	g.lock.Unlock()
+
+	g.prepare(keyType)
+
+	return key
+}
+
+// wait waits for keys being generated.
+func (g *keyPregenerator) wait() {
+	g.pending.Wait()
+}
+
+// generatePKCS8RSAKey generates an RSA key, PKCS#8 encoded as keysutil imports keys.
+func generatePKCS8RSAKey(bits int) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+// rotatePolicy rotates the keyring's policy to a new key version; using a pre-generated key when one is ready.
+// The policy must be locked for writing.
+func (b *backend) rotatePolicy(ctx context.Context, stg logical.Storage, policy *keysutil.Policy) error {
+	if key := b.keyPregenerator.take(policy.Type); key != nil {
+		err := importPolicyKey(ctx, stg, policy, key)
+		if err == nil {
+			return nil
+		}
+		b.Logger().Warn("Failed to rotate to pre-generated key, generating key", "keyring", policy.Name, "error", err)
+	}
+
+	return policy.Rotate(ctx, stg, rand.Reader)
+}
+
+// importPolicyKey adds the PKCS#8 encoded private key to the policy as its new key version, restoring
+// the policy if it can't be persisted.
+func importPolicyKey(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, key []byte) (retErr error) {
+	priorLatestVersion := policy.LatestVersion
+	priorMinDecryptionVersion := policy.MinDecryptionVersion
+	var priorKeys map[string]keysutil.KeyEntry
+	if policy.Keys != nil {
+		priorKeys = map[string]keysutil.KeyEntry{}
+		for k, v := range policy.Keys {
+			priorKeys[k] = v
+		}
+	}
+
+	defer func() {
+		if retErr != nil {
+			policy.LatestVersion = priorLatestVersion
+			policy.MinDecryptionVersion = priorMinDecryptionVersion
+			policy.Keys = priorKeys
+		}
+	}()
+
+	return policy.Import(ctx, stg, key, rand.Reader)
+}
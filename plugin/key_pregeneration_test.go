@@ -0,0 +1,114 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"strconv"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestKeyPregenerator(t *testing.T) {
+	var g keyPregenerator
+
+	// Other key types generate quickly
+	g.prepare(keysutil.KeyType_ECDSA_P256)
+	g.wait()
+	if key := g.take(keysutil.KeyType_ECDSA_P256); key != nil {
+		t.Error("ECDSA keys should not be pre-generated")
+	}
+
+	g.prepare(keysutil.KeyType_RSA2048)
+	g.wait()
+
+	key := g.take(keysutil.KeyType_RSA2048)
+	if key == nil {
+		t.Fatal("RSA key should be pre-generated")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(2048, parsed.(*rsa.PrivateKey).N.BitLen()); diff != nil {
+		t.Error("key size", diff)
+	}
+
+	// Taking a key generates the next
+	g.wait()
+	if next := g.take(keysutil.KeyType_RSA2048); next == nil || string(next) == string(key) {
+		t.Error("next RSA key should be pre-generated")
+	}
+	g.wait()
+}
+
+func TestRotatePregeneratedKey(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: string(jose.RS256)}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	b.keyPregenerator.wait()
+
+	pregenerated, err := x509.ParsePKCS8PrivateKey(b.keyPregenerator.keys[policy.Type])
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	version := policy.LatestVersion
+
+	policy.Lock(true)
+	err = b.rotatePolicy(context.Background(), *storage, policy)
+	policy.Unlock()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal(version+1, policy.LatestVersion); diff != nil {
+		t.Error("latest version", diff)
+	}
+
+	rotated := policy.Keys[strconv.Itoa(policy.LatestVersion)].RSAKey
+	if !rotated.Equal(pregenerated) {
+		t.Error("keyring should be rotated to the pre-generated key")
+	}
+
+	// The rotated keyring still signs
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	b.keyPregenerator.wait()
+}
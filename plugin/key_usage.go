@@ -0,0 +1,112 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	signatureCountsPath = "signature-counts/"
+)
+
+// signatureCount is the number of signatures made by a version of a keyring's key.
+type signatureCount struct {
+	// Version is the key version the signatures were made by.
+	Version int
+
+	// Count is the number of signatures made by the key version.
+	Count int
+}
+
+// countKeySignature counts a signature by the key version, rotating the keyring once the version has made
+// the configured maximum number of signatures.
+func (b *backend) countKeySignature(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, config *Config, keyVersion int, mount string) error {
+	b.signatureCountLock.Lock()
+	defer b.signatureCountLock.Unlock()
+
+	count, err := getSignatureCount(ctx, stg, policy.Name)
+	if err != nil {
+		return err
+	}
+
+	if count.Version != keyVersion {
+		count = &signatureCount{Version: keyVersion}
+	}
+	count.Count++
+
+	entry, err := logical.StorageEntryJSON(signatureCountsPath+policy.Name, count)
+	if err != nil {
+		return err
+	}
+	if err := stg.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	if count.Count < config.MaxSignaturesPerKey {
+		return nil
+	}
+
+	return b.rotateForUsage(ctx, stg, policy, keyVersion, mount)
+}
+
+// rotateForUsage rotates the keyring after its key version reached its maximum number of signatures, unless
+// a newer version was already created (e.g. a pre-published key that will replace it).
+func (b *backend) rotateForUsage(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, keyVersion int, mount string) error {
+	policy.Lock(true)
+	defer policy.Unlock()
+
+	if policy.LatestVersion != keyVersion {
+		return nil
+	}
+
+	err := b.rotatePolicy(ctx, stg, policy)
+	if err != nil {
+		return err
+	}
+
+	b.lockManager.InvalidatePolicy(policy.Name)
+
+	b.Logger().Info(fmt.Sprintf("Key Rotated: mount=%s, keyring=%s, reason=usage", mount, policy.Name))
+
+	emitKeyRotation(policy.Name, mount, rotationReasonUsage)
+
+	return nil
+}
+
+// getSignatureCount returns the signature count of the keyring's current key version.
+func getSignatureCount(ctx context.Context, stg logical.Storage, keyring string) (*signatureCount, error) {
+	entry, err := stg.Get(ctx, signatureCountsPath+keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	count := &signatureCount{}
+	if entry == nil {
+		return count, nil
+	}
+
+	if err := entry.DecodeJSON(count); err != nil {
+		return nil, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,49 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestMaxSignaturesPerKey(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyMaxSignaturesPerKey: -1}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("negative max signatures per key should have failed")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyMaxSignaturesPerKey: 3}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expectedVersions := []int{1, 1, 2, 2, 2, 3}
+	for i, expected := range expectedVersions {
+		if resp, err := signData(b, storage, "tester", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if diff := deep.Equal(expected, readStatus(t, b, storage)["key_version"]); diff != nil {
+			t.Error(i, diff)
+		}
+	}
+}
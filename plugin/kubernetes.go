@@ -0,0 +1,105 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"regexp"
+)
+
+// Parameters of sign requests populating the claims of Kubernetes style tokens.
+const (
+	kubernetesNamespaceParameter         = "namespace"
+	kubernetesServiceAccountParameter    = "serviceaccount"
+	kubernetesServiceAccountUIDParameter = "serviceaccount_uid"
+	kubernetesPodParameter               = "pod"
+	kubernetesPodUIDParameter            = "pod_uid"
+)
+
+// KubernetesParameters are the parameters of Kubernetes style tokens which roles define patterns for; a UID
+// parameter can only be provided with the name of its object.
+var KubernetesParameters = []string{kubernetesNamespaceParameter, kubernetesServiceAccountParameter, kubernetesPodParameter}
+
+// kubernetesProfileParameters are all the parameters of Kubernetes style tokens.
+var kubernetesProfileParameters = append(KubernetesParameters, kubernetesServiceAccountUIDParameter, kubernetesPodUIDParameter)
+
+// kubernetesClaim is the structured claim describing the namespace, service account & pod tokens are issued to.
+const kubernetesClaim = "kubernetes.io"
+
+var (
+	// kubernetesNamespaceRegex matches namespace names (RFC 1123 labels).
+	kubernetesNamespaceRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+	// kubernetesNameRegex matches service account & pod names (RFC 1123 subdomains).
+	kubernetesNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// kubernetesClaims returns the subject ('system:serviceaccount:<namespace>:<name>') & 'kubernetes.io' claim of
+// service account tokens, populated from the parameters of the sign request; names must match the role's patterns.
+func kubernetesClaims(role *Role, parameters map[string]string) (map[string]interface{}, error) {
+
+	object := func(nameParameter, uidParameter string, nameRegex *regexp.Regexp) (map[string]interface{}, error) {
+		name := parameters[nameParameter]
+		if !nameRegex.MatchString(name) {
+			return nil, fmt.Errorf("parameter %s is not a valid Kubernetes name", nameParameter)
+		}
+		if !matchPattern(anchoredPattern(role.KubernetesPatterns[nameParameter]), name) {
+			return nil, fmt.Errorf("validation of parameter %s failed (doesn't match role restriction)", nameParameter)
+		}
+
+		ref := map[string]interface{}{"name": name}
+		if uid, ok := parameters[uidParameter]; ok {
+			if _, err := uuid.Parse(uid); err != nil {
+				return nil, fmt.Errorf("parameter %s is not a valid UID", uidParameter)
+			}
+			ref["uid"] = uid
+		}
+		return ref, nil
+	}
+
+	namespace, err := object(kubernetesNamespaceParameter, "", kubernetesNamespaceRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceAccount, err := object(kubernetesServiceAccountParameter, kubernetesServiceAccountUIDParameter, kubernetesNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := map[string]interface{}{
+		"namespace":      namespace["name"],
+		"serviceaccount": serviceAccount,
+	}
+
+	if _, ok := parameters[kubernetesPodParameter]; ok {
+		if _, ok := role.KubernetesPatterns[kubernetesPodParameter]; !ok {
+			return nil, fmt.Errorf("parameter %s not permitted", kubernetesPodParameter)
+		}
+		if claim["pod"], err = object(kubernetesPodParameter, kubernetesPodUIDParameter, kubernetesNameRegex); err != nil {
+			return nil, err
+		}
+	} else if _, ok := parameters[kubernetesPodUIDParameter]; ok {
+		return nil, fmt.Errorf("parameter %s requires parameter %s", kubernetesPodUIDParameter, kubernetesPodParameter)
+	}
+
+	return map[string]interface{}{
+		"sub":           fmt.Sprintf("system:serviceaccount:%s:%s", namespace["name"], serviceAccount["name"]),
+		kubernetesClaim: claim,
+	}, nil
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestKubernetesProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{
+		keyIssuer:             "https://kubernetes.default.svc.cluster.local",
+		keyTokenProfile:       TokenProfileKubernetes,
+		keyKubernetesPatterns: map[string]interface{}{kubernetesNamespaceParameter: "billing-.*"},
+	}
+
+	// Service accounts must be restricted
+	if resp, err := writeProfileRole(b, storage, "k8s", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role without service account pattern should have failed")
+	}
+
+	roleData[keyKubernetesPatterns] = map[string]interface{}{
+		kubernetesNamespaceParameter:      "billing-.*",
+		kubernetesServiceAccountParameter: "api|worker",
+	}
+
+	if resp, err := writeProfileRole(b, storage, "k8s", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// signed signs a token of the role with the parameters, returning its claims
+	signed := func(role string, parameters map[string]interface{}) map[string]interface{} {
+		resp, err := signData(b, storage, role, map[string]interface{}{keyClaims: map[string]interface{}{"aud": "https://kubernetes.default.svc"}, keyParameters: parameters})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return unsafeClaims(t, resp.Data["token"].(string))
+	}
+
+	claims := signed("k8s", map[string]interface{}{
+		kubernetesNamespaceParameter:         "billing-prod",
+		kubernetesServiceAccountParameter:    "api",
+		kubernetesServiceAccountUIDParameter: "4ac8ea2c-6fa4-4d4b-a2b8-f2a0e0dc2c3b",
+	})
+
+	if diff := deep.Equal("system:serviceaccount:billing-prod:api", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+	expected := map[string]interface{}{
+		"namespace": "billing-prod",
+		"serviceaccount": map[string]interface{}{
+			"name": "api",
+			"uid":  "4ac8ea2c-6fa4-4d4b-a2b8-f2a0e0dc2c3b",
+		},
+	}
+	if diff := deep.Equal(expected, claims[kubernetesClaim]); diff != nil {
+		t.Error(kubernetesClaim, diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"namespace pattern":       {kubernetesNamespaceParameter: "payroll", kubernetesServiceAccountParameter: "api"},
+		"partial pattern match":   {kubernetesNamespaceParameter: "billing-prod", kubernetesServiceAccountParameter: "api-admin"},
+		"missing service account": {kubernetesNamespaceParameter: "billing-prod"},
+		"invalid name":            {kubernetesNamespaceParameter: "billing-prod:admin", kubernetesServiceAccountParameter: "api"},
+		"invalid uid":             {kubernetesNamespaceParameter: "billing-prod", kubernetesServiceAccountParameter: "api", kubernetesServiceAccountUIDParameter: "api"},
+		"pod without pattern":     {kubernetesNamespaceParameter: "billing-prod", kubernetesServiceAccountParameter: "api", kubernetesPodParameter: "api-7d4b9"},
+	}
+
+	for name, parameters := range invalid {
+		if resp, err := signData(b, storage, "k8s", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "https://kubernetes.default.svc"}, keyParameters: parameters}); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	roleData[keyKubernetesPatterns] = map[string]interface{}{
+		kubernetesNamespaceParameter:      "billing-.*",
+		kubernetesServiceAccountParameter: "api",
+		kubernetesPodParameter:            "api-.*",
+	}
+
+	if resp, err := writeProfileRole(b, storage, "k8s-pods", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	claims = signed("k8s-pods", map[string]interface{}{
+		kubernetesNamespaceParameter:      "billing-prod",
+		kubernetesServiceAccountParameter: "api",
+		kubernetesPodParameter:            "api-7d4b9",
+		kubernetesPodUIDParameter:         "0a6f3b2e-3c59-4f3d-9d0e-5c3b1f1e8d7a",
+	})
+
+	expectedPod := map[string]interface{}{
+		"name": "api-7d4b9",
+		"uid":  "0a6f3b2e-3c59-4f3d-9d0e-5c3b1f1e8d7a",
+	}
+	if diff := deep.Equal(expectedPod, claims[kubernetesClaim].(map[string]interface{})["pod"]); diff != nil {
+		t.Error("pod", diff)
+	}
+
+	// Parameters are only accepted by the kubernetes token profile
+	if resp, err := writeProfileRole(b, storage, "plain", map[string]interface{}{
+		keyIssuer:             "https://vault.example.com",
+		keyKubernetesPatterns: roleData[keyKubernetesPatterns],
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := signData(b, storage, "plain", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "https://kubernetes.default.svc"}, keyParameters: map[string]interface{}{kubernetesNamespaceParameter: "billing-prod"}}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("parameter of plain role should have failed")
+	}
+}
@@ -0,0 +1,248 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// storageVersion is the version of the layout of the plugin's storage.
+const storageVersion = 2
+
+// storageVersionPath is the storage path of the version marker of the config & roles. Keyrings are upgraded
+// by keysutil when they are loaded.
+const storageVersionPath = "storage-version"
+
+// migration upgrades the storage from the previous version.
+type migration struct {
+	// Version is the storage version the migration upgrades to.
+	Version int
+
+	// Description describes the migration, for logging.
+	Description string
+
+	// Migrate upgrades the stored entries.
+	Migrate func(b *backend, ctx context.Context, stg logical.Storage) error
+}
+
+// migrations upgrade the storage, in order of their versions, to the current storage version.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "replace legacy regexp-serialized patterns",
+		Migrate:     (*backend).migrateLegacyPatterns,
+	},
+	{
+		Version:     2,
+		Description: "unset roles' zero max_audiences",
+		Migrate:     (*backend).migrateRoleMaxAudiences,
+	},
+}
+
+// unmatchablePattern is a pattern matching no value; legacy patterns are replaced by it, so entries which couldn't
+// sign tokens before the upgrade don't accept any subject or audience after it.
+const unmatchablePattern = `[^\x00-\x{10FFFF}]`
+
+// storedVersion is the storage version marker.
+type storedVersion struct {
+	Version int `json:"version"`
+}
+
+// migrateStorage upgrades the storage to the current storage version, recording the version after each
+// migration so that interrupted upgrades resume where they stopped.
+func (b *backend) migrateStorage(ctx context.Context, stg logical.Storage) error {
+	version, err := getStorageVersion(ctx, stg)
+	if err != nil {
+		return err
+	}
+
+	if version > storageVersion {
+		return fmt.Errorf("storage version %d is newer than the supported version %d; downgrades are not supported", version, storageVersion)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		b.Logger().Info(fmt.Sprintf("Migrating Storage: version=%d, %s", m.Version, m.Description))
+
+		err := m.Migrate(b, ctx, stg)
+
+		// Migrations rewrite roles in storage directly
+		b.cachedRoles.clear()
+
+		if err != nil {
+			return fmt.Errorf("failed to migrate storage to version %d: %w", m.Version, err)
+		}
+
+		entry, err := logical.StorageEntryJSON(storageVersionPath, &storedVersion{Version: m.Version})
+		if err != nil {
+			return err
+		}
+		if err := stg.Put(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getStorageVersion returns the version of the storage; 0 for storage written before versioning.
+func getStorageVersion(ctx context.Context, stg logical.Storage) (int, error) {
+	entry, err := stg.Get(ctx, storageVersionPath)
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil {
+		return 0, nil
+	}
+
+	var version storedVersion
+	if err := entry.DecodeJSON(&version); err != nil {
+		return 0, err
+	}
+
+	return version.Version, nil
+}
+
+// migrateLegacyPatterns replaces the audience & subject patterns of the config & roles stored as serialized
+// regexps, which encode as empty objects that cannot be decoded, by a pattern matching nothing; the original
+// patterns were not stored and cannot be recovered. Roles with a legacy pattern are also disabled, failing closed
+// until the operator sets their patterns & enables them.
+func (b *backend) migrateLegacyPatterns(ctx context.Context, stg logical.Storage) error {
+	resetPatterns := func(key string, data map[string]interface{}) bool {
+		reset := false
+		for _, field := range []string{"AudiencePattern", "SubjectPattern"} {
+			value, ok := data[field]
+			if _, isString := value.(string); !ok || isString {
+				continue
+			}
+			b.Logger().Warn(fmt.Sprintf("Legacy pattern replaced, matching nothing until it is set: entry=%s, field=%s", key, field))
+			data[field] = unmatchablePattern
+			reset = true
+		}
+		if reset && key != configPath {
+			b.Logger().Warn(fmt.Sprintf("Role with legacy pattern disabled: entry=%s", key))
+			data["disabled"] = true
+		}
+		return reset
+	}
+
+	if err := migrateEntry(ctx, stg, configPath, resetPatterns); err != nil {
+		return err
+	}
+
+	roles, err := stg.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range roles {
+		if err := migrateEntry(ctx, stg, path.Join(keyStorageRolePath, name), resetPatterns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateRoleMaxAudiences unsets the maximum number of audiences of roles & role templates stored as zero, which
+// roles had when they didn't set one; zero now allows no audiences, like the config's, and -1 is unset.
+func (b *backend) migrateRoleMaxAudiences(ctx context.Context, stg logical.Storage) error {
+	// Stored numbers decode as json.Number, and raw fields of templates can also be strings
+	isZero := func(value interface{}) bool {
+		return fmt.Sprint(value) == "0"
+	}
+
+	roles, err := stg.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range roles {
+		err := migrateEntry(ctx, stg, path.Join(keyStorageRolePath, name), func(_ string, data map[string]interface{}) bool {
+			updated := false
+			if value, ok := data[keyMaxAllowedAudiences]; !ok || isZero(value) {
+				data[keyMaxAllowedAudiences] = DefaultMaxAudiences
+				updated = true
+			}
+			// Roles with a template hold the fields written to them as overrides
+			if overrides, ok := data["template_overrides"].(map[string]interface{}); ok && isZero(overrides[keyMaxAllowedAudiences]) {
+				overrides[keyMaxAllowedAudiences] = DefaultMaxAudiences
+				updated = true
+			}
+			return updated
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	templates, err := stg.List(ctx, roleTemplatesPath)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range templates {
+		err := migrateEntry(ctx, stg, roleTemplatesPath+name, func(_ string, data map[string]interface{}) bool {
+			fields, ok := data["fields"].(map[string]interface{})
+			if !ok || !isZero(fields[keyMaxAllowedAudiences]) {
+				return false
+			}
+			fields[keyMaxAllowedAudiences] = DefaultMaxAudiences
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateEntry rewrites the JSON entry, if it exists, when it is updated by the update function.
+func migrateEntry(ctx context.Context, stg logical.Storage, key string, update func(key string, data map[string]interface{}) bool) error {
+	entry, err := stg.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	var data map[string]interface{}
+	if err := entry.DecodeJSON(&data); err != nil {
+		return fmt.Errorf("failed to decode '%s': %w", key, err)
+	}
+
+	if !update(key, data) {
+		return nil
+	}
+
+	updated, err := logical.StorageEntryJSON(key, data)
+	if err != nil {
+		return err
+	}
+	updated.SealWrap = entry.SealWrap
+
+	return stg.Put(ctx, updated)
+}
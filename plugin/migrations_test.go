@@ -0,0 +1,134 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestMigrateLegacyPatterns(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	// Early releases stored patterns as regexps, which serialize as empty objects
+	legacyEntries := map[string]string{
+		configPath:    `{"SignatureAlgorithm":"ES384","AudiencePattern":{},"SubjectPattern":{},"MaxAudiences":3}`,
+		"role/tester": `{"issuer":"tester.example.com","claims":{"scope":"read"},"AudiencePattern":{},"SubjectPattern":"^user-"}`,
+	}
+	for key, value := range legacyEntries {
+		if err := (*storage).Put(context.Background(), &logical.StorageEntry{Key: key, Value: []byte(value)}); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: *storage}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal([]interface{}{"ES384", unmatchablePattern, unmatchablePattern, 3},
+		[]interface{}{string(config.SignatureAlgorithm), config.AudiencePattern, config.SubjectPattern, config.MaxAudiences}); diff != nil {
+		t.Error("config", diff)
+	}
+
+	role, err := b.getRole(context.Background(), *storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal([]interface{}{"tester.example.com", unmatchablePattern, "^user-", map[string]interface{}{"scope": "read"}, true},
+		[]interface{}{role.Issuer, role.AudiencePattern, role.SubjectPattern, role.Claims, role.Disabled}); diff != nil {
+		t.Error("role", diff)
+	}
+
+	// Replaced patterns fail closed
+	for _, value := range []string{"", "user-fry", "\n"} {
+		if matchPattern(unmatchablePattern, value) {
+			t.Errorf("replaced pattern matched '%s'", value)
+		}
+	}
+
+	version, err := getStorageVersion(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(storageVersion, version); diff != nil {
+		t.Error("storage version", diff)
+	}
+}
+
+func TestMigrateRoleMaxAudiences(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	// Roles stored zero, or nothing, when they had no maximum number of audiences
+	entries := map[string]string{
+		storageVersionPath:    `{"version":1}`,
+		"role/tester":         `{"issuer":"tester.example.com","SubjectPattern":"^user-","AudiencePattern":"^api$"}`,
+		"role/limited":        `{"issuer":"limited.example.com","SubjectPattern":"^user-","AudiencePattern":"^api$","max_audiences":2}`,
+		"role/templated":      `{"role_template":"base","template_overrides":{"max_audiences":0}}`,
+		"role-templates/base": `{"fields":{"issuer":"base.example.com","max_audiences":"0"}}`,
+	}
+	for key, value := range entries {
+		if err := (*storage).Put(context.Background(), &logical.StorageEntry{Key: key, Value: []byte(value)}); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: *storage}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for name, maxAudiences := range map[string]int{"tester": -1, "limited": 2, "templated": -1} {
+		role, err := b.getRole(context.Background(), *storage, name)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if diff := deep.Equal(maxAudiences, role.MaxAudiences); diff != nil {
+			t.Error(name, diff)
+		}
+	}
+
+	template, err := b.getRoleTemplate(context.Background(), *storage, "base")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("-1", fmt.Sprint(template.Fields[keyMaxAllowedAudiences])); diff != nil {
+		t.Error("template", diff)
+	}
+}
+
+func TestMigrateNewerStorage(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	entry, err := logical.StorageEntryJSON(storageVersionPath, &storedVersion{Version: storageVersion + 1})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: *storage}); err == nil {
+		t.Error("initializing newer storage should have failed")
+	}
+}
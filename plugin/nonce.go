@@ -0,0 +1,137 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	usedNoncesPath = "nonces/"
+)
+
+// usedNonce records the use of a nonce by a role, until its replay window ends.
+type usedNonce struct {
+	// Role is the name of the role the nonce was used with.
+	Role string
+
+	// Expiration is the end of the nonce's replay window.
+	Expiration time.Time
+}
+
+// useNonce records the use of the nonce by the role for the replay window, returning false if the nonce was
+// already used within its window.
+func (b *backend) useNonce(ctx context.Context, stg logical.Storage, roleName string, nonce string, window time.Duration) (bool, error) {
+	b.nonceLock.Lock()
+	defer b.nonceLock.Unlock()
+
+	now := time.Now()
+
+	used, err := nonceUsed(ctx, stg, roleName, nonce, now)
+	if err != nil || used {
+		return false, err
+	}
+
+	entry, err := logical.StorageEntryJSON(usedNoncePath(roleName, nonce), &usedNonce{Role: roleName, Expiration: now.Add(window)})
+	if err != nil {
+		return false, err
+	}
+
+	return true, stg.Put(ctx, entry)
+}
+
+// checkNonce returns false if the nonce was already used by the role within its window, without recording its use.
+func (b *backend) checkNonce(ctx context.Context, stg logical.Storage, roleName string, nonce string) (bool, error) {
+	b.nonceLock.Lock()
+	defer b.nonceLock.Unlock()
+
+	used, err := nonceUsed(ctx, stg, roleName, nonce, time.Now())
+	return !used, err
+}
+
+// nonceUsed checks if the nonce was used by the role within a replay window that ends after now.
+func nonceUsed(ctx context.Context, stg logical.Storage, roleName string, nonce string, now time.Time) (bool, error) {
+	entry, err := stg.Get(ctx, usedNoncePath(roleName, nonce))
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	var used usedNonce
+	if err := entry.DecodeJSON(&used); err != nil {
+		return false, err
+	}
+
+	return used.Expiration.After(now), nil
+}
+
+// tidyUsedNonces removes the nonces whose replay window has ended, returning the number removed. Nonces are
+// listed without holding the lock, which is only held to remove each nonce, so signing isn't blocked by the scan.
+func (b *backend) tidyUsedNonces(ctx context.Context, stg logical.Storage) (int, error) {
+	entries, err := stg.List(ctx, usedNoncesPath)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, name := range entries {
+		expired, err := b.removeExpiredNonce(ctx, stg, usedNoncesPath+name)
+		if err != nil {
+			return removed, err
+		}
+		if expired {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// removeExpiredNonce removes the used nonce at the path if its replay window has ended; it is read under the lock,
+// as the nonce may have been used again since it was listed.
+func (b *backend) removeExpiredNonce(ctx context.Context, stg logical.Storage, path string) (bool, error) {
+	b.nonceLock.Lock()
+	defer b.nonceLock.Unlock()
+
+	entry, err := stg.Get(ctx, path)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	var used usedNonce
+	if err := entry.DecodeJSON(&used); err != nil {
+		return false, err
+	}
+
+	if used.Expiration.After(time.Now()) {
+		return false, nil
+	}
+
+	return true, stg.Delete(ctx, path)
+}
+
+// usedNoncePath returns the storage path of a used nonce; nonces are hashed, with the role, as they are arbitrary
+// strings.
+func usedNoncePath(roleName string, nonce string) string {
+	hash := sha256.Sum256([]byte(roleName + "\x00" + nonce))
+	return usedNoncesPath + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestSignNonce(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "nonce"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Nonces can be reused without a replay window
+	for i := 0; i < 2; i++ {
+		resp, err := signData(b, storage, "tester", map[string]interface{}{keyNonce: "n-0S6_WzA2Mj"})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if diff := deep.Equal("n-0S6_WzA2Mj", unsafeClaims(t, resp.Data["token"].(string))["nonce"]); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyNonce: "a", keyClaims: map[string]interface{}{"nonce": "b"}}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("nonce with 'nonce' claim should have failed")
+	}
+
+	roleData[keyNonceReplayWindow] = "1h"
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := writeRoleData(b, storage, "other", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyNonce: "replayed"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyNonce: "replayed"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("replayed nonce should have failed")
+	}
+
+	// Requests that fail to sign don't use their nonce
+	restrictedData := map[string]interface{}{keyIssuer: "tester.example.com", keyNonceReplayWindow: "1h", keyAllowedAlgorithms: "ES384"}
+	if resp, err := writeRoleData(b, storage, "restricted", restrictedData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := signData(b, storage, "restricted", map[string]interface{}{keyNonce: "unsigned"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("signing with a disallowed algorithm should have failed")
+	}
+	restrictedData[keyAllowedAlgorithms] = "ES256"
+	if resp, err := writeRoleData(b, storage, "restricted", restrictedData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := signData(b, storage, "restricted", map[string]interface{}{keyNonce: "unsigned"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Nonces are tracked per role
+	if resp, err := signData(b, storage, "other", map[string]interface{}{keyNonce: "replayed"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Nonces can be reused after their replay window, and are tidied
+	if _, err := b.useNonce(context.Background(), *storage, "tester", "expiring", time.Millisecond); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := b.tidyUsedNonces(context.Background(), *storage); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	entries, err := (*storage).List(context.Background(), usedNoncesPath)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(3, len(entries)); diff != nil {
+		t.Error(diff)
+	}
+
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyNonce: "expiring"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+}
@@ -0,0 +1,204 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultOPATimeout is the default duration allowed for OPA policy decisions.
+const DefaultOPATimeout = 5 * time.Second
+
+// OPAConfig holds the configuration of the Open Policy Agent (https://www.openpolicyagent.org) issuance check.
+type OPAConfig struct {
+	// URL of the OPA Data API document deciding if tokens are issued (e.g. 'http://opa:8181/v1/data/jwt/allow').
+	URL string
+
+	// Token is sent as a bearer token to authenticate with OPA.
+	Token string
+
+	// Timeout is the duration allowed for a decision; defaults to DefaultOPATimeout when zero.
+	Timeout time.Duration
+}
+
+// opaDecision is the result of OPA policy documents; either a boolean, or an object with 'allow' & 'reason'.
+type opaDecision struct {
+	Allow  bool
+	Reason string
+}
+
+func (d *opaDecision) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.Allow); err == nil {
+		return nil
+	}
+
+	var object struct {
+		Allow  *bool  `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil || object.Allow == nil {
+		return fmt.Errorf("decision must be a boolean or an object with an 'allow' boolean")
+	}
+
+	d.Allow = *object.Allow
+	d.Reason = object.Reason
+	return nil
+}
+
+// validateOPAConfig checks the OPA configuration is usable.
+func validateOPAConfig(config *OPAConfig) error {
+	endpoint, err := url.Parse(config.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("'%s' must be an http(s) url", keyOPAURL)
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("'%s' cannot be negative", keyOPATimeout)
+	}
+	return nil
+}
+
+// opaDeniedError reports that the OPA decision denied the token.
+type opaDeniedError struct {
+	reason string
+}
+
+func (e *opaDeniedError) Error() string {
+	if e.reason != "" {
+		return "denied by opa policy: " + e.reason
+	}
+	return "denied by opa policy"
+}
+
+// opaUnavailableError reports that OPA could not be queried, or responded without a decision; issuance is denied,
+// without a policy deciding to.
+type opaUnavailableError struct {
+	err error
+}
+
+func (e *opaUnavailableError) Error() string {
+	return fmt.Sprintf("opa policy check failed: %v", e.err)
+}
+
+func (e *opaUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// checkOPA queries OPA with the claims of the token, the role & the identity of the requester, returning an
+// error unless the decision is to allow the token to be issued; an opaDeniedError when denied by the decision. Issuance
+// is denied when OPA cannot be queried, with an opaUnavailableError.
+func (b *backend) checkOPA(ctx context.Context, req *logical.Request, config *OPAConfig, roleName string, claims map[string]interface{}) error {
+
+	identity := map[string]interface{}{
+		"entity_id":    req.EntityID,
+		"display_name": req.DisplayName,
+	}
+	if req.EntityID != "" {
+		entity, err := b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return fmt.Errorf("error looking up entity: %w", err)
+		}
+		if entity != nil {
+			identity["entity_name"] = entity.Name
+			identity["entity_metadata"] = entity.Metadata
+		}
+		groups, err := b.System().GroupsForEntity(req.EntityID)
+		if err != nil {
+			return fmt.Errorf("error looking up entity groups: %w", err)
+		}
+		groupNames := make([]string, 0, len(groups))
+		for _, group := range groups {
+			groupNames = append(groupNames, group.Name)
+		}
+		identity["groups"] = groupNames
+	}
+
+	inputClaims := make(map[string]interface{}, len(claims))
+	for name, value := range claims {
+		if date, ok := value.(jwt.NumericDate); ok {
+			value = int64(date)
+		}
+		inputClaims[name] = value
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"input": map[string]interface{}{
+			"claims":      inputClaims,
+			"role":        roleName,
+			"identity":    identity,
+			"mount_point": req.MountPoint,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultOPATimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opaReq, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &opaUnavailableError{err: err}
+	}
+	opaReq.Header.Set("Content-Type", "application/json")
+	if config.Token != "" {
+		opaReq.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+
+	resp, err := cleanhttp.DefaultClient().Do(opaReq)
+	if err != nil {
+		return &opaUnavailableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readResponse(resp)
+	if err != nil {
+		return &opaUnavailableError{err: err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &opaUnavailableError{err: fmt.Errorf("status %d", resp.StatusCode)}
+	}
+
+	// An undefined decision (no 'result') denies issuance
+	var output struct {
+		Result *opaDecision `json:"result"`
+	}
+	if err := json.Unmarshal(respBody, &output); err != nil {
+		return &opaUnavailableError{err: err}
+	}
+	if output.Result == nil {
+		return &opaDeniedError{}
+	}
+	if !output.Result.Allow {
+		return &opaDeniedError{reason: output.Result.Reason}
+	}
+
+	return nil
+}
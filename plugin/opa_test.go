@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// newFakeOPA starts a server emulating an OPA policy allowing tokens of 'svc-' subjects, recording the inputs.
+func newFakeOPA(t *testing.T, inputs *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/data/jwt/decision" || r.Header.Get("Authorization") != "Bearer opa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*inputs = append(*inputs, body.Input)
+
+		claims := body.Input["claims"].(map[string]interface{})
+		switch claims["sub"] {
+		case "svc-ship":
+			_, _ = w.Write([]byte(`{"result": {"allow": true}}`))
+		case "svc-undefined":
+			_, _ = w.Write([]byte(`{}`))
+		case "svc-legacy":
+			_, _ = w.Write([]byte(`{"result": true}`))
+		default:
+			_, _ = w.Write([]byte(`{"result": {"allow": false, "reason": "subject is not a service"}}`))
+		}
+	}))
+}
+
+func TestSignOPA(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	var inputs []map[string]interface{}
+	server := newFakeOPA(t, &inputs)
+	defer server.Close()
+
+	config := map[string]interface{}{
+		keyAllowedClaims: []string{"sub"},
+		keyOPAURL:        server.URL + "/v1/data/jwt/decision",
+		keyOPAToken:      "opa-token",
+		keyOPATimeout:    "2s",
+	}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for _, sub := range []string{"svc-ship", "svc-legacy"} {
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": sub}, map[string]interface{}{}, nil, nil); err != nil {
+			t.Errorf("%s: %v\n", sub, err)
+		}
+	}
+
+	for _, sub := range []string{"bender", "svc-undefined"} {
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": sub}, map[string]interface{}{}, nil, nil); err == nil {
+			t.Errorf("%s should have been denied", sub)
+		}
+	}
+	resp, _ := signData(b, storage, "tester", map[string]interface{}{"claims": map[string]interface{}{"sub": "bender"}})
+	if diff := deep.Equal(ErrorCodePolicyDenied, errorCode(resp)); diff != nil {
+		t.Error("denied error code", diff)
+	}
+
+	if len(inputs) != 5 {
+		t.Fatalf("expected 5 decisions, got %d", len(inputs))
+	}
+
+	input := inputs[0]
+	claims := input["claims"].(map[string]interface{})
+	if diff := deep.Equal(claims["iss"], "tester.example.com"); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		t.Errorf("'exp' claim was %T, not a number", claims["exp"])
+	}
+	if diff := deep.Equal(input["role"], "tester"); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := input["identity"].(map[string]interface{}); !ok {
+		t.Error("missing identity")
+	}
+
+	// Unreachable policy engines deny issuance
+	server.Close()
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "svc-ship"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("unreachable opa should have denied")
+	}
+	resp, _ = signData(b, storage, "tester", map[string]interface{}{"claims": map[string]interface{}{"sub": "svc-ship"}})
+	if diff := deep.Equal(ErrorCodePolicyUnavailable, errorCode(resp)); diff != nil {
+		t.Error("unreachable opa error code", diff)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyOPAURL: ""}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "svc-ship"}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
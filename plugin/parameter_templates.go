@@ -0,0 +1,87 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// parameterNamePattern matches the names of template parameters; names must be referencable as '{{.name}}'.
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hasTemplate checks if the value contains templates; identity or parameter templates.
+func hasTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// hasParameterTemplate checks if the value is a parameter template (e.g. 'repo/{{.repo}}'); identity & parameter
+// templates cannot be combined in a single value.
+func hasParameterTemplate(value string) bool {
+	return hasTemplate(value) && !hasIdentityTemplate(value)
+}
+
+// parseParameterTemplate parses the Go template; referencing parameters without a value fails.
+func parseParameterTemplate(value string) (*template.Template, error) {
+	return template.New("claim").Option("missingkey=error").Parse(value)
+}
+
+// renderParameterTemplate renders the parameter template with the parameters of a sign request.
+func renderParameterTemplate(value string, parameters map[string]string) (string, error) {
+	if !hasParameterTemplate(value) {
+		return value, nil
+	}
+
+	tmpl, err := parseParameterTemplate(value)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, parameters); err != nil {
+		return "", fmt.Errorf("error rendering template '%s': %w", value, err)
+	}
+
+	return rendered.String(), nil
+}
+
+// validateParameterTemplates checks the parameter templates of the value's strings are well-formed, and
+// only reference the declared parameters.
+func validateParameterTemplates(value interface{}, declared []string) error {
+	parameters := make(map[string]string, len(declared))
+	for _, name := range declared {
+		parameters[name] = ""
+	}
+
+	_, err := mapStrings(value, func(value string) (string, error) {
+		if !hasParameterTemplate(value) {
+			return value, nil
+		}
+		tmpl, err := parseParameterTemplate(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid template '%s': %w", value, err)
+		}
+		if err := tmpl.Execute(io.Discard, parameters); err != nil {
+			return "", fmt.Errorf("invalid template '%s', only declared parameters can be referenced: %w", value, err)
+		}
+		return value, nil
+	})
+	return err
+}
@@ -0,0 +1,145 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestValidateParameterTemplates(t *testing.T) {
+	declared := []string{"repo", "branch"}
+
+	valid := []interface{}{
+		"repo/{{.repo}}/branch/{{.branch}}",
+		[]interface{}{"{{.repo}}", "static"},
+		map[string]interface{}{"ref": "refs/heads/{{.branch}}"},
+		"{{identity.entity.name}}",
+	}
+	for _, value := range valid {
+		if err := validateParameterTemplates(value, declared); err != nil {
+			t.Errorf("%v: %s", value, err)
+		}
+	}
+
+	invalid := []interface{}{
+		"env/{{.environment}}",
+		"repo/{{.repo",
+		"{{undefined .repo}}",
+		map[string]interface{}{"ref": "{{.tag}}"},
+	}
+	for _, value := range invalid {
+		if err := validateParameterTemplates(value, declared); err == nil {
+			t.Errorf("%v should have failed", value)
+		}
+	}
+}
+
+func TestRenderParameterTemplate(t *testing.T) {
+	parameters := map[string]string{"repo": "planet-express/ship", "branch": "{{.repo}}"}
+
+	rendered, err := renderParameterTemplate("repo/{{.repo}}/branch/{{.branch}}", parameters)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Parameter values are never interpreted as templates
+	if diff := deep.Equal("repo/planet-express/ship/branch/{{.repo}}", rendered); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := renderParameterTemplate("env/{{.environment}}", parameters); err == nil {
+		t.Error("missing parameter should have failed")
+	}
+}
+
+func TestSignParameterTemplates(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "path"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer: "ci.example.com",
+		keyClaims: map[string]interface{}{"path": "repo/{{.repo}}/branch/{{.branch}}"},
+	}
+
+	// Referenced parameters must be declared
+	if resp, err := writeRoleData(b, storage, "ci", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with undeclared parameters should have failed")
+	}
+
+	roleData[keyTemplateParameters] = "repo,branch"
+	if resp, err := writeRoleData(b, storage, "ci", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	signData := map[string]interface{}{
+		keyParameters: map[string]interface{}{"repo": "planet-express/ship", "branch": "main"},
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/ci",
+		Storage:    *storage,
+		Data:       signData,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("repo/planet-express/ship/branch/main", decoded["path"]); diff != nil {
+		t.Error("path", diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing":    {"repo": "planet-express/ship"},
+		"undeclared": {"repo": "planet-express/ship", "branch": "main", "tag": "v1"},
+		"non-string": {"repo": "planet-express/ship", "branch": 1},
+	}
+
+	for name, parameters := range invalid {
+		signData[keyParameters] = parameters
+		if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%s parameters should have failed", name)
+		}
+	}
+
+	// The issuer can't be bound to request parameters
+	roleData[keyIssuer] = "{{.repo}}.example.com"
+	if resp, err := writeRoleData(b, storage, "ci", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("templated issuer should have failed")
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Supported token formats.
+const (
+	// TokenFormatJWT issues JWTs.
+	TokenFormatJWT = "jwt"
+
+	// TokenFormatPASETO issues v4.public PASETOs.
+	TokenFormatPASETO = "paseto"
+)
+
+// AllowedTokenFormats are the supported token formats.
+var AllowedTokenFormats = []string{TokenFormatJWT, TokenFormatPASETO, TokenFormatCWT}
+
+const pasetoV4PublicHeader = "v4.public."
+
+// pasetoTimeClaims are the registered PASETO claims encoded as RFC 3339 dates, rather than numeric dates.
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+// signPASETO signs the claims of a JWT as a v4.public PASETO; the signer must use Ed25519 keys. The signing
+// key's id is included in the footer ({"kid":"..."}), allowing the key to be located in the JWKS.
+func signPASETO(signer inputSigner, claims map[string]interface{}) (string, error) {
+	message, err := json.Marshal(pasetoClaims(claims))
+	if err != nil {
+		return "", err
+	}
+
+	var footer []byte
+
+	signature, err := signer.SignInput(func(kid string) ([]byte, error) {
+		footer, err = json.Marshal(map[string]string{"kid": kid})
+		if err != nil {
+			return nil, err
+		}
+		// v4.public signs PAE(header, message, footer, implicit assertion); no implicit assertion is used
+		return pasetoPAE([]byte(pasetoV4PublicHeader), message, footer, nil), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return pasetoV4PublicHeader +
+		base64.RawURLEncoding.EncodeToString(append(message, signature...)) + "." +
+		base64.RawURLEncoding.EncodeToString(footer), nil
+}
+
+// pasetoClaims converts the claims of a JWT to those of a PASETO; numeric dates are encoded as RFC 3339 dates.
+func pasetoClaims(claims map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(claims))
+	for claim, value := range claims {
+		converted[claim] = value
+	}
+
+	for _, claim := range pasetoTimeClaims {
+		if date, ok := claims[claim].(jwt.NumericDate); ok {
+			converted[claim] = date.Time().UTC().Format(time.RFC3339)
+		}
+	}
+
+	return converted
+}
+
+// pasetoPAE returns the pre-authentication encoding of the pieces.
+func pasetoPAE(pieces ...[]byte) []byte {
+	pae := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		pae = binary.LittleEndian.AppendUint64(pae, uint64(len(piece)))
+		pae = append(pae, piece...)
+	}
+	return pae
+}
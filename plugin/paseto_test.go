@@ -0,0 +1,158 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPASETOPAE(t *testing.T) {
+	// Test vectors from the PASETO specification
+	vectors := map[string][][]byte{
+		"\x00\x00\x00\x00\x00\x00\x00\x00":                                                                 {},
+		"\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00":                                 {{}},
+		"\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00test":                             {[]byte("test")},
+		"\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00": {{}, {}},
+	}
+
+	for expected, pieces := range vectors {
+		if diff := deep.Equal([]byte(expected), pasetoPAE(pieces...)); diff != nil {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestSignPASETO(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	signData := map[string]interface{}{
+		keyClaims: map[string]interface{}{"sub": "Zapp Brannigan"},
+		keyFormat: TokenFormatPASETO,
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       signData,
+		MountPoint: "test",
+	}
+
+	// PASETO v4.public requires Ed25519 keys
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("PASETO signed without EdDSA keys")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "EdDSA"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token := resp.Data["token"].(string)
+	if !strings.HasPrefix(token, pasetoV4PublicHeader) {
+		t.Fatalf("token is not a v4.public PASETO: %s", token)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(token, pasetoV4PublicHeader), ".")
+	if len(parts) != 2 {
+		t.Fatalf("token has no footer: %s", token)
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	message, signature := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+
+	var footerClaims map[string]string
+	if err := json.Unmarshal(footer, &footerClaims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	keys, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	matchingKeys := keys.Key(footerClaims["kid"])
+	if len(matchingKeys) != 1 {
+		t.Fatalf("no published key with id '%s'", footerClaims["kid"])
+	}
+
+	publicKey, ok := matchingKeys[0].Key.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("published key is %T, not ed25519", matchingKeys[0].Key)
+	}
+
+	if !ed25519.Verify(publicKey, pasetoPAE([]byte(pasetoV4PublicHeader), message, footer, nil), signature) {
+		t.Fatal("invalid PASETO signature")
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(message, &claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("Zapp Brannigan", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+	if diff := deep.Equal("tester.example.com", claims["iss"]); diff != nil {
+		t.Error("iss", diff)
+	}
+
+	exp, err := time.Parse(time.RFC3339, claims["exp"].(string))
+	if err != nil {
+		t.Fatalf("exp is not an RFC 3339 date: %s\n", err)
+	}
+	if exp.Before(time.Now()) {
+		t.Error("token already expired")
+	}
+
+	// Claims are restricted identically to JWTs
+	signData[keyClaims] = map[string]interface{}{"foo": "bar"}
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("disallowed claim should have failed")
+	}
+
+	// JWTs are also signed with EdDSA keys
+	jwt := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+	if diff := deep.Equal(true, verifyToken(t, b, storage, map[string]interface{}{keyToken: jwt}).Data[keyValid]); diff != nil {
+		t.Error("EdDSA jwt", diff)
+	}
+}
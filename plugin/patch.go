@@ -0,0 +1,109 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// keyClear names the fields cleared by a write, for callers unable to set fields to null (e.g. the CLI).
+const keyClear = "clear"
+
+// withClearField adds the 'clear' field to the fields of a path.
+func withClearField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields[keyClear] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Fields to clear, as if set to null.`,
+	}
+	return fields
+}
+
+// clearedFields returns the fields of the request with the fields named by 'clear' set to null.
+func clearedFields(d *framework.FieldData) (*framework.FieldData, error) {
+	rawClear, ok := d.GetOk(keyClear)
+	if !ok {
+		return d, nil
+	}
+
+	raw := make(map[string]interface{}, len(d.Raw))
+	for field, value := range d.Raw {
+		if field != keyClear {
+			raw[field] = value
+		}
+	}
+
+	for _, field := range rawClear.([]string) {
+		if _, ok := d.Schema[field]; !ok || field == keyClear || field == keyRoleName {
+			return nil, fmt.Errorf("unknown field '%s' cannot be cleared", field)
+		}
+		if value, ok := raw[field]; ok && value != nil {
+			return nil, fmt.Errorf("'%s' cannot be both set and cleared", field)
+		}
+		raw[field] = nil
+	}
+
+	return &framework.FieldData{Raw: raw, Schema: d.Schema}, nil
+}
+
+// patchFieldData returns the fields of a write, or patch (JSON merge patch, RFC 7396), as the fields of an update;
+// fields set to null are cleared, replaced by their cleared value or the zero value of their type. Required
+// fields cannot be cleared.
+func patchFieldData(d *framework.FieldData, clearedValues map[string]interface{}, required ...string) (*framework.FieldData, error) {
+	raw := make(map[string]interface{}, len(d.Raw))
+
+	for field, value := range d.Raw {
+		schema, ok := d.Schema[field]
+		if value != nil || !ok {
+			raw[field] = value
+			continue
+		}
+
+		if stringInSlice(field, required) {
+			return nil, fmt.Errorf("'%s' is required and cannot be cleared", field)
+		}
+
+		if cleared, ok := clearedValues[field]; ok {
+			raw[field] = cleared
+		} else {
+			raw[field] = clearedFieldValue(schema)
+		}
+	}
+
+	return &framework.FieldData{Raw: raw, Schema: d.Schema}, nil
+}
+
+// clearedFieldValue returns the value a field is cleared to; its default, or the zero value of its type.
+func clearedFieldValue(schema *framework.FieldSchema) interface{} {
+	if schema.Default != nil {
+		return schema.Default
+	}
+
+	switch schema.Type {
+	case framework.TypeBool:
+		return false
+	case framework.TypeInt, framework.TypeInt64, framework.TypeFloat:
+		return 0
+	case framework.TypeMap, framework.TypeKVPairs:
+		return map[string]interface{}{}
+	case framework.TypeSlice, framework.TypeStringSlice, framework.TypeCommaStringSlice, framework.TypeCommaIntSlice:
+		return []interface{}{}
+	default:
+		return ""
+	}
+}
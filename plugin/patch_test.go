@@ -0,0 +1,63 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+func TestPatchFieldData(t *testing.T) {
+	d := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"name":    "tester",
+			"pattern": nil,
+			"enabled": nil,
+			"claims":  nil,
+			"ttl":     nil,
+		},
+		Schema: map[string]*framework.FieldSchema{
+			"name":    {Type: framework.TypeString},
+			"pattern": {Type: framework.TypeString},
+			"enabled": {Type: framework.TypeBool, Default: true},
+			"claims":  {Type: framework.TypeMap},
+			"ttl":     {Type: framework.TypeString},
+		},
+	}
+
+	patched, err := patchFieldData(d, map[string]interface{}{"ttl": "0s"})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expected := map[string]interface{}{
+		"name":    "tester",
+		"pattern": "",
+		"enabled": true,
+		"claims":  map[string]interface{}{},
+		"ttl":     "0s",
+	}
+	if diff := deep.Equal(expected, patched.Raw); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := patchFieldData(d, nil, "pattern"); err == nil {
+		t.Error("clearing a required field should have failed")
+	}
+}
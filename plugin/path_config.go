@@ -30,15 +30,65 @@ const (
 	keySignatureAlgorithm  = "sig_alg"
 	keyRSAKeyBits          = "rsa_key_bits"
 	keyRotationDuration    = "key_ttl"
+	keyPrePublishDuration  = "key_prepublish"
+	keyMaxSignaturesPerKey = "max_signatures_per_key"
 	keyTokenTTL            = "jwt_ttl"
+	keyMaxTokenTTL         = "jwt_max_ttl"
 	keySetIAT              = "set_iat"
 	keySetJTI              = "set_jti"
+	keyJTIStrategy         = "jti_strategy"
 	keySetNBF              = "set_nbf"
+	keyClockSkew           = "clock_skew"
 	keyAudiencePattern     = "audience_pattern"
 	keySubjectPattern      = "subject_pattern"
 	keyMaxAllowedAudiences = "max_audiences"
+	keyAllowedAudiences    = "allowed_audiences"
+	keyAllowedACRValues    = "allowed_acr_values"
+	keyAllowedAMRValues    = "allowed_amr_values"
 	keyAllowedClaims       = "allowed_claims"
 	keyAllowedHeaders      = "allowed_headers"
+	keyDefaultClaims       = "default_claims"
+	keyDiscoveryMetadata   = "discovery_metadata"
+	keyRedactedClaims      = "redacted_claims"
+	keySignerType          = "signer_type"
+	keyTransitAddress      = "transit_address"
+	keyTransitToken        = "transit_token"
+	keyTransitNamespace    = "transit_namespace"
+	keyTransitMount        = "transit_mount"
+	keyTransitKeyName      = "transit_key_name"
+	keyAWSKMSKeyID         = "awskms_key_id"
+	keyAWSKMSRegion        = "awskms_region"
+	keyAWSKMSAccessKeyID   = "awskms_access_key_id"
+	keyAWSKMSSecretKey     = "awskms_secret_access_key"
+	keyAWSKMSSessionToken  = "awskms_session_token"
+	keyAWSKMSEndpoint      = "awskms_endpoint"
+	keyGCPKMSKeyName       = "gcpkms_key_name"
+	keyGCPKMSCredentials   = "gcpkms_credentials"
+	keyGCPKMSEndpoint      = "gcpkms_endpoint"
+	keyAzureKVVaultURL     = "azurekv_vault_url"
+	keyAzureKVKeyName      = "azurekv_key_name"
+	keyAzureKVTenantID     = "azurekv_tenant_id"
+	keyAzureKVClientID     = "azurekv_client_id"
+	keyAzureKVClientSecret = "azurekv_client_secret"
+	keyPKCS11Library       = "pkcs11_library"
+	keyPKCS11Slot          = "pkcs11_slot"
+	keyPKCS11PIN           = "pkcs11_pin"
+	keyPKCS11KeyLabel      = "pkcs11_key_label"
+	keyKeyIDStrategy       = "kid_strategy"
+	keyKeyIDPrefix         = "kid_prefix"
+	keyUnauthenticatedKeys = "unauthenticated_keys"
+	keyLeaseTokens         = "lease_tokens"
+	keyPeriodicTidy        = "periodic_tidy"
+	keyStrictIssuer        = "strict_issuer"
+	keyIssuerMode          = "issuer_mode"
+	keyIssuanceLogSize     = "issuance_log_size"
+	keyLogSignDecisions    = "log_sign_decisions"
+	keyOPAURL              = "opa_url"
+	keyOPAToken            = "opa_token"
+	keyOPATimeout          = "opa_timeout"
+	keyAllowNonFIPS        = "allow_non_fips_algorithms"
+	keyResponseWrapTTL     = "response_wrap_ttl"
+	keyJWKSCacheTTL        = "jwks_cache_ttl"
 )
 
 func pathConfig(b *backend) *framework.Path {
@@ -53,14 +103,30 @@ func pathConfig(b *backend) *framework.Path {
 				Type:        framework.TypeInt,
 				Description: `Size of generated RSA keys, when signature algorithm is one of the allowed RSA signing algorithm.`,
 			},
+			keyAllowNonFIPS: {
+				Type:        framework.TypeBool,
+				Description: `Allow signature algorithms which aren't FIPS approved (ES256K).`,
+			},
 			keyRotationDuration: {
 				Type:        framework.TypeString,
 				Description: `Duration a specific key will be used to sign new tokens.`,
 			},
+			keyPrePublishDuration: {
+				Type:        framework.TypeString,
+				Description: `Duration a new key is published before it is used to sign new tokens.`,
+			},
+			keyMaxSignaturesPerKey: {
+				Type:        framework.TypeInt,
+				Description: `Number of signatures after which a key is rotated, in addition to 'key_ttl'; unlimited when 0.`,
+			},
 			keyTokenTTL: {
 				Type:        framework.TypeString,
 				Description: `Duration a token is valid for (mapped to the 'exp' claim).`,
 			},
+			keyMaxTokenTTL: {
+				Type:        framework.TypeString,
+				Description: `Maximum duration a token is valid for, including those of roles; defaults to the max lease ttl.`,
+			},
 			keySetIAT: {
 				Type:        framework.TypeBool,
 				Description: `Whether or not the backend should generate and set the 'iat' claim.`,
@@ -69,13 +135,43 @@ func pathConfig(b *backend) *framework.Path {
 				Type:        framework.TypeBool,
 				Description: `Whether or not the backend should generate and set the 'jti' claim.`,
 			},
+			keyJTIStrategy: {
+				Type: framework.TypeString,
+				Description: `How token ids (jti) are generated; 'friendly' (default), 'uuid', 'ulid', 'random'
+(128-bit hex) or 'counter'.`,
+			},
 			keySetNBF: {
 				Type:        framework.TypeBool,
 				Description: `Whether or not the backend should generate and set the 'nbf' claim.`,
 			},
-			keyIssuer: {
+			keyClockSkew: {
 				Type:        framework.TypeString,
-				Description: `Value to set as the 'iss' claim. Claim is omitted if empty.`,
+				Description: `Duration the 'iat' & 'nbf' claims are back-dated by, tolerating clock drift at verifiers.`,
+			},
+			keyResponseWrapTTL: {
+				Type: framework.TypeString,
+				Description: `TTL sign responses are response wrapped with, when not requested by callers; responses are
+returned unwrapped when 0 (the default).`,
+			},
+			keyJWKSCacheTTL: {
+				Type: framework.TypeString,
+				Description: `Duration verifiers can cache JWKS & PEM bundle responses for ('Cache-Control' max-age);
+responses are not cacheable when 0 (the default).`,
+			},
+			keyIssuer: {
+				Type: framework.TypeString,
+				Description: `Issuer identifier published in the OpenID discovery document; can include the
+'{{mount_path}}' & '{{namespace}}' placeholders.`,
+			},
+			keyIssuerMode: {
+				Type: framework.TypeString,
+				Description: `How the issuer is determined; 'manual' (default) uses 'issuer', 'auto' derives it from
+the cluster's API address and the mount path.`,
+			},
+			keyStrictIssuer: {
+				Type: framework.TypeBool,
+				Description: `Require issuers of the config & roles to be absolute https URLs, removing trailing
+slashes when written.`,
 			},
 			keyAudiencePattern: {
 				Type:        framework.TypeString,
@@ -89,15 +185,185 @@ func pathConfig(b *backend) *framework.Path {
 				Type:        framework.TypeInt,
 				Description: `Maximum number of allowed audiences, or -1 for no limit.`,
 			},
+			keyAllowedAudiences: {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Audiences ('aud' claim) tokens can have, as exact values; any audience when empty.`,
+			},
+			keyAllowedACRValues: {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Values the OIDC 'acr' claim can have; any value when empty.`,
+			},
+			keyAllowedAMRValues: {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Values the OIDC 'amr' claim can contain; any value when empty.`,
+			},
 			keyAllowedClaims: {
 				Type: framework.TypeStringSlice,
 				Description: `Claims which are able to be set in addition to ones generated by the backend.
 Note: 'aud' and 'sub' should be in this list if you would like to set them.`,
 			},
+			keyDefaultClaims: {
+				Type:        framework.TypeMap,
+				Description: `Claims set on every issued JWT, unless provided by the role or the sign request.`,
+			},
+			keyDiscoveryMetadata: {
+				Type:        framework.TypeMap,
+				Description: `Additional fields of the OpenID Connect discovery document (e.g. 'token_endpoint' or 'scopes_supported').`,
+			},
+			keyRedactedClaims: {
+				Type:        framework.TypeStringSlice,
+				Description: `Claims whose values are replaced by an HMAC in error messages & issuance records.`,
+			},
 			keyAllowedHeaders: {
 				Type:        framework.TypeStringSlice,
 				Description: `Headers which are able to be set in addition to ones generated by the backend.`,
 			},
+			keySignerType: {
+				Type:        framework.TypeString,
+				Description: `Where signing keys are held; 'local' (generated and stored by the backend), 'transit', 'awskms', 'gcpkms', 'azurekv' or 'pkcs11'.`,
+			},
+			keyTransitAddress: {
+				Type:        framework.TypeString,
+				Description: `Address of the Vault server hosting the Transit secrets engine. Defaults to VAULT_ADDR.`,
+			},
+			keyTransitToken: {
+				Type:         framework.TypeString,
+				Description:  `Token used to access the Transit secrets engine.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyTransitNamespace: {
+				Type:        framework.TypeString,
+				Description: `Namespace of the Transit secrets engine.`,
+			},
+			keyTransitMount: {
+				Type:        framework.TypeString,
+				Description: `Mount path of the Transit secrets engine. Defaults to 'transit'.`,
+			},
+			keyTransitKeyName: {
+				Type:        framework.TypeString,
+				Description: `Name of the Transit key used to sign tokens.`,
+			},
+			keyAWSKMSKeyID: {
+				Type:        framework.TypeString,
+				Description: `Id or ARN of the asymmetric AWS KMS key used to sign tokens.`,
+			},
+			keyAWSKMSRegion: {
+				Type:        framework.TypeString,
+				Description: `Region of the AWS KMS key. Defaults to the region of the AWS SDK's default configuration (e.g. AWS_REGION).`,
+			},
+			keyAWSKMSAccessKeyID: {
+				Type:        framework.TypeString,
+				Description: `AWS access key id, overriding the AWS SDK's default credential chain.`,
+			},
+			keyAWSKMSSecretKey: {
+				Type:         framework.TypeString,
+				Description:  `AWS secret access key of the access key id.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyAWSKMSSessionToken: {
+				Type:        framework.TypeString,
+				Description: `AWS session token of the access key id, when it is temporary.`,
+			},
+			keyAWSKMSEndpoint: {
+				Type:        framework.TypeString,
+				Description: `Overrides the AWS KMS endpoint (e.g. for VPC endpoints).`,
+			},
+			keyGCPKMSKeyName: {
+				Type:        framework.TypeString,
+				Description: `Resource name of the asymmetric Cloud KMS key used to sign tokens (projects/*/locations/*/keyRings/*/cryptoKeys/*).`,
+			},
+			keyGCPKMSCredentials: {
+				Type:         framework.TypeString,
+				Description:  `Service account key file (JSON). Defaults to GOOGLE_APPLICATION_CREDENTIALS or the metadata server.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyGCPKMSEndpoint: {
+				Type:        framework.TypeString,
+				Description: `Overrides the Cloud KMS endpoint (e.g. for Private Service Connect).`,
+			},
+			keyAzureKVVaultURL: {
+				Type:        framework.TypeString,
+				Description: `URL of the Azure Key Vault or Managed HSM holding the key (e.g. https://myvault.vault.azure.net).`,
+			},
+			keyAzureKVKeyName: {
+				Type:        framework.TypeString,
+				Description: `Name of the Azure Key Vault key used to sign tokens.`,
+			},
+			keyAzureKVTenantID: {
+				Type:        framework.TypeString,
+				Description: `Tenant id of the service principal. Defaults to AZURE_TENANT_ID.`,
+			},
+			keyAzureKVClientID: {
+				Type:        framework.TypeString,
+				Description: `Client id of the service principal or user assigned managed identity. Defaults to AZURE_CLIENT_ID.`,
+			},
+			keyAzureKVClientSecret: {
+				Type:         framework.TypeString,
+				Description:  `Client secret of the service principal. Defaults to AZURE_CLIENT_SECRET; when unavailable the managed identity is used.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyPKCS11Library: {
+				Type:        framework.TypeString,
+				Description: `Path of the PKCS#11 module (shared library) provided by the HSM vendor.`,
+			},
+			keyPKCS11Slot: {
+				Type:        framework.TypeInt,
+				Description: `Id of the slot holding the token containing the key.`,
+			},
+			keyPKCS11PIN: {
+				Type:         framework.TypeString,
+				Description:  `PIN of the token's user.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyPKCS11KeyLabel: {
+				Type:        framework.TypeString,
+				Description: `Label of the key pair used to sign tokens.`,
+			},
+			keyKeyIDStrategy: {
+				Type:        framework.TypeString,
+				Description: `How key ids (kid) are generated; 'hash' (default), 'thumbprint' (RFC 7638) or 'counter'.`,
+			},
+			keyKeyIDPrefix: {
+				Type:        framework.TypeString,
+				Description: `Prefix of key ids generated by the 'counter' strategy.`,
+			},
+			keyUnauthenticatedKeys: {
+				Type:        framework.TypeBool,
+				Default:     true,
+				Description: `Whether the JWKS, discovery document & status lists can be read without a token. Takes effect when the plugin is reloaded.`,
+			},
+			keyLeaseTokens: {
+				Type:        framework.TypeBool,
+				Default:     true,
+				Description: `Whether signed tokens are returned with a lease; revoking the lease revokes the token.`,
+			},
+			keyPeriodicTidy: {
+				Type:        framework.TypeBool,
+				Default:     true,
+				Description: `Whether expired state is removed periodically, as by 'tidy'.`,
+			},
+			keyIssuanceLogSize: {
+				Type:        framework.TypeInt,
+				Description: `Number of most recently issued tokens recorded (see 'issuances/'); disabled when 0.`,
+			},
+			keyLogSignDecisions: {
+				Type:        framework.TypeBool,
+				Description: `Whether the decisions of sign requests are logged at debug level.`,
+			},
+			keyOPAURL: {
+				Type: framework.TypeString,
+				Description: `URL of the OPA Data API document deciding if tokens are issued, e.g.
+'http://opa:8181/v1/data/jwt/allow'. Set to empty to disable the check.`,
+			},
+			keyOPAToken: {
+				Type:         framework.TypeString,
+				Description:  `Bearer token used to authenticate with OPA.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyOPATimeout: {
+				Type:        framework.TypeString,
+				Description: `Duration allowed for OPA decisions; defaults to 5s.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -110,6 +376,9 @@ Note: 'aud' and 'sub' should be in this list if you would like to set them.`,
 			logical.UpdateOperation: &framework.PathOperation{
 				Callback: b.pathConfigWrite,
 			},
+			logical.PatchOperation: &framework.PathOperation{
+				Callback: b.pathConfigPatch,
+			},
 			logical.DeleteOperation: &framework.PathOperation{
 				Callback: b.pathConfigDelete,
 			},
@@ -147,6 +416,19 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.SignatureAlgorithm = jose.SignatureAlgorithm(newSignatureAlgorithmName)
 	}
 
+	if newAllowNonFIPS, ok := d.GetOk(keyAllowNonFIPS); ok {
+		config.AllowNonFIPSAlgorithms = newAllowNonFIPS.(bool)
+		if !config.AllowNonFIPSAlgorithms {
+			if resp, err := b.checkKeySetsFIPS(ctx, req.Storage); resp != nil || err != nil {
+				return resp, err
+			}
+		}
+	}
+
+	if stringInSlice(string(config.SignatureAlgorithm), NonFIPSSignatureAlgorithmNames) && !config.AllowNonFIPSAlgorithms {
+		return logical.ErrorResponse("the %s signature algorithm isn't FIPS approved, '%s' must be enabled", config.SignatureAlgorithm, keyAllowNonFIPS), logical.ErrInvalidRequest
+	}
+
 	if newRawRSAKeyBits, ok := d.GetOk(keyRSAKeyBits); ok {
 		newRSAKeyBits, ok := newRawRSAKeyBits.(int)
 		if !ok {
@@ -166,6 +448,25 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.KeyRotationPeriod = duration
 	}
 
+	if newPrePublishPeriod, ok := d.GetOk(keyPrePublishDuration); ok {
+		duration, err := time.ParseDuration(newPrePublishPeriod.(string))
+		if err != nil {
+			return nil, err
+		}
+		config.KeyPrePublishPeriod = duration
+	}
+
+	if config.KeyPrePublishPeriod < 0 || config.KeyPrePublishPeriod >= config.KeyRotationPeriod {
+		return logical.ErrorResponse("'%s' must be less than '%s'", keyPrePublishDuration, keyRotationDuration), logical.ErrInvalidRequest
+	}
+
+	if newMaxSignatures, ok := d.GetOk(keyMaxSignaturesPerKey); ok {
+		if newMaxSignatures.(int) < 0 {
+			return logical.ErrorResponse("'%s' cannot be negative", keyMaxSignaturesPerKey), logical.ErrInvalidRequest
+		}
+		config.MaxSignaturesPerKey = newMaxSignatures.(int)
+	}
+
 	if newTTL, ok := d.GetOk(keyTokenTTL); ok {
 		duration, err := time.ParseDuration(newTTL.(string))
 		if err != nil {
@@ -174,6 +475,14 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.TokenTTL = duration
 	}
 
+	if newMaxTTL, ok := d.GetOk(keyMaxTokenTTL); ok {
+		duration, err := time.ParseDuration(newMaxTTL.(string))
+		if err != nil {
+			return nil, err
+		}
+		config.MaxTokenTTL = duration
+	}
+
 	if newSetIat, ok := d.GetOk(keySetIAT); ok {
 		config.SetIAT = newSetIat.(bool)
 	}
@@ -182,10 +491,44 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.SetJTI = newSetJTI.(bool)
 	}
 
+	if newJTIStrategy, ok := d.GetOk(keyJTIStrategy); ok {
+		if !stringInSlice(newJTIStrategy.(string), AllowedJTIStrategies) {
+			return logical.ErrorResponse("unknown/unsupported jti strategy, must be one of %s", AllowedJTIStrategies), logical.ErrInvalidRequest
+		}
+		config.JTIStrategy = newJTIStrategy.(string)
+	}
+
 	if newSetNBF, ok := d.GetOk(keySetNBF); ok {
 		config.SetNBF = newSetNBF.(bool)
 	}
 
+	if newClockSkew, ok := d.GetOk(keyClockSkew); ok {
+		duration, err := time.ParseDuration(newClockSkew.(string))
+		if err != nil {
+			return nil, err
+		}
+		if duration < 0 {
+			return logical.ErrorResponse("'%s' cannot be negative", keyClockSkew), logical.ErrInvalidRequest
+		}
+		config.ClockSkew = duration
+	}
+
+	if newResponseWrapTTL, ok := d.GetOk(keyResponseWrapTTL); ok {
+		duration, err := time.ParseDuration(newResponseWrapTTL.(string))
+		if err != nil || duration < 0 {
+			return logical.ErrorResponse("invalid '%s', must be a non-negative duration", keyResponseWrapTTL), logical.ErrInvalidRequest
+		}
+		config.ResponseWrapTTL = duration
+	}
+
+	if newJWKSCacheTTL, ok := d.GetOk(keyJWKSCacheTTL); ok {
+		duration, err := time.ParseDuration(newJWKSCacheTTL.(string))
+		if err != nil || duration < 0 {
+			return logical.ErrorResponse("invalid '%s', must be a non-negative duration", keyJWKSCacheTTL), logical.ErrInvalidRequest
+		}
+		config.JWKSCacheTTL = duration
+	}
+
 	if newAudiencePattern, ok := d.GetOk(keyAudiencePattern); ok {
 		config.AudiencePattern = newAudiencePattern.(string)
 		_, err := regexp.Compile(config.AudiencePattern)
@@ -206,6 +549,18 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.MaxAudiences = newMaxAudiences.(int)
 	}
 
+	if newAllowedAudiences, ok := d.GetOk(keyAllowedAudiences); ok {
+		config.AllowedAudiences = newAllowedAudiences.([]string)
+	}
+
+	if newAllowedACRValues, ok := d.GetOk(keyAllowedACRValues); ok {
+		config.AllowedACRValues = newAllowedACRValues.([]string)
+	}
+
+	if newAllowedAMRValues, ok := d.GetOk(keyAllowedAMRValues); ok {
+		config.AllowedAMRValues = newAllowedAMRValues.([]string)
+	}
+
 	if newAllowedClaims, ok := d.GetOk(keyAllowedClaims); ok {
 
 		// Check allowed claims doesn't contain reserved claims
@@ -218,6 +573,40 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.AllowedClaims = newAllowedClaims.([]string)
 	}
 
+	if newDefaultClaims, ok := d.GetOk(keyDefaultClaims); ok {
+
+		// Check default claims doesn't contain reserved claims
+		for defaultClaim := range newDefaultClaims.(map[string]interface{}) {
+			if stringInSlice(defaultClaim, ReservedClaims) {
+				return logical.ErrorResponse("'%s' claim is reserved and not permitted in default_claims", defaultClaim), logical.ErrInvalidRequest
+			}
+		}
+
+		config.DefaultClaims = newDefaultClaims.(map[string]interface{})
+	}
+
+	if newDiscoveryMetadata, ok := d.GetOk(keyDiscoveryMetadata); ok {
+
+		// Check discovery metadata doesn't contain fields derived from the issuer & keys
+		for field := range newDiscoveryMetadata.(map[string]interface{}) {
+			if stringInSlice(field, ReservedDiscoveryMetadata) {
+				return logical.ErrorResponse("'%s' is generated and not permitted in %s", field, keyDiscoveryMetadata), logical.ErrInvalidRequest
+			}
+		}
+
+		config.DiscoveryMetadata = newDiscoveryMetadata.(map[string]interface{})
+	}
+
+	if newRedactedClaims, ok := d.GetOk(keyRedactedClaims); ok {
+		for _, claim := range newRedactedClaims.([]string) {
+			if claim == "" {
+				return logical.ErrorResponse("'%s' cannot contain empty claim names", keyRedactedClaims), logical.ErrInvalidRequest
+			}
+		}
+
+		config.RedactedClaims = newRedactedClaims.([]string)
+	}
+
 	if newAllowedHeaders, ok := d.GetOk(keyAllowedHeaders); ok {
 
 		// Check allowed headers doesn't contain reserved headers
@@ -230,10 +619,242 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		config.AllowedHeaders = newAllowedHeaders.([]string)
 	}
 
+	if newSignerType, ok := d.GetOk(keySignerType); ok {
+		if !stringInSlice(newSignerType.(string), AllowedSignerTypes) {
+			return logical.ErrorResponse("unknown/unsupported signer type, must be one of %s", AllowedSignerTypes), logical.ErrInvalidRequest
+		}
+		config.SignerType = newSignerType.(string)
+	}
+
+	if config.SignerType == SignerTypeTransit {
+		if config.Transit == nil {
+			config.Transit = &TransitConfig{Mount: DefaultTransitMount}
+		}
+		if newAddress, ok := d.GetOk(keyTransitAddress); ok {
+			config.Transit.Address = newAddress.(string)
+		}
+		if newToken, ok := d.GetOk(keyTransitToken); ok {
+			config.Transit.Token = newToken.(string)
+		}
+		if newNamespace, ok := d.GetOk(keyTransitNamespace); ok {
+			config.Transit.Namespace = newNamespace.(string)
+		}
+		if newMount, ok := d.GetOk(keyTransitMount); ok {
+			config.Transit.Mount = newMount.(string)
+		}
+		if newKeyName, ok := d.GetOk(keyTransitKeyName); ok {
+			config.Transit.KeyName = newKeyName.(string)
+		}
+		if config.Transit.KeyName == "" {
+			return logical.ErrorResponse("'%s' is required when using the transit signer", keyTransitKeyName), logical.ErrInvalidRequest
+		}
+	}
+
+	if config.SignerType == SignerTypeAWSKMS {
+		if config.AWSKMS == nil {
+			config.AWSKMS = &AWSKMSConfig{}
+		}
+		if newKeyID, ok := d.GetOk(keyAWSKMSKeyID); ok {
+			config.AWSKMS.KeyID = newKeyID.(string)
+		}
+		if newRegion, ok := d.GetOk(keyAWSKMSRegion); ok {
+			config.AWSKMS.Region = newRegion.(string)
+		}
+		if newAccessKeyID, ok := d.GetOk(keyAWSKMSAccessKeyID); ok {
+			config.AWSKMS.AccessKeyID = newAccessKeyID.(string)
+		}
+		if newSecretKey, ok := d.GetOk(keyAWSKMSSecretKey); ok {
+			config.AWSKMS.SecretAccessKey = newSecretKey.(string)
+		}
+		if newSessionToken, ok := d.GetOk(keyAWSKMSSessionToken); ok {
+			config.AWSKMS.SessionToken = newSessionToken.(string)
+		}
+		if newEndpoint, ok := d.GetOk(keyAWSKMSEndpoint); ok {
+			config.AWSKMS.Endpoint = newEndpoint.(string)
+		}
+		if config.AWSKMS.KeyID == "" {
+			return logical.ErrorResponse("'%s' is required when using the awskms signer", keyAWSKMSKeyID), logical.ErrInvalidRequest
+		}
+	}
+
+	if config.SignerType == SignerTypeGCPKMS {
+		if config.GCPKMS == nil {
+			config.GCPKMS = &GCPKMSConfig{}
+		}
+		if newKeyName, ok := d.GetOk(keyGCPKMSKeyName); ok {
+			config.GCPKMS.KeyName = newKeyName.(string)
+		}
+		if newCredentials, ok := d.GetOk(keyGCPKMSCredentials); ok {
+			config.GCPKMS.Credentials = newCredentials.(string)
+		}
+		if newEndpoint, ok := d.GetOk(keyGCPKMSEndpoint); ok {
+			config.GCPKMS.Endpoint = newEndpoint.(string)
+		}
+		if config.GCPKMS.KeyName == "" {
+			return logical.ErrorResponse("'%s' is required when using the gcpkms signer", keyGCPKMSKeyName), logical.ErrInvalidRequest
+		}
+	}
+
+	if config.SignerType == SignerTypeAzureKV {
+		if config.AzureKV == nil {
+			config.AzureKV = &AzureKeyVaultConfig{}
+		}
+		if newVaultURL, ok := d.GetOk(keyAzureKVVaultURL); ok {
+			config.AzureKV.VaultURL = newVaultURL.(string)
+		}
+		if newKeyName, ok := d.GetOk(keyAzureKVKeyName); ok {
+			config.AzureKV.KeyName = newKeyName.(string)
+		}
+		if newTenantID, ok := d.GetOk(keyAzureKVTenantID); ok {
+			config.AzureKV.TenantID = newTenantID.(string)
+		}
+		if newClientID, ok := d.GetOk(keyAzureKVClientID); ok {
+			config.AzureKV.ClientID = newClientID.(string)
+		}
+		if newClientSecret, ok := d.GetOk(keyAzureKVClientSecret); ok {
+			config.AzureKV.ClientSecret = newClientSecret.(string)
+		}
+		if config.AzureKV.VaultURL == "" || config.AzureKV.KeyName == "" {
+			return logical.ErrorResponse("'%s' and '%s' are required when using the azurekv signer", keyAzureKVVaultURL, keyAzureKVKeyName), logical.ErrInvalidRequest
+		}
+	}
+
+	if config.SignerType == SignerTypePKCS11 {
+		if config.PKCS11 == nil {
+			config.PKCS11 = &PKCS11Config{}
+		}
+		if newLibrary, ok := d.GetOk(keyPKCS11Library); ok {
+			config.PKCS11.Library = newLibrary.(string)
+		}
+		if newSlot, ok := d.GetOk(keyPKCS11Slot); ok {
+			config.PKCS11.Slot = newSlot.(int)
+		}
+		if newPIN, ok := d.GetOk(keyPKCS11PIN); ok {
+			config.PKCS11.PIN = newPIN.(string)
+		}
+		if newKeyLabel, ok := d.GetOk(keyPKCS11KeyLabel); ok {
+			config.PKCS11.KeyLabel = newKeyLabel.(string)
+		}
+		if config.PKCS11.Library == "" || config.PKCS11.KeyLabel == "" {
+			return logical.ErrorResponse("'%s' and '%s' are required when using the pkcs11 signer", keyPKCS11Library, keyPKCS11KeyLabel), logical.ErrInvalidRequest
+		}
+	}
+
+	if newKeyIDStrategy, ok := d.GetOk(keyKeyIDStrategy); ok {
+		if !stringInSlice(newKeyIDStrategy.(string), AllowedKeyIDStrategies) {
+			return logical.ErrorResponse("unknown/unsupported kid strategy, must be one of %s", AllowedKeyIDStrategies), logical.ErrInvalidRequest
+		}
+		config.KeyIDStrategy = newKeyIDStrategy.(string)
+	}
+
+	if newKeyIDPrefix, ok := d.GetOk(keyKeyIDPrefix); ok {
+		config.KeyIDPrefix = newKeyIDPrefix.(string)
+	}
+
+	if newStrictIssuer, ok := d.GetOk(keyStrictIssuer); ok {
+		config.StrictIssuer = newStrictIssuer.(bool)
+	}
+
+	if newIssuer, ok := d.GetOk(keyIssuer); ok {
+		config.Issuer = newIssuer.(string)
+		if err := validateConfigIssuer(config.Issuer); err != nil {
+			return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+		}
+	}
+
+	if newIssuerMode, ok := d.GetOk(keyIssuerMode); ok {
+		if !stringInSlice(newIssuerMode.(string), AllowedIssuerModes) {
+			return logical.ErrorResponse("unknown issuer mode, must be one of %s", AllowedIssuerModes), logical.ErrInvalidRequest
+		}
+		config.IssuerMode = newIssuerMode.(string)
+	}
+
+	if config.IssuerMode == IssuerModeAuto && config.Issuer != "" {
+		return logical.ErrorResponse("'%s' cannot be configured with the '%s' issuer mode", keyIssuer, IssuerModeAuto), logical.ErrInvalidRequest
+	}
+
+	if config.StrictIssuer && config.Issuer != "" {
+		if config.Issuer, err = normalizeStrictIssuer(config.Issuer); err != nil {
+			return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+		}
+	}
+
+	if newUnauthenticatedKeys, ok := d.GetOk(keyUnauthenticatedKeys); ok {
+		config.AuthenticatedKeys = !newUnauthenticatedKeys.(bool)
+	}
+
+	if newLeaseTokens, ok := d.GetOk(keyLeaseTokens); ok {
+		config.DisableLeases = !newLeaseTokens.(bool)
+	}
+
+	if newPeriodicTidy, ok := d.GetOk(keyPeriodicTidy); ok {
+		config.DisablePeriodicTidy = !newPeriodicTidy.(bool)
+	}
+
+	if newIssuanceLogSize, ok := d.GetOk(keyIssuanceLogSize); ok {
+		if newIssuanceLogSize.(int) < 0 {
+			return logical.ErrorResponse("'%s' cannot be negative", keyIssuanceLogSize), logical.ErrInvalidRequest
+		}
+		config.IssuanceLogSize = newIssuanceLogSize.(int)
+	}
+
+	if newLogSignDecisions, ok := d.GetOk(keyLogSignDecisions); ok {
+		config.LogSignDecisions = newLogSignDecisions.(bool)
+	}
+
+	if newOPAURL, ok := d.GetOk(keyOPAURL); ok {
+		if newOPAURL.(string) == "" {
+			config.OPA = nil
+		} else {
+			if config.OPA == nil {
+				config.OPA = &OPAConfig{}
+			}
+			config.OPA.URL = newOPAURL.(string)
+		}
+	}
+
+	if config.OPA != nil {
+		if newOPAToken, ok := d.GetOk(keyOPAToken); ok {
+			config.OPA.Token = newOPAToken.(string)
+		}
+		if newOPATimeout, ok := d.GetOk(keyOPATimeout); ok {
+			duration, err := time.ParseDuration(newOPATimeout.(string))
+			if err != nil {
+				return logical.ErrorResponse("invalid '%s'", keyOPATimeout), logical.ErrInvalidRequest
+			}
+			config.OPA.Timeout = duration
+		}
+		if err := validateOPAConfig(config.OPA); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	// External keys are not versioned by the plugin
+	if config.KeyIDStrategy == KeyIDStrategyCounter && !config.usesLocalKeys() {
+		return logical.ErrorResponse("the 'counter' kid strategy is only supported by the local signer"), logical.ErrInvalidRequest
+	}
+
+	// Shared secrets & secp256k1 keys are generated & stored by the plugin
+	if (isHMACAlgorithm(config.SignatureAlgorithm) || config.SignatureAlgorithm == ES256K) && !config.usesLocalKeys() {
+		return logical.ErrorResponse("the %s signature algorithm is only supported by the local signer", config.SignatureAlgorithm), logical.ErrInvalidRequest
+	}
+
+	if _, err := newExternalSigner(b.id, config); err != nil {
+		return logical.ErrorResponse("invalid signer configuration: %v", err), logical.ErrInvalidRequest
+	}
+
 	if config.TokenTTL > b.System().MaxLeaseTTL() {
 		return logical.ErrorResponse("'%s' is greater that the max lease ttl", keyTokenTTL), logical.ErrInvalidRequest
 	}
 
+	if config.MaxTokenTTL < 0 || config.MaxTokenTTL > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("'%s' is greater that the max lease ttl", keyMaxTokenTTL), logical.ErrInvalidRequest
+	}
+
+	if config.TokenTTL > b.maxTokenTTL(config) {
+		return logical.ErrorResponse("'%s' is greater than '%s'", keyTokenTTL, keyMaxTokenTTL), logical.ErrInvalidRequest
+	}
+
 	if err := b.saveConfig(ctx, req.Storage, config, req.MountPoint); err != nil {
 		return nil, err
 	}
@@ -241,6 +862,25 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 	return configResponse(config)
 }
 
+// pathConfigPatch updates the config with the fields of the request, resetting those set to null to their defaults.
+func (b *backend) pathConfigPatch(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	defaults, err := configResponse(DefaultConfig(b.System()))
+	if err != nil {
+		return nil, err
+	}
+
+	clearedValues := defaults.Data
+	clearedValues[keyTransitMount] = DefaultTransitMount
+	clearedValues[keyOPATimeout] = "0s"
+
+	patched, err := patchFieldData(d, clearedValues)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return b.pathConfigWrite(ctx, req, patched)
+}
+
 func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 	config, err := b.getConfig(ctx, req.Storage)
 	if err != nil {
@@ -260,22 +900,82 @@ func (b *backend) pathConfigDelete(ctx context.Context, req *logical.Request, _
 }
 
 func configResponse(config *Config) (*logical.Response, error) {
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
 			keySignatureAlgorithm:  config.SignatureAlgorithm,
 			keyRSAKeyBits:          config.RSAKeyBits,
 			keyRotationDuration:    config.KeyRotationPeriod.String(),
+			keyPrePublishDuration:  config.KeyPrePublishPeriod.String(),
+			keyMaxSignaturesPerKey: config.MaxSignaturesPerKey,
 			keyTokenTTL:            config.TokenTTL.String(),
+			keyMaxTokenTTL:         config.MaxTokenTTL.String(),
 			keySetIAT:              config.SetIAT,
 			keySetJTI:              config.SetJTI,
+			keyJTIStrategy:         firstNonEmpty(config.JTIStrategy, DefaultJTIStrategy),
 			keySetNBF:              config.SetNBF,
+			keyClockSkew:           config.ClockSkew.String(),
+			keyResponseWrapTTL:     config.ResponseWrapTTL.String(),
+			keyJWKSCacheTTL:        config.JWKSCacheTTL.String(),
 			keyAudiencePattern:     config.AudiencePattern,
 			keySubjectPattern:      config.SubjectPattern,
 			keyMaxAllowedAudiences: config.MaxAudiences,
+			keyAllowedAudiences:    config.AllowedAudiences,
+			keyAllowedACRValues:    config.AllowedACRValues,
+			keyAllowedAMRValues:    config.AllowedAMRValues,
 			keyAllowedClaims:       config.AllowedClaims,
 			keyAllowedHeaders:      config.AllowedHeaders,
+			keyDefaultClaims:       config.DefaultClaims,
+			keyDiscoveryMetadata:   config.DiscoveryMetadata,
+			keyRedactedClaims:      config.RedactedClaims,
+			keySignerType:          config.SignerType,
+			keyKeyIDStrategy:       config.KeyIDStrategy,
+			keyKeyIDPrefix:         config.KeyIDPrefix,
+			keyIssuer:              config.Issuer,
+			keyIssuerMode:          firstNonEmpty(config.IssuerMode, DefaultIssuerMode),
+			keyStrictIssuer:        config.StrictIssuer,
+			keyUnauthenticatedKeys: !config.AuthenticatedKeys,
+			keyLeaseTokens:         !config.DisableLeases,
+			keyPeriodicTidy:        !config.DisablePeriodicTidy,
+			keyIssuanceLogSize:     config.IssuanceLogSize,
+			keyLogSignDecisions:    config.LogSignDecisions,
+			keyAllowNonFIPS:        config.AllowNonFIPSAlgorithms,
 		},
-	}, nil
+	}
+
+	// Credentials are write-only and never returned
+	if config.Transit != nil {
+		resp.Data[keyTransitAddress] = config.Transit.Address
+		resp.Data[keyTransitNamespace] = config.Transit.Namespace
+		resp.Data[keyTransitMount] = config.Transit.Mount
+		resp.Data[keyTransitKeyName] = config.Transit.KeyName
+	}
+	if config.AWSKMS != nil {
+		resp.Data[keyAWSKMSKeyID] = config.AWSKMS.KeyID
+		resp.Data[keyAWSKMSRegion] = config.AWSKMS.Region
+		resp.Data[keyAWSKMSAccessKeyID] = config.AWSKMS.AccessKeyID
+		resp.Data[keyAWSKMSEndpoint] = config.AWSKMS.Endpoint
+	}
+	if config.GCPKMS != nil {
+		resp.Data[keyGCPKMSKeyName] = config.GCPKMS.KeyName
+		resp.Data[keyGCPKMSEndpoint] = config.GCPKMS.Endpoint
+	}
+	if config.AzureKV != nil {
+		resp.Data[keyAzureKVVaultURL] = config.AzureKV.VaultURL
+		resp.Data[keyAzureKVKeyName] = config.AzureKV.KeyName
+		resp.Data[keyAzureKVTenantID] = config.AzureKV.TenantID
+		resp.Data[keyAzureKVClientID] = config.AzureKV.ClientID
+	}
+	if config.PKCS11 != nil {
+		resp.Data[keyPKCS11Library] = config.PKCS11.Library
+		resp.Data[keyPKCS11Slot] = config.PKCS11.Slot
+		resp.Data[keyPKCS11KeyLabel] = config.PKCS11.KeyLabel
+	}
+	if config.OPA != nil {
+		resp.Data[keyOPAURL] = config.OPA.URL
+		resp.Data[keyOPATimeout] = config.OPA.Timeout.String()
+	}
+
+	return resp, nil
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -301,20 +1001,108 @@ Configure the backend.
 `
 
 const pathConfigHelpDesc = `
-Configure the backend.
+Configure the backend. Patching the config updates the provided fields, resetting
+those set to null to their defaults.
 
 sig_alg:		  Signature algorithm used to sign new tokens.
+                  The HMAC algorithms (HS256, HS384, HS512) sign with shared secrets, read at 'secret'.
+                  ES256K (secp256k1) requires allow_non_fips_algorithms.
 rsa_key_bits:	  Size of generate RSA keys, when using RSA signature algorithms.
+allow_non_fips_algorithms:
+                  Allow signature algorithms which aren't FIPS approved (ES256K), for the
+                  config & key sets; defaults to false.
 key_ttl:          Duration before a key stops signing new tokens and a new one is generated.
 		          After this period the public key will still be available to verify JWTs.
+key_prepublish:   Duration a new key is published in the JWKS before it starts signing
+                  tokens, allowing verifiers to refresh cached key sets. Must be less
+                  than key_ttl; defaults to 0 (keys sign as soon as they are created).
+max_signatures_per_key:
+                  Number of signatures after which a key is rotated, in addition to
+                  key_ttl, bounding the use of each key. Unlimited when 0 (the default).
 jwt_ttl:          Duration before a token expires.
+jwt_max_ttl:      Maximum duration before a token expires, capping the TTLs of roles;
+                  defaults to the max lease ttl.
 set_iat:          Whether or not the backend should generate and set the 'iat' claim.
 set_jti:          Whether or not the backend should generate and set the 'jti' claim.
+jti_strategy:     How token ids (jti) are generated; 'friendly' (default) friendly-id encoded
+                  UUIDs, 'uuid' random UUIDs, 'ulid' ULIDs, 'random' 128-bit hex ids, or
+                  'counter' sequential ids, which reveal the number of issued tokens.
 set_nbf:          Whether or not the backend should generate and set the 'nbf' claim.
-issuer:           Value to set as the 'iss' claim. Claim omitted if empty.
+clock_skew:       Duration the 'iat' & 'nbf' claims are back-dated by, tolerating clock
+                  drift at verifiers; defaults to 0.
+response_wrap_ttl:
+                  TTL sign responses are response wrapped with when callers don't request
+                  wrapping, so tokens are only readable by unwrapping them; responses are
+                  returned unwrapped when 0 (the default).
+jwks_cache_ttl:   Duration verifiers can cache JWKS (& PEM bundle) responses for, set as the
+                  'max-age' of their 'Cache-Control' header; not cacheable when 0 (the
+                  default). Keep it below 'key_prepublish', so new keys are fetched before
+                  they sign tokens. Responses carry an 'ETag'; 'If-None-Match' is answered
+                  with 304 Not Modified when passed through to the mount.
+issuer:           Issuer identifier published in the OpenID discovery document. Roles
+                  set the 'iss' claim of the tokens they sign. The '{{mount_path}}' &
+                  '{{namespace}}' placeholders are replaced with the paths of the mount and
+                  its namespace.
+issuer_mode:      How the issuer is determined; 'manual' (default) uses 'issuer', while 'auto'
+                  derives it from the cluster's API address ('VAULT_API_ADDR' of the plugin's
+                  environment) and the mount path, e.g. https://vault.example.com/v1/jwt.
+                  Roles without an 'issuer' then sign with the derived issuer.
+strict_issuer:    Require issuers of the config & roles to be absolute https URLs, without a
+                  query or fragment; trailing slashes are removed when issuers are written.
 audience_pattern: Regular expression which must match incoming 'aud' claims.
 subject_pattern:  Regular expression which must match incoming 'sub' claims.
 max_audiences:    Maximum number of allowed audiences, or -1 for no limit.
+allowed_audiences: Audiences ('aud' claim) tokens can have, as exact values; in addition to
+                  the audience pattern. Any audience is allowed when empty.
+allowed_acr_values:
+                  Values the OIDC 'acr' claim can have; any value when empty.
+allowed_amr_values:
+                  Values the OIDC 'amr' claim can contain; any value when empty.
 allowed_claims:   Claims which are able to be set in addition to ones generated by the backend.
                   Note: 'aud' and 'sub' should be in this list if you would like to set them.
+default_claims:   Claims set on every issued JWT (e.g. 'env' or 'cluster'), unless provided by
+                  the role or the sign request.
+discovery_metadata:
+                  Additional fields of the discovery document (e.g. 'token_endpoint' or
+                  'scopes_supported'), for relying parties requiring them; endpoints hosted
+                  elsewhere can be advertised. The issuer, key set & signing algorithms are
+                  generated and can't be set.
+redacted_claims:  Claims whose values (e.g. emails) are replaced by an HMAC in error messages,
+                  which audit devices record in plain text, and in issuance records.
+signer_type:      Where signing keys are held; 'local' (default), 'transit', 'awskms',
+                  'gcpkms', 'azurekv' or 'pkcs11'.
+transit_*:        Address, token, namespace, mount and key name of the Transit key used
+                  to sign tokens when signer_type is 'transit'.
+awskms_*:         Key id, region, credentials and endpoint of the AWS KMS key used to
+                  sign tokens when signer_type is 'awskms'.
+gcpkms_*:         Key name, credentials and endpoint of the Cloud KMS key used to sign
+                  tokens when signer_type is 'gcpkms'.
+azurekv_*:        Vault url, key name and credentials of the Azure Key Vault key used to
+                  sign tokens when signer_type is 'azurekv'.
+pkcs11_*:         Library, slot, pin and key label of the HSM key used to sign tokens
+                  when signer_type is 'pkcs11'.
+kid_strategy:     How key ids (kid) are generated; 'hash' (default) derives them from
+                  the key name & version, 'thumbprint' uses the RFC 7638 JWK thumbprint
+                  and 'counter' uses kid_prefix followed by the key version. Changing
+                  the strategy changes the ids of existing keys.
+kid_prefix:       Prefix of key ids generated by the 'counter' strategy.
+unauthenticated_keys: Whether the JWKS, discovery document & status lists can be read without a
+                  token (default true). Vault applies the change when the plugin is
+                  reloaded or the backend is remounted.
+lease_tokens:     Whether signed tokens are returned with a lease expiring with the
+                  token (default true). Revoking the lease revokes the token's jti.
+periodic_tidy:    Whether expired state is removed periodically, as by 'tidy' (default true).
+issuance_log_size:
+                  Number of most recently issued tokens recorded, with their role & requester,
+                  listed by 'issuances/'. Disabled when 0 (the default).
+log_sign_decisions:
+                  Whether the decisions of sign requests (the role matched, the restriction
+                  rejecting a claim value, the effective TTL) are logged at debug level;
+                  values of redacted claims are logged as their HMAC. Default false.
+opa_url:          URL of an Open Policy Agent Data API document (e.g.
+                  'http://opa:8181/v1/data/jwt/allow') queried with the claims, role &
+                  requester identity of each token; tokens are only signed when the
+                  decision is to allow. Set to empty to disable the check.
+opa_token:        Bearer token used to authenticate with OPA.
+opa_timeout:      Duration allowed for OPA decisions; defaults to 5s.
 `
@@ -206,9 +206,77 @@ func TestWriteInvalidConfig(t *testing.T) {
 	}
 
 	resp, err = writeConfig(b, storage, map[string]interface{}{
-		keySignatureAlgorithm: "HS256",
+		keySignatureAlgorithm: "PS256",
 	})
 	if err == nil {
 		t.Errorf("Should have errored but got response: %#v", resp)
 	}
+
+	resp, err = writeConfig(b, storage, map[string]interface{}{
+		keyTokenTTL:    "10m",
+		keyMaxTokenTTL: "5m",
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+	resp, err = writeConfig(b, storage, map[string]interface{}{
+		keyOPAURL: "opa:8181/v1/data/jwt/allow",
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+}
+
+func patchConfig(b *backend, storage *logical.Storage, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.PatchOperation,
+		Path:       "config",
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestPatchConfig(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keySubjectPattern:  "^svc-",
+		keyAudiencePattern: "^api$",
+		keyTokenTTL:        updatedTTL,
+	}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	resp, err := patchConfig(b, storage, map[string]interface{}{keyAudiencePattern: "^web$"})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal("^web$", resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("audience pattern", diff)
+	}
+	if diff := deep.Equal("^svc-", resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("subject pattern should be unchanged", diff)
+	}
+
+	// Nulls reset fields to their defaults
+	resp, err = patchConfig(b, storage, map[string]interface{}{keySubjectPattern: nil, keyTokenTTL: nil, keyUnauthenticatedKeys: nil})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal(DefaultSubjectPattern, resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("cleared subject pattern", diff)
+	}
+	if diff := deep.Equal(DefaultTokenTTL, resp.Data[keyTokenTTL]); diff != nil {
+		t.Error("cleared token ttl", diff)
+	}
+	if diff := deep.Equal(true, resp.Data[keyUnauthenticatedKeys]); diff != nil {
+		t.Error("cleared unauthenticated keys", diff)
+	}
+	if diff := deep.Equal("^web$", resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("audience pattern should be unchanged", diff)
+	}
 }
@@ -0,0 +1,153 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	keyVerify = "verify"
+)
+
+func pathDecode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "decode",
+		Fields: map[string]*framework.FieldSchema{
+			keyToken: {
+				Type:         framework.TypeString,
+				Description:  `Compact serialized JWT to decode.`,
+				Required:     true,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyVerify: {
+				Type:        framework.TypeBool,
+				Description: `Also verify the token against the keys of this mount, as 'verify' does.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathDecodeWrite,
+			},
+		},
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+func (b *backend) pathDecodeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rawToken := d.Get(keyToken).(string)
+	if rawToken == "" {
+		return logical.ErrorResponse("'%s' is required", keyToken), logical.ErrInvalidRequest
+	}
+
+	headers, claims, err := decodeCompactToken(rawToken)
+	if err != nil {
+		return logical.ErrorResponse("malformed token: %v", err), logical.ErrInvalidRequest
+	}
+
+	data := map[string]interface{}{
+		keyHeaders: headers,
+		keyClaims:  claims,
+	}
+
+	// Times are decoded for readability, the claims are left as they are
+	for _, claim := range []string{"exp", "nbf", "iat"} {
+		if seconds, ok := claims[claim].(float64); ok {
+			data[claim] = time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if d.Get(keyVerify).(bool) {
+		_, kid, err := b.verifyToken(ctx, req.Storage, req.MountPoint, rawToken, jwt.Expected{Time: time.Now()})
+		if err != nil {
+			var invalid *invalidTokenError
+			if !errors.As(err, &invalid) {
+				return nil, err
+			}
+			data[keyValid] = false
+			data[keyError] = invalid.Error()
+		} else {
+			data[keyValid] = true
+			data[keyKeyID] = kid
+		}
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+// decodeCompactToken decodes the header & claims of a compact serialized JWS, without verifying it.
+func decodeCompactToken(rawToken string) (map[string]interface{}, map[string]interface{}, error) {
+	parts := strings.Split(rawToken, ".")
+	switch len(parts) {
+	case 3:
+	case 5:
+		return nil, nil, fmt.Errorf("encrypted tokens cannot be decoded")
+	default:
+		return nil, nil, fmt.Errorf("compact JWS format must have three parts")
+	}
+
+	var headers map[string]interface{}
+	if err := decodeTokenPart(parts[0], &headers); err != nil {
+		return nil, nil, fmt.Errorf("invalid header: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, nil, fmt.Errorf("invalid claims: %v", err)
+	}
+
+	return headers, claims, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON object of a compact serialized token.
+func decodeTokenPart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+const pathDecodeHelpSyn = `
+Decode a token.
+`
+
+const pathDecodeHelpDesc = `
+Decode the headers & claims of a compact serialized JWT, for debugging tokens without
+external tooling. Tokens are decoded without verification, unless requested; tokens
+of any issuer can be decoded.
+
+verify: Also verify the token against the keys of this mount, as 'verify' does,
+        reporting whether it is 'valid', with the 'kid' of the verifying key, or
+        the 'error' that caused verification to fail.
+
+Returns the 'headers' & 'claims' of the token, and its 'exp', 'nbf' & 'iat' claims
+as RFC 3339 dates.
+`
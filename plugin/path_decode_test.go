@@ -0,0 +1,115 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func decodeToken(b *backend, storage *logical.Storage, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "decode",
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestDecode(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp, err := decodeToken(b, storage, map[string]interface{}{keyToken: token})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	headers := resp.Data[keyHeaders].(map[string]interface{})
+	if diff := deep.Equal(parsed.Headers[0].KeyID, headers["kid"]); diff != nil {
+		t.Error("kid", diff)
+	}
+	if diff := deep.Equal(string(DefaultSignatureAlgorithm), headers["alg"]); diff != nil {
+		t.Error("alg", diff)
+	}
+
+	claims := resp.Data[keyClaims].(map[string]interface{})
+	if diff := deep.Equal(unsafeClaims(t, token), claims); diff != nil {
+		t.Error("claims", diff)
+	}
+
+	expiration := time.Unix(int64(claims["exp"].(float64)), 0).UTC().Format(time.RFC3339)
+	if diff := deep.Equal(expiration, resp.Data["exp"]); diff != nil {
+		t.Error("exp", diff)
+	}
+
+	if _, ok := resp.Data[keyValid]; ok {
+		t.Error("tokens should only be verified when requested")
+	}
+
+	resp, err = decodeToken(b, storage, map[string]interface{}{keyToken: token, keyVerify: true})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal(true, resp.Data[keyValid]); diff != nil {
+		t.Error("valid", diff)
+	}
+	if diff := deep.Equal(parsed.Headers[0].KeyID, resp.Data[keyKeyID]); diff != nil {
+		t.Error("kid", diff)
+	}
+
+	// Tokens failing verification are still decoded
+	tampered := token[:len(token)-4] + "AAAA"
+
+	resp, err = decodeToken(b, storage, map[string]interface{}{keyToken: tampered, keyVerify: true})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal(false, resp.Data[keyValid]); diff != nil {
+		t.Error("valid", diff)
+	}
+	if diff := deep.Equal(claims, resp.Data[keyClaims]); diff != nil {
+		t.Error("claims", diff)
+	}
+
+	for _, malformed := range []string{"not-a-token", "a.b.c", "a.b.c.d.e"} {
+		if resp, err := decodeToken(b, storage, map[string]interface{}{keyToken: malformed}); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%s should have failed", malformed)
+		}
+	}
+}
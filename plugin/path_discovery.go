@@ -0,0 +1,102 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+)
+
+func pathDiscovery(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `\.well-known/openid-configuration`,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathDiscoveryRead,
+			},
+		},
+
+		HelpSynopsis:    pathDiscoveryHelpSyn,
+		HelpDescription: pathDiscoveryHelpDesc,
+	}
+}
+
+func (b *backend) pathDiscoveryRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.hasIssuer() {
+		return logical.ErrorResponse("'%s' must be configured to publish a discovery document", keyIssuer), nil
+	}
+
+	issuer, err := b.mountIssuer(config, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return discoveryResponse(issuer, config)
+}
+
+// ReservedDiscoveryMetadata are the fields of the discovery document derived from the issuer & its keys, which
+// can't be overridden by the configured metadata.
+var ReservedDiscoveryMetadata = []string{"issuer", "jwks_uri", "id_token_signing_alg_values_supported"}
+
+// discoveryResponse returns the discovery document of the issuer, whose tokens are signed as configured.
+func discoveryResponse(issuer string, config *Config) (*logical.Response, error) {
+
+	discovery := map[string]interface{}{
+		"response_types_supported": []string{"id_token"},
+		"subject_types_supported":  []string{"public"},
+	}
+	for field, value := range config.DiscoveryMetadata {
+		discovery[field] = value
+	}
+
+	// The issuer is expected to be the mount's URL (e.g. https://vault.example.com/v1/jwt), or that of
+	// a hosted issuer (e.g. https://vault.example.com/v1/jwt/issuers/<name>), making the discovery document & key set resolvable relative to it.
+	discovery["issuer"] = issuer
+	discovery["jwks_uri"] = strings.TrimSuffix(issuer, "/") + "/jwks"
+	discovery["id_token_signing_alg_values_supported"] = []string{string(config.SignatureAlgorithm)}
+
+	discoveryJson, err := json.Marshal(discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     discoveryJson,
+		},
+	}, nil
+}
+
+const pathDiscoveryHelpSyn = `
+Get the OpenID Connect discovery document.
+`
+
+const pathDiscoveryHelpDesc = `
+Get the OpenID Connect discovery document describing the configured issuer
+and the location of its JSON Web Key Set.
+`
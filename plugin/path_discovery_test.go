@@ -0,0 +1,212 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func fetchDiscovery(b *backend, storage *logical.Storage) (map[string]interface{}, error) {
+	return fetchDiscoveryPath(b, storage, ".well-known/openid-configuration")
+}
+
+func fetchDiscoveryPath(b *backend, storage *logical.Storage, path string) (map[string]interface{}, error) {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       path,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, resp.Error()
+	}
+
+	rawBody, ok := resp.Data[logical.HTTPRawBody].([]byte)
+	if !ok {
+		return nil, errors.New("no raw body returned")
+	}
+
+	var discovery map[string]interface{}
+	if err := json.Unmarshal(rawBody, &discovery); err != nil {
+		return nil, err
+	}
+
+	return discovery, nil
+}
+
+func TestDiscovery(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := fetchDiscovery(b, storage); err == nil {
+		t.Error("discovery should fail without an issuer")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyIssuer: "https://vault.example.com/v1/jwt/",
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	discovery, err := fetchDiscovery(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("https://vault.example.com/v1/jwt/", discovery["issuer"]); diff != nil {
+		t.Error("issuer", diff)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/jwt/jwks", discovery["jwks_uri"]); diff != nil {
+		t.Error("jwks_uri", diff)
+	}
+	if diff := deep.Equal([]interface{}{string(DefaultSignatureAlgorithm)}, discovery["id_token_signing_alg_values_supported"]); diff != nil {
+		t.Error("signing algorithms", diff)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyIssuer: "https://vault.example.com/v1/{{mount_path}}",
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	discovery, err = fetchDiscovery(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("https://vault.example.com/v1/test", discovery["issuer"]); diff != nil {
+		t.Error("issuer", diff)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/test/jwks", discovery["jwks_uri"]); diff != nil {
+		t.Error("jwks_uri", diff)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyIssuer: "https://{{identity.entity.name}}.example.com",
+	}); err == nil {
+		t.Error("issuer with templates should have failed")
+	}
+}
+
+func TestDiscoveryMetadata(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyIssuer: "https://vault.example.com/v1/jwt",
+		keyDiscoveryMetadata: map[string]interface{}{
+			"token_endpoint":           "https://auth.example.com/token",
+			"scopes_supported":         []string{"openid"},
+			"response_types_supported": []string{"code", "id_token"},
+		},
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	discovery, err := fetchDiscovery(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal("https://auth.example.com/token", discovery["token_endpoint"]); diff != nil {
+		t.Error("token_endpoint", diff)
+	}
+	if diff := deep.Equal([]interface{}{"openid"}, discovery["scopes_supported"]); diff != nil {
+		t.Error("scopes_supported", diff)
+	}
+	if diff := deep.Equal([]interface{}{"code", "id_token"}, discovery["response_types_supported"]); diff != nil {
+		t.Error("response_types_supported should be overridden", diff)
+	}
+	if diff := deep.Equal([]interface{}{"public"}, discovery["subject_types_supported"]); diff != nil {
+		t.Error("subject_types_supported", diff)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/jwt/jwks", discovery["jwks_uri"]); diff != nil {
+		t.Error("jwks_uri", diff)
+	}
+
+	for _, field := range ReservedDiscoveryMetadata {
+		if _, err := writeConfig(b, storage, map[string]interface{}{
+			keyDiscoveryMetadata: map[string]interface{}{field: "https://evil.example.com"},
+		}); err == nil {
+			t.Errorf("'%s' should not be configurable", field)
+		}
+	}
+
+	if _, err := patchConfig(b, storage, map[string]interface{}{
+		keyDiscoveryMetadata: nil,
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	discovery, err = fetchDiscovery(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if _, ok := discovery["token_endpoint"]; ok {
+		t.Error("token_endpoint should be reset")
+	}
+	if diff := deep.Equal([]interface{}{"id_token"}, discovery["response_types_supported"]); diff != nil {
+		t.Error("response_types_supported should be reset", diff)
+	}
+}
+
+func TestAuthenticatedKeys(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = new(logical.InmemStorage)
+	config.BackendUUID = uuid.New().String()
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal(publicKeyPaths, b.SpecialPaths().Unauthenticated); diff != nil {
+		t.Error("public key paths should be unauthenticated by default", diff)
+	}
+
+	storage := &config.StorageView
+	if _, err := writeConfig(b.(*backend), storage, map[string]interface{}{
+		keyUnauthenticatedKeys: false,
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Special paths are applied when the plugin is reloaded
+	b, err = Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if len(b.SpecialPaths().Unauthenticated) != 0 {
+		t.Errorf("public key paths should require authentication: %v", b.SpecialPaths().Unauthenticated)
+	}
+	if diff := deep.Equal(sealWrapStoragePaths, b.SpecialPaths().SealWrapStorage); diff != nil {
+		t.Error("seal wrapped paths should be kept", diff)
+	}
+}
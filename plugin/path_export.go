@@ -0,0 +1,354 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	keyIncludeKeys     = "include_keys"
+	keyExportVersion   = "version"
+	keyExportConfig    = "config"
+	keyExportKeySets   = "key_sets"
+	keyExportTemplates = "role_templates"
+	keyExportRoles     = "roles"
+	keyExportKeys      = "keys"
+)
+
+// exportVersion is the version of the format of exported documents.
+const exportVersion = 1
+
+func pathExport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "export",
+		Fields: map[string]*framework.FieldSchema{
+			keyIncludeKeys: {
+				Type:        framework.TypeBool,
+				Description: `Whether the private keys are exported; requires the response to be wrapped.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathExportRead,
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							keyExportKeys: {
+								Type:         framework.TypeMap,
+								Description:  `Backups of the keyrings, by name.`,
+								DisplayAttrs: sensitiveDisplayAttrs,
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    pathExportHelpSyn,
+		HelpDescription: pathExportHelpDesc,
+	}
+}
+
+func pathImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "import",
+		Fields: map[string]*framework.FieldSchema{
+			keyExportVersion: {
+				Type:        framework.TypeInt,
+				Description: `Version of the format of the document.`,
+			},
+			keyExportConfig: {
+				Type:        framework.TypeMap,
+				Description: `Configuration, as written to 'config'.`,
+			},
+			keyExportKeySets: {
+				Type:        framework.TypeMap,
+				Description: `Key sets by name, as written to 'keys/:name'.`,
+			},
+			keyExportTemplates: {
+				Type:        framework.TypeMap,
+				Description: `Role templates by name, as written to 'role-templates/:name'.`,
+			},
+			keyExportRoles: {
+				Type:        framework.TypeMap,
+				Description: `Roles by name, as written to 'roles/:name'.`,
+			},
+			keyExportKeys: {
+				Type:         framework.TypeMap,
+				Description:  `Backups of the keyrings, by name, as exported.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathImportWrite,
+			},
+		},
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathExportRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	includeKeys := d.Get(keyIncludeKeys).(bool)
+
+	if includeKeys && (req.WrapInfo == nil || req.WrapInfo.TTL == 0) {
+		return logical.ErrorResponse("exporting keys requires a wrapped response (e.g. 'vault read -wrap-ttl=5m')"), logical.ErrInvalidRequest
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	configResp, err := configResponse(config)
+	if err != nil {
+		return nil, err
+	}
+
+	keySetNames, err := b.listKeySets(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keySets := map[string]interface{}{}
+	for _, name := range keySetNames {
+		keySet, err := b.getKeySet(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if keySet != nil {
+			keySets[name] = keySetResponse(keySet).Data
+		}
+	}
+
+	templateNames, err := req.Storage.List(ctx, roleTemplatesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]interface{}{}
+	for _, name := range templateNames {
+		template, err := b.getRoleTemplate(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if template != nil {
+			templates[name] = template.Fields
+		}
+	}
+
+	roleNames, err := req.Storage.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := map[string]interface{}{}
+	for _, name := range roleNames {
+		role, err := b.getStoredRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			roles[name] = exportedRoleData(role)
+		}
+	}
+
+	data := map[string]interface{}{
+		keyExportVersion:   exportVersion,
+		keyExportConfig:    configResp.Data,
+		keyExportKeySets:   keySets,
+		keyExportTemplates: templates,
+		keyExportRoles:     roles,
+	}
+
+	if includeKeys {
+		keys := map[string]interface{}{}
+
+		err := b.forEachKeyring(ctx, req.Storage, config, req.MountPoint, func(policy *keysutil.Policy, _ *Config) error {
+			backup, err := backupKeyring(ctx, req.Storage, policy)
+			if err != nil {
+				return err
+			}
+			keys[policy.Name] = backup
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		data[keyExportKeys] = keys
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if version := d.Get(keyExportVersion).(int); version > exportVersion {
+		return logical.ErrorResponse("unsupported document version %d, must be at most %d", version, exportVersion), logical.ErrInvalidRequest
+	}
+
+	keys := d.Get(keyExportKeys).(map[string]interface{})
+	for name, backup := range keys {
+		if _, ok := backup.(string); !ok || !validKeyringName(name) {
+			return logical.ErrorResponse("invalid keyring backup '%s'", name), logical.ErrInvalidRequest
+		}
+	}
+
+	// Keys are restored last, replacing any generated by a change of key format
+	if config := d.Get(keyExportConfig).(map[string]interface{}); len(config) > 0 {
+		if resp, err := b.importEntry(ctx, req, "config", config); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	for name, keySet := range d.Get(keyExportKeySets).(map[string]interface{}) {
+		if resp, err := b.importEntry(ctx, req, "keys/"+name, keySet); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	for name, template := range d.Get(keyExportTemplates).(map[string]interface{}) {
+		if resp, err := b.importEntry(ctx, req, "role-templates/"+name, template); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	for name, role := range d.Get(keyExportRoles).(map[string]interface{}) {
+		if resp, err := b.importEntry(ctx, req, "roles/"+name, role); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	for name, backup := range keys {
+		if err := b.lockManager.RestorePolicy(ctx, req.Storage, name, backup.(string), true); err != nil {
+			return nil, fmt.Errorf("failed to restore keyring '%s': %w", name, err)
+		}
+	}
+
+	return nil, nil
+}
+
+// importEntry writes the exported data to the path, creating or updating its entry with the path's own
+// validation; an error response is returned when the data is rejected.
+func (b *backend) importEntry(ctx context.Context, req *logical.Request, path string, data interface{}) (*logical.Response, error) {
+	entryData, ok := data.(map[string]interface{})
+	if !ok {
+		return logical.ErrorResponse("invalid entry '%s'", path), logical.ErrInvalidRequest
+	}
+
+	entryReq := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       path,
+		Data:       entryData,
+		Storage:    req.Storage,
+		MountPoint: req.MountPoint,
+		EntityID:   req.EntityID,
+	}
+
+	checkFound, exists, err := b.HandleExistenceCheck(ctx, entryReq)
+	if err != nil {
+		return logical.ErrorResponse("invalid entry '%s': %s", path, err), logical.ErrInvalidRequest
+	}
+	if checkFound && !exists {
+		entryReq.Operation = logical.CreateOperation
+	}
+
+	resp, err := b.HandleRequest(ctx, entryReq)
+	if resp != nil && resp.IsError() {
+		return logical.ErrorResponse("invalid entry '%s': %s", path, resp.Error()), logical.ErrInvalidRequest
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// backupKeyring encodes the keyring's policy & archived keys, in the format restored by keysutil.
+func backupKeyring(ctx context.Context, stg logical.Storage, policy *keysutil.Policy) (string, error) {
+	policy.Lock(false)
+	defer policy.Unlock()
+
+	archive, err := policy.LoadArchive(ctx, stg)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := jsonutil.EncodeJSON(&keysutil.KeyData{Policy: policy, ArchivedKeys: archive})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// validKeyringName checks if the name is that of the main keyring, or a keyring of a role or key set.
+func validKeyringName(name string) bool {
+	if name == mainKeyName {
+		return true
+	}
+	for _, prefix := range []string{roleKeyringPrefix, keySetKeyringPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return keySetNameRegex.MatchString(strings.TrimPrefix(name, prefix))
+		}
+	}
+	return false
+}
+
+const pathExportHelpSyn = `
+Export the configuration, roles & keys of the backend.
+`
+
+const pathExportHelpDesc = `
+Export the configuration, key sets, role templates & roles of the backend as a single
+document, which can be written to 'import' (e.g. on another cluster). Credentials of the
+configuration are write-only and not exported.
+
+include_keys: Whether the private keys of the local keyrings are exported. The response
+              must be wrapped, e.g. 'vault read -wrap-ttl=5m jwt/export include_keys=true'.
+`
+
+const pathImportHelpSyn = `
+Import a document exported by 'export'.
+`
+
+const pathImportHelpDesc = `
+Import a document exported by 'export', creating or updating the configuration, key sets,
+role templates & roles it contains, as if written to their paths, and restoring its
+keyrings, replacing existing keys. Entries not in the document are kept. Entries are
+imported in turn, and a rejected entry stops the import, leaving earlier entries imported.
+
+version:        Version of the format of the document.
+config:         Configuration; credentials must be added, as they are not exported.
+key_sets:       Key sets, by name.
+role_templates: Role templates, by name.
+roles:          Roles, by name.
+keys:           Backups of the keyrings, by name.
+`
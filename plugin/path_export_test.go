@@ -0,0 +1,154 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func exportMount(b *backend, storage *logical.Storage, includeKeys bool) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "export",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyIncludeKeys: includeKeys},
+		MountPoint: "test",
+	}
+	if includeKeys {
+		req.WrapInfo = &logical.RequestWrapInfo{TTL: time.Minute}
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func importMount(b *backend, storage *logical.Storage, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "import",
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestExportImport(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyRotationDuration: "6h", keyAllowedClaims: []string{"sub", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := writeRoleTemplate(b, storage, "base", map[string]interface{}{keyIssuer: "base.example.com", keyTTL: "5m"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	roles := map[string]map[string]interface{}{
+		"tester":    {keyIssuer: "tester.example.com", keyClaims: map[string]interface{}{"scope": "read"}},
+		"isolated":  {keyIssuer: "isolated.example.com", keyIsolatedKeyring: true},
+		"bound":     {keyIssuer: "bound.example.com", keyKey: "rsa"},
+		"templated": {keyIssuer: "templated.example.com", keyRoleTemplate: "base"},
+	}
+	for name, data := range roles {
+		if resp, err := writeRoleData(b, storage, name, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	tokens := map[string]string{}
+	for name := range roles {
+		tokens[name] = signToken(t, b, storage, name, map[string]interface{}{})
+	}
+
+	// Keys are only exported in wrapped responses
+	if resp, err := exportMount(b, storage, false); err != nil || resp.IsError() || resp.Data[keyExportKeys] != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "export",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyIncludeKeys: true},
+		MountPoint: "test",
+	}
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("unwrapped export of keys should have failed")
+	}
+
+	resp, err := exportMount(b, storage, true)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	exported := resp.Data
+
+	var keyrings []string
+	for name := range exported[keyExportKeys].(map[string]interface{}) {
+		keyrings = append(keyrings, name)
+	}
+	sort.Strings(keyrings)
+	if diff := deep.Equal([]string{"keyset/rsa", "main", "role/isolated"}, keyrings); diff != nil {
+		t.Error("keys", diff)
+	}
+
+	target, targetStorage := getTestBackend(t)
+
+	if resp, err := importMount(target, targetStorage, exported); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Tokens signed by the source verify with the imported keys
+	for name, token := range tokens {
+		verifyToken(t, target, targetStorage, map[string]interface{}{"token": token})
+		if diff := deep.Equal(unsafeClaims(t, token)["iss"], roles[name][keyIssuer]); diff != nil {
+			t.Error(name, diff)
+		}
+	}
+
+	resp, err = exportMount(target, targetStorage, true)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	// Empty lists are read as nil once stored
+	deep.NilSlicesAreEmpty = true
+	defer func() { deep.NilSlicesAreEmpty = false }()
+	for _, field := range []string{keyExportConfig, keyExportKeySets, keyExportTemplates, keyExportRoles} {
+		if diff := deep.Equal(exported[field], resp.Data[field]); diff != nil {
+			t.Error(field, diff)
+		}
+	}
+
+	invalid := []map[string]interface{}{
+		{keyExportVersion: exportVersion + 1},
+		{keyExportKeys: map[string]interface{}{"policy/other": "e30="}},
+		{keyExportRoles: map[string]interface{}{"tester": map[string]interface{}{keySubjectPattern: "("}}},
+	}
+	for _, data := range invalid {
+		if resp, err := importMount(target, targetStorage, data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error("import should have failed", data)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"time"
+)
+
+const (
+	keyTokenTypeHint = "token_type_hint"
+)
+
+func pathIntrospect(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "introspect",
+		Fields: map[string]*framework.FieldSchema{
+			keyToken: {
+				Type:         framework.TypeString,
+				Description:  `Token to introspect.`,
+				Required:     true,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyTokenTypeHint: {
+				Type:        framework.TypeString,
+				Description: `Hint about the type of the token; accepted for compatibility and ignored.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIntrospectWrite,
+			},
+		},
+		HelpSynopsis:    pathIntrospectHelpSyn,
+		HelpDescription: pathIntrospectHelpDesc,
+	}
+}
+
+func (b *backend) pathIntrospectWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+
+	// Per RFC 7662, tokens that cannot be verified are reported as inactive, without a reason
+	introspection := map[string]interface{}{"active": false}
+
+	claims, _, err := b.verifyToken(ctx, req.Storage, req.MountPoint, d.Get(keyToken).(string), jwt.Expected{Time: time.Now()})
+	if err != nil {
+		var invalid *invalidTokenError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+	} else {
+		introspection = claims
+		introspection["active"] = true
+	}
+
+	introspectionJson, err := json.Marshal(introspection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     introspectionJson,
+		},
+	}, nil
+}
+
+const pathIntrospectHelpSyn = `
+Introspect a token (RFC 7662).
+`
+
+const pathIntrospectHelpDesc = `
+Introspect a token signed by this backend, returning an RFC 7662 token
+introspection response. Valid tokens are reported as 'active' along with their
+claims (e.g. 'exp', 'sub', 'aud'); all other tokens are reported as inactive.
+`
@@ -0,0 +1,86 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func introspectToken(t *testing.T, b *backend, storage *logical.Storage, token string) map[string]interface{} {
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "introspect",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyToken: token,
+		},
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var introspection map[string]interface{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &introspection); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return introspection
+}
+
+func TestIntrospect(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan", "aud": "nimbus"})
+
+	introspection := introspectToken(t, b, storage, token)
+
+	if diff := deep.Equal(true, introspection["active"]); diff != nil {
+		t.Fatal("active", diff)
+	}
+	if diff := deep.Equal("Zapp Brannigan", introspection["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+	if diff := deep.Equal("nimbus", introspection["aud"]); diff != nil {
+		t.Error("aud", diff)
+	}
+	if diff := deep.Equal("tester.example.com", introspection["iss"]); diff != nil {
+		t.Error("iss", diff)
+	}
+	if _, ok := introspection["exp"].(float64); !ok {
+		t.Error("exp missing")
+	}
+
+	// Invalid tokens are only reported as inactive
+	introspection = introspectToken(t, b, storage, "not-a-token")
+
+	if diff := deep.Equal(map[string]interface{}{"active": false}, introspection); diff != nil {
+		t.Error("inactive", diff)
+	}
+}
@@ -0,0 +1,293 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	keyIssuanceID = "id"
+	keySince      = "since"
+	keyUntil      = "until"
+
+	issuancesPath = "issuances/"
+)
+
+// Issuance records a token issued by a role, for incident response.
+type Issuance struct {
+	// JTI is the 'jti' claim of the token, if any.
+	JTI string
+
+	// Role is the name of the role which issued the token.
+	Role string
+
+	// Subject is the 'sub' claim of the token, if any.
+	Subject string
+
+	// Audience is the 'aud' claim of the token, if any.
+	Audience []string
+
+	// IssuedAt is the time the token was issued.
+	IssuedAt time.Time
+
+	// ExpiresAt is the 'exp' claim of the token.
+	ExpiresAt time.Time
+
+	// EntityID is the id of the entity which requested the token.
+	EntityID string
+}
+
+func pathIssuances(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issuances/" + framework.GenericNameRegex(keyIssuanceID),
+			Fields: map[string]*framework.FieldSchema{
+				keyIssuanceID: {
+					Type:        framework.TypeString,
+					Description: `Id of the issuance record.`,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuancesRead,
+				},
+			},
+			HelpSynopsis:    pathIssuancesHelpSyn,
+			HelpDescription: pathIssuancesHelpDesc,
+		},
+		{
+			Pattern: "issuances/?$",
+			Fields: map[string]*framework.FieldSchema{
+				keyRoleName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Only list tokens issued by the role.`,
+				},
+				keySince: {
+					Type:        framework.TypeString,
+					Description: `Only list tokens issued at or after the time; an RFC 3339 date or unix time.`,
+				},
+				keyUntil: {
+					Type:        framework.TypeString,
+					Description: `Only list tokens issued before the time; an RFC 3339 date or unix time.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathIssuancesList,
+				},
+			},
+			HelpSynopsis:    pathIssuancesListHelpSyn,
+			HelpDescription: pathIssuancesListHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathIssuancesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get(keyRoleName).(string)
+
+	var since, until time.Time
+	if rawSince, ok := d.GetOk(keySince); ok {
+		var err error
+		if since, err = parseExpiresAt(rawSince.(string)); err != nil {
+			return logical.ErrorResponse("invalid '%s', must be an RFC 3339 date or unix time", keySince), logical.ErrInvalidRequest
+		}
+	}
+	if rawUntil, ok := d.GetOk(keyUntil); ok {
+		var err error
+		if until, err = parseExpiresAt(rawUntil.(string)); err != nil {
+			return logical.ErrorResponse("invalid '%s', must be an RFC 3339 date or unix time", keyUntil), logical.ErrInvalidRequest
+		}
+	}
+
+	entries, err := req.Storage.List(ctx, issuancesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	keyInfo := map[string]interface{}{}
+
+	for _, id := range entries {
+		issuance, err := b.getIssuance(ctx, req.Storage, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuance == nil {
+			continue
+		}
+
+		if roleName != "" && issuance.Role != roleName {
+			continue
+		}
+		if (!since.IsZero() && issuance.IssuedAt.Before(since)) || (!until.IsZero() && !issuance.IssuedAt.Before(until)) {
+			continue
+		}
+
+		keys = append(keys, id)
+		keyInfo[id] = issuance.toResponseData()
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *backend) pathIssuancesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	issuance, err := b.getIssuance(ctx, req.Storage, d.Get(keyIssuanceID).(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuance == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: issuance.toResponseData(),
+	}, nil
+}
+
+// Return response data for an issuance record
+func (i *Issuance) toResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"jti":       i.JTI,
+		"role":      i.Role,
+		"sub":       i.Subject,
+		"aud":       i.Audience,
+		"iat":       i.IssuedAt.Unix(),
+		"exp":       i.ExpiresAt.Unix(),
+		"entity_id": i.EntityID,
+	}
+}
+
+func (b *backend) getIssuance(ctx context.Context, stg logical.Storage, id string) (*Issuance, error) {
+	entry, err := stg.Get(ctx, issuancesPath+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issuance Issuance
+	if err := entry.DecodeJSON(&issuance); err != nil {
+		return nil, err
+	}
+
+	return &issuance, nil
+}
+
+// recordIssuance records the issuance of a token, removing the oldest records beyond the configured size. Records
+// are stored by ULID, so they are listed in the order they were issued.
+func (b *backend) recordIssuance(ctx context.Context, stg logical.Storage, config *Config, issuance *Issuance) error {
+	b.issuanceLock.Lock()
+	defer b.issuanceLock.Unlock()
+
+	id, err := newULID(issuance.IssuedAt)
+	if err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(issuancesPath+id, issuance)
+	if err != nil {
+		return err
+	}
+	if err := stg.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	_, err = trimIssuances(ctx, stg, config.IssuanceLogSize)
+	return err
+}
+
+// tidyIssuances removes the oldest records beyond the configured size, e.g. after the size is reduced or the log
+// disabled, returning the number removed.
+func (b *backend) tidyIssuances(ctx context.Context, stg logical.Storage, config *Config) (int, error) {
+	b.issuanceLock.Lock()
+	defer b.issuanceLock.Unlock()
+
+	return trimIssuances(ctx, stg, config.IssuanceLogSize)
+}
+
+// trimIssuances removes the oldest records beyond size, returning the number removed.
+func trimIssuances(ctx context.Context, stg logical.Storage, size int) (int, error) {
+	entries, err := stg.List(ctx, issuancesPath)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for ; removed < len(entries)-size; removed++ {
+		if err := stg.Delete(ctx, issuancesPath+entries[removed]); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// newIssuance describes the issuance of a token with the claims.
+func newIssuance(req *logical.Request, roleName string, claims map[string]interface{}, issuedAt time.Time, expiresAt time.Time) *Issuance {
+	issuance := &Issuance{
+		Role:      roleName,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+		EntityID:  req.EntityID,
+	}
+
+	issuance.JTI, _ = claims["jti"].(string)
+	issuance.Subject, _ = claims["sub"].(string)
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		issuance.Audience = []string{aud}
+	case []interface{}:
+		for _, entry := range aud {
+			if value, ok := entry.(string); ok {
+				issuance.Audience = append(issuance.Audience, value)
+			}
+		}
+	}
+
+	return issuance
+}
+
+const pathIssuancesHelpSyn = `
+Read the record of an issued token.
+`
+
+const pathIssuancesHelpDesc = `
+Read the record of a token issued by a role; its 'jti', 'sub', 'aud', 'iat' & 'exp'
+claims, the role, and the id of the requesting entity. Tokens are recorded when the
+'issuance_log_size' configuration is positive.
+`
+
+const pathIssuancesListHelpSyn = `
+List the records of issued tokens.
+`
+
+const pathIssuancesListHelpDesc = `
+List the records of issued tokens, in the order they were issued, along with their
+details. Only the most recent 'issuance_log_size' tokens are recorded.
+
+role:  Only list tokens issued by the role.
+since: Only list tokens issued at or after the time; an RFC 3339 date or unix time.
+until: Only list tokens issued before the time; an RFC 3339 date or unix time.
+`
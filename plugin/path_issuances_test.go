@@ -0,0 +1,116 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func listIssuances(t *testing.T, b *backend, storage *logical.Storage, data map[string]interface{}) *logical.Response {
+
+	req := &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "issuances/",
+		Storage:   *storage,
+		Data:      data,
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp
+}
+
+func TestIssuances(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	// Nothing is recorded by default
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+
+	if keys := listIssuances(t, b, storage, nil).Data["keys"]; keys != nil && len(keys.([]string)) != 0 {
+		t.Errorf("unexpected issuances %v", keys)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuanceLogSize: 3}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := writeRole(b, storage, "other", "other.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Fry"})
+	time.Sleep(2 * time.Millisecond)
+	signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Leela", "aud": "nimbus"})
+	time.Sleep(2 * time.Millisecond)
+	signToken(t, b, storage, "other", map[string]interface{}{"sub": "Bender"})
+	time.Sleep(2 * time.Millisecond)
+	signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Kif Kroker"})
+
+	// Only the most recent issuances are kept
+	resp := listIssuances(t, b, storage, nil)
+	keys := resp.Data["keys"].([]string)
+	if diff := deep.Equal(3, len(keys)); diff != nil {
+		t.Fatal(diff)
+	}
+	var subjects []interface{}
+	for _, key := range keys {
+		subjects = append(subjects, resp.Data["key_info"].(map[string]interface{})[key].(map[string]interface{})["sub"])
+	}
+	if diff := deep.Equal([]interface{}{"Leela", "Bender", "Kif Kroker"}, subjects); diff != nil {
+		t.Error(diff)
+	}
+
+	resp = listIssuances(t, b, storage, map[string]interface{}{keyRoleName: "tester"})
+	if diff := deep.Equal([]string{keys[0], keys[2]}, resp.Data["keys"]); diff != nil {
+		t.Error(diff)
+	}
+
+	resp = listIssuances(t, b, storage, map[string]interface{}{keySince: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	if keys, ok := resp.Data["keys"].([]string); ok && len(keys) != 0 {
+		t.Errorf("unexpected issuances %v", keys)
+	}
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "issuances/" + keys[0],
+		Storage:   *storage,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	expected := map[string]interface{}{"role": "tester", "sub": "Leela", "aud": []string{"nimbus"}, "entity_id": ""}
+	for field, value := range expected {
+		if diff := deep.Equal(value, resp.Data[field]); diff != nil {
+			t.Error(field, diff)
+		}
+	}
+	if resp.Data["jti"] == "" {
+		t.Error("missing jti")
+	}
+}
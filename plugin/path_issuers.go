@@ -0,0 +1,516 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	keyIssuerName = "name"
+	keyJWKSURL    = "jwks_url"
+	keyJWKS       = "jwks"
+
+	issuersPath = "issuers/"
+
+	// How long keys fetched from an issuer's JWKS URL are cached
+	issuerKeysCacheTTL = 5 * time.Minute
+)
+
+// TrustedIssuer is an external token issuer whose tokens are accepted as subject tokens for token exchange, or
+// an issuer hosted by this backend, issuing the tokens of the roles bound to it.
+type TrustedIssuer struct {
+	// Issuer is the 'iss' claim of the issuer's tokens.
+	Issuer string
+
+	// JWKSURL is the URL of the issuer's JSON Web Key Set.
+	JWKSURL string
+
+	// JWKS is the issuer's JSON Web Key Set; used instead of fetching it from JWKSURL.
+	JWKS string
+
+	// Key names the key set signing the tokens of an issuer hosted by this backend.
+	Key string
+}
+
+// hosted returns whether the issuer is hosted by this backend, rather than an external issuer.
+func (i *TrustedIssuer) hosted() bool {
+	return i.Key != ""
+}
+
+// issuerKeysCache caches the key sets fetched from trusted issuers' JWKS URLs.
+type issuerKeysCache struct {
+	lock    sync.Mutex
+	entries map[string]cachedIssuerKeys
+}
+
+type cachedIssuerKeys struct {
+	keys    *jose.JSONWebKeySet
+	expires time.Time
+}
+
+func pathIssuers(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issuers/" + framework.GenericNameRegex(keyIssuerName),
+			Fields: map[string]*framework.FieldSchema{
+				keyIssuerName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the trusted issuer.`,
+					Required:    true,
+				},
+				keyIssuer: {
+					Type:        framework.TypeString,
+					Description: `The 'iss' claim of the issuer's tokens.`,
+				},
+				keyJWKSURL: {
+					Type:        framework.TypeString,
+					Description: `URL of the issuer's JSON Web Key Set.`,
+				},
+				keyJWKS: {
+					Type:        framework.TypeString,
+					Description: `The issuer's JSON Web Key Set; used instead of fetching it from 'jwks_url'.`,
+				},
+				keyKey: {
+					Type:        framework.TypeString,
+					Description: `Name of the key set signing the issuer's tokens, hosting the issuer on this backend.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuersRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathIssuersWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathIssuersWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathIssuersDelete,
+				},
+			},
+			ExistenceCheck:  b.pathIssuersExistenceCheck,
+			HelpSynopsis:    pathIssuersHelpSyn,
+			HelpDescription: pathIssuersHelpDesc,
+		},
+		{
+			Pattern: "issuers/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathIssuersList,
+				},
+			},
+			HelpSynopsis:    pathIssuersListHelpSyn,
+			HelpDescription: pathIssuersListHelpDesc,
+		},
+		{
+			Pattern: "issuers/" + framework.GenericNameRegex(keyIssuerName) + "/jwks",
+			Fields: map[string]*framework.FieldSchema{
+				keyIssuerName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the hosted issuer.`,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuerJwksRead,
+				},
+			},
+			HelpSynopsis:    pathIssuerJwksHelpSyn,
+			HelpDescription: pathIssuerJwksHelpDesc,
+		},
+		{
+			Pattern: "issuers/" + framework.GenericNameRegex(keyIssuerName) + `/\.well-known/openid-configuration`,
+			Fields: map[string]*framework.FieldSchema{
+				keyIssuerName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the hosted issuer.`,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuerDiscoveryRead,
+				},
+			},
+			HelpSynopsis:    pathIssuerDiscoveryHelpSyn,
+			HelpDescription: pathIssuerDiscoveryHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathIssuersExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	issuer, err := b.getTrustedIssuer(ctx, req.Storage, d.Get(keyIssuerName).(string))
+	if err != nil {
+		return false, err
+	}
+
+	return issuer != nil, nil
+}
+
+func (b *backend) pathIssuersList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, issuersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathIssuersRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.getTrustedIssuer(ctx, req.Storage, d.Get(keyIssuerName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyIssuer:  issuer.Issuer,
+			keyJWKSURL: issuer.JWKSURL,
+			keyJWKS:    issuer.JWKS,
+			keyKey:     issuer.Key,
+		},
+	}, nil
+}
+
+func (b *backend) pathIssuersWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyIssuerName).(string)
+
+	issuer, err := b.getTrustedIssuer(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		issuer = &TrustedIssuer{}
+	}
+
+	if newIssuer, ok := d.GetOk(keyIssuer); ok {
+		issuer.Issuer = newIssuer.(string)
+	}
+
+	if newJWKSURL, ok := d.GetOk(keyJWKSURL); ok {
+		issuer.JWKSURL = newJWKSURL.(string)
+	}
+
+	if newJWKS, ok := d.GetOk(keyJWKS); ok {
+		issuer.JWKS = newJWKS.(string)
+	}
+
+	if newKey, ok := d.GetOk(keyKey); ok {
+		issuer.Key = newKey.(string)
+	}
+
+	if issuer.Issuer == "" {
+		return logical.ErrorResponse("'%s' is required", keyIssuer), logical.ErrInvalidRequest
+	}
+
+	if issuer.hosted() {
+		if resp, err := b.validateHostedIssuer(ctx, req.Storage, issuer); resp != nil || err != nil {
+			return resp, err
+		}
+	} else if issuer.JWKSURL == "" && issuer.JWKS == "" {
+		return logical.ErrorResponse("one of '%s', '%s' or '%s' is required", keyJWKSURL, keyJWKS, keyKey), logical.ErrInvalidRequest
+	}
+
+	if issuer.JWKS != "" {
+		if err := json.Unmarshal([]byte(issuer.JWKS), &jose.JSONWebKeySet{}); err != nil {
+			return logical.ErrorResponse("invalid '%s': %v", keyJWKS, err), logical.ErrInvalidRequest
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(issuersPath+name, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	// Roles bound to the issuer are cached with it
+	b.cachedRoles.clear()
+
+	return nil, nil
+}
+
+// validateHostedIssuer validates the issuer & key set of an issuer hosted by this backend, normalizing
+// the issuer when strict issuers are configured.
+func (b *backend) validateHostedIssuer(ctx context.Context, stg logical.Storage, issuer *TrustedIssuer) (*logical.Response, error) {
+	if issuer.JWKSURL != "" || issuer.JWKS != "" {
+		return logical.ErrorResponse("'%s' cannot be used with '%s' or '%s'", keyKey, keyJWKSURL, keyJWKS), logical.ErrInvalidRequest
+	}
+
+	config, err := b.getConfig(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.usesLocalKeys() {
+		return logical.ErrorResponse("'%s' is only supported by the local signer", keyKey), logical.ErrInvalidRequest
+	}
+
+	keySet, err := b.getKeySet(ctx, stg, issuer.Key)
+	if err != nil {
+		return nil, err
+	}
+	if keySet == nil {
+		return logical.ErrorResponse("unknown key set '%s'", issuer.Key), logical.ErrInvalidRequest
+	}
+
+	if err := validateConfigIssuer(issuer.Issuer); err != nil {
+		return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+	}
+	if config.StrictIssuer {
+		if issuer.Issuer, err = normalizeStrictIssuer(issuer.Issuer); err != nil {
+			return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+		}
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathIssuersDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyIssuerName).(string)
+
+	roleNames, err := req.Storage.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.IssuerRef == name {
+			return logical.ErrorResponse("issuer '%s' is used by role '%s'", name, roleName), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := req.Storage.Delete(ctx, issuersPath+name); err != nil {
+		return nil, err
+	}
+
+	b.cachedRoles.clear()
+
+	return nil, nil
+}
+
+// getHostedIssuer returns the named issuer hosted by this backend, with the configuration of its key set. An error
+// response is returned when the issuer is unknown or external.
+func (b *backend) getHostedIssuer(ctx context.Context, stg logical.Storage, name string) (*TrustedIssuer, *Config, *logical.Response, error) {
+	issuer, err := b.getTrustedIssuer(ctx, stg, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if issuer == nil || !issuer.hosted() {
+		return nil, nil, logical.ErrorResponse("unknown hosted issuer '%s'", name), nil
+	}
+
+	config, err := b.getConfig(ctx, stg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	keySet, err := b.getKeySet(ctx, stg, issuer.Key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if keySet == nil {
+		return nil, nil, nil, errutil.InternalError{Err: fmt.Sprintf("unknown key set '%s' of issuer '%s'", issuer.Key, name)}
+	}
+
+	return issuer, keySet.config(config), nil, nil
+}
+
+func (b *backend) pathIssuerJwksRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	issuer, keyConfig, resp, err := b.getHostedIssuer(ctx, req.Storage, d.Get(keyIssuerName).(string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	jwkSet, err := b.getKeyringPublicKeys(ctx, req.Storage, keyConfig, keySetKeyringName(issuer.Key), req.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwksResponse(req, keyConfig, jwkSet)
+}
+
+func (b *backend) pathIssuerDiscoveryRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	issuer, keyConfig, resp, err := b.getHostedIssuer(ctx, req.Storage, d.Get(keyIssuerName).(string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	resolved, err := resolveIssuer(issuer.Issuer, req, newIdentityTemplates(b.System(), ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return discoveryResponse(resolved, keyConfig)
+}
+
+// getTrustedIssuer returns the named trusted issuer, or nil if it does not exist.
+func (b *backend) getTrustedIssuer(ctx context.Context, stg logical.Storage, name string) (*TrustedIssuer, error) {
+	entry, err := stg.Get(ctx, issuersPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issuer TrustedIssuer
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, err
+	}
+
+	return &issuer, nil
+}
+
+// findTrustedIssuer returns the trusted issuer of tokens with the given 'iss' claim, or nil if the issuer is not trusted.
+func (b *backend) findTrustedIssuer(ctx context.Context, stg logical.Storage, iss string) (*TrustedIssuer, error) {
+	names, err := stg.List(ctx, issuersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		issuer, err := b.getTrustedIssuer(ctx, stg, name)
+		if err != nil {
+			return nil, err
+		}
+		// Tokens of hosted issuers are verified with the backend's own keys
+		if issuer != nil && !issuer.hosted() && issuer.Issuer == iss {
+			return issuer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// issuerKeys returns the trusted issuer's keys.
+func (b *backend) issuerKeys(ctx context.Context, issuer *TrustedIssuer) (*jose.JSONWebKeySet, error) {
+	if issuer.JWKS != "" {
+		var keys jose.JSONWebKeySet
+		if err := json.Unmarshal([]byte(issuer.JWKS), &keys); err != nil {
+			return nil, err
+		}
+		return &keys, nil
+	}
+
+	b.issuerKeysCache.lock.Lock()
+	defer b.issuerKeysCache.lock.Unlock()
+
+	if cached, ok := b.issuerKeysCache.entries[issuer.JWKSURL]; ok && cached.expires.After(time.Now()) {
+		return cached.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks of issuer '%s' failed (%d)", issuer.Issuer, resp.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, err
+	}
+
+	if b.issuerKeysCache.entries == nil {
+		b.issuerKeysCache.entries = map[string]cachedIssuerKeys{}
+	}
+	b.issuerKeysCache.entries[issuer.JWKSURL] = cachedIssuerKeys{keys: &keys, expires: time.Now().Add(issuerKeysCacheTTL)}
+
+	return &keys, nil
+}
+
+const pathIssuersHelpSyn = `
+Manage trusted & hosted token issuers.
+`
+
+const pathIssuersHelpDesc = `
+Manage external token issuers whose tokens are accepted as subject & actor tokens
+by the 'token-exchange' endpoint. Tokens signed by this backend are always accepted.
+
+Issuers with a 'key' are instead hosted by this backend; roles bound to the issuer
+('issuer_ref') issue its tokens, signed with the key set's keys. Hosted issuers
+publish their keys at 'issuers/<name>/jwks', and their discovery document at
+'issuers/<name>/.well-known/openid-configuration'. Issuers cannot be deleted while
+roles are bound to them.
+
+issuer:   The 'iss' claim of the issuer's tokens.
+jwks_url: URL of the issuer's JSON Web Key Set; fetched keys are cached for 5 minutes.
+jwks:     The issuer's JSON Web Key Set; used instead of fetching it from 'jwks_url'.
+key:      Name of the key set signing the tokens of a hosted issuer.
+`
+
+const pathIssuersListHelpSyn = `
+List the trusted token issuers.
+`
+
+const pathIssuersListHelpDesc = `
+List the trusted token issuers. Only the issuer names are returned, not any values.
+`
+
+const pathIssuerJwksHelpSyn = `
+Get the JSON Web Key Set of a hosted issuer.
+`
+
+const pathIssuerJwksHelpDesc = `
+Get a JSON Web Key Set containing the keys of the key set signing the tokens of
+a hosted issuer.
+`
+
+const pathIssuerDiscoveryHelpSyn = `
+Get the OpenID Connect discovery document of a hosted issuer.
+`
+
+const pathIssuerDiscoveryHelpDesc = `
+Get the OpenID Connect discovery document describing a hosted issuer and the
+location of its JSON Web Key Set; the issuer is expected to be the URL of the
+'issuers/<name>' path, e.g. https://vault.example.com/v1/jwt/issuers/<name>.
+`
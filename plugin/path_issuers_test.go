@@ -0,0 +1,313 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func writeIssuer(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "issuers/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func newIssuerKey(t *testing.T, kid string) (*ecdsa.PrivateKey, string) {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: &privateKey.PublicKey, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"}},
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return privateKey, string(jwks)
+}
+
+func TestTrustedIssuer(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	_, jwks := newIssuerKey(t, "idp-1")
+
+	invalid := map[string]map[string]interface{}{
+		"missing issuer": {keyJWKS: jwks},
+		"missing keys":   {keyIssuer: "https://idp.example.com"},
+		"invalid jwks":   {keyIssuer: "https://idp.example.com", keyJWKS: "not-a-jwks"},
+	}
+
+	for name, data := range invalid {
+		if resp, err := writeIssuer(b, storage, "idp", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "write should have failed")
+		}
+	}
+
+	if resp, err := writeIssuer(b, storage, "idp", map[string]interface{}{keyIssuer: "https://idp.example.com", keyJWKS: jwks}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "issuers/idp",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	expected := map[string]interface{}{
+		keyIssuer:  "https://idp.example.com",
+		keyJWKSURL: "",
+		keyJWKS:    jwks,
+		keyKey:     "",
+	}
+	if diff := deep.Equal(expected, resp.Data); diff != nil {
+		t.Error(diff)
+	}
+
+	issuer, err := b.findTrustedIssuer(context.Background(), *storage, "https://idp.example.com")
+	if err != nil || issuer == nil {
+		t.Fatalf("trusted issuer not found: %v\n", err)
+	}
+
+	keys, err := b.issuerKeys(context.Background(), issuer)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(1, len(keys.Key("idp-1"))); diff != nil {
+		t.Error("issuer keys", diff)
+	}
+
+	req = &logical.Request{
+		Operation:  logical.ListOperation,
+		Path:       "issuers/",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal([]string{"idp"}, resp.Data["keys"]); diff != nil {
+		t.Error("list", diff)
+	}
+
+	req = &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "issuers/idp",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	issuer, err = b.findTrustedIssuer(context.Background(), *storage, "https://idp.example.com")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if issuer != nil {
+		t.Error("deleted issuer still trusted")
+	}
+}
+
+func TestTrustedIssuerJWKSURL(t *testing.T) {
+	b, _ := getTestBackend(t)
+
+	_, jwks := newIssuerKey(t, "idp-1")
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(jwks))
+	}))
+	defer server.Close()
+
+	issuer := &TrustedIssuer{Issuer: "https://idp.example.com", JWKSURL: server.URL}
+
+	for i := 0; i < 2; i++ {
+		keys, err := b.issuerKeys(context.Background(), issuer)
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		if diff := deep.Equal(1, len(keys.Key("idp-1"))); diff != nil {
+			t.Error("issuer keys", diff)
+		}
+	}
+
+	// Fetched keys are cached
+	if diff := deep.Equal(1, fetches); diff != nil {
+		t.Error("fetches", diff)
+	}
+}
+
+func TestHostedIssuers(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	keySetAlgs := map[string]string{"ec": "ES256", "rsa": "RS256"}
+	for name, alg := range keySetAlgs {
+		if resp, err := writeKeySet(b, storage, name, map[string]interface{}{keySignatureAlgorithm: alg}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"unknown key set": {keyIssuer: "https://vault.example.com/v1/jwt/issuers/bad", keyKey: "missing"},
+		"with jwks":       {keyIssuer: "https://vault.example.com/v1/jwt/issuers/bad", keyKey: "ec", keyJWKSURL: "https://idp.example.com/jwks"},
+		"templated":       {keyIssuer: "https://{{identity.entity.name}}.example.com", keyKey: "ec"},
+	}
+
+	for name, data := range invalid {
+		if resp, err := writeIssuer(b, storage, "bad", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "write should have failed")
+		}
+	}
+
+	issuers := map[string]string{"payments": "ec", "shipping": "rsa"}
+	for name, keySet := range issuers {
+		data := map[string]interface{}{keyIssuer: "https://vault.example.com/v1/jwt/issuers/" + name, keyKey: keySet}
+		if resp, err := writeIssuer(b, storage, name, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if resp, err := writeRoleData(b, storage, name, map[string]interface{}{keyIssuerRef: name}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	for name, keySet := range issuers {
+		issuer := "https://vault.example.com/v1/jwt/issuers/" + name
+
+		signed := signToken(t, b, storage, name, map[string]interface{}{})
+		if diff := deep.Equal(issuer, unsafeClaims(t, signed)["iss"]); diff != nil {
+			t.Error(name, "iss", diff)
+		}
+
+		keys, err := fetchJWKSPath(b, storage, "issuers/"+name+"/jwks")
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+
+		token, err := jwt.ParseSigned(signed)
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		if len(keys.Key(token.Headers[0].KeyID)) != 1 {
+			t.Error(name, "signing key not published in the issuer's key set")
+		}
+		if diff := deep.Equal(keySetAlgs[keySet], token.Headers[0].Algorithm); diff != nil {
+			t.Error(name, "alg", diff)
+		}
+
+		discovery, err := fetchDiscoveryPath(b, storage, "issuers/"+name+"/.well-known/openid-configuration")
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		if diff := deep.Equal(issuer, discovery["issuer"]); diff != nil {
+			t.Error(name, "discovery issuer", diff)
+		}
+		if diff := deep.Equal(issuer+"/jwks", discovery["jwks_uri"]); diff != nil {
+			t.Error(name, "discovery jwks_uri", diff)
+		}
+		if diff := deep.Equal([]interface{}{token.Headers[0].Algorithm}, discovery["id_token_signing_alg_values_supported"]); diff != nil {
+			t.Error(name, "discovery algorithms", diff)
+		}
+	}
+
+	// Hosted issuers are not trusted as external issuers
+	issuer, err := b.findTrustedIssuer(context.Background(), *storage, "https://vault.example.com/v1/jwt/issuers/payments")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if issuer != nil {
+		t.Error("hosted issuer found as a trusted issuer")
+	}
+
+	// Roles are bound to either an issuer or a hosted issuer
+	conflicts := map[string]map[string]interface{}{
+		"issuer":  {keyIssuerRef: "payments", keyIssuer: "https://payments.example.com"},
+		"key set": {keyIssuerRef: "payments", keyKey: "ec"},
+		"unknown": {keyIssuerRef: "missing"},
+	}
+	for name, data := range conflicts {
+		if resp, err := writeRoleData(b, storage, "conflict", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "role write should have failed")
+		}
+	}
+
+	// Existing roles are bound by clearing their issuer
+	if resp, err := writeRoleData(b, storage, "legacy", map[string]interface{}{keyIssuer: "https://legacy.example.com"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := patchRole(b, storage, "legacy", map[string]interface{}{keyIssuer: nil, keyIssuerRef: "shipping"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/jwt/issuers/shipping", unsafeClaims(t, signToken(t, b, storage, "legacy", map[string]interface{}{}))["iss"]); diff != nil {
+		t.Error("bound iss", diff)
+	}
+
+	// Issuers & key sets cannot be deleted while bound
+	req := &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "issuers/payments",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting a bound issuer should have failed")
+	}
+	if resp, err := deleteKeySet(b, storage, "ec"); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting the key set of an issuer should have failed")
+	}
+
+	// Updating the issuer updates the tokens of its roles
+	data := map[string]interface{}{keyIssuer: "https://pay.example.com", keyKey: "ec"}
+	if resp, err := writeIssuer(b, storage, "payments", data); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal("https://pay.example.com", unsafeClaims(t, signToken(t, b, storage, "payments", map[string]interface{}{}))["iss"]); diff != nil {
+		t.Error("updated iss", diff)
+	}
+}
@@ -18,48 +18,162 @@ package jwtsecrets
 
 import (
 	"context"
-	"crypto/x509"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
+	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"gopkg.in/square/go-jose.v2"
+	"net/http"
 	"strconv"
+	"strings"
 )
 
-func pathJwks(b *backend) *framework.Path {
-	return &framework.Path{
-		Pattern: "jwks",
-		Operations: map[logical.Operation]framework.OperationHandler{
-			logical.ReadOperation: &framework.PathOperation{
-				Callback: b.pathJwksRead,
+func pathJwks(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "jwks",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathJwksRead,
+				},
 			},
+
+			HelpSynopsis:    pathJwksHelpSyn,
+			HelpDescription: pathJwksHelpDesc,
 		},
+		{
+			Pattern: "jwks/" + framework.GenericNameRegex(keyRoleName),
+			Fields: map[string]*framework.FieldSchema{
+				keyRoleName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the role.`,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathJwksRoleRead,
+				},
+			},
 
-		HelpSynopsis:    pathJwksHelpSyn,
-		HelpDescription: pathJwksHelpDesc,
+			HelpSynopsis:    pathJwksRoleHelpSyn,
+			HelpDescription: pathJwksRoleHelpDesc,
+		},
 	}
 }
 
 func (b *backend) pathJwksRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
 	jwkSet, err := b.getPublicKeys(ctx, req.Storage, req.MountPoint)
 	if err != nil {
 		return nil, err
 	}
 
-	jwkSetJson, err := json.Marshal(map[string]interface{}{"keys": jwkSet.Keys})
+	return jwksResponse(req, config, jwkSet)
+}
+
+func (b *backend) pathJwksRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, roleName, _, err := b.matchRole(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown role"), logical.ErrInvalidRequest
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	return &logical.Response{
+	var jwkSet *jose.JSONWebKeySet
+	if keyring := role.keyring(roleName); keyring != mainKeyName {
+		keyConfig, err := b.roleKeyConfig(ctx, req.Storage, config, role)
+		if err != nil {
+			return nil, err
+		}
+
+		jwkSet, err = b.getKeyringPublicKeys(ctx, req.Storage, keyConfig, keyring, req.MountPoint)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		jwkSet, err = b.getPublicKeys(ctx, req.Storage, req.MountPoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return jwksResponse(req, config, jwkSet)
+}
+
+// jwksResponse returns the raw JWKS response.
+func jwksResponse(req *logical.Request, config *Config, jwkSet *jose.JSONWebKeySet) (*logical.Response, error) {
+
+	// go-jose can't marshal secp256k1 keys
+	keys := make([]interface{}, len(jwkSet.Keys))
+	for idx, key := range jwkSet.Keys {
+		if isSecp256k1Key(key.Key) {
+			keys[idx] = secp256k1JWK(key)
+		} else {
+			keys[idx] = key
+		}
+	}
+
+	jwkSetJson, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKeysResponse(req, config, "application/jwk-set+json", jwkSetJson), nil
+}
+
+// publicKeysResponse returns the raw response publishing public keys; cacheable for the configured JWKS cache TTL,
+// and identified by an ETag, answering requests whose 'If-None-Match' header matches it with 304 Not Modified.
+func publicKeysResponse(req *logical.Request, config *Config, contentType string, body []byte) *logical.Response {
+
+	hash := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(hash[:]) + `"`
+
+	resp := &logical.Response{
 		Data: map[string]interface{}{
-			logical.HTTPStatusCode:  200,
-			logical.HTTPContentType: "application/jwk-set+json",
-			logical.HTTPRawBody:     jwkSetJson,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
 		},
-	}, nil
+		Headers: map[string][]string{"ETag": {etag}},
+	}
+
+	if config.JWKSCacheTTL > 0 {
+		resp.Data[logical.HTTPCacheControlHeader] = fmt.Sprintf("public, max-age=%d", int64(config.JWKSCacheTTL.Seconds()))
+	}
+
+	if etagMatches(requestHeader(req, "If-None-Match"), etag) {
+		resp.Data[logical.HTTPStatusCode] = http.StatusNotModified
+		resp.Data[logical.HTTPRawBody] = []byte{}
+	}
+
+	return resp
+}
+
+// etagMatches returns whether the entity tags of an 'If-None-Match' header match the etag; weak tags are
+// compared by their value (RFC 9110).
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // GetPublicKeys returns a set of JSON Web Keys.
@@ -70,19 +184,109 @@ func (b *backend) getPublicKeys(ctx context.Context, stg logical.Storage, mount
 		return nil, err
 	}
 
-	policy, err := b.getPolicy(ctx, stg, config, mount)
+	jwkSet := jose.JSONWebKeySet{}
+
+	extSigner, err := b.getExternalSigner(config)
 	if err != nil {
 		return nil, err
 	}
 
+	if extSigner != nil {
+		extKeys, err := extSigner.publicKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, extKey := range extKeys {
+			if extKey.Algorithm == "" {
+				extKey.Algorithm = string(config.SignatureAlgorithm)
+				if !algorithmSupported(extKey.Key, config.SignatureAlgorithm) {
+					if keyAlgs := keyAlgorithms(extKey.Key); len(keyAlgs) > 0 {
+						extKey.Algorithm = string(keyAlgs[0])
+					}
+				}
+			}
+			extKey.KeyID = keyId(config, extKey.Key, 0, extKey.KeyID)
+			extKey.Use = "sig"
+			jwkSet.Keys = append(jwkSet.Keys, extKey)
+		}
+	}
+
+	// Local keys are published even when using an external signer, so tokens
+	// signed before migrating remain verifiable until the keys are pruned.
+	policy, err := b.getLocalPolicy(ctx, stg, config, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy != nil {
+		jwkSet.Keys = append(jwkSet.Keys, b.policyPublicKeys(policy, config)...)
+	}
+
+	// Key sets are mount resources, published alongside the mount-wide keys
+	keySetNames, err := b.listKeySets(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, keySetName := range keySetNames {
+		keySet, err := b.getKeySet(ctx, stg, keySetName)
+		if err != nil {
+			return nil, err
+		}
+		if keySet == nil {
+			continue
+		}
+
+		keySetConfig := keySet.config(config)
+
+		policy, err := b.getKeyringPolicy(ctx, stg, keySetConfig, keySetKeyringName(keySetName), mount)
+		if err != nil {
+			return nil, err
+		}
+
+		jwkSet.Keys = append(jwkSet.Keys, b.policyPublicKeys(policy, keySetConfig)...)
+	}
+
+	for idx := range jwkSet.Keys {
+		if err := b.attachCertificates(ctx, stg, &jwkSet.Keys[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &jwkSet, nil
+}
+
+// getKeyringPublicKeys returns a set of JSON Web Keys for the keys of a role's keyring or a key set.
+func (b *backend) getKeyringPublicKeys(ctx context.Context, stg logical.Storage, config *Config, keyring string, mount string) (*jose.JSONWebKeySet, error) {
+
+	policy, err := b.getKeyringPolicy(ctx, stg, config, keyring, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	jwkSet := jose.JSONWebKeySet{Keys: b.policyPublicKeys(policy, config)}
+
+	for idx := range jwkSet.Keys {
+		if err := b.attachCertificates(ctx, stg, &jwkSet.Keys[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &jwkSet, nil
+}
+
+// policyPublicKeys returns the JSON Web Keys for each available version of the policy's keys; shared
+// secrets have no public key and are never published.
+func (b *backend) policyPublicKeys(policy *keysutil.Policy, config *Config) []jose.JSONWebKey {
+	var err error
+
 	policy.Lock(false)
 	defer policy.Unlock()
 
 	keyCount := (policy.LatestVersion - policy.MinDecryptionVersion) + 1
 
-	jwkSet := jose.JSONWebKeySet{
-		Keys: make([]jose.JSONWebKey, keyCount),
-	}
+	keys := make([]jose.JSONWebKey, keyCount)
 
 	keyIdx := 0
 	for version := policy.MinDecryptionVersion; version <= policy.LatestVersion; version++ {
@@ -92,27 +296,27 @@ func (b *backend) getPublicKeys(ctx context.Context, stg logical.Storage, mount
 			continue
 		}
 
-		if key.FormattedPublicKey != "" {
-			block, _ := pem.Decode([]byte(key.FormattedPublicKey))
-			if block == nil {
-				continue
-			}
+		keys[keyIdx].Key, err = keyEntryPublicKey(key, config.Secp256k1Keys)
+		if err != nil {
+			continue
+		}
 
-			jwkSet.Keys[keyIdx].Key, err = x509.ParsePKIXPublicKey(block.Bytes)
-			if err != nil {
-				continue
+		// Keys generated before a change of key format keep the algorithm they signed with
+		alg := config.SignatureAlgorithm
+		if !algorithmSupported(keys[keyIdx].Key, alg) {
+			if keyAlgs := keyAlgorithms(keys[keyIdx].Key); len(keyAlgs) > 0 {
+				alg = keyAlgs[0]
 			}
-		} else if key.RSAKey != nil {
-			jwkSet.Keys[keyIdx].Key = &key.RSAKey.PublicKey
 		}
 
-		jwkSet.Keys[keyIdx].KeyID = createKeyId(b.id, policy.Name, version)
-		jwkSet.Keys[keyIdx].Algorithm = string(config.SignatureAlgorithm)
-		jwkSet.Keys[keyIdx].Use = "sig"
+		keys[keyIdx].KeyID = localKeyId(b.id, config, policy, version)
+		keys[keyIdx].Algorithm = string(alg)
+		keys[keyIdx].Use = "sig"
 		keyIdx += 1
 	}
 
-	return &jwkSet, nil
+	// Individually deleted versions leave gaps in the version range
+	return keys[:keyIdx]
 }
 
 const pathJwksHelpSyn = `
@@ -122,3 +326,13 @@ Get a JSON Web Key Set.
 const pathJwksHelpDesc = `
 Get a JSON Web Key Set.
 `
+
+const pathJwksRoleHelpSyn = `
+Get a JSON Web Key Set for a role.
+`
+
+const pathJwksRoleHelpDesc = `
+Get a JSON Web Key Set containing the keys used to sign a role's tokens. Roles
+with an isolated keyring, or bound to a key set, publish only those keys; other
+roles publish the mount-wide keys.
+`
@@ -18,20 +18,32 @@ package jwtsecrets
 
 import (
 	"context"
+	"crypto"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"testing"
 
 	"github.com/go-test/deep"
 	"github.com/hashicorp/vault/sdk/logical"
 	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 func FetchJWKS(b *backend, storage *logical.Storage) (*jose.JSONWebKeySet, error) {
+	return fetchJWKSPath(b, storage, "jwks")
+}
+
+func fetchRoleJWKS(b *backend, storage *logical.Storage, role string) (*jose.JSONWebKeySet, error) {
+	return fetchJWKSPath(b, storage, "jwks/"+role)
+}
+
+func fetchJWKSPath(b *backend, storage *logical.Storage, path string) (*jose.JSONWebKeySet, error) {
 
 	req := &logical.Request{
 		Operation:  logical.ReadOperation,
-		Path:       "jwks",
+		Path:       path,
 		Storage:    *storage,
 		MountPoint: "test",
 	}
@@ -93,3 +105,225 @@ func TestJwks(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestJwksThumbprintKeyID(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keyKeyIDStrategy: KeyIDStrategyThumbprint,
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	jwkSet, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("err:%s\n", err)
+	}
+
+	thumbprint, err := jwkSet.Keys[0].Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("err:%s\n", err)
+	}
+
+	if diff := deep.Equal(base64.RawURLEncoding.EncodeToString(thumbprint), jwkSet.Keys[0].KeyID); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJwksCounterKeyID(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keyKeyIDStrategy: KeyIDStrategyCounter,
+		keyKeyIDPrefix:   "jwt-",
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	jwkSet, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("err:%s\n", err)
+	}
+
+	if diff := deep.Equal("jwt-1", jwkSet.Keys[0].KeyID); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJwksRoleKeyring(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	for _, role := range []string{"isolated", "shared"} {
+		if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+			t.Fatalf("%s\n", err)
+		}
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "roles/isolated",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyIsolatedKeyring: true},
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/isolated",
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	kid := token.Headers[0].KeyID
+
+	// The role's keys are only published in its own key set
+	roleJwks, err := fetchRoleJWKS(b, storage, "isolated")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(roleJwks.Keys), 1); diff != nil {
+		t.Fatal("role jwks key count", diff)
+	}
+	if keys := roleJwks.Key(kid); len(keys) != 1 {
+		t.Fatal("signing key not published in role jwks")
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(roleJwks.Keys[0], &claims); err != nil {
+		t.Error("token does not verify with role jwks", err)
+	}
+
+	mountJwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if keys := mountJwks.Key(kid); len(keys) != 0 {
+		t.Error("role key published in mount jwks")
+	}
+
+	// Roles without an isolated keyring publish the mount-wide keys
+	sharedJwks, err := fetchRoleJWKS(b, storage, "shared")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(sharedJwks.Keys, mountJwks.Keys); diff != nil {
+		t.Error("shared role jwks", diff)
+	}
+
+	// Deleting the role deletes its keyring
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "roles/isolated",
+		Storage:    *storage,
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	keyrings, err := b.listRoleKeyrings(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(keyrings), 0); diff != nil {
+		t.Error("role keyring count", diff)
+	}
+}
+
+func TestJwksCaching(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	read := func(headers map[string][]string) *logical.Response {
+		req := &logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       "jwks",
+			Storage:    *storage,
+			Headers:    headers,
+			MountPoint: "test",
+		}
+
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return resp
+	}
+
+	resp := read(nil)
+	if _, ok := resp.Data[logical.HTTPCacheControlHeader]; ok {
+		t.Error("jwks should not be cacheable by default")
+	}
+	etag := resp.Headers["ETag"]
+	if len(etag) != 1 || etag[0] == "" {
+		t.Fatalf("missing etag: %v", resp.Headers)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyJWKSCacheTTL: "10m"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp = read(nil)
+	if diff := deep.Equal("public, max-age=600", resp.Data[logical.HTTPCacheControlHeader]); diff != nil {
+		t.Error("cache control", diff)
+	}
+	if diff := deep.Equal(etag, resp.Headers["ETag"]); diff != nil {
+		t.Error("etag of unchanged keys", diff)
+	}
+
+	// Matching entity tags are answered without the key set
+	for _, ifNoneMatch := range []string{etag[0], `"other", W/` + etag[0], "*"} {
+		resp = read(map[string][]string{"If-None-Match": {ifNoneMatch}})
+		if diff := deep.Equal(http.StatusNotModified, resp.Data[logical.HTTPStatusCode]); diff != nil {
+			t.Error(ifNoneMatch, diff)
+		}
+		if len(resp.Data[logical.HTTPRawBody].([]byte)) != 0 {
+			t.Error(ifNoneMatch, "unexpected body")
+		}
+	}
+
+	// Published keys change the entity tag
+	if resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp = read(map[string][]string{"If-None-Match": etag})
+	if diff := deep.Equal(http.StatusOK, resp.Data[logical.HTTPStatusCode]); diff != nil {
+		t.Error("changed keys", diff)
+	}
+	if diff := deep.Equal(etag, resp.Headers["ETag"]); diff == nil {
+		t.Error("etag unchanged by new keys")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyJWKSCacheTTL: "-1m"}); err == nil {
+		t.Error("negative cache ttl should have failed")
+	}
+}
@@ -0,0 +1,585 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	keyKeyID      = "kid"
+	keyKeySetName = "name"
+
+	keySetsPath = "keysets/"
+
+	// Prefix of the keyrings holding the keys of named key sets
+	keySetKeyringPrefix = "keyset/"
+)
+
+var keySetNameRegex = regexp.MustCompile(`^\w(([\w-.]+)?\w)?$`)
+
+// KeySet holds the configuration of a named set of keys, which roles can be bound to.
+type KeySet struct {
+	// SignatureAlgorithm is the signing algorithm to use.
+	SignatureAlgorithm jose.SignatureAlgorithm
+
+	// RSAKeyBits is size of generated RSA keys; only used when SignatureAlgorithm is one of the supported RSA algorithms.
+	RSAKeyBits int
+
+	// Secp256k1Keys marks the key set's keyring as holding secp256k1 keys; see Config.Secp256k1Keys.
+	Secp256k1Keys bool `json:"secp256k1_keys"`
+
+	// KeyRotationPeriod is how frequently a new key is created.
+	KeyRotationPeriod time.Duration
+
+	// KeyPrePublishPeriod is how long a new key is published in the JWKS before it is used to sign tokens.
+	KeyPrePublishPeriod time.Duration
+}
+
+// config returns a copy of the configuration using the key set's key settings.
+func (ks *KeySet) config(config *Config) *Config {
+	cc := config.copy()
+	cc.SignatureAlgorithm = ks.SignatureAlgorithm
+	cc.RSAKeyBits = ks.RSAKeyBits
+	cc.Secp256k1Keys = ks.Secp256k1Keys
+	cc.KeyRotationPeriod = ks.KeyRotationPeriod
+	cc.KeyPrePublishPeriod = ks.KeyPrePublishPeriod
+	return cc
+}
+
+// keySetKeyringName returns the name of the keyring holding the keys of the named key set.
+func keySetKeyringName(name string) string {
+	return keySetKeyringPrefix + name
+}
+
+func pathKeys(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "keys/(?P<" + keyKeySetName + ">[^/]+)",
+			Fields: map[string]*framework.FieldSchema{
+				keyKeySetName: {
+					Type:        framework.TypeString,
+					Description: `Name of the key set.`,
+					Required:    true,
+				},
+				keySignatureAlgorithm: {
+					Type:        framework.TypeString,
+					Description: `Signature algorithm used to sign new tokens.`,
+				},
+				keyRSAKeyBits: {
+					Type:        framework.TypeInt,
+					Description: `Size of generated RSA keys, when signature algorithm is one of the allowed RSA signing algorithm.`,
+				},
+				keyRotationDuration: {
+					Type:        framework.TypeString,
+					Description: `Duration a specific key will be used to sign new tokens.`,
+				},
+				keyPrePublishDuration: {
+					Type:        framework.TypeString,
+					Description: `Duration a new key is published before it is used to sign new tokens.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathKeysRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathKeysWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathKeysWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathKeysDelete,
+				},
+			},
+			ExistenceCheck:  b.pathKeysExistenceCheck,
+			HelpSynopsis:    pathKeysHelpSyn,
+			HelpDescription: pathKeysHelpDesc,
+		},
+		{
+			Pattern: "keys/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathKeysList,
+				},
+			},
+			HelpSynopsis:    pathKeysListHelpSyn,
+			HelpDescription: pathKeysListHelpDesc,
+		},
+		{
+			Pattern: "key-versions/(?P<" + keyKeyID + ">[^/]+)",
+			Fields: map[string]*framework.FieldSchema{
+				keyKeyID: {
+					Type:        framework.TypeString,
+					Description: `Key id (kid) of the key.`,
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathKeyVersionsDelete,
+				},
+			},
+			HelpSynopsis:    pathKeyVersionsHelpSyn,
+			HelpDescription: pathKeyVersionsHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathKeysExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	keySet, err := b.getKeySet(ctx, req.Storage, d.Get(keyKeySetName).(string))
+	if err != nil {
+		return false, err
+	}
+
+	return keySet != nil, nil
+}
+
+func (b *backend) pathKeysList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, keySetsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathKeysRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keySet, err := b.getKeySet(ctx, req.Storage, d.Get(keyKeySetName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if keySet == nil {
+		return nil, nil
+	}
+
+	return keySetResponse(keySet), nil
+}
+
+func (b *backend) pathKeysWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyKeySetName).(string)
+
+	if !keySetNameRegex.MatchString(name) || name == keysPEMName {
+		return logical.ErrorResponse("invalid key set name '%s'", name), logical.ErrInvalidRequest
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet, err := b.getKeySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *KeySet
+	if keySet == nil {
+		keySet = &KeySet{
+			SignatureAlgorithm:  config.SignatureAlgorithm,
+			RSAKeyBits:          config.RSAKeyBits,
+			KeyRotationPeriod:   config.KeyRotationPeriod,
+			KeyPrePublishPeriod: config.KeyPrePublishPeriod,
+		}
+	} else {
+		current := *keySet
+		previous = &current
+	}
+
+	if newSignatureAlgorithmName, ok := d.GetOk(keySignatureAlgorithm); ok {
+		if !stringInSlice(newSignatureAlgorithmName.(string), AllowedSignatureAlgorithmNames) {
+			return logical.ErrorResponse("unknown/unsupported signature algorithm, must be one of %s", AllowedSignatureAlgorithmNames), logical.ErrInvalidRequest
+		}
+		keySet.SignatureAlgorithm = jose.SignatureAlgorithm(newSignatureAlgorithmName.(string))
+	}
+
+	// Key sets exist to publish their keys, which shared secrets never are
+	if isHMACAlgorithm(keySet.SignatureAlgorithm) {
+		return logical.ErrorResponse("key sets don't support HMAC signature algorithms, '%s' must be an asymmetric algorithm", keySignatureAlgorithm), logical.ErrInvalidRequest
+	}
+
+	if stringInSlice(string(keySet.SignatureAlgorithm), NonFIPSSignatureAlgorithmNames) && !config.AllowNonFIPSAlgorithms {
+		return logical.ErrorResponse("the %s signature algorithm isn't FIPS approved, the config's '%s' must be enabled", keySet.SignatureAlgorithm, keyAllowNonFIPS), logical.ErrInvalidRequest
+	}
+
+	if newRSAKeyBits, ok := d.GetOk(keyRSAKeyBits); ok {
+		if !intInSlice(newRSAKeyBits.(int), AllowedRSAKeyBits) {
+			return logical.ErrorResponse("unsupported rsa_key_bits, must be one of %s", AllowedRSAKeyBits), logical.ErrInvalidRequest
+		}
+		keySet.RSAKeyBits = newRSAKeyBits.(int)
+	}
+
+	if newRotationPeriod, ok := d.GetOk(keyRotationDuration); ok {
+		duration, err := time.ParseDuration(newRotationPeriod.(string))
+		if err != nil {
+			return nil, err
+		}
+		keySet.KeyRotationPeriod = duration
+	}
+
+	if newPrePublishPeriod, ok := d.GetOk(keyPrePublishDuration); ok {
+		duration, err := time.ParseDuration(newPrePublishPeriod.(string))
+		if err != nil {
+			return nil, err
+		}
+		keySet.KeyPrePublishPeriod = duration
+	}
+
+	if keySet.KeyPrePublishPeriod < 0 || keySet.KeyPrePublishPeriod >= keySet.KeyRotationPeriod {
+		return logical.ErrorResponse("'%s' must be less than '%s'", keyPrePublishDuration, keyRotationDuration), logical.ErrInvalidRequest
+	}
+
+	if keySet.SignatureAlgorithm == ES256K {
+		keySet.Secp256k1Keys = true
+	}
+
+	entry, err := logical.StorageEntryJSON(keySetsPath+name, keySet)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	keyFormatChanged :=
+		previous != nil &&
+			(keySet.SignatureAlgorithm != previous.SignatureAlgorithm ||
+				keySet.RSAKeyBits != previous.RSAKeyBits)
+
+	if keyFormatChanged {
+		b.Logger().Info(fmt.Sprintf("Key Format Rotation: key=%s", name))
+
+		if err := b.rotateKeyFormat(ctx, req.Storage, keySet.config(config), keySetKeyringName(name), req.MountPoint); err != nil {
+			return nil, err
+		}
+	}
+
+	return keySetResponse(keySet), nil
+}
+
+func (b *backend) pathKeysDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyKeySetName).(string)
+
+	keySet, err := b.getKeySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if keySet == nil {
+		return nil, nil
+	}
+
+	roleNames, err := req.Storage.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Key == name {
+			return logical.ErrorResponse("key set '%s' is used by role '%s'", name, roleName), logical.ErrInvalidRequest
+		}
+	}
+
+	issuerNames, err := req.Storage.List(ctx, issuersPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issuerName := range issuerNames {
+		issuer, err := b.getTrustedIssuer(ctx, req.Storage, issuerName)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil && issuer.Key == name {
+			return logical.ErrorResponse("key set '%s' is used by issuer '%s'", name, issuerName), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := req.Storage.Delete(ctx, keySetsPath+name); err != nil {
+		return nil, err
+	}
+
+	if err := b.deleteKeyring(ctx, req.Storage, keySetKeyringName(name)); err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info(fmt.Sprintf("Key Set Deleted: mount=%s, key=%s", req.MountPoint, name))
+
+	return nil, nil
+}
+
+func (b *backend) pathKeyVersionsDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	kid := d.Get(keyKeyID).(string)
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are looked up in every keyring, whose own settings determine its active & upcoming keys
+	var resp *logical.Response
+	found := false
+	err = b.forEachKeyring(ctx, req.Storage, config, req.MountPoint, func(policy *keysutil.Policy, keyringConfig *Config) error {
+		if found {
+			return nil
+		}
+
+		policy.Lock(true)
+		defer policy.Unlock()
+
+		version := keyVersionByID(b.id, keyringConfig, policy, kid)
+		if version == 0 {
+			return nil
+		}
+		found = true
+
+		if version == signingKeyVersion(policy, keyringConfig.KeyPrePublishPeriod, time.Now()) {
+			resp = logical.ErrorResponse("key '%s' is the active signing key and cannot be deleted", kid)
+			return nil
+		}
+
+		if version == policy.LatestVersion {
+			resp = logical.ErrorResponse("key '%s' is the upcoming signing key and cannot be deleted", kid)
+			return nil
+		}
+
+		if err := b.deleteKeyVersion(ctx, req.Storage, policy, version); err != nil {
+			return err
+		}
+
+		b.Logger().Info(fmt.Sprintf("Key Deleted: mount=%s, keyring=%s, version=%d", req.MountPoint, policy.Name, version))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return logical.ErrorResponse("unknown key '%s'", kid), logical.ErrInvalidRequest
+	}
+	if resp != nil {
+		return resp, logical.ErrInvalidRequest
+	}
+
+	if err := req.Storage.Delete(ctx, certificatesPath+kid); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// keyVersionByID returns the version of the policy's key with the key id, or 0 when the policy has no such key.
+func keyVersionByID(backendId string, config *Config, policy *keysutil.Policy, kid string) int {
+	for version := policy.MinDecryptionVersion; version <= policy.LatestVersion; version++ {
+		if _, ok := policy.Keys[strconv.Itoa(version)]; !ok {
+			continue
+		}
+		if localKeyId(backendId, config, policy, version) == kid {
+			return version
+		}
+	}
+	return 0
+}
+
+// getKeySet returns the named key set, or nil if it does not exist.
+func (b *backend) getKeySet(ctx context.Context, stg logical.Storage, name string) (*KeySet, error) {
+	entry, err := stg.Get(ctx, keySetsPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var keySet KeySet
+	if err := entry.DecodeJSON(&keySet); err != nil {
+		return nil, err
+	}
+
+	return &keySet, nil
+}
+
+// listKeySets returns the names of all key sets.
+func (b *backend) listKeySets(ctx context.Context, stg logical.Storage) ([]string, error) {
+	return stg.List(ctx, keySetsPath)
+}
+
+// checkKeySetsFIPS returns an error response when a key set signs with an algorithm which isn't FIPS approved.
+func (b *backend) checkKeySetsFIPS(ctx context.Context, stg logical.Storage) (*logical.Response, error) {
+	names, err := b.listKeySets(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		keySet, err := b.getKeySet(ctx, stg, name)
+		if err != nil {
+			return nil, err
+		}
+		if keySet != nil && stringInSlice(string(keySet.SignatureAlgorithm), NonFIPSSignatureAlgorithmNames) {
+			return logical.ErrorResponse("key set '%s' uses the %s signature algorithm, which isn't FIPS approved", name, keySet.SignatureAlgorithm), logical.ErrInvalidRequest
+		}
+	}
+
+	return nil, nil
+}
+
+func keySetResponse(keySet *KeySet) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keySignatureAlgorithm: keySet.SignatureAlgorithm,
+			keyRSAKeyBits:         keySet.RSAKeyBits,
+			keyRotationDuration:   keySet.KeyRotationPeriod.String(),
+			keyPrePublishDuration: keySet.KeyPrePublishPeriod.String(),
+		},
+	}
+}
+
+// deleteKeyVersion removes a single retired key version from the policy and its archive.
+// The caller must hold an exclusive lock on the policy.
+func (b *backend) deleteKeyVersion(ctx context.Context, stg logical.Storage, policy *keysutil.Policy, version int) error {
+
+	// Ensure that cache doesn't get corrupted in error cases
+	previousMinAvailableVersion := policy.MinAvailableVersion
+	previousMinDecryptionVersion := policy.MinDecryptionVersion
+
+	if version == policy.MinDecryptionVersion {
+		// Removing the oldest key; advance the minimum versions past it (and
+		// any already deleted versions) and let archiving trim it from storage.
+		nextVersion := version + 1
+		for ; nextVersion < policy.LatestVersion; nextVersion++ {
+			if _, ok := policy.Keys[strconv.Itoa(nextVersion)]; ok {
+				break
+			}
+		}
+		policy.MinAvailableVersion = nextVersion
+		policy.MinDecryptionVersion = nextVersion
+	} else {
+		// Removing a key from the middle of the available range; scrub it from
+		// the archive, which otherwise retains every version.
+		archive, err := policy.LoadArchive(ctx, stg)
+		if err != nil {
+			return err
+		}
+
+		archiveIdx := version - policy.MinAvailableVersion
+		if archiveIdx >= 0 && archiveIdx < len(archive.Keys) {
+			archive.Keys[archiveIdx] = keysutil.KeyEntry{}
+
+			buf, err := json.Marshal(archive)
+			if err != nil {
+				return err
+			}
+
+			err = stg.Put(ctx, &logical.StorageEntry{
+				Key:   path.Join(policy.StoragePrefix, "archive", policy.Name),
+				Value: buf,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	removedKeys := trimKeyVersions(policy, version)
+
+	if err := policy.Persist(ctx, stg); err != nil {
+		policy.MinAvailableVersion = previousMinAvailableVersion
+		policy.MinDecryptionVersion = previousMinDecryptionVersion
+		restoreKeyVersions(policy, removedKeys)
+		return err
+	}
+
+	return nil
+}
+
+// trimKeyVersions removes the given version, and any versions older than the minimum decryption
+// version, from the policy's keys; returning the removed entries. Archiving only trims a contiguous
+// range of versions, which no longer holds once individual keys have been deleted.
+func trimKeyVersions(policy *keysutil.Policy, versions ...int) map[string]keysutil.KeyEntry {
+	removed := map[string]keysutil.KeyEntry{}
+	for versionKey, entry := range policy.Keys {
+		version, err := strconv.Atoi(versionKey)
+		if err != nil {
+			continue
+		}
+		if version < policy.MinDecryptionVersion || intInSlice(version, versions) {
+			removed[versionKey] = entry
+			delete(policy.Keys, versionKey)
+		}
+	}
+	return removed
+}
+
+// restoreKeyVersions adds key entries previously removed by trimKeyVersions back to the policy.
+func restoreKeyVersions(policy *keysutil.Policy, removed map[string]keysutil.KeyEntry) {
+	for versionKey, entry := range removed {
+		policy.Keys[versionKey] = entry
+	}
+}
+
+const pathKeysHelpSyn = `
+Manage named key sets.
+`
+
+const pathKeysHelpDesc = `
+Manage named key sets, which roles are bound to with their 'key' field. Each key
+set holds its own automatically rotated keys.
+
+sig_alg:        Signature algorithm used to sign new tokens.
+rsa_key_bits:   Size of generate RSA keys, when using RSA signature algorithms.
+key_ttl:        Duration before a key stops signing new tokens and a new one is generated.
+key_prepublish: Duration a new key is published in the JWKS before it starts signing.
+
+Settings default to those of the configuration when the key set is created. Key
+sets cannot be deleted while roles or hosted issuers are bound to them.
+`
+
+const pathKeysListHelpSyn = `
+List the named key sets.
+`
+
+const pathKeysListHelpDesc = `
+List the named key sets. Only the key set names are returned, not any values.
+`
+
+const pathKeyVersionsHelpSyn = `
+Delete an individual signing key.
+`
+
+const pathKeyVersionsHelpDesc = `
+Delete the key with the key id (kid), from any keyring; the mount's, a key set's
+or a role's isolated keyring. The key is removed from storage and from the
+published JSON Web Key Set immediately and tokens signed by the key will no longer
+verify. The active and upcoming signing keys of the keyring cannot be deleted.
+`
@@ -0,0 +1,219 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"strings"
+)
+
+const (
+	keyCertificate = "certificate"
+
+	certificatesPath = "certificates/"
+)
+
+// keyCertificates holds the certificate chain attached to a key.
+type keyCertificates struct {
+	// Chain is the PEM encoded certificate chain, starting with the key's certificate.
+	Chain string
+}
+
+func pathKeysCertificate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/(?P<" + keyKeyID + ">[^/]+)/certificate",
+		Fields: map[string]*framework.FieldSchema{
+			keyKeyID: {
+				Type:        framework.TypeString,
+				Description: `Key id (kid) of the key, as published in the JWKS.`,
+				Required:    true,
+			},
+			keyCertificate: {
+				Type:        framework.TypeString,
+				Description: `PEM encoded certificate chain; the first certificate must certify the key.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathKeysCertificateRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathKeysCertificateWrite,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathKeysCertificateDelete,
+			},
+		},
+
+		HelpSynopsis:    pathKeysCertificateHelpSyn,
+		HelpDescription: pathKeysCertificateHelpDesc,
+	}
+}
+
+func (b *backend) pathKeysCertificateRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	kid := d.Get(keyKeyID).(string)
+
+	certificates, err := b.getKeyCertificates(ctx, req.Storage, kid)
+	if err != nil {
+		return nil, err
+	}
+	if certificates == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyKeyID:       kid,
+			keyCertificate: certificates.Chain,
+		},
+	}, nil
+}
+
+func (b *backend) pathKeysCertificateWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	kid := d.Get(keyKeyID).(string)
+
+	chainPEM := strings.TrimSpace(d.Get(keyCertificate).(string))
+	if chainPEM == "" {
+		return logical.ErrorResponse("'%s' is required", keyCertificate), logical.ErrInvalidRequest
+	}
+
+	chain, err := parseCertificateChain(chainPEM)
+	if err != nil {
+		return logical.ErrorResponse("invalid certificate chain: %v", err), logical.ErrInvalidRequest
+	}
+
+	jwkSet, err := b.getPublicKeys(ctx, req.Storage, req.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := jwkSet.Key(kid)
+	if len(keys) == 0 {
+		return logical.ErrorResponse("unknown key '%s'", kid), logical.ErrInvalidRequest
+	}
+
+	publicKey, ok := keys[0].Key.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(chain[0].PublicKey) {
+		return logical.ErrorResponse("certificate does not match key '%s'", kid), logical.ErrInvalidRequest
+	}
+
+	entry, err := logical.StorageEntryJSON(certificatesPath+kid, &keyCertificates{Chain: chainPEM})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info(fmt.Sprintf("Key Certificate Attached: mount=%s, kid=%s", req.MountPoint, kid))
+
+	return nil, nil
+}
+
+func (b *backend) pathKeysCertificateDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	kid := d.Get(keyKeyID).(string)
+
+	if err := req.Storage.Delete(ctx, certificatesPath+kid); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// getKeyCertificates returns the certificate chain attached to the key, or nil if none is attached.
+func (b *backend) getKeyCertificates(ctx context.Context, stg logical.Storage, kid string) (*keyCertificates, error) {
+	entry, err := stg.Get(ctx, certificatesPath+kid)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var certificates keyCertificates
+	if err := entry.DecodeJSON(&certificates); err != nil {
+		return nil, err
+	}
+
+	return &certificates, nil
+}
+
+// attachCertificates adds the attached certificate chain (x5c) and its thumbprint (x5t#S256) to the key.
+func (b *backend) attachCertificates(ctx context.Context, stg logical.Storage, key *jose.JSONWebKey) error {
+	certificates, err := b.getKeyCertificates(ctx, stg, key.KeyID)
+	if err != nil || certificates == nil {
+		return err
+	}
+
+	chain, err := parseCertificateChain(certificates.Chain)
+	if err != nil {
+		return err
+	}
+
+	thumbprint := sha256.Sum256(chain[0].Raw)
+
+	key.Certificates = chain
+	key.CertificateThumbprintSHA256 = thumbprint[:]
+
+	return nil
+}
+
+func parseCertificateChain(chainPEM string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+
+	rest := []byte(chainPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block '%s'", block.Type)
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return chain, nil
+}
+
+const pathKeysCertificateHelpSyn = `
+Manage the certificate chain of a signing key.
+`
+
+const pathKeysCertificateHelpDesc = `
+Attach a PEM encoded certificate chain to a key, identified by its key id (kid).
+The first certificate must certify the key; the chain is published in the JSON
+Web Key Set as the key's 'x5c' & 'x5t#S256' members.
+`
@@ -0,0 +1,131 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func writeKeyCertificate(b *backend, storage *logical.Storage, kid string, chain string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/" + kid + "/certificate",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyCertificate: chain,
+		},
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+// issueCertificate issues a certificate for the public key from a freshly generated CA.
+func issueCertificate(t *testing.T, publicKey interface{}) string {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Signing Key"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, template, caTemplate, publicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+}
+
+func TestKeyCertificate(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Fatal("jwks key count", diff)
+	}
+	key := jwks.Keys[0]
+
+	if resp, err := writeKeyCertificate(b, storage, key.KeyID, issueCertificate(t, key.Key)); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jwks, err = FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	key = jwks.Keys[0]
+
+	if diff := deep.Equal(len(key.Certificates), 2); diff != nil {
+		t.Fatal("x5c length", diff)
+	}
+	thumbprint := sha256.Sum256(key.Certificates[0].Raw)
+	if diff := deep.Equal(thumbprint[:], key.CertificateThumbprintSHA256); diff != nil {
+		t.Error("x5t#S256", diff)
+	}
+
+	// Certificates for other keys are rejected
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if resp, err := writeKeyCertificate(b, storage, key.KeyID, issueCertificate(t, &otherKey.PublicKey)); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("mismatched certificate should have been rejected")
+	}
+
+	// As are certificates for unknown keys
+	if resp, err := writeKeyCertificate(b, storage, "unknown", issueCertificate(t, key.Key)); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("certificate for unknown key should have been rejected")
+	}
+}
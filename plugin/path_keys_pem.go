@@ -0,0 +1,84 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// keysPEMName is the name of the PEM bundle path under 'keys/', reserved from key set names.
+const keysPEMName = "pem"
+
+func pathKeysPEM(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + keysPEMName,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathKeysPEMRead,
+			},
+		},
+
+		HelpSynopsis:    pathKeysPEMHelpSyn,
+		HelpDescription: pathKeysPEMHelpDesc,
+	}
+}
+
+func (b *backend) pathKeysPEMRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	jwkSet, err := b.getPublicKeys(ctx, req.Storage, req.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle []byte
+	for _, key := range jwkSet.Keys {
+
+		// x509 can't marshal secp256k1 keys, which have no standard PKIX encoding
+		if isSecp256k1Key(key.Key) {
+			continue
+		}
+
+		der, err := x509.MarshalPKIXPublicKey(key.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+
+	return publicKeysResponse(req, config, "application/x-pem-file", bundle), nil
+}
+
+const pathKeysPEMHelpSyn = `
+Get the public keys as a PEM bundle.
+`
+
+const pathKeysPEMHelpDesc = `
+Get the mount's published public keys, those signing tokens and those retained to
+verify previously signed tokens, as a bundle of PEM encoded ('PUBLIC KEY') keys;
+for consumers unable to use the JWKS. Keys are in the order of the JWKS, and
+ES256K keys, which have no standard PEM encoding, are omitted.
+`
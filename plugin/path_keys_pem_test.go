@@ -0,0 +1,98 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func fetchKeysPEM(t *testing.T, b *backend, storage *logical.Storage) []interface{} {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "keys/pem",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal("application/x-pem-file", resp.Data[logical.HTTPContentType]); diff != nil {
+		t.Error("content type", diff)
+	}
+
+	var keys []interface{}
+	rest := resp.Data[logical.HTTPRawBody].([]byte)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if diff := deep.Equal("PUBLIC KEY", block.Type); diff != nil {
+			t.Error("block type", diff)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestKeysPEM(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	if resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	keys := fetchKeysPEM(t, b, storage)
+	if len(keys) != len(jwks.Keys) || len(keys) < 2 {
+		t.Fatalf("expected the %d keys of the JWKS, got %d", len(jwks.Keys), len(keys))
+	}
+	for idx, key := range keys {
+		if diff := deep.Equal(jwks.Keys[idx].Key, key); diff != nil {
+			t.Error(jwks.Keys[idx].KeyID, diff)
+		}
+	}
+
+	// The bundle's path is reserved from key set names
+	if resp, err := writeKeySet(b, storage, "pem", map[string]interface{}{}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("key set named 'pem' should have failed")
+	}
+}
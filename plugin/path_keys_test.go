@@ -0,0 +1,323 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func deleteKey(b *backend, storage *logical.Storage, kid string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "key-versions/" + kid,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func deleteKeySet(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "keys/" + name,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestDeleteKey(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Build up versions 1, 2 & 3
+	for i := 0; i < 2; i++ {
+		if err := policy.Rotate(context.Background(), *storage, rand.Reader); err != nil {
+			t.Fatalf("%s\n", err)
+		}
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 3); diff != nil {
+		t.Fatal("jwks key count", diff)
+	}
+
+	// Key ids are not key set names
+	middleKid := createKeyId(b.id, policy.Name, 2)
+	if resp, err := deleteKeySet(b, storage, middleKid); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jwks, err = FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 3); diff != nil {
+		t.Fatal("jwks key count", diff)
+	}
+
+	// Delete a key from the middle of the range
+	if resp, err := deleteKey(b, storage, middleKid); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jwks, err = FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 2); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+	if keys := jwks.Key(middleKid); len(keys) != 0 {
+		t.Error("deleted key still published")
+	}
+
+	// Delete the oldest key
+	oldestKid := createKeyId(b.id, policy.Name, 1)
+	if resp, err := deleteKey(b, storage, oldestKid); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jwks, err = FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+	if diff := deep.Equal(policy.MinDecryptionVersion, 3); diff != nil {
+		t.Error("policy min-decryption version", diff)
+	}
+	if diff := deep.Equal(len(policy.Keys), 1); diff != nil {
+		t.Error("policy key count", diff)
+	}
+
+	// Deleting again should fail
+	if resp, err := deleteKey(b, storage, oldestKid); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting an unknown key should have failed")
+	}
+}
+
+func TestDeleteActiveKey(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Fatal("jwks key count", diff)
+	}
+
+	if resp, err := deleteKey(b, storage, jwks.Keys[0].KeyID); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting the active key should have failed")
+	}
+}
+
+func TestDeleteKeySetKey(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeKeySet(b, storage, "ec", map[string]interface{}{keySignatureAlgorithm: string(jose.ES256)}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	keySet, err := b.getKeySet(context.Background(), *storage, "ec")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	keySetConfig := keySet.config(config)
+
+	policy, err := b.getKeyringPolicy(context.Background(), *storage, keySetConfig, keySetKeyringName("ec"), "test")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Build up versions 1, 2 & 3
+	for i := 0; i < 2; i++ {
+		if err := policy.Rotate(context.Background(), *storage, rand.Reader); err != nil {
+			t.Fatalf("%s\n", err)
+		}
+	}
+
+	if resp, err := deleteKey(b, storage, localKeyId(b.id, keySetConfig, policy, 1)); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, ok := policy.Keys["1"]; ok {
+		t.Error("deleted key still in the key set's keyring")
+	}
+
+	// The key set's own active key cannot be deleted
+	policy.Lock(false)
+	activeVersion := signingKeyVersion(policy, keySetConfig.KeyPrePublishPeriod, time.Now())
+	policy.Unlock()
+
+	if resp, err := deleteKey(b, storage, localKeyId(b.id, keySetConfig, policy, activeVersion)); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting the active key of the key set should have failed")
+	}
+}
+
+func writeKeySet(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "keys/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestKeySet(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{
+		keySignatureAlgorithm: string(jose.RS256),
+		keyRotationDuration:   "1h",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal(jose.RS256, resp.Data[keySignatureAlgorithm]); diff != nil {
+		t.Error("key set signature algorithm", diff)
+	}
+	if diff := deep.Equal(DefaultRSAKeyBits, resp.Data[keyRSAKeyBits]); diff != nil {
+		t.Error("key set rsa key bits should default to config", diff)
+	}
+
+	// Roles can only be bound to existing key sets
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "roles/unknown",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyIssuer: "unknown.example.com", keyKey: "unknown"},
+		MountPoint: "test",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("binding to an unknown key set should have failed")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "roles/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyIssuer: "tester.example.com", keyKey: "rsa"},
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(string(jose.RS256), token.Headers[0].Algorithm); diff != nil {
+		t.Error("token algorithm", diff)
+	}
+
+	// Key set keys are published in the role's & mount's key sets
+	roleJwks, err := fetchRoleJWKS(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(roleJwks.Keys), 1); diff != nil {
+		t.Fatal("role jwks key count", diff)
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(roleJwks.Key(token.Headers[0].KeyID)[0], &claims); err != nil {
+		t.Error("token does not verify with role jwks", err)
+	}
+
+	mountJwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(mountJwks.Keys), 2); diff != nil {
+		t.Error("mount jwks key count", diff)
+	}
+
+	// Key sets cannot be deleted while bound to roles
+	if resp, err := deleteKeySet(b, storage, "rsa"); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting a bound key set should have failed")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "roles/tester",
+		Storage:    *storage,
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := deleteKeySet(b, storage, "rsa"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	mountJwks, err = FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(mountJwks.Keys), 1); diff != nil {
+		t.Error("mount jwks key count", diff)
+	}
+}
@@ -0,0 +1,205 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"time"
+)
+
+const (
+	revokedPath = "revoked/"
+)
+
+// revokedToken records the revocation of a token, until the token expires.
+type revokedToken struct {
+	// JTI is the 'jti' claim of the revoked token.
+	JTI string
+
+	// Expiration is the 'exp' claim of the revoked token.
+	Expiration time.Time
+}
+
+func pathRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "revoke",
+		Fields: map[string]*framework.FieldSchema{
+			keyToken: {
+				Type:         framework.TypeString,
+				Description:  `Token to revoke.`,
+				Required:     true,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRevokeWrite,
+			},
+		},
+		HelpSynopsis:    pathRevokeHelpSyn,
+		HelpDescription: pathRevokeHelpDesc,
+	}
+}
+
+func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rawToken := d.Get(keyToken).(string)
+	if rawToken == "" {
+		return logical.ErrorResponse("'%s' is required", keyToken), logical.ErrInvalidRequest
+	}
+
+	// Only the signature is verified; expired tokens need no revocation
+	claims, _, err := b.verifyToken(ctx, req.Storage, req.MountPoint, rawToken, jwt.Expected{})
+	if err != nil {
+		var invalid *invalidTokenError
+		if errors.As(err, &invalid) {
+			return logical.ErrorResponse("invalid token: %v", invalid), logical.ErrInvalidRequest
+		}
+		return nil, err
+	}
+
+	jti, _ := claims["jti"].(string)
+	status, hasStatus := claimedTokenStatus(claims)
+	if jti == "" && !hasStatus {
+		return logical.ErrorResponse("token has no 'jti' or 'status' claim and cannot be revoked"), logical.ErrInvalidRequest
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return logical.ErrorResponse("token has no 'exp' claim and cannot be revoked"), logical.ErrInvalidRequest
+	}
+
+	// Tokens can only revoke entries of the mount's own status lists
+	if hasStatus {
+		config, err := b.getConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		issuer, err := b.mountIssuer(config, req)
+		if err != nil {
+			return logical.ErrorResponse("error resolving issuer: %v", err), logical.ErrInvalidRequest
+		}
+		if claimedStatusListURI(claims) != statusListURI(issuer, status.List) {
+			return logical.ErrorResponse("token's 'status' claim doesn't reference a status list of this mount"), logical.ErrInvalidRequest
+		}
+	}
+
+	if jti != "" {
+		if err := b.revokeToken(ctx, req.Storage, jti, time.Unix(int64(exp), 0)); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasStatus {
+		if err := b.setTokenStatus(ctx, req.Storage, status, tokenStatusInvalid); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasStatus {
+		b.Logger().Info(fmt.Sprintf("Token Revoked: mount=%s, jti=%s, status_list=%d, status_idx=%d", req.MountPoint, jti, status.List, status.Index))
+	} else {
+		b.Logger().Info(fmt.Sprintf("Token Revoked: mount=%s, jti=%s", req.MountPoint, jti))
+	}
+
+	return nil, nil
+}
+
+// revokeToken records the revocation of the token with the given jti until it expires.
+func (b *backend) revokeToken(ctx context.Context, stg logical.Storage, jti string, expiration time.Time) error {
+	if !expiration.After(time.Now()) {
+		return nil
+	}
+
+	entry, err := logical.StorageEntryJSON(revokedTokenPath(jti), &revokedToken{JTI: jti, Expiration: expiration})
+	if err != nil {
+		return err
+	}
+
+	return stg.Put(ctx, entry)
+}
+
+// isTokenRevoked checks if the token with the given jti has been revoked.
+func (b *backend) isTokenRevoked(ctx context.Context, stg logical.Storage, jti string) (bool, error) {
+	entry, err := stg.Get(ctx, revokedTokenPath(jti))
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+// tidyRevokedTokens removes the revocations of tokens that have expired, returning the number removed.
+func (b *backend) tidyRevokedTokens(ctx context.Context, stg logical.Storage) (int, error) {
+	entries, err := stg.List(ctx, revokedPath)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	removed := 0
+
+	for _, name := range entries {
+		entry, err := stg.Get(ctx, revokedPath+name)
+		if err != nil {
+			return removed, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		var revoked revokedToken
+		if err := entry.DecodeJSON(&revoked); err != nil {
+			return removed, err
+		}
+
+		if revoked.Expiration.After(now) {
+			continue
+		}
+
+		if err := stg.Delete(ctx, revokedPath+name); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// revokedTokenPath returns the storage path of a revocation; jtis are hashed as they are arbitrary strings.
+func revokedTokenPath(jti string) string {
+	hash := sha256.Sum256([]byte(jti))
+	return revokedPath + hex.EncodeToString(hash[:])
+}
+
+const pathRevokeHelpSyn = `
+Revoke a token.
+`
+
+const pathRevokeHelpDesc = `
+Revoke a token signed by this backend, identified by its 'jti' claim. The
+'verify' and 'introspect' endpoints treat revoked tokens as invalid. Revocations
+are retained until the token expires. Tokens referenced from a status list
+('status' claim) have their status set in the list, published at
+'status-list/<list>'.
+`
@@ -0,0 +1,108 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func revokeToken(b *backend, storage *logical.Storage, token string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyToken: token,
+		},
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestRevoke(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{})
+	otherToken := signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	if resp, err := revokeToken(b, storage, token); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+	if diff := deep.Equal(false, resp.Data[keyValid]); diff != nil {
+		t.Error("revoked token valid", diff)
+	}
+
+	if diff := deep.Equal(false, introspectToken(t, b, storage, token)["active"]); diff != nil {
+		t.Error("revoked token active", diff)
+	}
+
+	// Other tokens are unaffected
+	resp = verifyToken(t, b, storage, map[string]interface{}{keyToken: otherToken})
+	if diff := deep.Equal(true, resp.Data[keyValid]); diff != nil {
+		t.Error("other token valid", diff)
+	}
+
+	// Tokens not signed by the backend cannot be revoked
+	if resp, err := revokeToken(b, storage, "not-a-token"); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("revoking an invalid token should have failed")
+	}
+}
+
+func TestTidyRevokedTokens(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	entry, err := logical.StorageEntryJSON(revokedTokenPath("expired"), &revokedToken{JTI: "expired", Expiration: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := b.revokeToken(context.Background(), *storage, "unexpired", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	removed, err := b.tidyRevokedTokens(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(1, removed); diff != nil {
+		t.Error("removed revocations", diff)
+	}
+
+	entries, err := (*storage).List(context.Background(), revokedPath)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal([]string{revokedTokenPath("unexpired")[len(revokedPath):]}, entries); diff != nil {
+		t.Error("remaining revocations", diff)
+	}
+}
@@ -0,0 +1,305 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	roleTemplatesPath = "role-templates/"
+)
+
+// RoleTemplate holds role fields inherited by the roles referencing the template.
+type RoleTemplate struct {
+	// Fields are the role fields written to the template.
+	Fields map[string]interface{} `json:"fields"`
+}
+
+func pathRoleTemplates(b *backend) []*framework.Path {
+	fields := withClearField(roleFields())
+	delete(fields, keyRoleTemplate)
+	fields[keyRoleName] = &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: `Name of the role template.`,
+		Required:    true,
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "role-templates/" + framework.GenericNameRegex(keyRoleName),
+			Fields:  fields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathRoleTemplatesRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathRoleTemplatesWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRoleTemplatesWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathRoleTemplatesDelete,
+				},
+			},
+			ExistenceCheck:  b.pathRoleTemplatesExistenceCheck,
+			HelpSynopsis:    pathRoleTemplatesHelpSyn,
+			HelpDescription: pathRoleTemplatesHelpDesc,
+		},
+		{
+			Pattern: "role-templates/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathRoleTemplatesList,
+				},
+			},
+			HelpSynopsis:    pathRoleTemplatesListHelpSyn,
+			HelpDescription: pathRoleTemplatesListHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathRoleTemplatesExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	template, err := b.getRoleTemplate(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return false, err
+	}
+
+	return template != nil, nil
+}
+
+func (b *backend) pathRoleTemplatesList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, roleTemplatesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleTemplatesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	template, err := b.getRoleTemplate(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: template.Fields,
+	}, nil
+}
+
+func (b *backend) pathRoleTemplatesWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyRoleName).(string)
+
+	template, err := b.getRoleTemplate(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		template = &RoleTemplate{}
+	}
+
+	if d, err = clearedFields(d); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	template.Fields = templateOverrides(template.Fields, d)
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Templates must be valid on their own, and for each role inheriting them
+	templateData := &framework.FieldData{Raw: template.Fields, Schema: roleFields()}
+	if resp, err := b.updateRole(ctx, req.Storage, config, newRole(), templateData, false); resp != nil || err != nil {
+		return resp, err
+	}
+
+	roles, err := b.listTemplateRoles(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for roleName, role := range roles {
+		if _, resp, err := b.resolveRole(ctx, req.Storage, config, role, template); resp != nil {
+			return logical.ErrorResponse("role '%s' does not resolve with the template: %s", roleName, resp.Error()), logical.ErrInvalidRequest
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(roleTemplatesPath+name, template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = req.Storage.Put(ctx, entry)
+	b.cachedRoles.clear()
+
+	return nil, err
+}
+
+func (b *backend) pathRoleTemplatesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get(keyRoleName).(string)
+
+	roles, err := b.listTemplateRoles(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) > 0 {
+		roleNames := make([]string, 0, len(roles))
+		for roleName := range roles {
+			roleNames = append(roleNames, roleName)
+		}
+		return logical.ErrorResponse("role template is used by roles: %s", strings.Join(roleNames, ", ")), logical.ErrInvalidRequest
+	}
+
+	err = req.Storage.Delete(ctx, roleTemplatesPath+name)
+	b.cachedRoles.clear()
+
+	return nil, err
+}
+
+// getRoleTemplate returns the named role template, or nil if it does not exist.
+func (b *backend) getRoleTemplate(ctx context.Context, stg logical.Storage, name string) (*RoleTemplate, error) {
+	entry, err := stg.Get(ctx, roleTemplatesPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var template RoleTemplate
+	if err := entry.DecodeJSON(&template); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// listTemplateRoles returns the stored roles referencing the named template, by name.
+func (b *backend) listTemplateRoles(ctx context.Context, stg logical.Storage, templateName string) (map[string]*Role, error) {
+	names, err := stg.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := map[string]*Role{}
+	for _, name := range names {
+		role, err := b.getStoredRole(ctx, stg, name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.RoleTemplate == templateName {
+			roles[name] = role
+		}
+	}
+
+	return roles, nil
+}
+
+// resolveRole returns the role with the fields of its template, overridden by the role's; the template is
+// loaded when nil. An error response, with logical.ErrInvalidRequest, is returned when the resolved role is invalid.
+func (b *backend) resolveRole(ctx context.Context, stg logical.Storage, config *Config, role *Role, template *RoleTemplate) (*Role, *logical.Response, error) {
+	if template == nil {
+		var err error
+		if template, err = b.getRoleTemplate(ctx, stg, role.RoleTemplate); err != nil {
+			return nil, nil, err
+		}
+		if template == nil {
+			return nil, logical.ErrorResponse("unknown role template '%s'", role.RoleTemplate), logical.ErrInvalidRequest
+		}
+	}
+
+	fields := map[string]interface{}{}
+	for field, value := range template.Fields {
+		fields[field] = value
+	}
+	for field, value := range role.TemplateOverrides {
+		fields[field] = value
+	}
+
+	if _, ok := fields[keyIssuer]; !ok && fields[keyIssuerRef] == nil {
+		return nil, logical.ErrorResponse("missing issuer in role & its template"), logical.ErrInvalidRequest
+	}
+
+	resolved := newRole()
+	if resp, err := b.updateRole(ctx, stg, config, resolved, &framework.FieldData{Raw: fields, Schema: roleFields()}, true); resp != nil {
+		return nil, resp, logical.ErrInvalidRequest
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	resolved.RoleTemplate = role.RoleTemplate
+	resolved.TemplateOverrides = role.TemplateOverrides
+
+	return resolved, nil, nil
+}
+
+// templateOverrides returns the fields updated with the role fields written in the request.
+func templateOverrides(fields map[string]interface{}, d *framework.FieldData) map[string]interface{} {
+	updated := map[string]interface{}{}
+	for field, value := range fields {
+		updated[field] = value
+	}
+	for field := range d.Schema {
+		if field == keyRoleName || field == keyRoleTemplate {
+			continue
+		}
+		if value, ok := d.Raw[field]; ok {
+			// Overrides set to null are removed, inheriting the template's field
+			if value == nil {
+				delete(updated, field)
+			} else {
+				updated[field] = value
+			}
+		}
+	}
+	return updated
+}
+
+const pathRoleTemplatesHelpSyn = `
+Manage role templates, whose fields roles inherit.
+`
+
+const pathRoleTemplatesHelpDesc = `
+This path allows you to create, read, update, and delete role templates, which hold any
+of the fields of roles. Roles referencing a template with 'role_template' inherit its
+fields, resolved each time the role is used; fields written to the role override those
+of the template. Changes to a template apply to all of its roles, and are rejected when
+any of them would become invalid. Templates cannot be deleted while roles reference them.
+Fields set to null, or named by 'clear', are removed from the template.
+`
+
+const pathRoleTemplatesListHelpSyn = `
+List role templates.
+`
+
+const pathRoleTemplatesListHelpDesc = `
+List the names of the role templates.
+`
@@ -0,0 +1,146 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func writeRoleTemplate(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "role-templates/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func deleteRoleTemplate(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "role-templates/" + name,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestRoleTemplates(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "team", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	templateData := map[string]interface{}{
+		keyIssuer: "teams.example.com",
+		keyClaims: map[string]interface{}{"scope": "read"},
+		keyTTL:    "10m",
+	}
+	if resp, err := writeRoleTemplate(b, storage, "team", templateData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := writeRoleTemplate(b, storage, "invalid", map[string]interface{}{keyTTL: "forever"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("invalid template should have failed")
+	}
+	if resp, err := writeRoleData(b, storage, "unknown", map[string]interface{}{keyRoleTemplate: "unknown"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("role with unknown template should have failed")
+	}
+
+	roleData := map[string]interface{}{
+		keyRoleTemplate: "team",
+		keyClaims:       map[string]interface{}{"team": "payments"},
+	}
+	if resp, err := writeRoleData(b, storage, "payments", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Fields are inherited from the template, or overridden by the role
+	resp, err := readRole(b, storage, "payments")
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected := map[string]interface{}{
+		keyIssuer:       "teams.example.com",
+		keyClaims:       map[string]interface{}{"team": "payments"},
+		keyTTL:          "10m0s",
+		keyRoleTemplate: "team",
+	}
+	for field, value := range expected {
+		if diff := deep.Equal(value, resp.Data[field]); diff != nil {
+			t.Error(field, diff)
+		}
+	}
+
+	claims := unsafeClaims(t, signToken(t, b, storage, "payments", map[string]interface{}{}))
+	if diff := deep.Equal([]interface{}{"teams.example.com", "payments", nil}, []interface{}{claims["iss"], claims["team"], claims["scope"]}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Changes to the template apply when signing
+	templateData[keyIssuer] = "platform.example.com"
+	if resp, err := writeRoleTemplate(b, storage, "team", templateData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal("platform.example.com", unsafeClaims(t, signToken(t, b, storage, "payments", map[string]interface{}{}))["iss"]); diff != nil {
+		t.Error(diff)
+	}
+
+	// Template changes invalidating roles are rejected
+	if resp, err := writeRoleData(b, storage, "payments", map[string]interface{}{keyTTL: "2h"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := writeRoleTemplate(b, storage, "team", map[string]interface{}{keyMaxTTL: "1h"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("template invalidating a role should have failed")
+	}
+
+	if resp, err := deleteRoleTemplate(b, storage, "team"); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("deleting a template used by roles should have failed")
+	}
+
+	// Detaching the template keeps the inherited fields
+	if resp, err := writeRoleData(b, storage, "payments", map[string]interface{}{keyRoleTemplate: ""}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := deleteRoleTemplate(b, storage, "team"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, "payments")
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected[keyIssuer] = "platform.example.com"
+	expected[keyTTL] = "2h0m0s"
+	expected[keyRoleTemplate] = ""
+	for field, value := range expected {
+		if diff := deep.Equal(value, resp.Data[field]); diff != nil {
+			t.Error(field, diff)
+		}
+	}
+}
@@ -19,16 +19,74 @@ package jwtsecrets
 import (
 	"context"
 	"fmt"
+	"github.com/google/cel-go/cel"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
 	"path"
 	"regexp"
+	"strings"
+	"time"
 )
 
 const (
 	keyStorageRolePath = "role"
 	keyRoleName        = "name"
 	keyIssuer          = "issuer"
+	keyIsolatedKeyring = "isolated_keyring"
+	keyKey             = "key"
+
+	keyAllowedAlgorithms = "allowed_algorithms"
+
+	keyExchangeClaims  = "exchange_claims"
+	keyClaimPatterns   = "claim_patterns"
+	keyDeniedClaims    = "denied_claims"
+	keyMergeClaims     = "merge_claims"
+	keyClaimTypes      = "claim_types"
+	keyRequireAudience = "require_aud"
+	keyAllowedScopes   = "allowed_scopes"
+	keyStatusList      = "status_list"
+
+	keyAllowRequestClaims = "allow_request_claims"
+
+	keyEnabled   = "enabled"
+	keyNotBefore = "not_before"
+	keyNotAfter  = "not_after"
+
+	keyIssuerRef = "issuer_ref"
+
+	keyRequireCertificateBinding = "require_certificate_binding"
+	keyRequireDPoPProof          = "require_dpop_proof"
+	keyDPoPProofMaxAge           = "dpop_proof_max_age"
+	keyNonceReplayWindow         = "nonce_replay_window"
+
+	keyBindSubjectToEntity = "bind_subject_to_entity"
+	keySubjectTemplate     = "subject_template"
+
+	keyEncryptionKey       = "encryption_key"
+	keyEncryptionAlgorithm = "encryption_algorithm"
+	keyContentEncryption   = "content_encryption"
+
+	keyPayloadTypes        = "payload_types"
+	keyPayloadContentTypes = "payload_content_types"
+
+	keyTokenProfile       = "token_profile"
+	keyTokenType          = "token_type"
+	keyTrustDomainPattern = "trust_domain_pattern"
+	keyKubernetesPatterns = "kubernetes_patterns"
+
+	keyTemplateParameters = "template_parameters"
+	keyClaimsSchema       = "claims_schema"
+	keyPolicyExpression   = "policy_expression"
+
+	keyTTL    = "ttl"
+	keyMaxTTL = "max_ttl"
+
+	keyMaxTokensPerMinute = "max_tokens_per_minute"
+	keyMaxActiveTokens    = "max_active_tokens"
+
+	keyRoleTemplate = "role_template"
 )
 
 type Role struct {
@@ -36,9 +94,25 @@ type Role struct {
 	// Issuer defines the 'iss' claim for the issued JWT. It is required for each role.
 	Issuer string
 
+	// Disabled rejects requests issuing tokens of the role, while keeping its definition.
+	Disabled bool `json:"disabled"`
+
+	// NotBefore & NotAfter bound the period tokens of the role can be issued in, when not zero; tokens never
+	// outlive the role.
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+
 	// Claims defines claim values to be set on the issued JWT; each claim must be allowed by the plugin config.
 	Claims map[string]interface{} `json:"claims"`
 
+	// ClaimTypes maps claims provided by callers to their declared type, one of AllowedClaimTypes; claims are
+	// coerced to their type (e.g. "42" to 42 for numbers), failing when they cannot be.
+	ClaimTypes map[string]string `json:"claim_types"`
+
+	// MergeClaims maps object claims of the role, which sign requests can also provide, to the rule resolving
+	// conflicts when the role's & request's objects are deep merged; one of AllowedClaimMergeRules.
+	MergeClaims map[string]string `json:"merge_claims"`
+
 	// SubjectPattern defines a regular expression (https://golang.org/pkg/regexp/) which must be matched by any
 	// incoming 'sub' claims. This restriction is in addition to that defined on the plugin config.
 	SubjectPattern string
@@ -48,65 +122,617 @@ type Role struct {
 	// This restriction is in addition to that defined on the plugin config.
 	AudiencePattern string
 
+	// BindSubjectToEntity sets the 'sub' claim from the entity of the requesting token, ignoring any provided by
+	// callers, so callers can only issue tokens for their own identity.
+	BindSubjectToEntity bool `json:"bind_subject_to_entity"`
+
+	// SubjectTemplate is the identity template the 'sub' claim of entity bound subjects is resolved from;
+	// defaults to DefaultSubjectTemplate.
+	SubjectTemplate string `json:"subject_template"`
+
+	// AllowedAudiences defines the audiences ('aud' claim) tokens of the role can have, when not empty. This
+	// restriction is in addition to those of the audience pattern & the plugin config.
+	AllowedAudiences []string `json:"allowed_audiences"`
+
+	// MaxAudiences defines the maximum number of audiences ('aud' claim) tokens of the role can have, in addition to
+	// the config's maximum; the stricter of both applies. The role has no maximum of its own when negative.
+	MaxAudiences int `json:"max_audiences"`
+
+	// AllowedScopes defines the scopes sign requests can request, which are set as the space-delimited 'scope' claim.
+	AllowedScopes []string `json:"allowed_scopes"`
+
+	// RequireCertificateBinding requires tokens of the role to be bound to a client certificate (RFC 8705).
+	RequireCertificateBinding bool `json:"require_certificate_binding"`
+
+	// RequireDPoPProof requires tokens of the role to be bound to the key of a fresh DPoP proof (RFC 9449).
+	RequireDPoPProof bool `json:"require_dpop_proof"`
+
+	// DPoPProofMaxAge is the maximum age of DPoP proofs; defaults to DefaultDPoPProofMaxAge when zero.
+	DPoPProofMaxAge time.Duration `json:"dpop_proof_max_age"`
+
+	// NonceReplayWindow is the duration a nonce provided to sign cannot be reused for; nonces can be reused when zero.
+	NonceReplayWindow time.Duration `json:"nonce_replay_window"`
+
+	// RequireAudience requires tokens of the role to have at least one audience ('aud' claim).
+	RequireAudience bool `json:"require_aud"`
+
+	// StatusList references each issued token from a status list ('status' claim), where its revocation is published.
+	StatusList bool `json:"status_list"`
+
+	// ClaimPatterns maps claim names to regular expressions which must be matched by the claims. If a claim is an
+	// array, each element in the array must match the pattern. This restriction is in addition to the subject &
+	// audience patterns.
+	ClaimPatterns map[string]string `json:"claim_patterns"`
+
+	// DeniedClaims defines claims which cannot be provided to sign (or exchanged) by callers of the role, even if
+	// allowed by the plugin config.
+	DeniedClaims []string `json:"denied_claims"`
+
+	// DenyRequestClaims locks the role's claims to those of the role & its templates; sign requests providing
+	// claims, and token exchanges requesting audiences, are rejected.
+	DenyRequestClaims bool `json:"deny_request_claims"`
+
 	// Headers defines header values to be set on the issued JWT; each header must be allowed by the plugin config.
 	Headers map[string]interface{} `json:"headers"`
+
+	// IsolatedKeyring defines if tokens are signed with keys dedicated to the role, instead of the mount-wide keys.
+	IsolatedKeyring bool
+
+	// Key is the name of the key set used to sign tokens, instead of the mount-wide keys.
+	Key string
+
+	// AllowedAlgorithms defines the signature algorithms tokens of the role can be signed with, when not empty;
+	// signing fails while the role's keys use another algorithm.
+	AllowedAlgorithms []string `json:"allowed_algorithms"`
+
+	// IssuerRef is the name of the hosted issuer issuing the role's tokens, signed with the issuer's key set.
+	IssuerRef string `json:"issuer_ref"`
+
+	// hostedIssuer is the issuer named by IssuerRef, bound when the role is loaded.
+	hostedIssuer *TrustedIssuer
+
+	// ExchangeClaims maps claims of exchanged subject tokens to the claims of the issued JWT.
+	ExchangeClaims map[string]string `json:"exchange_claims"`
+
+	// EncryptionKey is the recipient public key (JWK or PEM) issued tokens are encrypted to, after signing.
+	EncryptionKey string
+
+	// EncryptionAlgorithm is the key management algorithm used to encrypt tokens; defaults according to the key type.
+	EncryptionAlgorithm string
+
+	// ContentEncryption is the content encryption algorithm used to encrypt tokens; defaults to A256GCM.
+	ContentEncryption string
+
+	// PayloadTypes defines the types ('typ' header) of payloads the role can sign; payload signing is disabled when empty.
+	PayloadTypes []string `json:"payload_types"`
+
+	// PayloadContentTypes defines the content types ('cty' header) of payloads the role can sign.
+	PayloadContentTypes []string `json:"payload_content_types"`
+
+	// TokenProfile defines the profile of issued tokens; tokens are typed according to the profile and
+	// must include the profile's required claims.
+	TokenProfile string `json:"token_profile"`
+
+	// TokenType defines the type ('typ' header) of issued tokens, overriding the type of the token profile.
+	TokenType string `json:"token_type"`
+
+	// TrustDomainPattern defines a regular expression which must match the trust domain of the SPIFFE ID
+	// ('sub' claim) of JWT-SVIDs.
+	TrustDomainPattern string `json:"trust_domain_pattern"`
+
+	// KubernetesPatterns maps the parameters of Kubernetes style tokens (see KubernetesParameters) to regular
+	// expressions which must match the entire parameter; parameters without a pattern cannot be provided.
+	KubernetesPatterns map[string]string `json:"kubernetes_patterns"`
+
+	// TTL defines how long the role's tokens are valid for; defaults to the configured token TTL when zero.
+	TTL time.Duration `json:"ttl"`
+
+	// MaxTTL caps the lifetime of the role's tokens; defaults to the configured max token TTL when zero.
+	MaxTTL time.Duration `json:"max_ttl"`
+
+	// ResponseWrapTTL response wraps sign responses with the TTL, unless callers request wrapping; defaults to the
+	// configured response wrap TTL when zero.
+	ResponseWrapTTL time.Duration `json:"response_wrap_ttl"`
+
+	// MaxTokensPerMinute limits the rate the role issues tokens at, per Vault node; unlimited when zero.
+	MaxTokensPerMinute int `json:"max_tokens_per_minute"`
+
+	// MaxActiveTokens limits the number of unexpired tokens issued by the role; unlimited when zero.
+	MaxActiveTokens int `json:"max_active_tokens"`
+
+	// RoleTemplate names the role template the role inherits its fields from, resolved each time the role is
+	// used. Roles with a template store only their TemplateOverrides.
+	RoleTemplate string `json:"role_template"`
+
+	// TemplateOverrides are the fields written to a role with a template, overriding those of the template.
+	TemplateOverrides map[string]interface{} `json:"template_overrides"`
+
+	// TemplateParameters defines the sign request parameters the role's claims can reference as Go templates
+	// (e.g. 'repo/{{.repo}}').
+	TemplateParameters []string `json:"template_parameters"`
+
+	// ClaimsSchema defines a JSON Schema the claims of sign requests must satisfy.
+	ClaimsSchema string `json:"claims_schema"`
+
+	// PolicyExpression defines a CEL expression, evaluated against the claims of each token and the request,
+	// which must be true for the token to be issued.
+	PolicyExpression string `json:"policy_expression"`
+
+	// policyProgram is the compiled PolicyExpression, compiled when the role is written or loaded.
+	policyProgram cel.Program
+}
+
+// tokenProfile returns the name of the profile of the role's tokens.
+func (r *Role) tokenProfile() string {
+	return firstNonEmpty(r.TokenProfile, TokenProfileJWT)
+}
+
+// deniesClaim checks if callers of the role are denied from providing the claim.
+func (r *Role) deniesClaim(claim string) bool {
+	return stringInSlice(claim, r.DeniedClaims)
+}
+
+// subjectTemplate returns the identity template of entity bound subjects.
+func (r *Role) subjectTemplate() string {
+	return firstNonEmpty(r.SubjectTemplate, DefaultSubjectTemplate)
+}
+
+// dpopProofMaxAge returns the maximum age of DPoP proofs.
+func (r *Role) dpopProofMaxAge() time.Duration {
+	if r.DPoPProofMaxAge > 0 {
+		return r.DPoPProofMaxAge
+	}
+	return DefaultDPoPProofMaxAge
+}
+
+// checkIssuable checks if tokens of the role can be issued at the time; the role must be enabled, and the time
+// within the role's period.
+func (r *Role) checkIssuable(name string, now time.Time) error {
+	switch {
+	case r.Disabled:
+		return fmt.Errorf("role '%s' is disabled", name)
+	case !r.NotBefore.IsZero() && now.Before(r.NotBefore):
+		return fmt.Errorf("role '%s' cannot issue tokens before %s", name, formatRoleTime(r.NotBefore))
+	case !r.NotAfter.IsZero() && !now.Before(r.NotAfter):
+		return fmt.Errorf("role '%s' cannot issue tokens after %s", name, formatRoleTime(r.NotAfter))
+	default:
+		return nil
+	}
+}
+
+// parseRoleTime parses the time of a role field, or the zero time when empty.
+func parseRoleTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := parseExpiresAt(raw)
+	return parsed.UTC(), err
+}
+
+// formatRoleTime formats the time of a role field as an RFC 3339 date, or empty when zero.
+func formatRoleTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// allowsAlgorithm checks if the role's tokens can be signed with the algorithm.
+func (r *Role) allowsAlgorithm(alg jose.SignatureAlgorithm) bool {
+	return len(r.AllowedAlgorithms) == 0 || stringInSlice(string(alg), r.AllowedAlgorithms)
+}
+
+// profile returns the profile of the role's tokens.
+func (r *Role) profile() *tokenProfile {
+	return tokenProfiles[r.tokenProfile()]
+}
+
+// roleTokenTTLs returns the default & maximum lifetimes of the role's tokens, limited by the config.
+func (b *backend) roleTokenTTLs(config *Config, role *Role) (time.Duration, time.Duration) {
+	maxTTL := b.maxTokenTTL(config)
+	if role.MaxTTL > 0 {
+		maxTTL = durationMin(role.MaxTTL, maxTTL)
+	}
+
+	ttl := config.TokenTTL
+	if role.TTL > 0 {
+		ttl = role.TTL
+	}
+
+	return durationMin(ttl, maxTTL), maxTTL
+}
+
+// maxAudiences returns the maximum number of audiences of the role's tokens, the stricter of the role's & the
+// config's, or -1 when unlimited.
+func (r *Role) maxAudiences(config *Config) int {
+	switch {
+	case r.MaxAudiences < 0:
+		return config.MaxAudiences
+	case config.MaxAudiences < 0:
+		return r.MaxAudiences
+	default:
+		return intMin(r.MaxAudiences, config.MaxAudiences)
+	}
+}
+
+// responseWrapTTL returns the TTL the role's sign responses are wrapped with, or zero when they are not.
+func (r *Role) responseWrapTTL(config *Config) time.Duration {
+	if r.ResponseWrapTTL > 0 {
+		return r.ResponseWrapTTL
+	}
+	return config.ResponseWrapTTL
+}
+
+// tokenType returns the type ('typ' header) of the role's tokens.
+func (r *Role) tokenType() string {
+	return firstNonEmpty(r.TokenType, r.profile().Type)
+}
+
+// encryption returns the encryption of the role's tokens to the recipient key, or nil when
+// tokens are not encrypted. The key provided with a request takes precedence over the role's key.
+func (r *Role) encryption(requestKey string) (*tokenEncryption, error) {
+	rawKey := firstNonEmpty(requestKey, r.EncryptionKey)
+	if rawKey == "" {
+		return nil, nil
+	}
+
+	return newTokenEncryption(rawKey, r.EncryptionAlgorithm, r.ContentEncryption)
+}
+
+// issuer returns the issuer of the role's tokens; that of the hosted issuer the role is bound to, if any.
+func (r *Role) issuer() string {
+	if r.hostedIssuer != nil {
+		return r.hostedIssuer.Issuer
+	}
+	return r.Issuer
+}
+
+// keySet returns the name of the key set used to sign the role's tokens; that of the hosted issuer the role
+// is bound to, if any.
+func (r *Role) keySet() string {
+	if r.hostedIssuer != nil {
+		return r.hostedIssuer.Key
+	}
+	return r.Key
+}
+
+// keyring returns the name of the keyring used to sign the role's tokens.
+func (r *Role) keyring(name string) string {
+	if keySet := r.keySet(); keySet != "" {
+		return keySetKeyringName(keySet)
+	}
+	if r.IsolatedKeyring {
+		return roleKeyringName(name)
+	}
+	return mainKeyName
+}
+
+// roleKeyConfig returns the configuration of the keys used to sign the role's tokens.
+func (b *backend) roleKeyConfig(ctx context.Context, stg logical.Storage, config *Config, role *Role) (*Config, error) {
+	keySetName := role.keySet()
+	if keySetName == "" {
+		return config, nil
+	}
+
+	keySet, err := b.getKeySet(ctx, stg, keySetName)
+	if err != nil {
+		return nil, err
+	}
+	if keySet == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unknown key set '%s'", keySetName)}
+	}
+
+	return keySet.config(config), nil
 }
 
 // Return response data for a role
 func (r *Role) toResponseData() map[string]interface{} {
 	respData := map[string]interface{}{
-		keyIssuer:          r.Issuer,
-		keyClaims:          r.Claims,
-		keyHeaders:         r.Headers,
-		keySubjectPattern:  r.SubjectPattern,
-		keyAudiencePattern: r.AudiencePattern,
+		keyIssuer:              r.Issuer,
+		keyClaims:              r.Claims,
+		keyHeaders:             r.Headers,
+		keySubjectPattern:      r.SubjectPattern,
+		keyAudiencePattern:     r.AudiencePattern,
+		keyIsolatedKeyring:     r.IsolatedKeyring,
+		keyKey:                 r.Key,
+		keyAllowedAlgorithms:   r.AllowedAlgorithms,
+		keyIssuerRef:           r.IssuerRef,
+		keyExchangeClaims:      r.ExchangeClaims,
+		keyClaimPatterns:       r.ClaimPatterns,
+		keyDeniedClaims:        r.DeniedClaims,
+		keyAllowRequestClaims:  !r.DenyRequestClaims,
+		keyEnabled:             !r.Disabled,
+		keyNotBefore:           formatRoleTime(r.NotBefore),
+		keyNotAfter:            formatRoleTime(r.NotAfter),
+		keyMergeClaims:         r.MergeClaims,
+		keyClaimTypes:          r.ClaimTypes,
+		keyRequireAudience:     r.RequireAudience,
+		keyAllowedScopes:       r.AllowedScopes,
+		keyStatusList:          r.StatusList,
+		keyAllowedAudiences:    r.AllowedAudiences,
+		keyMaxAllowedAudiences: r.MaxAudiences,
+
+		keyRequireCertificateBinding: r.RequireCertificateBinding,
+		keyRequireDPoPProof:          r.RequireDPoPProof,
+		keyDPoPProofMaxAge:           r.dpopProofMaxAge().String(),
+		keyNonceReplayWindow:         r.NonceReplayWindow.String(),
+
+		keyBindSubjectToEntity: r.BindSubjectToEntity,
+		keySubjectTemplate:     r.SubjectTemplate,
+
+		keyEncryptionKey:       r.EncryptionKey,
+		keyEncryptionAlgorithm: r.EncryptionAlgorithm,
+		keyContentEncryption:   r.ContentEncryption,
+		keyPayloadTypes:        r.PayloadTypes,
+		keyPayloadContentTypes: r.PayloadContentTypes,
+		keyTokenProfile:        r.tokenProfile(),
+		keyTokenType:           r.tokenType(),
+		keyTrustDomainPattern:  r.TrustDomainPattern,
+		keyKubernetesPatterns:  r.KubernetesPatterns,
+		keyTTL:                 r.TTL.String(),
+		keyMaxTTL:              r.MaxTTL.String(),
+		keyResponseWrapTTL:     r.ResponseWrapTTL.String(),
+		keyMaxTokensPerMinute:  r.MaxTokensPerMinute,
+		keyMaxActiveTokens:     r.MaxActiveTokens,
+		keyTemplateParameters:  r.TemplateParameters,
+		keyClaimsSchema:        r.ClaimsSchema,
+		keyPolicyExpression:    r.PolicyExpression,
+		keyRoleTemplate:        r.RoleTemplate,
 	}
 	return respData
 }
 
-func pathRole(b *backend) []*framework.Path {
-	return []*framework.Path{
-		{
-			Pattern: "roles/" + framework.GenericNameRegex(keyRoleName),
-			Fields: map[string]*framework.FieldSchema{
-				keyRoleName: {
-					Type:        framework.TypeLowerCaseString,
-					Description: `Specifies the name of the role to create. This is part of the request URL.`,
-					Required:    true,
-				},
-				keyIssuer: {
-					Type:        framework.TypeString,
-					Description: `Value to set as the 'iss' claim. Required on all roles.`,
-				},
-				keyClaims: {
-					Type:        framework.TypeMap,
-					Description: `Claims to be set on issued JWTs. Each claim must be allowed by the configuration.`,
-				},
-				keySubjectPattern: {
-					Type: framework.TypeString,
-					Description: `Regular expression which must match 'sub' claims provided during sign requests.
+// roleFields returns the fields of roles, which role templates share.
+func roleFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		keyRoleName: {
+			Type:        framework.TypeLowerCaseString,
+			Description: `Specifies the name of the role to create. This is part of the request URL.`,
+			Required:    true,
+		},
+		keyIssuer: {
+			Type: framework.TypeString,
+			Description: `Value to set as the 'iss' claim. Required on all roles not bound to a hosted issuer.
+Can include identity templates, and the '{{mount_path}}' & '{{namespace}}' placeholders.`,
+		},
+		keyIssuerRef: {
+			Type: framework.TypeString,
+			Description: `Name of the hosted issuer issuing the role's tokens, signed with the issuer's key set;
+instead of 'issuer' & 'key'.`,
+		},
+		keyClaims: {
+			Type:        framework.TypeMap,
+			Description: `Claims to be set on issued JWTs. Each claim must be allowed by the configuration.`,
+		},
+		keySubjectPattern: {
+			Type: framework.TypeString,
+			Description: `Regular expression which must match 'sub' claims provided during sign requests.
 This restriction is in addition to that defined in the config.`,
-				},
-				keyAudiencePattern: {
-					Type: framework.TypeString,
-					Description: `Regular expression which must match 'aud' claims provided during sign requests.
+		},
+		keyAudiencePattern: {
+			Type: framework.TypeString,
+			Description: `Regular expression which must match 'aud' claims provided during sign requests.
 This restriction is in addition to that defined in the config.`,
-				},
-				keyMaxAllowedAudiences: {
-					Type: framework.TypeInt,
-					Description: `Maximum number of allowed audiences, or -1 for no limit.
-Must be less than or equal to the maximum number of allowed audiences defined in the config`,
-				},
-				keyAllowedClaims: {
-					Type: framework.TypeStringSlice,
-					Description: `Claims which are able to be set in addition to ones generated by the backend.
+		},
+		keyMaxAllowedAudiences: {
+			Type:    framework.TypeInt,
+			Default: DefaultMaxAudiences,
+			Description: `Maximum number of allowed audiences, or -1 for no limit. The stricter of this and
+the maximum number of allowed audiences defined in the config applies.`,
+		},
+		keyAllowedClaims: {
+			Type: framework.TypeStringSlice,
+			Description: `Claims which are able to be set in addition to ones generated by the backend.
 Note: 'aud' and 'sub' should be in this list if you would like to set them.`,
-				},
-				keyHeaders: {
-					Type:        framework.TypeMap,
-					Description: `Headers to be set on issued JWTs. Each header must be allowed by the configuration.`,
-				},
-			},
+		},
+		keyHeaders: {
+			Type:        framework.TypeMap,
+			Description: `Headers to be set on issued JWTs. Each header must be allowed by the configuration.`,
+		},
+		keyIsolatedKeyring: {
+			Type: framework.TypeBool,
+			Description: `Whether tokens are signed with keys dedicated to the role, published at 'jwks/<role>'.
+Requires the local signer.`,
+		},
+		keyKey: {
+			Type:        framework.TypeString,
+			Description: `Name of the key set used to sign tokens, instead of the mount-wide keys. Requires the local signer.`,
+		},
+		keyAllowedAlgorithms: {
+			Type: framework.TypeCommaStringSlice,
+			Description: `Signature algorithms tokens of the role can be signed with; any algorithm when empty.
+Signing fails while the role's keys use another algorithm.`,
+		},
+		keyClaimPatterns: {
+			Type: framework.TypeKVPairs,
+			Description: `Regular expressions which must match claims, as a map of claim name to pattern. Each
+element of array claims must match the pattern.`,
+		},
+		keyAllowedAudiences: {
+			Type: framework.TypeCommaStringSlice,
+			Description: `Audiences ('aud' claim) tokens can have, as exact values; in addition to the
+configured restrictions.`,
+		},
+		keyAllowedScopes: {
+			Type:        framework.TypeCommaStringSlice,
+			Description: `Scopes sign requests can request, set as the space-delimited 'scope' claim.`,
+		},
+		keyRequireCertificateBinding: {
+			Type: framework.TypeBool,
+			Description: `Require tokens to be bound to a client certificate ('cnf' claim), provided by sign
+requests.`,
+		},
+		keyRequireDPoPProof: {
+			Type: framework.TypeBool,
+			Description: `Require tokens to be bound to the key of a fresh DPoP proof ('cnf' claim), provided by
+sign requests.`,
+		},
+		keyDPoPProofMaxAge: {
+			Type:        framework.TypeString,
+			Description: `Maximum age of DPoP proofs; defaults to 1m.`,
+		},
+		keyNonceReplayWindow: {
+			Type:        framework.TypeString,
+			Description: `Duration a nonce provided to sign cannot be reused for; nonces can be reused when zero.`,
+		},
+		keyRequireAudience: {
+			Type:        framework.TypeBool,
+			Description: `Require tokens to have at least one audience ('aud' claim).`,
+		},
+		keyStatusList: {
+			Type: framework.TypeBool,
+			Description: `Reference issued tokens from a status list ('status' claim), published at
+'status-list/<list>', where their revocation is published.`,
+		},
+		keyBindSubjectToEntity: {
+			Type: framework.TypeBool,
+			Description: `Set the 'sub' claim from the entity of the requesting token, ignoring any provided
+by callers.`,
+		},
+		keySubjectTemplate: {
+			Type: framework.TypeString,
+			Description: `Identity template the 'sub' claim of entity bound subjects is resolved from; defaults
+to '{{identity.entity.id}}'.`,
+		},
+		keyClaimTypes: {
+			Type: framework.TypeKVPairs,
+			Description: `Types of claims provided by callers, as a map of claim name to type; 'string', 'number',
+'bool' or 'string-array'. Claims are coerced to their type, or rejected.`,
+		},
+		keyMergeClaims: {
+			Type: framework.TypeKVPairs,
+			Description: `Object claims of the role sign requests can also provide, deep merging both, as a map
+of claim name to the rule resolving conflicting values; 'role', 'request' or 'reject'.`,
+		},
+		keyDeniedClaims: {
+			Type: framework.TypeCommaStringSlice,
+			Description: `Claims which cannot be provided by callers of the role, even if allowed by the
+configuration.`,
+		},
+		keyEnabled: {
+			Type:    framework.TypeBool,
+			Default: true,
+			Description: `Whether tokens can be issued for the role; disabled roles reject sign requests, while
+keeping their definition.`,
+		},
+		keyNotBefore: {
+			Type:        framework.TypeString,
+			Description: `Time (RFC 3339 date or unix time) from which tokens can be issued for the role.`,
+		},
+		keyNotAfter: {
+			Type: framework.TypeString,
+			Description: `Time (RFC 3339 date or unix time) after which tokens can no longer be issued for the role;
+tokens never outlive it.`,
+		},
+		keyAllowRequestClaims: {
+			Type:    framework.TypeBool,
+			Default: true,
+			Description: `Whether callers can provide claims; when false, claims come solely from the role
+and its templates.`,
+		},
+		keyExchangeClaims: {
+			Type: framework.TypeKVPairs,
+			Description: `Claims of subject tokens copied to tokens issued by token exchange, as a map of subject
+token claim to issued token claim. Defaults to copying the 'sub' claim.`,
+		},
+		keyEncryptionKey: {
+			Type: framework.TypeString,
+			Description: `Recipient public key, as a JWK or PEM encoded public key or certificate, issued tokens
+are encrypted to after signing.`,
+		},
+		keyEncryptionAlgorithm: {
+			Type: framework.TypeString,
+			Description: `Key management algorithm used to encrypt tokens; defaults to 'RSA-OAEP-256' for RSA keys
+and 'ECDH-ES+A256KW' for EC keys.`,
+		},
+		keyContentEncryption: {
+			Type:        framework.TypeString,
+			Description: `Content encryption algorithm used to encrypt tokens; defaults to 'A256GCM'.`,
+		},
+		keyPayloadTypes: {
+			Type: framework.TypeCommaStringSlice,
+			Description: `Types ('typ' header) of payloads the role can sign using 'sign-payload'; payload signing
+is disabled when empty.`,
+		},
+		keyPayloadContentTypes: {
+			Type:        framework.TypeCommaStringSlice,
+			Description: `Content types ('cty' header) of payloads the role can sign using 'sign-payload'.`,
+		},
+		keyTokenProfile: {
+			Type: framework.TypeString,
+			Description: `Profile of issued tokens; 'jwt' (default), 'at+jwt' for OAuth 2.0 access tokens
+following RFC 9068, 'jwt-svid' for SPIFFE JWT-SVIDs, 'vc+jwt' for W3C Verifiable Credentials,
+'client-assertion' for OAuth 2.0 client assertions following RFC 7523, 'gcp-workload-identity' for
+tokens exchangeable for Google Cloud credentials, 'aws-web-identity' for tokens assuming AWS IAM roles,
+'kubernetes' for tokens shaped like Kubernetes service account tokens, or 'github-actions' for tokens shaped
+like GitHub Actions OIDC tokens.`,
+		},
+		keyTokenType: {
+			Type: framework.TypeString,
+			Description: `Type ('typ' header) of issued tokens, e.g. 'JWT' or 'secevent+jwt'; defaults to the type
+of the token profile. Must be 'JWT' or an explicit JWT type ('<type>+jwt').`,
+		},
+		keyTemplateParameters: {
+			Type: framework.TypeCommaStringSlice,
+			Description: `Parameters of sign requests the role's claims can reference as Go templates,
+e.g. 'repo/{{.repo}}'.`,
+		},
+		keyClaimsSchema: {
+			Type: framework.TypeString,
+			Description: `JSON Schema the claims of sign requests must satisfy, in addition to being allowed by
+the configuration; schemas using unsupported keywords are rejected.`,
+		},
+		keyPolicyExpression: {
+			Type: framework.TypeString,
+			Description: `Policy expression (CEL), over the token's 'claims' and the 'request', which must be true for
+tokens to be issued.`,
+		},
+		keyTrustDomainPattern: {
+			Type: framework.TypeString,
+			Description: `Regular expression which must match the entire trust domain of the SPIFFE ID ('sub' claim)
+of JWT-SVIDs. Required by the 'jwt-svid' token profile.`,
+		},
+		keyKubernetesPatterns: {
+			Type: framework.TypeKVPairs,
+			Description: `Regular expressions which must match the entire 'namespace', 'serviceaccount' & 'pod'
+parameters of Kubernetes style tokens, as a map of parameter to pattern. The 'namespace' &
+'serviceaccount' patterns are required by the 'kubernetes' token profile.`,
+		},
+		keyTTL: {
+			Type:        framework.TypeString,
+			Description: `Duration the role's tokens are valid for; defaults to the configured 'jwt_ttl'.`,
+		},
+		keyMaxTTL: {
+			Type: framework.TypeString,
+			Description: `Maximum duration the role's tokens are valid for; must be less than or equal to the
+configured 'jwt_max_ttl'.`,
+		},
+		keyResponseWrapTTL: {
+			Type: framework.TypeString,
+			Description: `TTL the role's sign responses are response wrapped with, when not requested by callers;
+defaults to the configured 'response_wrap_ttl'.`,
+		},
+		keyMaxTokensPerMinute: {
+			Type:        framework.TypeInt,
+			Description: `Maximum number of tokens the role issues per minute, on each Vault node; unlimited when 0.`,
+		},
+		keyMaxActiveTokens: {
+			Type:        framework.TypeInt,
+			Description: `Maximum number of unexpired tokens issued by the role; unlimited when 0.`,
+		},
+		keyRoleTemplate: {
+			Type: framework.TypeString,
+			Description: `Name of a role template the role inherits its fields from; the fields written to the
+role override those of the template. Set to empty to detach the template, keeping the inherited fields.`,
+		},
+	}
+}
+
+func pathRole(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "roles/" + roleNameRegex(keyRoleName),
+			Fields:  withClearField(roleFields()),
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
 					Callback: b.pathRolesRead,
@@ -117,6 +743,9 @@ Note: 'aud' and 'sub' should be in this list if you would like to set them.`,
 				logical.UpdateOperation: &framework.PathOperation{
 					Callback: b.pathRolesWrite,
 				},
+				logical.PatchOperation: &framework.PathOperation{
+					Callback: b.pathRolesWrite,
+				},
 				logical.DeleteOperation: &framework.PathOperation{
 					Callback: b.pathRolesDelete,
 				},
@@ -156,7 +785,57 @@ func (b *backend) pathRolesList(ctx context.Context, req *logical.Request, _ *fr
 		return nil, err
 	}
 
-	return logical.ListResponse(entries), nil
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := map[string]interface{}{}
+
+	// Roles failing to load, e.g. bound to an unknown hosted issuer, are listed with their error
+	for _, name := range entries {
+		role, err := b.getRole(ctx, req.Storage, name)
+		if err == nil && role == nil {
+			continue
+		}
+
+		var info map[string]interface{}
+		if err == nil {
+			info, err = b.roleInfo(ctx, req.Storage, config, role)
+		}
+		if err != nil {
+			b.Logger().Warn("Role failed to load while listing", "role", name, "error", err)
+			info = map[string]interface{}{"error": err.Error()}
+		}
+
+		keyInfo[name] = info
+	}
+
+	return logical.ListResponseWithInfo(entries, keyInfo), nil
+}
+
+// roleInfo returns the summary of a role included in role listings; its issuer, the algorithm, effective
+// TTLs & key binding of its tokens.
+func (b *backend) roleInfo(ctx context.Context, stg logical.Storage, config *Config, role *Role) (map[string]interface{}, error) {
+	keyConfig, err := b.roleKeyConfig(ctx, stg, config, role)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, maxTTL := b.roleTokenTTLs(config, role)
+
+	return map[string]interface{}{
+		keyIssuer:             role.issuer(),
+		keySignatureAlgorithm: keyConfig.SignatureAlgorithm,
+		keyTTL:                ttl.String(),
+		keyMaxTTL:             maxTTL.String(),
+		keyKey:                role.keySet(),
+		keyIssuerRef:          role.IssuerRef,
+		keyIsolatedKeyring:    role.IsolatedKeyring,
+		keyTokenProfile:       role.tokenProfile(),
+		keyRoleTemplate:       role.RoleTemplate,
+		keyEnabled:            !role.Disabled,
+	}, nil
 }
 
 // pathRolesRead makes a request to Vault storage to read a role and return response data
@@ -182,17 +861,11 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		return logical.ErrorResponse("missing role name"), nil
 	}
 
-	role, err := b.getRole(ctx, req.Storage, name.(string))
+	role, err := b.getStoredRole(ctx, req.Storage, name.(string))
 	if err != nil {
 		return nil, err
 	}
 
-	if role == nil {
-		role = &Role{}
-		role.SubjectPattern = DefaultSubjectPattern
-		role.AudiencePattern = DefaultAudiencePattern
-	}
-
 	config, err := b.getConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
@@ -200,9 +873,98 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 
 	createOperation := req.Operation == logical.CreateOperation
 
+	// Patches update the fields of existing roles
+	if req.Operation == logical.PatchOperation && role == nil {
+		return logical.ErrorResponse("unknown role"), logical.ErrInvalidRequest
+	}
+
+	// Fields set to null, or named by 'clear', are cleared
+	if d, err = clearedFields(d); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	newRoleTemplate, roleTemplateOk := d.GetOk(keyRoleTemplate)
+
+	switch {
+	case roleTemplateOk && newRoleTemplate.(string) != "":
+		// Attaching a template replaces the fields of a role without one
+		if role == nil || role.RoleTemplate == "" {
+			role = &Role{}
+		}
+		role.RoleTemplate = newRoleTemplate.(string)
+		role.TemplateOverrides = templateOverrides(role.TemplateOverrides, d)
+
+	case role != nil && role.RoleTemplate != "" && !roleTemplateOk:
+		role.TemplateOverrides = templateOverrides(role.TemplateOverrides, d)
+
+	default:
+		if role == nil {
+			role = newRole()
+		} else if role.RoleTemplate != "" {
+			// Detaching the template keeps the fields the role resolved to
+			resolved, resp, err := b.resolveRole(ctx, req.Storage, config, role, nil)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+			role = resolved
+			role.RoleTemplate = ""
+			role.TemplateOverrides = nil
+		}
+
+		// The issuer can only be cleared by roles bound to a hosted issuer
+		required := []string{keyIssuer}
+		if issuerRef, _ := d.Raw[keyIssuerRef].(string); issuerRef != "" || role.IssuerRef != "" {
+			required = nil
+		}
+
+		if d, err = patchFieldData(d, roleClearedValues, required...); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		if resp, err := b.updateRole(ctx, req.Storage, config, role, d, createOperation); resp != nil || err != nil {
+			return resp, err
+		}
+
+		return nil, b.setRole(ctx, req.Storage, name.(string), role)
+	}
+
+	// Roles with a template are stored unresolved, after checking they resolve
+	if _, resp, err := b.resolveRole(ctx, req.Storage, config, role, nil); resp != nil || err != nil {
+		return resp, err
+	}
+
+	return nil, b.setRole(ctx, req.Storage, name.(string), role)
+}
+
+// roleClearedValues are the values role fields are cleared to, where they differ from the zero value of their type.
+var roleClearedValues = map[string]interface{}{
+	keySubjectPattern:      DefaultSubjectPattern,
+	keyAudiencePattern:     DefaultAudiencePattern,
+	keyTokenProfile:        TokenProfileJWT,
+	keyDPoPProofMaxAge:     "0s",
+	keyNonceReplayWindow:   "0s",
+	keyTTL:                 "0s",
+	keyMaxTTL:              "0s",
+	keyResponseWrapTTL:     "0s",
+	keyMaxAllowedAudiences: DefaultMaxAudiences,
+}
+
+// newRole returns a role with the default patterns, and no maximum number of audiences of its own.
+func newRole() *Role {
+	return &Role{
+		SubjectPattern:  DefaultSubjectPattern,
+		AudiencePattern: DefaultAudiencePattern,
+		MaxAudiences:    DefaultMaxAudiences,
+	}
+}
+
+// updateRole updates the role with the fields, validating the result.
+func (b *backend) updateRole(ctx context.Context, stg logical.Storage, config *Config, role *Role, d *framework.FieldData, createOperation bool) (*logical.Response, error) {
+	var err error
+
 	if newIssuer, ok := d.GetOk(keyIssuer); ok {
 		role.Issuer = newIssuer.(string)
-	} else if !ok && createOperation {
+	} else if _, bound := d.GetOk(keyIssuerRef); !bound && createOperation && config.IssuerMode != IssuerModeAuto {
 		return nil, fmt.Errorf("missing issuer in role")
 	}
 
@@ -230,6 +992,360 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		}
 	}
 
+	if newClaimPatterns, ok := d.GetOk(keyClaimPatterns); ok {
+		role.ClaimPatterns = newClaimPatterns.(map[string]string)
+	}
+
+	for claim, pattern := range role.ClaimPatterns {
+		if stringInSlice(claim, ReservedClaims) {
+			return logical.ErrorResponse("claim pattern %s not permitted, claim is reserved", claim), logical.ErrInvalidRequest
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return logical.ErrorResponse("invalid pattern for claim %s", claim), logical.ErrInvalidRequest
+		}
+	}
+
+	if newAllowedAudiences, ok := d.GetOk(keyAllowedAudiences); ok {
+		role.AllowedAudiences = newAllowedAudiences.([]string)
+	}
+
+	if newAllowedAlgorithms, ok := d.GetOk(keyAllowedAlgorithms); ok {
+		role.AllowedAlgorithms = newAllowedAlgorithms.([]string)
+		for _, alg := range role.AllowedAlgorithms {
+			if !stringInSlice(alg, AllowedSignatureAlgorithmNames) {
+				return logical.ErrorResponse("unknown/unsupported signature algorithm %s, must be one of %s", alg, AllowedSignatureAlgorithmNames), logical.ErrInvalidRequest
+			}
+		}
+	}
+
+	if newMaxAudiences, ok := d.GetOk(keyMaxAllowedAudiences); ok {
+		role.MaxAudiences = newMaxAudiences.(int)
+	}
+
+	if newAllowedScopes, ok := d.GetOk(keyAllowedScopes); ok {
+		role.AllowedScopes = newAllowedScopes.([]string)
+		if err := validateScopes(role.AllowedScopes); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	if newRequireCertificateBinding, ok := d.GetOk(keyRequireCertificateBinding); ok {
+		role.RequireCertificateBinding = newRequireCertificateBinding.(bool)
+	}
+
+	if newRequireDPoPProof, ok := d.GetOk(keyRequireDPoPProof); ok {
+		role.RequireDPoPProof = newRequireDPoPProof.(bool)
+	}
+
+	if newDPoPProofMaxAge, ok := d.GetOk(keyDPoPProofMaxAge); ok {
+		duration, err := time.ParseDuration(newDPoPProofMaxAge.(string))
+		if err != nil || duration < 0 {
+			return logical.ErrorResponse("invalid '%s', must be a non-negative duration", keyDPoPProofMaxAge), logical.ErrInvalidRequest
+		}
+		role.DPoPProofMaxAge = duration
+	}
+
+	if newNonceReplayWindow, ok := d.GetOk(keyNonceReplayWindow); ok {
+		duration, err := time.ParseDuration(newNonceReplayWindow.(string))
+		if err != nil || duration < 0 {
+			return logical.ErrorResponse("invalid '%s', must be a non-negative duration", keyNonceReplayWindow), logical.ErrInvalidRequest
+		}
+		role.NonceReplayWindow = duration
+	}
+
+	if newRequireAudience, ok := d.GetOk(keyRequireAudience); ok {
+		role.RequireAudience = newRequireAudience.(bool)
+	}
+
+	if newStatusList, ok := d.GetOk(keyStatusList); ok {
+		role.StatusList = newStatusList.(bool)
+	}
+
+	if newBindSubjectToEntity, ok := d.GetOk(keyBindSubjectToEntity); ok {
+		role.BindSubjectToEntity = newBindSubjectToEntity.(bool)
+	}
+
+	if newSubjectTemplate, ok := d.GetOk(keySubjectTemplate); ok {
+		role.SubjectTemplate = newSubjectTemplate.(string)
+	}
+
+	if role.SubjectTemplate != "" {
+		if !hasIdentityTemplate(role.SubjectTemplate) || hasParameterTemplate(role.SubjectTemplate) {
+			return logical.ErrorResponse("invalid subject template: must be an identity template"), logical.ErrInvalidRequest
+		}
+		if err := validateIdentityTemplates(role.SubjectTemplate); err != nil {
+			return logical.ErrorResponse("invalid subject template: %v", err), logical.ErrInvalidRequest
+		}
+	}
+
+	if newClaimTypes, ok := d.GetOk(keyClaimTypes); ok {
+		role.ClaimTypes = newClaimTypes.(map[string]string)
+	}
+
+	for claim, claimType := range role.ClaimTypes {
+		if !stringInSlice(claimType, AllowedClaimTypes) {
+			return logical.ErrorResponse("unknown type %s for claim %s", claimType, claim), logical.ErrInvalidRequest
+		}
+		if stringInSlice(claim, ReservedClaims) {
+			return logical.ErrorResponse("claim type %s not permitted, claim is reserved", claim), logical.ErrInvalidRequest
+		}
+	}
+
+	if newMergeClaims, ok := d.GetOk(keyMergeClaims); ok {
+		role.MergeClaims = newMergeClaims.(map[string]string)
+	}
+
+	for claim, rule := range role.MergeClaims {
+		if !stringInSlice(rule, AllowedClaimMergeRules) {
+			return logical.ErrorResponse("unknown merge rule %s for claim %s", rule, claim), logical.ErrInvalidRequest
+		}
+		if _, ok := role.Claims[claim].(map[string]interface{}); !ok {
+			return logical.ErrorResponse("merge claim %s not permitted, not an object claim of the role", claim), logical.ErrInvalidRequest
+		}
+	}
+
+	if newDeniedClaims, ok := d.GetOk(keyDeniedClaims); ok {
+		role.DeniedClaims = newDeniedClaims.([]string)
+	}
+
+	if newEnabled, ok := d.GetOk(keyEnabled); ok {
+		role.Disabled = !newEnabled.(bool)
+	}
+
+	for field, roleTime := range map[string]*time.Time{keyNotBefore: &role.NotBefore, keyNotAfter: &role.NotAfter} {
+		if newTime, ok := d.GetOk(field); ok {
+			if *roleTime, err = parseRoleTime(newTime.(string)); err != nil {
+				return logical.ErrorResponse("invalid '%s', must be an RFC 3339 date or unix time", field), logical.ErrInvalidRequest
+			}
+		}
+	}
+
+	if !role.NotBefore.IsZero() && !role.NotAfter.IsZero() && !role.NotAfter.After(role.NotBefore) {
+		return logical.ErrorResponse("'%s' must be after '%s'", keyNotAfter, keyNotBefore), logical.ErrInvalidRequest
+	}
+
+	if newAllowRequestClaims, ok := d.GetOk(keyAllowRequestClaims); ok {
+		role.DenyRequestClaims = !newAllowRequestClaims.(bool)
+	}
+
+	if newIsolatedKeyring, ok := d.GetOk(keyIsolatedKeyring); ok {
+		role.IsolatedKeyring = newIsolatedKeyring.(bool)
+	}
+
+	if role.IsolatedKeyring && !config.usesLocalKeys() {
+		return logical.ErrorResponse("'%s' is only supported by the local signer", keyIsolatedKeyring), logical.ErrInvalidRequest
+	}
+
+	if newKey, ok := d.GetOk(keyKey); ok {
+		role.Key = newKey.(string)
+	}
+
+	if role.Key != "" {
+		if role.IsolatedKeyring {
+			return logical.ErrorResponse("'%s' and '%s' are mutually exclusive", keyKey, keyIsolatedKeyring), logical.ErrInvalidRequest
+		}
+		if !config.usesLocalKeys() {
+			return logical.ErrorResponse("'%s' is only supported by the local signer", keyKey), logical.ErrInvalidRequest
+		}
+		keySet, err := b.getKeySet(ctx, stg, role.Key)
+		if err != nil {
+			return nil, err
+		}
+		if keySet == nil {
+			return logical.ErrorResponse("unknown key set '%s'", role.Key), logical.ErrInvalidRequest
+		}
+	}
+
+	if newIssuerRef, ok := d.GetOk(keyIssuerRef); ok {
+		role.IssuerRef = newIssuerRef.(string)
+	}
+
+	role.hostedIssuer = nil
+	if role.IssuerRef != "" {
+		if role.Issuer != "" {
+			return logical.ErrorResponse("'%s' and '%s' are mutually exclusive", keyIssuer, keyIssuerRef), logical.ErrInvalidRequest
+		}
+		if role.Key != "" || role.IsolatedKeyring {
+			return logical.ErrorResponse("'%s' cannot be used with '%s' or '%s'", keyIssuerRef, keyKey, keyIsolatedKeyring), logical.ErrInvalidRequest
+		}
+		if bound, err := b.bindHostedIssuer(ctx, stg, role); err != nil {
+			return nil, err
+		} else if !bound {
+			return logical.ErrorResponse("unknown hosted issuer '%s'", role.IssuerRef), logical.ErrInvalidRequest
+		}
+	}
+
+	if newExchangeClaims, ok := d.GetOk(keyExchangeClaims); ok {
+		role.ExchangeClaims = newExchangeClaims.(map[string]string)
+	}
+
+	if newEncryptionKey, ok := d.GetOk(keyEncryptionKey); ok {
+		role.EncryptionKey = newEncryptionKey.(string)
+	}
+
+	if newEncryptionAlgorithm, ok := d.GetOk(keyEncryptionAlgorithm); ok {
+		role.EncryptionAlgorithm = newEncryptionAlgorithm.(string)
+	}
+
+	if newContentEncryption, ok := d.GetOk(keyContentEncryption); ok {
+		role.ContentEncryption = newContentEncryption.(string)
+	}
+
+	if err := validateEncryptionAlgorithms(role.EncryptionAlgorithm, role.ContentEncryption); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if _, err := role.encryption(""); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if newPayloadTypes, ok := d.GetOk(keyPayloadTypes); ok {
+		role.PayloadTypes = newPayloadTypes.([]string)
+	}
+
+	if newPayloadContentTypes, ok := d.GetOk(keyPayloadContentTypes); ok {
+		role.PayloadContentTypes = newPayloadContentTypes.([]string)
+	}
+
+	if newTokenProfile, ok := d.GetOk(keyTokenProfile); ok {
+		role.TokenProfile = newTokenProfile.(string)
+		if !stringInSlice(role.TokenProfile, AllowedTokenProfiles) {
+			return logical.ErrorResponse("unknown/unsupported token profile, must be one of %s", AllowedTokenProfiles), logical.ErrInvalidRequest
+		}
+	}
+
+	if newTokenType, ok := d.GetOk(keyTokenType); ok {
+		role.TokenType = newTokenType.(string)
+	}
+
+	// Typed tokens are verified as tokens (see 'verify'), and can't be confused with signed payloads
+	if role.TokenType != "" && !isTokenType(role.TokenType) {
+		return logical.ErrorResponse("token type %s not permitted, must be 'JWT' or '<type>+jwt'", role.TokenType), logical.ErrInvalidRequest
+	}
+
+	if profile := role.profile(); role.TokenType != "" && role.tokenProfile() != TokenProfileJWT && !strings.EqualFold(role.TokenType, profile.Type) {
+		return logical.ErrorResponse("token type %s conflicts with the %s token profile", role.TokenType, role.tokenProfile()), logical.ErrInvalidRequest
+	}
+
+	if newTrustDomainPattern, ok := d.GetOk(keyTrustDomainPattern); ok {
+		role.TrustDomainPattern = newTrustDomainPattern.(string)
+		if _, err := regexp.Compile(role.TrustDomainPattern); err != nil {
+			return logical.ErrorResponse("invalid trust domain pattern"), err
+		}
+	}
+
+	if role.tokenProfile() == TokenProfileJWTSVID && role.TrustDomainPattern == "" {
+		return logical.ErrorResponse("'%s' is required by the %s token profile", keyTrustDomainPattern, TokenProfileJWTSVID), logical.ErrInvalidRequest
+	}
+
+	if newKubernetesPatterns, ok := d.GetOk(keyKubernetesPatterns); ok {
+		role.KubernetesPatterns = newKubernetesPatterns.(map[string]string)
+	}
+
+	for parameter, pattern := range role.KubernetesPatterns {
+		if !stringInSlice(parameter, KubernetesParameters) {
+			return logical.ErrorResponse("unknown Kubernetes parameter '%s', must be one of %s", parameter, KubernetesParameters), logical.ErrInvalidRequest
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return logical.ErrorResponse("invalid pattern for Kubernetes parameter '%s'", parameter), logical.ErrInvalidRequest
+		}
+	}
+
+	// Kubernetes subjects are the service account, which is always matched by a pattern
+	if role.tokenProfile() == TokenProfileKubernetes {
+		for _, parameter := range []string{kubernetesNamespaceParameter, kubernetesServiceAccountParameter} {
+			if _, ok := role.KubernetesPatterns[parameter]; !ok {
+				return logical.ErrorResponse("'%s' pattern of '%s' is required by the %s token profile", parameter, keyKubernetesPatterns, TokenProfileKubernetes), logical.ErrInvalidRequest
+			}
+		}
+		if role.BindSubjectToEntity {
+			return logical.ErrorResponse("'%s' conflicts with the %s token profile", keyBindSubjectToEntity, TokenProfileKubernetes), logical.ErrInvalidRequest
+		}
+	}
+
+	// Repositories are the trust boundary of CI tokens, which must always be restricted
+	if _, ok := role.ClaimPatterns[githubRepositoryParameter]; !ok && role.tokenProfile() == TokenProfileGitHubActions {
+		return logical.ErrorResponse("'%s' pattern of '%s' is required by the %s token profile", githubRepositoryParameter, keyClaimPatterns, TokenProfileGitHubActions), logical.ErrInvalidRequest
+	}
+
+	// Client assertions are only issued to allowed token endpoints, as the client itself
+	if role.tokenProfile() == TokenProfileClientAssertion {
+		if len(role.AllowedAudiences) == 0 {
+			return logical.ErrorResponse("'%s' is required by the %s token profile", keyAllowedAudiences, TokenProfileClientAssertion), logical.ErrInvalidRequest
+		}
+		if role.BindSubjectToEntity {
+			return logical.ErrorResponse("'%s' conflicts with the %s token profile", keyBindSubjectToEntity, TokenProfileClientAssertion), logical.ErrInvalidRequest
+		}
+	}
+
+	if newTTL, ok := d.GetOk(keyTTL); ok {
+		duration, err := time.ParseDuration(newTTL.(string))
+		if err != nil {
+			return logical.ErrorResponse("invalid '%s': %v", keyTTL, err), logical.ErrInvalidRequest
+		}
+		role.TTL = duration
+	}
+
+	if newMaxTTL, ok := d.GetOk(keyMaxTTL); ok {
+		duration, err := time.ParseDuration(newMaxTTL.(string))
+		if err != nil {
+			return logical.ErrorResponse("invalid '%s': %v", keyMaxTTL, err), logical.ErrInvalidRequest
+		}
+		role.MaxTTL = duration
+	}
+
+	if newResponseWrapTTL, ok := d.GetOk(keyResponseWrapTTL); ok {
+		duration, err := time.ParseDuration(newResponseWrapTTL.(string))
+		if err != nil || duration < 0 {
+			return logical.ErrorResponse("invalid '%s', must be a non-negative duration", keyResponseWrapTTL), logical.ErrInvalidRequest
+		}
+		role.ResponseWrapTTL = duration
+	}
+
+	if newMaxTokensPerMinute, ok := d.GetOk(keyMaxTokensPerMinute); ok {
+		role.MaxTokensPerMinute = newMaxTokensPerMinute.(int)
+	}
+
+	if newMaxActiveTokens, ok := d.GetOk(keyMaxActiveTokens); ok {
+		role.MaxActiveTokens = newMaxActiveTokens.(int)
+	}
+
+	if role.MaxTokensPerMinute < 0 || role.MaxActiveTokens < 0 {
+		return logical.ErrorResponse("'%s' and '%s' cannot be negative", keyMaxTokensPerMinute, keyMaxActiveTokens), logical.ErrInvalidRequest
+	}
+
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("'%s' and '%s' cannot be negative", keyTTL, keyMaxTTL), logical.ErrInvalidRequest
+	}
+
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("'%s' is greater than '%s'", keyTTL, keyMaxTTL), logical.ErrInvalidRequest
+	}
+
+	if maxTTL := b.maxTokenTTL(config); role.TTL > maxTTL || role.MaxTTL > maxTTL {
+		return logical.ErrorResponse("'%s' and '%s' must not be greater than the config's max token ttl (%s)", keyTTL, keyMaxTTL, maxTTL), logical.ErrInvalidRequest
+	}
+
+	// Check payloads can't be passed off as tokens, bypassing the claim restrictions.
+	for _, payloadType := range role.PayloadTypes {
+		if isTokenType(payloadType) {
+			return logical.ErrorResponse("payload type %s not permitted, reserved for tokens", payloadType), logical.ErrInvalidRequest
+		}
+	}
+
+	// Check exchanged claims are allowed from the config, and don't replace those provided by the role.
+	for _, claim := range role.ExchangeClaims {
+		if allowedClaim, ok := config.allowedClaimsMap[claim]; !ok || !allowedClaim {
+			return logical.ErrorResponse("exchange claim %s not permitted", claim), logical.ErrInvalidRequest
+		}
+		if role.deniesClaim(claim) {
+			return logical.ErrorResponse("exchange claim %s not permitted, denied by role", claim), logical.ErrInvalidRequest
+		}
+		if _, ok := role.Claims[claim]; ok {
+			return logical.ErrorResponse("exchange claim %s not permitted, already provided by role", claim), logical.ErrInvalidRequest
+		}
+	}
+
 	// Check any provided claims are allowed from the config.
 	for claim := range role.Claims {
 		if allowedClaim, ok := config.allowedClaimsMap[claim]; !ok || !allowedClaim {
@@ -247,15 +1363,75 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		return logical.ErrorResponse("'sub' claim cannot be present in 'claims' field"), logical.ErrInvalidRequest
 	}
 
+	if newClaimsSchema, ok := d.GetOk(keyClaimsSchema); ok {
+		role.ClaimsSchema = newClaimsSchema.(string)
+		if role.ClaimsSchema != "" {
+			if _, err := parseClaimsSchema(role.ClaimsSchema); err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+		}
+	}
+
+	if newPolicyExpression, ok := d.GetOk(keyPolicyExpression); ok {
+		role.PolicyExpression = newPolicyExpression.(string)
+		if role.PolicyExpression != "" {
+			program, err := compilePolicyExpression(role.PolicyExpression)
+			if err != nil {
+				return logical.ErrorResponse("invalid policy expression: %v", err), logical.ErrInvalidRequest
+			}
+			role.policyProgram = program
+		} else {
+			role.policyProgram = nil
+		}
+	}
+
+	if newTemplateParameters, ok := d.GetOk(keyTemplateParameters); ok {
+		role.TemplateParameters = newTemplateParameters.([]string)
+	}
+
+	for _, parameter := range role.TemplateParameters {
+		if !parameterNamePattern.MatchString(parameter) {
+			return logical.ErrorResponse("invalid template parameter name '%s'", parameter), logical.ErrInvalidRequest
+		}
+		if parameter == wildcardParameter {
+			return logical.ErrorResponse("template parameter '%s' is reserved for wildcard roles", parameter), logical.ErrInvalidRequest
+		}
+	}
+
+	// Check templates (resolved when signing) of the issuer & claims are well-formed; the issuer can only be
+	// bound to the caller's identity & the mount, never to request parameters.
+	for _, issuerPart := range issuerPlaceholderPattern.Split(role.Issuer, -1) {
+		if err := validateIdentityTemplates(issuerPart); err != nil {
+			return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+		}
+		if hasParameterTemplate(issuerPart) {
+			return logical.ErrorResponse("invalid issuer: only identity templates & placeholders are supported"), logical.ErrInvalidRequest
+		}
+	}
+	if config.StrictIssuer && role.Issuer != "" {
+		if role.Issuer, err = normalizeStrictIssuer(role.Issuer); err != nil {
+			return logical.ErrorResponse("invalid issuer: %v", err), logical.ErrInvalidRequest
+		}
+	}
+	if err := validateIdentityTemplates(role.Claims); err != nil {
+		return logical.ErrorResponse("invalid claims: %v", err), logical.ErrInvalidRequest
+	}
+	if err := validateParameterTemplates(role.Claims, append([]string{wildcardParameter}, role.TemplateParameters...)); err != nil {
+		return logical.ErrorResponse("invalid claims: %v", err), logical.ErrInvalidRequest
+	}
+
 	// If any audience is set in the claims, validate it against the configured restrictions.
 	if rawAud, ok := role.Claims["aud"]; ok {
 		switch aud := rawAud.(type) {
 		case string:
-			if matched, _ := regexp.MatchString(config.AudiencePattern, aud); !matched {
+			if matched, _ := regexp.MatchString(config.AudiencePattern, aud); !matched && !hasTemplate(aud) {
 				return logical.ErrorResponse("validation of 'aud' claim failed"), logical.ErrInvalidRequest
 			}
+			if !audienceAllowed(aud, config.AllowedAudiences, role.AllowedAudiences) && !hasTemplate(aud) {
+				return logical.ErrorResponse("validation of 'aud' claim failed (not an allowed audience)"), logical.ErrInvalidRequest
+			}
 		case []interface{}:
-			if config.MaxAudiences > -1 && len(aud) > config.MaxAudiences {
+			if maxAudiences := role.maxAudiences(config); maxAudiences > -1 && len(aud) > maxAudiences {
 				return logical.ErrorResponse("too many audience claims: %d", len(aud)), logical.ErrInvalidRequest
 			}
 			for _, rawAudEntry := range aud {
@@ -263,9 +1439,12 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 				if !ok {
 					return logical.ErrorResponse("'aud' claim was %T, not string", audEntry), logical.ErrInvalidRequest
 				}
-				if matched, _ := regexp.MatchString(config.AudiencePattern, audEntry); !matched {
+				if matched, _ := regexp.MatchString(config.AudiencePattern, audEntry); !matched && !hasTemplate(audEntry) {
 					return logical.ErrorResponse("validation of 'aud' claim failed"), logical.ErrInvalidRequest
 				}
+				if !audienceAllowed(audEntry, config.AllowedAudiences, role.AllowedAudiences) && !hasTemplate(audEntry) {
+					return logical.ErrorResponse("validation of 'aud' claim failed (not an allowed audience)"), logical.ErrInvalidRequest
+				}
 			}
 		default:
 			return logical.ErrorResponse("'aud' claim was %T, not string or []string", rawAud), logical.ErrInvalidRequest
@@ -274,29 +1453,120 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 
 	// Check any provided headers are allowed from the config.
 	for header := range role.Headers {
+		if stringInSlice(header, ReservedHeaders) {
+			return logical.ErrorResponse("header %s is reserved", header), logical.ErrInvalidRequest
+		}
 		if allowedHeader, ok := config.allowedHeadersMap[header]; !ok || !allowedHeader {
 			return logical.ErrorResponse("header %s not permitted", header), logical.ErrInvalidRequest
 		}
 	}
 
-	if err := b.setRole(ctx, req.Storage, name.(string), role); err != nil {
-		return nil, err
-	}
-
 	return nil, nil
 }
 
 // pathRolesDelete makes a request to Vault storage to delete a role
 func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, path.Join(keyStorageRolePath, d.Get(keyRoleName).(string)))
+	name := d.Get(keyRoleName).(string)
+
+	err := req.Storage.Delete(ctx, path.Join(keyStorageRolePath, name))
+	b.cachedRoles.clear()
 	if err != nil {
 		return nil, fmt.Errorf("error deleting role: %w", err)
 	}
+
+	// Keys isolated to the role are of no further use
+	if err := b.deleteKeyring(ctx, req.Storage, roleKeyringName(name)); err != nil {
+		return nil, fmt.Errorf("error deleting role keyring: %w", err)
+	}
+
+	// A role recreated with the same name starts with no active tokens, or statistics
+	if err := b.deleteActiveTokens(ctx, req.Storage, name); err != nil {
+		return nil, fmt.Errorf("error deleting role active tokens: %w", err)
+	}
+	if err := b.deleteRoleStats(ctx, req.Storage, name); err != nil {
+		return nil, fmt.Errorf("error deleting role statistics: %w", err)
+	}
+
 	return nil, nil
 }
 
-// getRole gets the role from the Vault storage API
+// getRole gets the role from the cache or the Vault storage API, resolving its template. Roles are shared
+// with other requests; callers must not modify them.
 func (b *backend) getRole(ctx context.Context, stg logical.Storage, name string) (*Role, error) {
+	role, ok, generation := b.cachedRoles.get(name)
+	if ok {
+		return role, nil
+	}
+
+	role, err := b.loadRole(ctx, stg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.cachedRoles.put(name, role, generation)
+
+	return role, nil
+}
+
+// loadRole gets the role from the Vault storage API, resolving its template & hosted issuer
+func (b *backend) loadRole(ctx context.Context, stg logical.Storage, name string) (*Role, error) {
+	role, err := b.getStoredRole(ctx, stg, name)
+	if err != nil || role == nil {
+		return role, err
+	}
+
+	if role.RoleTemplate == "" {
+		if bound, err := b.bindHostedIssuer(ctx, stg, role); err != nil {
+			return nil, err
+		} else if !bound {
+			return nil, errutil.UserError{Err: fmt.Sprintf("role '%s' is bound to unknown hosted issuer '%s'", name, role.IssuerRef)}
+		}
+		if role.PolicyExpression != "" {
+			if role.policyProgram, err = compilePolicyExpression(role.PolicyExpression); err != nil {
+				return nil, errutil.UserError{Err: fmt.Sprintf("role '%s' has an invalid policy expression: %s", name, err)}
+			}
+		}
+		return role, nil
+	}
+
+	config, err := b.getConfig(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, resp, err := b.resolveRole(ctx, stg, config, role, nil)
+	if resp != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("role '%s' does not resolve with its template: %s", name, resp.Error())}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// bindHostedIssuer binds the role to the hosted issuer named by its IssuerRef, if any; returning false when
+// the issuer is unknown or not hosted by this backend.
+func (b *backend) bindHostedIssuer(ctx context.Context, stg logical.Storage, role *Role) (bool, error) {
+	if role.IssuerRef == "" {
+		return true, nil
+	}
+
+	issuer, err := b.getTrustedIssuer(ctx, stg, role.IssuerRef)
+	if err != nil {
+		return false, err
+	}
+	if issuer == nil || !issuer.hosted() {
+		return false, nil
+	}
+
+	role.hostedIssuer = issuer
+
+	return true, nil
+}
+
+// getStoredRole returns the role as stored; roles with a template are not resolved.
+func (b *backend) getStoredRole(ctx context.Context, stg logical.Storage, name string) (*Role, error) {
 	if name == "" {
 		return nil, fmt.Errorf("missing role name")
 	}
@@ -329,11 +1599,10 @@ func (b *backend) setRole(ctx context.Context, stg logical.Storage, name string,
 		return fmt.Errorf("failed to create storage entry for role")
 	}
 
-	if err := stg.Put(ctx, entry); err != nil {
-		return err
-	}
+	err = stg.Put(ctx, entry)
+	b.cachedRoles.clear()
 
-	return nil
+	return err
 }
 
 const pathRoleHelpSyn = `
@@ -341,9 +1610,132 @@ Manages Vault role for generating tokens.
 `
 
 const pathRoleHelpDesc = `
-Manages Vault role for generating tokens.
+Manages Vault role for generating tokens. Writing, or patching, a role updates the
+provided fields, clearing those set to null or named by 'clear'.
 
 subject:          Subject claim (sub) for tokens generated using this role.
+clear:            Fields to clear (e.g. 'claims,subject_pattern'), as if set to null; patterns
+                  are reset to their defaults, and roles with a template inherit the
+                  template's fields.
+allowed_audiences:
+                  Audiences ('aud' claim) tokens can have, as exact values; in addition to
+                  the audience patterns and the config's 'allowed_audiences'.
+allowed_algorithms:
+                  Signature algorithms (e.g. 'ES256,ES384') tokens can be signed with; any
+                  algorithm when empty. Signing fails while the role's keys use another
+                  algorithm, e.g. during a migration of the config's 'sig_alg'.
+max_audiences:    Maximum number of audiences ('aud' claim) tokens can have, or -1 for no
+                  limit; the stricter of this and the config's 'max_audiences' applies.
+allowed_scopes:   Scopes sign requests can request ('scopes'), which are set as the
+                  space-delimited 'scope' claim.
+require_certificate_binding:
+                  Require tokens to be bound to a client certificate ('cnf' claim), by
+                  providing 'client_certificate' or 'certificate_thumbprint' to sign.
+require_dpop_proof:
+                  Require tokens to be bound to the key of a fresh DPoP proof ('cnf'
+                  claim), by providing 'dpop_proof' to sign.
+dpop_proof_max_age:
+                  Maximum age of DPoP proofs; defaults to 1m.
+nonce_replay_window:
+                  Duration a nonce provided to sign cannot be reused for; nonces can be
+                  reused when zero.
+require_aud:      Require tokens to have at least one audience ('aud' claim).
+status_list:      Reference issued tokens from a status list ('status' claim), published at
+                  'status-list/<list>', where their revocation is published; requires the
+                  config's 'issuer'.
+bind_subject_to_entity:
+                  Set the 'sub' claim from the entity of the requesting token, ignoring any
+                  provided by callers.
+subject_template: Identity template entity bound 'sub' claims are resolved from; defaults to
+                  '{{identity.entity.id}}' (e.g. '{{identity.entity.name}}').
+claim_types:      Types of claims provided by callers, as a map of claim name to 'string',
+                  'number', 'bool' or 'string-array'; claims are coerced to their type (e.g.
+                  "42" to 42), or rejected when they cannot be.
+merge_claims:     Object claims of the role sign requests can also provide, as a map of claim
+                  name to conflict rule; the objects are deep merged, resolving conflicting
+                  values with the 'role' or 'request' value, or rejecting ('reject') them.
+denied_claims:    Claims callers of the role cannot provide, even if allowed by the config's
+                  'allowed_claims'.
+enabled:          Whether tokens can be issued for the role (default true); sign requests,
+                  payload signing & token exchanges of disabled roles are rejected, while
+                  the role's definition & keys are kept.
+not_before:       Time (RFC 3339 date or unix time) from which tokens can be issued for the
+                  role.
+not_after:        Time (RFC 3339 date or unix time) after which tokens can no longer be
+                  issued for the role, e.g. for temporary integrations; the lifetime of
+                  tokens is capped so they never outlive it.
+allow_request_claims:
+                  Whether callers can provide claims (default true); when false, claims come
+                  solely from the role and its templates, and sign requests providing 'claims'
+                  (or token exchanges providing 'audience') are rejected.
+claim_patterns:   Regular expressions which must match claims, as a map of claim name to
+                  pattern (e.g. 'scope=^read:'); each element of array claims must match.
+isolated_keyring: Sign tokens with keys dedicated to this role, published at 'jwks/<role>'.
+                  The keys are deleted along with the role.
+key:              Name of the key set (see 'keys/') used to sign tokens.
+issuer_ref:       Name of the hosted issuer (see 'issuers/') issuing the role's tokens; its
+                  issuer & key set are used instead of the role's 'issuer' & 'key'.
+exchange_claims:  Claims of subject tokens copied to tokens issued by 'token-exchange/<role>',
+                  as a map of subject token claim to issued token claim; defaults to 'sub=sub'.
+encryption_key:   Recipient public key (JWK or PEM) issued tokens are encrypted to after signing,
+                  producing nested JWTs (JWE with 'cty: JWT').
+encryption_algorithm:
+                  Key management algorithm used to encrypt tokens; defaults according to the key type.
+content_encryption:
+                  Content encryption algorithm used to encrypt tokens; defaults to 'A256GCM'.
+payload_types:    Types ('typ' header) of payloads the role can sign using 'sign-payload/<role>';
+                  payload signing is disabled when empty.
+payload_content_types:
+                  Content types ('cty' header) of payloads the role can sign.
+token_profile:    Profile of issued tokens; 'jwt' (default), 'at+jwt' for OAuth 2.0 access
+                  tokens (RFC 9068) which require the 'sub', 'aud', 'client_id' & 'scope' claims,
+                  'jwt-svid' for SPIFFE JWT-SVIDs which require the 'sub' & 'aud' claims,
+                  'vc+jwt' for W3C Verifiable Credentials which require the 'vc' claim,
+                  'client-assertion' for OAuth 2.0 client assertions ('private_key_jwt',
+                  RFC 7523) issued by, and for, the client id set as the issuer, to one of
+                  the token endpoints of 'allowed_audiences' ('aud' claim),
+                  'gcp-workload-identity' for tokens exchanged for Google Cloud credentials
+                  by workload identity federation, which require the 'sub' & 'aud' claims, or
+                  'aws-web-identity' for tokens assuming AWS IAM roles, which require the
+                  'sub' claim and default the 'aud' claim to 'sts.amazonaws.com', or
+                  'kubernetes' for tokens shaped like projected service account tokens, whose
+                  'sub' & 'kubernetes.io' claims are populated from the 'namespace',
+                  'serviceaccount' & 'pod' parameters (and their '*_uid'), which require the
+                  'aud' claim, or 'github-actions' for tokens shaped like GitHub Actions OIDC
+                  tokens, populated from the 'repository', 'ref', 'workflow', 'sha',
+                  'job_workflow_ref', 'actor', 'event_name', 'run_id' & 'environment'
+                  parameters, which require the 'aud' claim & a 'repository' claim pattern.
+token_type:       Type ('typ' header) of issued tokens, e.g. 'JWT' or 'secevent+jwt'; defaults
+                  to the type of the token profile.
+template_parameters:
+                  Parameters of sign requests the role's claims can reference as Go templates,
+                  e.g. 'repo/{{.repo}}'. Wildcard roles (e.g. 'team-*') can also reference the
+                  matched part of the requested name as '{{.role_suffix}}'.
+claims_schema:    JSON Schema the claims of sign requests must satisfy; supporting the type,
+                  enum, const, properties, required, additionalProperties, items, minItems,
+                  maxItems, minLength, maxLength, pattern, minimum & maximum keywords. Schemas
+                  using other keywords (e.g. 'format', '$ref' or 'oneOf') are rejected.
+policy_expression:
+                  Policy expression (CEL, see README) which must be true for tokens to
+                  be issued; evaluated against the token's 'claims' and the 'request' (role,
+                  entity_id, display_name & mount_point).
+trust_domain_pattern:
+                  Regular expression which must match the trust domain of JWT-SVID SPIFFE IDs.
+ttl:              Duration the role's tokens are valid for; defaults to the config's 'jwt_ttl'.
+max_ttl:          Maximum duration the role's tokens are valid for; must be greater than or
+                  equal to 'ttl', and less than or equal to the config's 'jwt_max_ttl'.
+response_wrap_ttl:
+                  TTL the role's sign responses are response wrapped with when callers don't
+                  request wrapping; defaults to the config's 'response_wrap_ttl'.
+max_tokens_per_minute:
+                  Maximum number of tokens the role issues per minute, on each Vault node;
+                  further requests are rejected (429) until the rate falls. Unlimited when 0.
+max_active_tokens:
+                  Maximum number of unexpired tokens issued by the role; further requests
+                  are rejected (429) until tokens expire. Unlimited when 0.
+role_template:    Role template (see 'role-templates/') the role inherits fields from, resolved
+                  when the role is used; fields written to the role override the template's.
+                  Set to empty to detach the template, keeping the inherited fields.
 `
 
 const pathRoleListHelpSyn = `
@@ -351,5 +1743,8 @@ This endpoint returns a list of available roles.
 `
 
 const pathRoleListHelpDesc = `
-This endpoint returns a list of available roles. Only the role names are returned, not any values.
+This endpoint returns a list of available roles. Each role is summarized in 'key_info' by its issuer,
+signature algorithm ('sig_alg'), effective 'ttl' & 'max_ttl', key binding ('key' set or
+'isolated_keyring'), 'token_profile' & 'role_template'; read a role for all of its values. Roles
+which fail to load are summarized by their 'error'.
 `
@@ -0,0 +1,89 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	keyCloneTarget = "target"
+)
+
+func pathRoleClone(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + roleNameRegex(keyRoleName) + "/clone",
+		Fields: map[string]*framework.FieldSchema{
+			keyRoleName: {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Name of the role to clone.`,
+			},
+			keyCloneTarget: {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Name of the role to create.`,
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRoleCloneWrite,
+			},
+		},
+		HelpSynopsis:    pathRoleCloneHelpSyn,
+		HelpDescription: pathRoleCloneHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleCloneWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	target := d.Get(keyCloneTarget).(string)
+	if target == "" {
+		return logical.ErrorResponse("missing '%s'", keyCloneTarget), logical.ErrInvalidRequest
+	}
+
+	role, err := b.getStoredRole(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown role '%s'", d.Get(keyRoleName).(string)), logical.ErrInvalidRequest
+	}
+
+	existing, err := b.getStoredRole(ctx, req.Storage, target)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("role '%s' already exists", target), logical.ErrInvalidRequest
+	}
+
+	return b.importEntry(ctx, req, "roles/"+target, exportedRoleData(role))
+}
+
+const pathRoleCloneHelpSyn = `
+Create a role as a copy of an existing role.
+`
+
+const pathRoleCloneHelpDesc = `
+Create the 'target' role as a copy of the role, with all of its fields; roles with a template
+are copied with the template & their overrides. The target role must not exist. Isolated
+keyrings are not copied; a cloned role with 'isolated_keyring' signs with its own keys.
+
+target: Name of the role to create.
+`
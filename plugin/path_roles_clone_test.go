@@ -0,0 +1,87 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func cloneRole(b *backend, storage *logical.Storage, name string, target string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "roles/" + name + "/clone",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyCloneTarget: target},
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestRoleClone(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:         "baseline.example.com",
+		keyClaims:         map[string]interface{}{"scope": "read"},
+		keySubjectPattern: "^svc-",
+		keyTTL:            "15m",
+	}
+	if resp, err := writeRoleData(b, storage, "baseline", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := cloneRole(b, storage, "baseline", "payments"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	baseline, err := readRole(b, storage, "baseline")
+	if err != nil || baseline == nil || baseline.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, baseline)
+	}
+	cloned, err := readRole(b, storage, "payments")
+	if err != nil || cloned == nil || cloned.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, cloned)
+	}
+
+	deep.NilSlicesAreEmpty = true
+	defer func() { deep.NilSlicesAreEmpty = false }()
+	if diff := deep.Equal(baseline.Data, cloned.Data); diff != nil {
+		t.Error(diff)
+	}
+
+	failures := map[string][]string{
+		"existing target": {"baseline", "payments"},
+		"unknown role":    {"unknown", "other"},
+		"missing target":  {"baseline", ""},
+		"invalid target":  {"baseline", "a/b"},
+	}
+	for name, clone := range failures {
+		if resp, err := cloneRole(b, storage, clone[0], clone[1]); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "should have failed")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	keyExportRole = "role"
+)
+
+func pathRoleExport(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "roles/" + roleNameRegex(keyRoleName) + "/export",
+			Fields: map[string]*framework.FieldSchema{
+				keyRoleName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the role.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathRoleExportRead,
+				},
+			},
+			HelpSynopsis:    pathRoleExportHelpSyn,
+			HelpDescription: pathRoleExportHelpDesc,
+		},
+		{
+			Pattern: "roles/" + roleNameRegex(keyRoleName) + "/import",
+			Fields: map[string]*framework.FieldSchema{
+				keyRoleName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the role.`,
+				},
+				keyExportVersion: {
+					Type:        framework.TypeInt,
+					Description: `Version of the format of the document.`,
+				},
+				keyExportRole: {
+					Type:        framework.TypeMap,
+					Description: `Role, as written to 'roles/:name'.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRoleImportWrite,
+				},
+			},
+			HelpSynopsis:    pathRoleImportHelpSyn,
+			HelpDescription: pathRoleImportHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathRoleExportRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.getStoredRole(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyExportVersion: exportVersion,
+			keyExportRole:    exportedRoleData(role),
+		},
+	}, nil
+}
+
+// exportedRoleData returns the fields written to recreate the stored role; for roles with a template, the
+// template's name & the role's overrides.
+func exportedRoleData(role *Role) map[string]interface{} {
+	if role.RoleTemplate == "" {
+		return role.toResponseData()
+	}
+
+	data := map[string]interface{}{
+		keyRoleTemplate: role.RoleTemplate,
+	}
+	for field, value := range role.TemplateOverrides {
+		data[field] = value
+	}
+	return data
+}
+
+func (b *backend) pathRoleImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if version := d.Get(keyExportVersion).(int); version > exportVersion {
+		return logical.ErrorResponse("unsupported document version %d, must be at most %d", version, exportVersion), logical.ErrInvalidRequest
+	}
+
+	role, ok := d.GetOk(keyExportRole)
+	if !ok {
+		return logical.ErrorResponse("missing role"), logical.ErrInvalidRequest
+	}
+
+	return b.importEntry(ctx, req, "roles/"+d.Get(keyRoleName).(string), role)
+}
+
+const pathRoleExportHelpSyn = `
+Export a role as a document.
+`
+
+const pathRoleExportHelpDesc = `
+Export the role as a document, including its patterns, claims & key binding, which can be
+written to 'roles/:name/import' (e.g. to promote the role to another mount). Roles with a
+template are exported as their template's name & overrides.
+`
+
+const pathRoleImportHelpSyn = `
+Import a role exported by 'roles/:name/export'.
+`
+
+const pathRoleImportHelpDesc = `
+Import a role exported by 'roles/:name/export', creating or updating the named role as if
+the exported role was written to 'roles/:name'. The role can be imported with another name.
+Roles bound to a key set, or with a template, require the key set or template to exist.
+
+version: Version of the format of the document.
+role:    Role.
+`
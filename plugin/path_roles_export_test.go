@@ -0,0 +1,115 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func exportRole(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "roles/" + name + "/export",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func importRole(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "roles/" + name + "/import",
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestRoleExportImport(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:          "tester.example.com",
+		keyClaims:          map[string]interface{}{"scope": "read"},
+		keySubjectPattern:  "^user-",
+		keyAudiencePattern: "^api$",
+		keyKey:             "rsa",
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := exportRole(b, storage, "unknown"); err != nil || resp != nil {
+		t.Errorf("unknown role should not be exported; err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := exportRole(b, storage, "tester")
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	exported := resp.Data
+
+	target, targetStorage := getTestBackend(t)
+
+	if _, err := writeConfig(target, targetStorage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Roles bound to a key set require it
+	if resp, err := importRole(target, targetStorage, "promoted", exported); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("import of role bound to an unknown key set should have failed")
+	}
+
+	if resp, err := writeKeySet(target, targetStorage, "rsa", map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := importRole(target, targetStorage, "promoted", exported); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = exportRole(target, targetStorage, "promoted")
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	deep.NilSlicesAreEmpty = true
+	defer func() { deep.NilSlicesAreEmpty = false }()
+	if diff := deep.Equal(exported, resp.Data); diff != nil {
+		t.Error(diff)
+	}
+
+	if resp, err := importRole(target, targetStorage, "promoted", map[string]interface{}{keyExportVersion: exportVersion}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("import without a role should have failed")
+	}
+}
@@ -0,0 +1,251 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	roleStatsPath = "role-stats/"
+
+	keyTokensIssued       = "tokens_issued"
+	keyLastIssued         = "last_issued"
+	keyValidationFailures = "validation_failures"
+)
+
+// RoleStats are the usage statistics of a role.
+type RoleStats struct {
+	// TokensIssued counts the tokens issued for the role.
+	TokensIssued uint64 `json:"tokens_issued"`
+
+	// LastIssued is the time the last token was issued for the role, or zero when none were.
+	LastIssued time.Time `json:"last_issued"`
+
+	// ValidationFailures counts the requests for the role's tokens which failed.
+	ValidationFailures uint64 `json:"validation_failures"`
+}
+
+// add adds the statistics accumulated since, to the statistics.
+func (s *RoleStats) add(since *RoleStats) {
+	s.TokensIssued += since.TokensIssued
+	s.ValidationFailures += since.ValidationFailures
+	if since.LastIssued.After(s.LastIssued) {
+		s.LastIssued = since.LastIssued
+	}
+}
+
+// roleUsage accumulates the usage statistics of roles, in memory, until they are persisted periodically.
+type roleUsage struct {
+	lock    sync.Mutex
+	pending map[string]*RoleStats
+}
+
+// record records an issuance for the role, or a failure to issue.
+func (u *roleUsage) record(roleName string, issued bool, now time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.pending == nil {
+		u.pending = map[string]*RoleStats{}
+	}
+
+	stats, ok := u.pending[roleName]
+	if !ok {
+		stats = &RoleStats{}
+		u.pending[roleName] = stats
+	}
+
+	if issued {
+		stats.add(&RoleStats{TokensIssued: 1, LastIssued: now})
+	} else {
+		stats.ValidationFailures++
+	}
+}
+
+// get returns the statistics of the role that were not persisted.
+func (u *roleUsage) get(roleName string) RoleStats {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if stats, ok := u.pending[roleName]; ok {
+		return *stats
+	}
+	return RoleStats{}
+}
+
+// take removes & returns the statistics of all roles that were not persisted.
+func (u *roleUsage) take() map[string]*RoleStats {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	pending := u.pending
+	u.pending = nil
+	return pending
+}
+
+// restore returns statistics that failed to be persisted, to be persisted later.
+func (u *roleUsage) restore(roleName string, stats *RoleStats) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.pending == nil {
+		u.pending = map[string]*RoleStats{}
+	}
+	if pending, ok := u.pending[roleName]; ok {
+		stats.add(pending)
+	}
+	u.pending[roleName] = stats
+}
+
+// discard removes the statistics of the role that were not persisted.
+func (u *roleUsage) discard(roleName string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	delete(u.pending, roleName)
+}
+
+// getStoredRoleStats returns the persisted statistics of the role.
+func (b *backend) getStoredRoleStats(ctx context.Context, stg logical.Storage, roleName string) (*RoleStats, error) {
+	entry, err := stg.Get(ctx, roleStatsPath+roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &RoleStats{}
+	if entry != nil {
+		if err := entry.DecodeJSON(stats); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// persistRoleStats adds the statistics accumulated in memory to the persisted statistics of each role. Statistics
+// failing to be persisted are kept in memory.
+func (b *backend) persistRoleStats(ctx context.Context, stg logical.Storage) error {
+	b.roleStatsLock.Lock()
+	defer b.roleStatsLock.Unlock()
+
+	for roleName, pending := range b.roleUsage.take() {
+		if err := b.persistPendingRoleStats(ctx, stg, roleName, pending); err != nil {
+			b.roleUsage.restore(roleName, pending)
+			return fmt.Errorf("error persisting statistics of role '%s': %w", roleName, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *backend) persistPendingRoleStats(ctx context.Context, stg logical.Storage, roleName string, pending *RoleStats) error {
+	stats, err := b.getStoredRoleStats(ctx, stg, roleName)
+	if err != nil {
+		return err
+	}
+
+	stats.add(pending)
+
+	entry, err := logical.StorageEntryJSON(roleStatsPath+roleName, stats)
+	if err != nil {
+		return err
+	}
+
+	return stg.Put(ctx, entry)
+}
+
+// deleteRoleStats deletes the persisted & accumulated statistics of the role.
+func (b *backend) deleteRoleStats(ctx context.Context, stg logical.Storage, roleName string) error {
+	b.roleStatsLock.Lock()
+	defer b.roleStatsLock.Unlock()
+
+	b.roleUsage.discard(roleName)
+
+	return stg.Delete(ctx, roleStatsPath+roleName)
+}
+
+func pathRoleStats(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + roleNameRegex(keyRoleName) + "/stats",
+		Fields: map[string]*framework.FieldSchema{
+			keyRoleName: {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Name of the role.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathRoleStatsRead,
+			},
+		},
+		HelpSynopsis:    pathRoleStatsHelpSyn,
+		HelpDescription: pathRoleStatsHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleStatsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get(keyRoleName).(string)
+
+	role, err := b.getStoredRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	stats, err := b.getStoredRoleStats(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := b.roleUsage.get(roleName)
+	stats.add(&pending)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyTokensIssued:       stats.TokensIssued,
+			keyLastIssued:         formatRoleTime(stats.LastIssued),
+			keyValidationFailures: stats.ValidationFailures,
+		},
+	}, nil
+}
+
+const pathRoleStatsHelpSyn = `
+Read the usage statistics of a role.
+`
+
+const pathRoleStatsHelpDesc = `
+Read the usage statistics of the role, to find unused or heavily used roles. Statistics
+are accumulated in memory and persisted periodically; reads include those not yet persisted
+on the node serving the request. Tokens issued for wildcard roles are counted for the
+wildcard role (e.g. 'team-*'). Statistics are deleted along with the role.
+
+tokens_issued:    Number of tokens issued by 'sign' & 'token-exchange'; dry runs are
+                  not counted.
+last_issued:      Time (RFC 3339) the last token was issued, empty when none were.
+validation_failures:
+                  Number of requests for tokens of the role that failed, e.g. by
+                  providing claims not allowed or exceeding quotas.
+`
@@ -0,0 +1,132 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func readRoleStats(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "roles/" + name + "/stats",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func deleteRole(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.DeleteOperation,
+		Path:       "roles/" + name,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func checkRoleStats(t *testing.T, b *backend, storage *logical.Storage, name string, issued uint64, failures uint64) *logical.Response {
+	t.Helper()
+
+	resp, err := readRoleStats(b, storage, name)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp.Data[keyTokensIssued] != issued {
+		t.Errorf("expected %d tokens issued, got %v", issued, resp.Data[keyTokensIssued])
+	}
+	if resp.Data[keyValidationFailures] != failures {
+		t.Errorf("expected %d validation failures, got %v", failures, resp.Data[keyValidationFailures])
+	}
+
+	return resp
+}
+
+func TestRoleStats(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "svc", "svc.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	resp := checkRoleStats(t, b, storage, "svc", 0, 0)
+	if resp.Data[keyLastIssued] != "" {
+		t.Errorf("expected no last issuance, got %v", resp.Data[keyLastIssued])
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, err := signData(b, storage, "svc", map[string]interface{}{"claims": map[string]interface{}{"sub": "Zapp Brannigan"}}); err != nil || resp.IsError() {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	// Dry runs are not counted as issued
+	if resp, err := signData(b, storage, "svc", map[string]interface{}{keyDryRun: true}); err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Disallowed claims are counted as failures
+	if resp, err := signData(b, storage, "svc", map[string]interface{}{"claims": map[string]interface{}{"unknown": "value"}}); err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+
+	// Unknown roles are not counted
+	if resp, err := signData(b, storage, "unknown", map[string]interface{}{}); err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+
+	resp = checkRoleStats(t, b, storage, "svc", 2, 1)
+	if resp.Data[keyLastIssued] == "" {
+		t.Error("expected last issuance")
+	}
+
+	// Statistics are the same after being persisted, and accumulate with those not yet persisted
+	if err := b.periodic(context.Background(), &logical.Request{Storage: *storage}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if pending := b.roleUsage.get("svc"); pending != (RoleStats{}) {
+		t.Errorf("expected no pending statistics, got %#v", pending)
+	}
+	checkRoleStats(t, b, storage, "svc", 2, 1)
+
+	if resp, err := signData(b, storage, "svc", map[string]interface{}{}); err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	checkRoleStats(t, b, storage, "svc", 3, 1)
+
+	if resp, err := readRoleStats(b, storage, "unknown"); err != nil || resp != nil {
+		t.Errorf("expected no statistics for unknown role, got err:%s resp:%#v\n", err, resp)
+	}
+
+	// A role recreated with the same name starts with no statistics
+	if resp, err := deleteRole(b, storage, "svc"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if err := writeRole(b, storage, "svc", "svc.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	checkRoleStats(t, b, storage, "svc", 0, 0)
+}
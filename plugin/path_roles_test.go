@@ -21,8 +21,11 @@ import (
 	"fmt"
 	"github.com/go-test/deep"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 func writeRole(b *backend, storage *logical.Storage, name string, issuer string, claims map[string]interface{}, headers map[string]interface{}) error {
@@ -48,6 +51,19 @@ func writeRole(b *backend, storage *logical.Storage, name string, issuer string,
 	return nil
 }
 
+func writeRoleData(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "roles/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
 func readRole(b *backend, storage *logical.Storage, name string) (*logical.Response, error) {
 
 	req := &logical.Request{
@@ -178,6 +194,59 @@ func TestCreateDisallowedOtherHeader(t *testing.T) {
 
 }
 
+func TestCreateReservedHeader(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	for _, header := range []string{"typ", "b64"} {
+		if resp, err := writeConfig(b, storage, map[string]interface{}{keyAllowedHeaders: []string{header}}); err == nil {
+			t.Errorf("allowing reserved header %s should have failed: %#v", header, resp)
+		}
+	}
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{keyAllowedHeaders: []string{"cty", "x5u"}})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Configs can predate the reservation of headers
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	config.AllowedHeaders = append(config.AllowedHeaders, "typ")
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	b.invalidate(context.Background(), configPath)
+
+	err = writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{"typ": "invoice+jws"})
+	if err == nil {
+		t.Error("role with reserved header should have failed")
+	}
+
+	headers := map[string]interface{}{"cty": "JWT", "x5u": "https://example.com/certs/signer.pem"}
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, headers); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	signedHeaders := map[string]interface{}{}
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, nil, signedHeaders); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for header, value := range headers {
+		if diff := deep.Equal(value, signedHeaders[header]); diff != nil {
+			t.Error(header, diff)
+		}
+	}
+}
+
 func TestCreateAudienceAsArray(t *testing.T) {
 	b, storage := getTestBackend(t)
 
@@ -245,6 +314,117 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestListInfo(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeKeySet(b, storage, "rsa", map[string]interface{}{keySignatureAlgorithm: string(jose.RS256)}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	roles := map[string]map[string]interface{}{
+		"mount":    {keyIssuer: "mount.example.com"},
+		"isolated": {keyIssuer: "isolated.example.com", keyIsolatedKeyring: true, keyTTL: "10m", keyMaxTTL: "30m"},
+		"keyset":   {keyIssuer: "keyset.example.com", keyKey: "rsa"},
+	}
+	for name, roleData := range roles {
+		if resp, err := writeRoleData(b, storage, name, roleData); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	req := &logical.Request{
+		Operation:  logical.ListOperation,
+		Path:       "roles",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	maxTTL := b.System().MaxLeaseTTL().String()
+	expected := map[string]interface{}{
+		"mount": map[string]interface{}{
+			keyIssuer:             "mount.example.com",
+			keySignatureAlgorithm: DefaultSignatureAlgorithm,
+			keyTTL:                DefaultTokenTTL,
+			keyMaxTTL:             maxTTL,
+			keyKey:                "",
+			keyIssuerRef:          "",
+			keyIsolatedKeyring:    false,
+			keyTokenProfile:       TokenProfileJWT,
+			keyRoleTemplate:       "",
+			keyEnabled:            true,
+		},
+		"isolated": map[string]interface{}{
+			keyIssuer:             "isolated.example.com",
+			keySignatureAlgorithm: DefaultSignatureAlgorithm,
+			keyTTL:                "10m0s",
+			keyMaxTTL:             "30m0s",
+			keyKey:                "",
+			keyIssuerRef:          "",
+			keyIsolatedKeyring:    true,
+			keyTokenProfile:       TokenProfileJWT,
+			keyRoleTemplate:       "",
+			keyEnabled:            true,
+		},
+		"keyset": map[string]interface{}{
+			keyIssuer:             "keyset.example.com",
+			keySignatureAlgorithm: jose.RS256,
+			keyTTL:                DefaultTokenTTL,
+			keyMaxTTL:             maxTTL,
+			keyKey:                "rsa",
+			keyIssuerRef:          "",
+			keyIsolatedKeyring:    false,
+			keyTokenProfile:       TokenProfileJWT,
+			keyRoleTemplate:       "",
+			keyEnabled:            true,
+		},
+	}
+
+	if diff := deep.Equal(expected, resp.Data["key_info"]); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestListInfoRoleError(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// e.g. restored without its issuer
+	entry := &logical.StorageEntry{Key: "role/broken", Value: []byte(`{"issuer_ref":"missing","SubjectPattern":"^user-","AudiencePattern":"^api$"}`)}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.ListOperation,
+		Path:       "roles",
+		Storage:    *storage,
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal([]string{"broken", "tester"}, resp.Data["keys"]); diff != nil {
+		t.Error("keys", diff)
+	}
+
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+	if _, ok := keyInfo["broken"].(map[string]interface{})["error"].(string); !ok {
+		t.Errorf("expected the error of the broken role, got %#v", keyInfo["broken"])
+	}
+	if diff := deep.Equal("tester.example.com", keyInfo["tester"].(map[string]interface{})[keyIssuer]); diff != nil {
+		t.Error("tester info", diff)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	b, storage := getTestBackend(t)
 
@@ -269,3 +449,381 @@ func TestDelete(t *testing.T) {
 		t.Errorf("Should have received empty response but got response: %#v", resp)
 	}
 }
+
+func TestRoleTTL(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyMaxTokenTTL: "1h"}); err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	invalid := []map[string]interface{}{
+		{keyTTL: "10m", keyMaxTTL: "5m"},
+		{keyTTL: "2h"},
+		{keyMaxTTL: "2h"},
+		{keyTTL: "-1m"},
+		{keyTTL: "fortnight"},
+	}
+
+	for _, data := range invalid {
+		data[keyIssuer] = role + ".example.com"
+		if resp, err := writeRoleData(b, storage, role, data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("role with %v should have failed", data)
+		}
+	}
+
+	resp, err := writeRoleData(b, storage, role, map[string]interface{}{
+		keyIssuer: role + ".example.com",
+		keyTTL:    "15m",
+		keyMaxTTL: "30m",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, role)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("15m0s", resp.Data[keyTTL]); diff != nil {
+		t.Error("ttl", diff)
+	}
+	if diff := deep.Equal("30m0s", resp.Data[keyMaxTTL]); diff != nil {
+		t.Error("max_ttl", diff)
+	}
+
+	// The ttl can't exceed the existing max ttl
+	if resp, err := writeRoleData(b, storage, role, map[string]interface{}{keyTTL: "45m"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("ttl greater than max_ttl should have failed")
+	}
+}
+
+func patchRole(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.PatchOperation,
+		Path:       "roles/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestPatchRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{
+		keyIssuer:         "tester.example.com",
+		keyClaims:         map[string]interface{}{"aud": "api"},
+		keySubjectPattern: "^svc-",
+		keyTTL:            "1m",
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Only the patched fields change
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keyAudiencePattern: "^api$"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("^api$", resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("audience pattern", diff)
+	}
+	if diff := deep.Equal("^svc-", resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("subject pattern", diff)
+	}
+	if diff := deep.Equal(map[string]interface{}{"aud": "api"}, resp.Data[keyClaims]); diff != nil {
+		t.Error("claims", diff)
+	}
+
+	// Nulls clear fields
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keySubjectPattern: nil, keyClaims: nil, keyTTL: nil}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(DefaultSubjectPattern, resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("cleared subject pattern", diff)
+	}
+	if diff := deep.Equal(map[string]interface{}{}, resp.Data[keyClaims]); diff != nil {
+		t.Error("cleared claims", diff)
+	}
+	if diff := deep.Equal("0s", resp.Data[keyTTL]); diff != nil {
+		t.Error("cleared ttl", diff)
+	}
+	if diff := deep.Equal("^api$", resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("audience pattern", diff)
+	}
+
+	// The issuer is required
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keyIssuer: nil}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("clearing the issuer should have failed")
+	}
+
+	if resp, err := patchRole(b, storage, "unknown", map[string]interface{}{keyAudiencePattern: "^api$"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("patching an unknown role should have failed")
+	}
+}
+
+func TestPatchTemplatedRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeRoleTemplate(b, storage, "base", map[string]interface{}{keyIssuer: "base.example.com", keySubjectPattern: "^base-"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	roleData := map[string]interface{}{keyRoleTemplate: "base", keySubjectPattern: "^tester-"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Clearing an override inherits the template's field
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keySubjectPattern: nil}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("^base-", resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("inherited subject pattern", diff)
+	}
+}
+
+func TestClearRoleFields(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{
+		keyIssuer:          "tester.example.com",
+		keyClaims:          map[string]interface{}{"aud": "api"},
+		keySubjectPattern:  "^svc-",
+		keyAudiencePattern: "^api$",
+		keyDeniedClaims:    []string{"aud"},
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Fields are cleared by name
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyClear: "claims,subject_pattern"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(map[string]interface{}{}, resp.Data[keyClaims]); diff != nil {
+		t.Error("cleared claims", diff)
+	}
+	if diff := deep.Equal(DefaultSubjectPattern, resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("cleared subject pattern", diff)
+	}
+	if diff := deep.Equal("^api$", resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("audience pattern should be unchanged", diff)
+	}
+
+	// Or by setting them to null
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyAudiencePattern: nil, keyDeniedClaims: nil}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(DefaultAudiencePattern, resp.Data[keyAudiencePattern]); diff != nil {
+		t.Error("cleared audience pattern", diff)
+	}
+	if diff := deep.Equal([]string{}, resp.Data[keyDeniedClaims]); diff != nil {
+		t.Error("cleared denied claims", diff)
+	}
+
+	invalid := []map[string]interface{}{
+		{keyClear: "unknown"},
+		{keyClear: "issuer"},
+		{keyClear: "claims", keyClaims: map[string]interface{}{"aud": "web"}},
+	}
+	for _, data := range invalid {
+		if resp, err := writeRoleData(b, storage, "tester", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("clearing should have failed: %v", data)
+		}
+	}
+}
+
+func TestClearTemplatedRoleFields(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeRoleTemplate(b, storage, "base", map[string]interface{}{keyIssuer: "base.example.com", keySubjectPattern: "^base-"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	roleData := map[string]interface{}{keyRoleTemplate: "base", keySubjectPattern: "^tester-"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyClear: "subject_pattern"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("^base-", resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("inherited subject pattern", diff)
+	}
+
+	// Clearing the template's field applies to its roles
+	if resp, err := writeRoleTemplate(b, storage, "base", map[string]interface{}{keyClear: "subject_pattern"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = readRole(b, storage, "tester")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(DefaultSubjectPattern, resp.Data[keySubjectPattern]); diff != nil {
+		t.Error("default subject pattern", diff)
+	}
+}
+
+func TestDisabledRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:       "tester.example.com",
+		keyEnabled:      false,
+		keyPayloadTypes: "manifest+jws",
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if enabled := resp.Data[keyEnabled]; enabled != false {
+		t.Errorf("expected role to be disabled, got %v", enabled)
+	}
+
+	resp, err = signData(b, storage, "tester", map[string]interface{}{})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("signing with a disabled role should have failed")
+	}
+	if diff := deep.Equal("role 'tester' is disabled", resp.Error().Error()); diff != nil {
+		t.Error(diff)
+	}
+
+	if resp, err := signPayload(b, storage, "tester", map[string]interface{}{keyPayload: "e30="}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("signing payloads with a disabled role should have failed")
+	}
+
+	// Definitions are kept, so re-enabling the role restores it
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keyEnabled: nil}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestTimeBoxedRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyTokenTTL: "1h"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	now := time.Now()
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:    "tester.example.com",
+		keyNotBefore: now.Add(time.Hour).Format(time.RFC3339),
+		keyNotAfter:  now.Format(time.RFC3339),
+	}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("role ending before it starts should have failed")
+	}
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyNotAfter: "tomorrow"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("invalid time should have failed")
+	}
+
+	// Not yet valid
+	notBefore := now.Add(time.Hour).UTC().Truncate(time.Second)
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:    "tester.example.com",
+		keyNotBefore: notBefore.Format(time.RFC3339),
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal(notBefore.Format(time.RFC3339), resp.Data[keyNotBefore]); diff != nil {
+		t.Error(keyNotBefore, diff)
+	}
+	if diff := deep.Equal("", resp.Data[keyNotAfter]); diff != nil {
+		t.Error(keyNotAfter, diff)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("signing before the role's period should have failed")
+	}
+
+	// Tokens of valid roles never outlive them
+	notAfter := now.Add(10 * time.Minute)
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:    "tester.example.com",
+		keyNotBefore: now.Add(-time.Hour).Unix(),
+		keyNotAfter:  notAfter.Unix(),
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var claims jwt.Claims
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if claims.Expiry.Time().After(notAfter) {
+		t.Errorf("token expiring at %s outlives the role", claims.Expiry.Time())
+	}
+
+	// Expired
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:   "tester.example.com",
+		keyNotAfter: now.Add(-time.Minute).Format(time.RFC3339),
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("signing after the role's period should have failed")
+	}
+
+	// Clearing the period allows signing again
+	if resp, err := patchRole(b, storage, "tester", map[string]interface{}{keyNotBefore: nil, keyNotAfter: nil}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
@@ -0,0 +1,236 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	keySecret        = "secret"
+	keySecretKeys    = "keys"
+	keySecretKid     = "kid"
+	keySecretVersion = "version"
+	keySecretCreated = "creation_time"
+	keySigningKid    = "signing_kid"
+)
+
+func pathSecret(b *backend) []*framework.Path {
+	operations := func() map[logical.Operation]framework.OperationHandler {
+		return map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathSecretRead,
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							keySecretKeys: {
+								Type:         framework.TypeMap,
+								Description:  `Shared secrets of the keyring, by version.`,
+								DisplayAttrs: sensitiveDisplayAttrs,
+							},
+						},
+					}},
+				},
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathSecretWrite,
+			},
+		}
+	}
+
+	secretField := &framework.FieldSchema{
+		Type:         framework.TypeString,
+		Description:  `Base64 encoded shared secret imported as the keyring's new key version.`,
+		DisplayAttrs: sensitiveDisplayAttrs,
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "secret",
+			Fields: map[string]*framework.FieldSchema{
+				keySecret: secretField,
+			},
+			Operations: operations(),
+
+			HelpSynopsis:    pathSecretHelpSyn,
+			HelpDescription: pathSecretHelpDesc,
+		},
+		{
+			Pattern: "secret/" + framework.GenericNameRegex(keyRoleName),
+			Fields: map[string]*framework.FieldSchema{
+				keyRoleName: {
+					Type:        framework.TypeLowerCaseString,
+					Description: `Name of the role.`,
+					Required:    true,
+				},
+				keySecret: secretField,
+			},
+			Operations: operations(),
+
+			HelpSynopsis:    pathSecretRoleHelpSyn,
+			HelpDescription: pathSecretRoleHelpDesc,
+		},
+	}
+}
+
+func (b *backend) pathSecretRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	policy, config, resp, err := b.secretPolicy(ctx, req, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	policy.Lock(false)
+	defer policy.Unlock()
+
+	keys := map[string]interface{}{}
+	for version := policy.MinDecryptionVersion; version <= policy.LatestVersion; version++ {
+		key, ok := policy.Keys[strconv.Itoa(version)]
+		if !ok {
+			continue
+		}
+
+		secret := keyEntrySecret(key)
+		if secret == nil {
+			continue
+		}
+
+		keys[strconv.Itoa(version)] = map[string]interface{}{
+			keySecretKid:     localKeyId(b.id, config, policy, version),
+			keySecret:        base64.StdEncoding.EncodeToString(secret),
+			keySecretCreated: key.CreationTime.Format(time.RFC3339),
+		}
+	}
+
+	signingVersion := signingKeyVersion(policy, config.KeyPrePublishPeriod, time.Now())
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keySignatureAlgorithm: config.SignatureAlgorithm,
+			keySecretKeys:         keys,
+			keySigningKid:         localKeyId(b.id, config, policy, signingVersion),
+		},
+	}, nil
+}
+
+func (b *backend) pathSecretWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rawSecret, ok := d.GetOk(keySecret)
+	if !ok {
+		return logical.ErrorResponse("missing '%s'", keySecret), logical.ErrInvalidRequest
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(rawSecret.(string))
+	if err != nil {
+		return logical.ErrorResponse("'%s' must be base64 encoded", keySecret), logical.ErrInvalidRequest
+	}
+
+	policy, config, resp, err := b.secretPolicy(ctx, req, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if minSize := hmacKeySizes[config.SignatureAlgorithm]; len(secret) < minSize || len(secret) > keysutil.HmacMaxKeySize {
+		return logical.ErrorResponse("'%s' must be between %d and %d bytes for %s", keySecret, minSize, keysutil.HmacMaxKeySize, config.SignatureAlgorithm), logical.ErrInvalidRequest
+	}
+
+	policy.Lock(true)
+	defer policy.Unlock()
+
+	if err := importPolicyKey(ctx, req.Storage, policy, secret); err != nil {
+		return nil, err
+	}
+
+	emitKeyRotation(policy.Name, req.MountPoint, rotationReasonImport)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keySecretVersion: policy.LatestVersion,
+			keySecretKid:     localKeyId(b.id, config, policy, policy.LatestVersion),
+		},
+	}, nil
+}
+
+// secretPolicy returns the keyring holding the shared secrets of the request's path, the mount keyring or
+// the isolated keyring of a role, with the configuration of its keys. An error response is returned when
+// the keyring doesn't sign with an HMAC signature algorithm.
+func (b *backend) secretPolicy(ctx context.Context, req *logical.Request, d *framework.FieldData) (*keysutil.Policy, *Config, *logical.Response, error) {
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !isHMACAlgorithm(config.SignatureAlgorithm) || !config.usesLocalKeys() {
+		return nil, nil, logical.ErrorResponse("shared secrets are only available with the HMAC signature algorithms"), logical.ErrInvalidRequest
+	}
+
+	keyring := mainKeyName
+	if rawRoleName, ok := d.GetOk(keyRoleName); ok {
+		role, roleName, _, err := b.matchRole(ctx, req.Storage, rawRoleName.(string))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if role == nil {
+			return nil, nil, logical.ErrorResponse("unknown role"), logical.ErrInvalidRequest
+		}
+		if !role.IsolatedKeyring {
+			return nil, nil, logical.ErrorResponse("role signs with the mount keyring, its secrets are at 'secret'"), logical.ErrInvalidRequest
+		}
+		keyring = role.keyring(roleName)
+	}
+
+	policy, err := b.getKeyringPolicy(ctx, req.Storage, config, keyring, req.MountPoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return policy, config, nil, nil
+}
+
+const pathSecretHelpSyn = `
+Read or import the shared secrets of the mount keyring.
+`
+
+const pathSecretHelpDesc = `
+Read or import the shared secrets signing tokens when the signature algorithm is one of
+the HMAC algorithms (HS256, HS384 or HS512). Secrets are never published in the JWKS;
+anybody able to read them can forge tokens, so access to this path must be restricted
+to privileged policies.
+
+Reading returns the secrets of each available key version, base64 encoded, with their
+key id (kid), and the kid of the secret currently signing tokens.
+
+secret: Base64 encoded secret imported as the new key version; at least the size of the
+        algorithm's hash output (e.g. 32 bytes for HS256). Secrets are rotated like
+        generated keys, with the imported size.
+`
+
+const pathSecretRoleHelpSyn = `
+Read or import the shared secrets of a role's isolated keyring.
+`
+
+const pathSecretRoleHelpDesc = `
+Read or import the shared secrets of the isolated keyring of a role, when the signature
+algorithm is one of the HMAC algorithms; see 'secret'.
+`
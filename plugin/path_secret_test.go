@@ -0,0 +1,175 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func readSecret(b *backend, storage *logical.Storage, path string) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       path,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func importSecret(b *backend, storage *logical.Storage, path string, secret []byte) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       path,
+		Storage:    *storage,
+		Data:       map[string]interface{}{keySecret: base64.StdEncoding.EncodeToString(secret)},
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestSecretRequiresHMAC(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := readSecret(b, storage, "secret")
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Errorf("expected secrets to be unavailable, err:%v resp:%#v", err, resp)
+	}
+}
+
+func TestSecretImport(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "HS256"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp, err := importSecret(b, storage, "secret", []byte("too short"))
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Errorf("expected short secret to be rejected, err:%v resp:%#v", err, resp)
+	}
+
+	secret := []byte("a legacy secret shared with a consumer")
+
+	resp, err = importSecret(b, storage, "secret", secret)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	kid := resp.Data[keySecretKid].(string)
+	version := strconv.Itoa(resp.Data[keySecretVersion].(int))
+
+	token, err := jwt.ParseSigned(signToken(t, b, storage, "tester", map[string]interface{}{}))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if token.Headers[0].KeyID != kid {
+		t.Errorf("expected token signed by the imported secret %s, got %s", kid, token.Headers[0].KeyID)
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(secret, &claims); err != nil {
+		t.Errorf("token not signed with the imported secret: %s", err)
+	}
+
+	resp, err = readSecret(b, storage, "secret")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	keys := resp.Data[keySecretKeys].(map[string]interface{})
+	if len(keys) < 2 {
+		t.Errorf("expected the generated & imported secrets, got %#v", keys)
+	}
+
+	imported := keys[version].(map[string]interface{})
+	if imported[keySecret] != base64.StdEncoding.EncodeToString(secret) || imported[keySecretKid] != kid {
+		t.Errorf("unexpected imported secret %#v", imported)
+	}
+
+	if resp.Data[keySigningKid] != kid {
+		t.Errorf("expected signing kid %s, got %v", kid, resp.Data[keySigningKid])
+	}
+}
+
+func TestSecretRoleKeyring(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "HS512"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "shared", "shared.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if resp, err := writeRoleData(b, storage, "isolated", map[string]interface{}{keyIssuer: "isolated.example.com", keyIsolatedKeyring: true}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readSecret(b, storage, "secret/shared")
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Errorf("expected role without an isolated keyring to be rejected, err:%v resp:%#v", err, resp)
+	}
+
+	mountResp, err := readSecret(b, storage, "secret")
+	if err != nil || (mountResp != nil && mountResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, mountResp)
+	}
+
+	roleResp, err := readSecret(b, storage, "secret/isolated")
+	if err != nil || (roleResp != nil && roleResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, roleResp)
+	}
+
+	roleKey := roleResp.Data[keySecretKeys].(map[string]interface{})["1"].(map[string]interface{})
+	mountKey := mountResp.Data[keySecretKeys].(map[string]interface{})["1"].(map[string]interface{})
+	if roleKey[keySecret] == mountKey[keySecret] {
+		t.Error("expected the role's keyring to have its own secret")
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(roleKey[keySecret].(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if len(secret) != 64 {
+		t.Errorf("expected a 64 byte secret for HS512, got %d", len(secret))
+	}
+
+	token, err := jwt.ParseSigned(signToken(t, b, storage, "isolated", map[string]interface{}{}))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(secret, &claims); err != nil {
+		t.Errorf("token not signed with the role's secret: %s", err)
+	}
+}
@@ -18,19 +18,74 @@ package jwtsecrets
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
 	"github.com/hashicorp/vault/sdk/logical"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
-	"regexp"
+	"net/http"
+	"sort"
+	"strconv"
 	"time"
 )
 
 const (
-	keyClaims  = "claims"
-	keyHeaders = "headers"
+	keyClaims     = "claims"
+	keyHeaders    = "headers"
+	keyFormat     = "format"
+	keyExpiresAt  = "expires_at"
+	keyParameters = "parameters"
+	keyScopes     = "scopes"
+	keyNonce      = "nonce"
+
+	keyIncludeClaims = "include_claims"
+	keyDryRun        = "dry_run"
+
+	keyClientCertificate     = "client_certificate"
+	keyCertificateThumbprint = "certificate_thumbprint"
+	keyDPoPProof             = "dpop_proof"
+	keyDPoPKey               = "dpop_jwk"
 )
 
+// tokenOptions are the options of a sign request.
+type tokenOptions struct {
+	// EncryptionKey is the recipient public key the token is encrypted to, overriding the role's key.
+	EncryptionKey string
+
+	// Format is the format of the token; defaults to JWT.
+	Format string
+
+	// TTL is the requested lifetime of the token, overriding the role's TTL; must not exceed the role's max TTL.
+	TTL time.Duration
+
+	// ExpiresAt is the requested expiration of the token, as an alternative to TTL; must not exceed the role's max TTL.
+	ExpiresAt time.Time
+
+	// Parameters are the values of the role's template parameters, referenced by the role's claims.
+	Parameters map[string]string
+
+	// Scope is the space-delimited 'scope' claim of the requested scopes, each allowed by the role.
+	Scope string
+
+	// Nonce is the 'nonce' claim, checked for replay when the role has a nonce replay window.
+	Nonce string
+
+	// Confirmation is the 'cnf' claim binding the token to a key of the caller (e.g. a client certificate).
+	Confirmation map[string]interface{}
+
+	// DPoPProof is set when the token is bound to the public key of a verified, fresh DPoP proof.
+	DPoPProof bool
+
+	// IncludeClaims includes the claims of the token in the response.
+	IncludeClaims bool
+
+	// DryRun validates the request, returning the claims of the token without signing it, using nonces or
+	// consuming quotas.
+	DryRun bool
+}
+
 func pathSign(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "sign/" + framework.GenericNameRegex(keyRoleName),
@@ -45,10 +100,72 @@ func pathSign(b *backend) *framework.Path {
 				Description: `JSON claims set to sign.`,
 				Required:    false,
 			},
+			keyEncryptionKey: {
+				Type: framework.TypeString,
+				Description: `Recipient public key, as a JWK or PEM encoded public key or certificate, the token is
+encrypted to after signing; overrides the role's encryption key.`,
+			},
+			keyTTL: {
+				Type:        framework.TypeString,
+				Description: `Duration the token is valid for, overriding the role's TTL; must not exceed the role's max TTL.`,
+			},
+			keyExpiresAt: {
+				Type: framework.TypeString,
+				Description: `Expiration of the token, as an RFC 3339 date or unix time, as an alternative to 'ttl'; must not
+exceed the role's max TTL.`,
+			},
+			keyParameters: {
+				Type: framework.TypeMap,
+				Description: `Values of the role's template parameters, referenced by the role's claims, or of the
+parameters of the role's token profile (e.g. 'kubernetes').`,
+			},
+			keyScopes: {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Scopes of the token, set as the space-delimited 'scope' claim; each must be allowed by the role.`,
+			},
+			keyNonce: {
+				Type:        framework.TypeString,
+				Description: `Nonce ('nonce' claim) of the token, e.g. of an OpenID Connect authentication request.`,
+			},
+			keyClientCertificate: {
+				Type:        framework.TypeString,
+				Description: `PEM encoded client certificate the token is bound to, by its SHA-256 thumbprint ('cnf' claim).`,
+			},
+			keyCertificateThumbprint: {
+				Type: framework.TypeString,
+				Description: `Base64url encoded SHA-256 thumbprint of the client certificate the token is bound to
+('cnf' claim), as an alternative to 'client_certificate'.`,
+			},
+			keyDPoPProof: {
+				Type:         framework.TypeString,
+				Description:  `DPoP proof (RFC 9449) of the key the token is bound to, by its JWK thumbprint ('cnf' claim).`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyDPoPKey: {
+				Type: framework.TypeString,
+				Description: `JSON encoded public JWK the token is bound to, by its JWK thumbprint ('cnf' claim), as an
+alternative to 'dpop_proof'.`,
+			},
+			keyFormat: {
+				Type: framework.TypeString,
+				Description: `Format of the token; 'jwt' (default), 'paseto' for v4.public PASETOs (requires EdDSA keys), or 'cwt' for
+CBOR Web Tokens.`,
+				Default: TokenFormatJWT,
+			},
+			keyIncludeClaims: {
+				Type:        framework.TypeBool,
+				Description: `Include the claims of the token in the response, as 'claims'.`,
+			},
+			keyDryRun: {
+				Type: framework.TypeBool,
+				Description: `Validate the request and return the claims of the token, without signing it, using the nonce or
+consuming quotas.`,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.pathSignWrite,
+				Callback:  b.instrumentIssuance("sign", b.redactClaimErrors(b.pathSignWrite)),
+				Responses: signResponses(),
 			},
 		},
 		HelpSynopsis:    pathSignHelpSyn,
@@ -57,14 +174,15 @@ func pathSign(b *backend) *framework.Path {
 }
 
 func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	roleName := d.Get("name").(string)
-
-	role, err := b.getRole(ctx, req.Storage, roleName)
+	role, roleName, roleSuffix, err := b.matchRole(ctx, req.Storage, d.Get(keyRoleName).(string))
 	if err != nil {
 		return nil, err
 	}
 	if role == nil {
-		return logical.ErrorResponse("unknown role"), logical.ErrInvalidRequest
+		return codedErrorResponse(ErrorCodeUnknownRole, "unknown role"), logical.ErrInvalidRequest
+	}
+	if err := role.checkIssuable(roleName, time.Now()); err != nil {
+		return codedErrorResponse(ErrorCodeRoleNotIssuable, err.Error()), logical.ErrInvalidRequest
 	}
 
 	// Gather "freeform" claims
@@ -79,54 +197,369 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse("claims not a map"), logical.ErrInvalidRequest
 	}
 
+	if role.DenyRequestClaims && len(claims) > 0 {
+		return codedErrorResponse(ErrorCodeClaimNotAllowed, "claims cannot be provided to the role"), logical.ErrInvalidRequest
+	}
+
 	config, err := b.getConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
+	// Subjects bound to the caller's entity are never provided by callers
+	if role.BindSubjectToEntity {
+		delete(claims, "sub")
+	}
+
 	for claim := range claims {
 		if allowedClaim, ok := config.allowedClaimsMap[claim]; !ok || !allowedClaim {
-			return logical.ErrorResponse("claim %s not permitted", claim), logical.ErrInvalidRequest
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted", claim), logical.ErrInvalidRequest
+		}
+		if role.deniesClaim(claim) {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted, denied by role", claim), logical.ErrInvalidRequest
+		}
+		if _, ok := role.Claims[claim]; ok && role.MergeClaims[claim] == "" {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted, already provided by role", claim), logical.ErrInvalidRequest
+		}
+	}
+
+	if err := coerceClaims(claims, role.ClaimTypes); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if role.ClaimsSchema != "" {
+		schema, err := parseClaimsSchema(role.ClaimsSchema)
+		if err != nil {
+			return nil, err
+		}
+		if err := schema.validate(claims, "claims"); err != nil {
+			return logical.ErrorResponse("validation of claims failed: %v", err), logical.ErrInvalidRequest
+		}
+	}
+
+	options := tokenOptions{
+		EncryptionKey: d.Get(keyEncryptionKey).(string),
+		Format:        d.Get(keyFormat).(string),
+		IncludeClaims: d.Get(keyIncludeClaims).(bool),
+		DryRun:        d.Get(keyDryRun).(bool),
+	}
+
+	if rawParameters, ok := d.GetOk(keyParameters); ok {
+		options.Parameters = map[string]string{}
+		for name, rawValue := range rawParameters.(map[string]interface{}) {
+			if !stringInSlice(name, role.TemplateParameters) && !stringInSlice(name, role.profile().Parameters) {
+				return codedErrorResponse(ErrorCodeParameterNotAllowed, "parameter %s not permitted", name), logical.ErrInvalidRequest
+			}
+			value, ok := rawValue.(string)
+			if !ok {
+				return logical.ErrorResponse("parameter %s was %T, not string", name, rawValue), logical.ErrInvalidRequest
+			}
+			options.Parameters[name] = value
+		}
+	}
+
+	if roleSuffix != "" {
+		if options.Parameters == nil {
+			options.Parameters = map[string]string{}
+		}
+		options.Parameters[wildcardParameter] = roleSuffix
+	}
+
+	if rawScopes, ok := d.GetOk(keyScopes); ok && len(rawScopes.([]string)) > 0 {
+		if _, ok := claims["scope"]; ok {
+			return logical.ErrorResponse("'scope' claim cannot be provided with '%s'", keyScopes), logical.ErrInvalidRequest
+		}
+		options.Scope, err = scopeClaim(rawScopes.([]string), role.AllowedScopes)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	if nonce := d.Get(keyNonce).(string); nonce != "" {
+		if _, ok := claims["nonce"]; ok {
+			return logical.ErrorResponse("'nonce' claim cannot be provided with '%s'", keyNonce), logical.ErrInvalidRequest
+		}
+		options.Nonce = nonce
+	}
+
+	rawCertificate, hasCertificate := d.GetOk(keyClientCertificate)
+	rawThumbprint, hasThumbprint := d.GetOk(keyCertificateThumbprint)
+	if hasCertificate && hasThumbprint {
+		return logical.ErrorResponse("'%s' and '%s' are mutually exclusive", keyClientCertificate, keyCertificateThumbprint), logical.ErrInvalidRequest
+	}
+	if hasCertificate || hasThumbprint {
+		var thumbprint string
+		if hasCertificate {
+			thumbprint, err = certificateThumbprint(rawCertificate.(string))
+		} else {
+			thumbprint = rawThumbprint.(string)
+			err = validateThumbprint(thumbprint)
+		}
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		options.Confirmation = map[string]interface{}{confirmationCertificateThumbprint: thumbprint}
+	}
+
+	rawProof, hasProof := d.GetOk(keyDPoPProof)
+	rawKey, hasKey := d.GetOk(keyDPoPKey)
+	if hasProof && hasKey {
+		return logical.ErrorResponse("'%s' and '%s' are mutually exclusive", keyDPoPProof, keyDPoPKey), logical.ErrInvalidRequest
+	}
+	if hasProof || hasKey {
+		var key *jose.JSONWebKey
+		if hasProof {
+			key, err = verifyDPoPProof(rawProof.(string), role.dpopProofMaxAge(), time.Now())
+			options.DPoPProof = err == nil
+		} else {
+			key, err = parseDPoPKey(rawKey.(string))
+		}
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		thumbprint, err := jwkThumbprint(key)
+		if err != nil {
+			return logical.ErrorResponse("invalid DPoP key: %v", err), logical.ErrInvalidRequest
 		}
-		if _, ok := role.Claims[claim]; ok {
-			return logical.ErrorResponse("claim %s not permitted, already provided by role", claim), logical.ErrInvalidRequest
+		if options.Confirmation == nil {
+			options.Confirmation = map[string]interface{}{}
+		}
+		options.Confirmation[confirmationJWKThumbprint] = thumbprint
+	}
+
+	if !stringInSlice(options.Format, AllowedTokenFormats) {
+		return logical.ErrorResponse("unknown/unsupported token format, must be one of %s", AllowedTokenFormats), logical.ErrInvalidRequest
+	}
+
+	if rawTTL, ok := d.GetOk(keyTTL); ok {
+		options.TTL, err = time.ParseDuration(rawTTL.(string))
+		if err != nil || options.TTL <= 0 {
+			return logical.ErrorResponse("invalid '%s', must be a positive duration", keyTTL), logical.ErrInvalidRequest
 		}
 	}
 
+	if rawExpiresAt, ok := d.GetOk(keyExpiresAt); ok {
+		if options.TTL > 0 {
+			return logical.ErrorResponse("'%s' and '%s' are mutually exclusive", keyTTL, keyExpiresAt), logical.ErrInvalidRequest
+		}
+		options.ExpiresAt, err = parseExpiresAt(rawExpiresAt.(string))
+		if err != nil {
+			return logical.ErrorResponse("invalid '%s', must be an RFC 3339 date or unix time", keyExpiresAt), logical.ErrInvalidRequest
+		}
+	}
+
+	return b.signRoleToken(ctx, req, roleName, role, config, claims, options)
+}
+
+// signRoleToken signs the claims, combined with the role's claims and the generated claims, returning the
+// signed token as a response. Tokens are encrypted to the requested encryption key, or the role's encryption key.
+func (b *backend) signRoleToken(ctx context.Context, req *logical.Request, roleName string, role *Role, config *Config, claims map[string]interface{}, options tokenOptions) (*logical.Response, error) {
+
+	decisions, err := b.signDecisions(ctx, req, config, roleName)
+	if err != nil {
+		return nil, err
+	}
+	decisions.log("role matched", "role_suffix", options.Parameters[wildcardParameter], "token_profile", role.tokenProfile())
+
+	encryption, err := role.encryption(options.EncryptionKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	paseto := options.Format == TokenFormatPASETO
+	if paseto && encryption != nil {
+		return logical.ErrorResponse("PASETO tokens cannot be encrypted"), logical.ErrInvalidRequest
+	}
+	if options.Format == TokenFormatCWT && encryption != nil {
+		return logical.ErrorResponse("CWT tokens cannot be encrypted"), logical.ErrInvalidRequest
+	}
+
+	// Templates of the role's issuer & claims are bound to the identity of the caller, or to the parameters
+	// of the request; each value is resolved once, so resolved values are never interpreted as templates.
+	templates := newIdentityTemplates(b.System(), req.EntityID)
+	resolve := func(value string) (string, error) {
+		if hasIdentityTemplate(value) {
+			return templates.resolveString(value)
+		}
+		return renderParameterTemplate(value, options.Parameters)
+	}
+
 	for roleClaim := range role.Claims {
-		claims[roleClaim] = role.Claims[roleClaim]
+		value, err := mapStrings(role.Claims[roleClaim], resolve)
+		if err != nil {
+			return logical.ErrorResponse("error resolving '%s' claim: %v", roleClaim, err), logical.ErrInvalidRequest
+		}
+
+		// Request values are merged after resolving the role's, so they are never interpreted as templates
+		if requestValue, ok := claims[roleClaim]; ok {
+			value, err = mergeClaim(roleClaim, value, requestValue, role.MergeClaims[roleClaim])
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+		}
+
+		claims[roleClaim] = value
 	}
 
-	claims["iss"] = role.Issuer
+	if profile := role.profile(); profile.parameterClaims != nil {
+		parameterClaims, err := profile.parameterClaims(role, options.Parameters)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		for claim, value := range parameterClaims {
+			if _, ok := claims[claim]; ok {
+				return codedErrorResponse(ErrorCodeClaimNotAllowed, "'%s' claim cannot be provided to the %s token profile", claim, role.tokenProfile()), logical.ErrInvalidRequest
+			}
+			claims[claim] = value
+		}
+	}
+
+	if options.Scope != "" {
+		if _, ok := claims["scope"]; ok {
+			return logical.ErrorResponse("'scope' claim already provided by role"), logical.ErrInvalidRequest
+		}
+		claims["scope"] = options.Scope
+	}
+
+	if options.Nonce != "" {
+		if _, ok := claims["nonce"]; ok {
+			return logical.ErrorResponse("'nonce' claim already provided by role"), logical.ErrInvalidRequest
+		}
+		claims["nonce"] = options.Nonce
+	}
+
+	if role.RequireCertificateBinding && options.Confirmation[confirmationCertificateThumbprint] == nil {
+		return logical.ErrorResponse("tokens of the role must be bound to a client certificate"), logical.ErrInvalidRequest
+	}
+
+	if role.RequireDPoPProof && !options.DPoPProof {
+		return logical.ErrorResponse("tokens of the role must be bound to the key of a fresh DPoP proof"), logical.ErrInvalidRequest
+	}
+
+	if len(options.Confirmation) > 0 {
+		if _, ok := claims["cnf"]; ok {
+			return logical.ErrorResponse("'cnf' claim cannot be provided with bound tokens"), logical.ErrInvalidRequest
+		}
+		claims["cnf"] = options.Confirmation
+	}
+
+	// Configs & roles can predate the reservation of the 'status' claim, which references the status lists revoked
+	// tokens are recorded in
+	if _, ok := claims["status"]; ok {
+		return logical.ErrorResponse("'status' claim is reserved"), logical.ErrInvalidRequest
+	}
+
+	if role.StatusList {
+		if !config.hasIssuer() {
+			return logical.ErrorResponse("'%s' must be configured to reference tokens from status lists", keyIssuer), logical.ErrInvalidRequest
+		}
+	}
+
+	// Mount-wide defaults have the lowest precedence
+	for defaultClaim, value := range config.DefaultClaims {
+		if _, ok := claims[defaultClaim]; !ok {
+			claims[defaultClaim] = value
+		}
+	}
+
+	// Roles without an issuer use the issuer derived for the mount
+	if roleIssuer := role.issuer(); roleIssuer == "" && config.IssuerMode == IssuerModeAuto {
+		claims["iss"], err = b.mountIssuer(config, req)
+	} else {
+		claims["iss"], err = resolveIssuer(roleIssuer, req, templates)
+	}
+	if err != nil {
+		return logical.ErrorResponse("error resolving issuer: %v", err), logical.ErrInvalidRequest
+	}
+
+	if role.BindSubjectToEntity {
+		sub, err := templates.resolveString(role.subjectTemplate())
+		if err != nil {
+			return logical.ErrorResponse("error binding subject to entity: %v", err), logical.ErrInvalidRequest
+		}
+		if sub == "" {
+			return logical.ErrorResponse("error binding subject to entity: empty subject"), logical.ErrInvalidRequest
+		}
+		claims["sub"] = sub
+	}
+
+	profile := role.profile()
 
 	now := time.Now()
 
-	expiry := now.Add(config.TokenTTL)
+	ttl, maxTTL := b.roleTokenTTLs(config, role)
+	if options.TTL > 0 {
+		if options.TTL > maxTTL {
+			return codedErrorResponse(ErrorCodeTTLExceedsMax, "'%s' is greater than the role's max ttl (%s)", keyTTL, maxTTL), logical.ErrInvalidRequest
+		}
+		ttl = options.TTL
+	}
+	if !options.ExpiresAt.IsZero() {
+		ttl = options.ExpiresAt.Sub(now)
+		if ttl <= 0 {
+			return logical.ErrorResponse("'%s' is in the past", keyExpiresAt), logical.ErrInvalidRequest
+		}
+		if ttl > maxTTL {
+			return codedErrorResponse(ErrorCodeTTLExceedsMax, "'%s' is beyond the role's max ttl (%s)", keyExpiresAt, maxTTL), logical.ErrInvalidRequest
+		}
+	}
+	ttl = profile.ttl(ttl)
+	if !role.NotAfter.IsZero() {
+		ttl = durationMin(ttl, role.NotAfter.Sub(now))
+	}
+
+	expiry := now.Add(ttl)
 	claims["exp"] = jwt.NumericDate(expiry.Unix())
 
-	if config.SetIAT {
-		claims["iat"] = jwt.NumericDate(now.Unix())
+	// Back-dated to tolerate verifiers with clocks behind ours
+	issuedAt := now.Add(-config.ClockSkew)
+
+	if config.SetIAT || profile.GenerateIDs {
+		claims["iat"] = jwt.NumericDate(issuedAt.Unix())
 	}
 
 	if config.SetNBF {
-		claims["nbf"] = jwt.NumericDate(now.Unix())
+		claims["nbf"] = jwt.NumericDate(issuedAt.Unix())
 	}
 
-	if config.SetJTI {
-		jti, err := b.idGen.id()
+	if config.SetJTI || profile.GenerateIDs {
+		generateJTI := b.generateJTI
+		if options.DryRun {
+			generateJTI = b.previewJTI
+		}
+		jti, err := generateJTI(ctx, req.Storage, config)
 		if err != nil {
 			return logical.ErrorResponse("could not generate 'jti' claim: %v", err), err
 		}
 		claims["jti"] = jti
 	}
 
+	// Profile claims are mapped prior to validating 'sub' & 'aud'
+	if err := profile.apply(role, claims); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Profiles can shorten the lifetime of tokens (e.g. to a credential's expiration date); the lease, quotas &
+	// response follow the token's 'exp' claim
+	if exp, ok := claims["exp"].(jwt.NumericDate); ok && int64(exp) < expiry.Unix() {
+		expiry = exp.Time()
+		ttl = expiry.Sub(now)
+		if ttl <= 0 {
+			return logical.ErrorResponse("token would expire in the past"), logical.ErrInvalidRequest
+		}
+	}
+
+	decisions.resolveTTL(ttl, maxTTL, options, role, expiry)
+
 	if rawSub, ok := claims["sub"]; ok {
 		if sub, ok := rawSub.(string); ok {
-			if matched, _ := regexp.MatchString(role.SubjectPattern, sub); !matched {
-				return logical.ErrorResponse("validation of 'sub' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
+			if !b.cachedRoles.matchPattern(role.SubjectPattern, sub) {
+				decisions.rejectClaim("sub", sub, "role subject_pattern", role.SubjectPattern)
+				return codedErrorResponse(ErrorCodeSubPatternMismatch, "validation of 'sub' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
 			}
-			if matched, _ := regexp.MatchString(config.SubjectPattern, sub); !matched {
-				return logical.ErrorResponse("validation of 'sub' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
+			if !b.cachedRoles.matchPattern(config.SubjectPattern, sub) {
+				decisions.rejectClaim("sub", sub, "config subject_pattern", config.SubjectPattern)
+				return codedErrorResponse(ErrorCodeSubPatternMismatch, "validation of 'sub' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
 			}
 		} else {
 			return logical.ErrorResponse("'sub' claim was %T, not string"), logical.ErrInvalidRequest
@@ -134,28 +567,49 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 	}
 
 	if rawAud, ok := claims["aud"]; ok {
+		// Audiences provided natively (e.g. by plugins embedding the backend) are checked as decoded from JSON
+		if aud, ok := rawAud.([]string); ok {
+			audEntries := make([]interface{}, len(aud))
+			for i, audEntry := range aud {
+				audEntries[i] = audEntry
+			}
+			rawAud = audEntries
+		}
+
 		switch aud := rawAud.(type) {
 		case string:
-			if matched, _ := regexp.MatchString(role.AudiencePattern, aud); !matched {
-				return logical.ErrorResponse("validation of 'aud' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
+			if !b.cachedRoles.matchPattern(role.AudiencePattern, aud) {
+				decisions.rejectClaim("aud", aud, "role audience_pattern", role.AudiencePattern)
+				return codedErrorResponse(ErrorCodeAudPatternMismatch, "validation of 'aud' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
+			}
+			if !b.cachedRoles.matchPattern(config.AudiencePattern, aud) {
+				decisions.rejectClaim("aud", aud, "config audience_pattern", config.AudiencePattern)
+				return codedErrorResponse(ErrorCodeAudPatternMismatch, "validation of 'aud' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
 			}
-			if matched, _ := regexp.MatchString(config.AudiencePattern, aud); !matched {
-				return logical.ErrorResponse("validation of 'aud' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
+			if !audienceAllowed(aud, config.AllowedAudiences, role.AllowedAudiences) {
+				decisions.rejectClaim("aud", aud, "allowed_audiences", append(config.AllowedAudiences, role.AllowedAudiences...))
+				return codedErrorResponse(ErrorCodeAudNotAllowed, "validation of 'aud' claim failed (not an allowed audience)"), logical.ErrInvalidRequest
 			}
 		case []interface{}:
-			if config.MaxAudiences > -1 && len(aud) > config.MaxAudiences {
-				return logical.ErrorResponse("too many audience claims: %d", len(aud)), logical.ErrInvalidRequest
+			if maxAudiences := role.maxAudiences(config); maxAudiences > -1 && len(aud) > maxAudiences {
+				return codedErrorResponse(ErrorCodeTooManyAudiences, "too many audience claims: %d", len(aud)), logical.ErrInvalidRequest
 			}
 			for _, rawAudEntry := range aud {
 				audEntry, ok := rawAudEntry.(string)
 				if !ok {
-					return logical.ErrorResponse("'aud' claim was %T, not string", audEntry), logical.ErrInvalidRequest
+					return logical.ErrorResponse("'aud' claim was %T, not string", rawAudEntry), logical.ErrInvalidRequest
 				}
-				if matched, _ := regexp.MatchString(role.AudiencePattern, audEntry); !matched {
-					return logical.ErrorResponse("validation of 'aud' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
+				if !b.cachedRoles.matchPattern(role.AudiencePattern, audEntry) {
+					decisions.rejectClaim("aud", audEntry, "role audience_pattern", role.AudiencePattern)
+					return codedErrorResponse(ErrorCodeAudPatternMismatch, "validation of 'aud' claim failed (doesn't match role restriction)"), logical.ErrInvalidRequest
 				}
-				if matched, _ := regexp.MatchString(config.AudiencePattern, audEntry); !matched {
-					return logical.ErrorResponse("validation of 'aud' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
+				if !b.cachedRoles.matchPattern(config.AudiencePattern, audEntry) {
+					decisions.rejectClaim("aud", audEntry, "config audience_pattern", config.AudiencePattern)
+					return codedErrorResponse(ErrorCodeAudPatternMismatch, "validation of 'aud' claim failed (doesn't match config restriction)"), logical.ErrInvalidRequest
+				}
+				if !audienceAllowed(audEntry, config.AllowedAudiences, role.AllowedAudiences) {
+					decisions.rejectClaim("aud", audEntry, "allowed_audiences", append(config.AllowedAudiences, role.AllowedAudiences...))
+					return codedErrorResponse(ErrorCodeAudNotAllowed, "validation of 'aud' claim failed (not an allowed audience)"), logical.ErrInvalidRequest
 				}
 			}
 		default:
@@ -163,37 +617,251 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 		}
 	}
 
-	policy, err := b.getPolicy(ctx, req.Storage, config, req.MountPoint)
-	if err != nil {
-		return logical.ErrorResponse("error getting key: %v", err), err
+	if err := validateSessionClaims(claims, now, config.AllowedACRValues, config.AllowedAMRValues); err != nil {
+		return logical.ErrorResponse("validation of session claims failed: %v", err), logical.ErrInvalidRequest
+	}
+
+	if role.RequireAudience && !hasAudience(claims) {
+		return logical.ErrorResponse("'aud' claim is required by the role"), logical.ErrInvalidRequest
+	}
+
+	if err := b.matchClaimPatterns(claims, role.ClaimPatterns); err != nil {
+		var patternErr *claimPatternError
+		if errors.As(err, &patternErr) {
+			decisions.rejectClaim(patternErr.claim, patternErr.value, "role claim_patterns", patternErr.pattern)
+			return codedErrorResponse(ErrorCodeClaimPatternMismatch, err.Error()), logical.ErrInvalidRequest
+		}
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if role.PolicyExpression != "" {
+		if err := evaluatePolicyExpression(req, roleName, role, claims); err != nil {
+			return codedErrorResponse(ErrorCodePolicyDenied, err.Error()), logical.ErrPermissionDenied
+		}
 	}
 
-	signer := &PolicySigner{
-		BackendId:          b.id,
-		SignatureAlgorithm: config.SignatureAlgorithm,
-		Policy:             policy,
-		SignerOptions:      (&jose.SignerOptions{}).WithType("JWT"),
+	if config.OPA != nil {
+		if err := b.checkOPA(ctx, req, config.OPA, roleName, claims); err != nil {
+			var denied *opaDeniedError
+			var unavailable *opaUnavailableError
+			switch {
+			case errors.As(err, &denied):
+				return codedErrorResponse(ErrorCodePolicyDenied, err.Error()), logical.ErrPermissionDenied
+			case errors.As(err, &unavailable):
+				return codedErrorResponse(ErrorCodePolicyUnavailable, err.Error()), logical.CodedError(http.StatusBadGateway, err.Error())
+			default:
+				return nil, err
+			}
+		}
 	}
 
+	decisions.log("claims validated", "claims", claimNames(claims), "dry_run", options.DryRun)
+
+	// Dry runs stop after validation, before anything is recorded or consumed
+	if options.DryRun {
+		if options.Nonce != "" && role.NonceReplayWindow > 0 {
+			unused, err := b.checkNonce(ctx, req.Storage, roleName, options.Nonce)
+			if err != nil {
+				return nil, err
+			}
+			if !unused {
+				return codedErrorResponse(ErrorCodeNonceReused, "'%s' was already used", keyNonce), logical.ErrInvalidRequest
+			}
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"claims":     claims,
+				"issued_at":  now.Unix(),
+				"expiration": expiry.Unix(),
+			},
+		}, nil
+	}
+
+	reservation, quotaResp, err := b.checkQuotas(ctx, req, quotaName(roleName, options.Parameters[wildcardParameter]), role, expiry)
+	if quotaResp != nil || err != nil {
+		return quotaResp, err
+	}
+
+	// Quotas are reserved before signing, and released unless the token is issued
+	issued := false
+	defer func() {
+		if !issued {
+			b.releaseQuotas(ctx, req.Storage, reservation)
+		}
+	}()
+
+	// Entries of status lists are allocated last, as they are never reused
+	var status *tokenStatus
+	if role.StatusList {
+		issuer, err := b.mountIssuer(config, req)
+		if err != nil {
+			return logical.ErrorResponse("error resolving issuer: %v", err), logical.ErrInvalidRequest
+		}
+		allocated, err := b.allocateTokenStatus(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		status = &allocated
+		claims["status"] = statusClaim(issuer, allocated)
+	}
+
+	signerOptions := (&jose.SignerOptions{}).WithType(jose.ContentType(role.tokenType()))
+
 	for headerName := range role.Headers {
+		// Roles written before the header was reserved
+		if stringInSlice(headerName, ReservedHeaders) {
+			return logical.ErrorResponse("header %s is reserved", headerName), logical.ErrInvalidRequest
+		}
 		headerValue := role.Headers[headerName]
-		signer.SignerOptions = signer.SignerOptions.WithHeader(jose.HeaderKey(headerName), headerValue)
+		signerOptions = signerOptions.WithHeader(jose.HeaderKey(headerName), headerValue)
 	}
 
-	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	keyConfig, err := b.roleKeyConfig(ctx, req.Storage, config, role)
 	if err != nil {
-		return logical.ErrorResponse("error serializing jwt: %v", err), err
+		return logical.ErrorResponse("error getting key: %v", err), err
 	}
 
-	resp := b.Secret(jwtSecretsTokenType).Response(
-		map[string]interface{}{
-			"token": token,
-		},
-		map[string]interface{}{},
-	)
-	resp.Secret.TTL = config.TokenTTL
+	if paseto && keyConfig.SignatureAlgorithm != jose.EdDSA {
+		return logical.ErrorResponse("PASETO tokens require EdDSA (Ed25519) keys"), logical.ErrInvalidRequest
+	}
+
+	if !role.allowsAlgorithm(keyConfig.SignatureAlgorithm) {
+		return codedErrorResponse(ErrorCodeAlgorithmNotAllowed, "the role doesn't allow the %s algorithm of its keys", keyConfig.SignatureAlgorithm), logical.ErrInvalidRequest
+	}
+
+	if !profile.allowsAlgorithm(keyConfig.SignatureAlgorithm) {
+		return codedErrorResponse(ErrorCodeAlgorithmNotAllowed, "the %s token profile requires one of the %s algorithms", role.tokenProfile(), profile.SignatureAlgorithms), logical.ErrInvalidRequest
+	}
+
+	keySigner, err := b.getSigner(ctx, req.Storage, keyConfig, role.keyring(roleName), req.MountPoint, signerOptions)
+	if err != nil {
+		return logical.ErrorResponse("error getting key: %v", err), err
+	}
+
+	signer := &keyIDSigner{inputSigner: keySigner}
+
+	var token string
+	switch options.Format {
+	case TokenFormatPASETO:
+		token, err = signPASETO(signer, claims)
+		if err != nil {
+			return logical.ErrorResponse("error signing paseto: %v", err), err
+		}
+	case TokenFormatCWT:
+		token, err = signCWT(signer, keyConfig.SignatureAlgorithm, claims)
+		if err != nil {
+			return logical.ErrorResponse("error signing cwt: %v", err), err
+		}
+	default:
+		token, err = jwt.Signed(signer).Claims(claims).CompactSerialize()
+		if err != nil {
+			return logical.ErrorResponse("error serializing jwt: %v", err), err
+		}
+	}
+
+	if encryption != nil {
+		token, err = encryption.encrypt(token)
+		if err != nil {
+			return logical.ErrorResponse("error encrypting jwt: %v", err), err
+		}
+	}
+
+	// Nonces are recorded last, once the token is signed, so requests failing validation, quotas or signing don't use them
+	if options.Nonce != "" && role.NonceReplayWindow > 0 {
+		unused, err := b.useNonce(ctx, req.Storage, roleName, options.Nonce, role.NonceReplayWindow)
+		if err != nil {
+			return nil, err
+		}
+		if !unused {
+			return codedErrorResponse(ErrorCodeNonceReused, "'%s' was already used", keyNonce), logical.ErrInvalidRequest
+		}
+	}
+
+	issued = true
+
+	decisions.log("token issued", "kid", signer.KeyID, "jti", claims["jti"])
+
+	if config.IssuanceLogSize > 0 {
+		redactor, err := b.claimRedactor(ctx, req.Storage, config)
+		if err != nil {
+			return nil, err
+		}
+
+		issuance := newIssuance(req, roleName, claims, now, expiry)
+		redactor.redactIssuance(issuance)
+
+		if err := b.recordIssuance(ctx, req.Storage, config, issuance); err != nil {
+			return nil, err
+		}
+	}
+
+	data := map[string]interface{}{
+		"token":      token,
+		"kid":        signer.KeyID,
+		"issued_at":  now.Unix(),
+		"expiration": expiry.Unix(),
+	}
+	if jti, ok := claims["jti"]; ok {
+		data["jti"] = jti
+	}
+	if options.IncludeClaims {
+		data["claims"] = claims
+	}
 
-	return resp, nil
+	if config.DisableLeases {
+		return wrapSignResponse(req, &logical.Response{
+			Data: data,
+		}, role.responseWrapTTL(config)), nil
+	}
+
+	// Revoking the lease revokes the token, which requires its jti or status list entry
+	internalData := map[string]interface{}{
+		"exp": expiry.Unix(),
+	}
+	if jti, ok := claims["jti"]; ok {
+		internalData["jti"] = jti
+	}
+	if status != nil {
+		internalData["status_list"] = status.List
+		internalData["status_idx"] = status.Index
+	}
+
+	resp := b.Secret(jwtSecretsTokenType).Response(data, internalData)
+	resp.Secret.TTL = ttl
+
+	return wrapSignResponse(req, resp, role.responseWrapTTL(config)), nil
+}
+
+// wrapSignResponse requests Vault response wraps the response with the TTL, so the token is only readable by
+// unwrapping it; callers requesting wrapping themselves have their response wrapped with their TTL.
+func wrapSignResponse(req *logical.Request, resp *logical.Response, wrapTTL time.Duration) *logical.Response {
+	if wrapTTL > 0 && (req.WrapInfo == nil || req.WrapInfo.TTL == 0) {
+		resp.WrapInfo = &wrapping.ResponseWrapInfo{TTL: wrapTTL}
+	}
+	return resp
+}
+
+// signResponses describes the responses of sign requests; the signed token and its metadata.
+func signResponses() map[int][]framework.Response {
+	responses := tokenResponses("token", "Signed token")
+
+	fields := responses[http.StatusOK][0].Fields
+	fields["kid"] = &framework.FieldSchema{Type: framework.TypeString, Description: "Id of the signing key"}
+	fields["issued_at"] = &framework.FieldSchema{Type: framework.TypeInt64, Description: "Unix time the token was issued"}
+	fields["expiration"] = &framework.FieldSchema{Type: framework.TypeInt64, Description: "Unix time the token expires"}
+	fields["jti"] = &framework.FieldSchema{Type: framework.TypeString, Description: "Id ('jti' claim) of the token, when generated"}
+	fields["claims"] = &framework.FieldSchema{Type: framework.TypeMap, Description: "Claims of the token, when requested"}
+
+	return responses
+}
+
+// parseExpiresAt parses an expiration as unix time (seconds), or an RFC 3339 date.
+func parseExpiresAt(raw string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
 }
 
 const pathSignHelpSyn = `
@@ -202,4 +870,127 @@ Sign a set of claims.
 
 const pathSignHelpDesc = `
 Sign a set of claims.
+
+encryption_key: Recipient public key (JWK or PEM) the signed token is encrypted to,
+                producing a nested JWT (JWE with 'cty: JWT'); overrides the role's key.
+ttl:            Duration the token is valid for, overriding the role's ttl; must not
+                exceed the role's max_ttl.
+expires_at:     Expiration of the token, as an RFC 3339 date or unix time, as an
+                alternative to ttl; must not exceed the role's max_ttl.
+parameters:     Values of the role's template parameters, referenced by the role's claims, or
+                of the parameters of the role's token profile; e.g. 'namespace' &
+                'serviceaccount' of the 'kubernetes' profile.
+scopes:         Scopes of the token, each allowed by the role's 'allowed_scopes'; set as the
+                space-delimited 'scope' claim.
+nonce:          Nonce ('nonce' claim) of the token; rejected when reused within the role's
+                'nonce_replay_window'.
+client_certificate:
+                PEM encoded client certificate the token is bound to, setting the RFC 8705
+                'cnf' claim to the certificate's SHA-256 thumbprint ('x5t#S256').
+certificate_thumbprint:
+                Base64url encoded SHA-256 thumbprint of the client certificate the token
+                is bound to, as an alternative to 'client_certificate'.
+dpop_proof:     DPoP proof (RFC 9449) of the key the token is bound to, setting the 'cnf'
+                claim to the JWK thumbprint ('jkt') of the proof's public key.
+dpop_jwk:       JSON encoded public JWK the token is bound to, as an alternative to
+                'dpop_proof'.
+format:         Format of the token; 'jwt' (default), 'paseto' for v4.public PASETOs
+                signed with EdDSA (Ed25519) keys, or 'cwt' for base64url encoded CBOR
+                Web Tokens signed as COSE_Sign1 messages. Claims are restricted identically.
+include_claims: Include the claims of the token in the response, as 'claims'.
+dry_run:        Validate the request and return the 'claims' of the token, without signing
+                it, using the nonce or consuming quotas.
+
+Along with the token, responses include the id of the signing key ('kid'), the
+'issued_at' & 'expiration' unix times of the token and its 'jti', when generated.
 `
+
+// matchClaimPatterns checks the claims match the patterns (claim name to regular expression) of the role; each
+// element of array claims must match. Claims missing from the token are not checked.
+func (b *backend) matchClaimPatterns(claims map[string]interface{}, patterns map[string]string) error {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rawClaim, ok := claims[name]
+		if !ok {
+			continue
+		}
+
+		var values []interface{}
+		switch claim := rawClaim.(type) {
+		case string:
+			values = []interface{}{claim}
+		case []string:
+			for _, value := range claim {
+				values = append(values, value)
+			}
+		case []interface{}:
+			values = claim
+		default:
+			return fmt.Errorf("'%s' claim was %T, not string or []string", name, rawClaim)
+		}
+
+		pattern, err := b.cachedRoles.compilePattern(patterns[name])
+		if err != nil {
+			return fmt.Errorf("invalid pattern for claim %s", name)
+		}
+
+		for _, rawValue := range values {
+			value, ok := rawValue.(string)
+			if !ok {
+				return fmt.Errorf("'%s' claim was %T, not string", name, rawValue)
+			}
+			if !pattern.MatchString(value) {
+				return &claimPatternError{claim: name, value: value, pattern: patterns[name]}
+			}
+		}
+	}
+
+	return nil
+}
+
+// claimPatternError reports a claim value not matching the role's pattern for the claim.
+type claimPatternError struct {
+	claim   string
+	value   string
+	pattern string
+}
+
+func (e *claimPatternError) Error() string {
+	return fmt.Sprintf("validation of '%s' claim failed (doesn't match role restriction)", e.claim)
+}
+
+// audienceAllowed checks the audience is a member of each of the (non-empty) lists of allowed audiences.
+func audienceAllowed(aud string, allowedAudiences ...[]string) bool {
+	for _, allowed := range allowedAudiences {
+		if len(allowed) > 0 && !stringInSlice(aud, allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAudience checks if the claims have at least one (non-empty) audience.
+func hasAudience(claims map[string]interface{}) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud != ""
+	case []string:
+		for _, audEntry := range aud {
+			if audEntry != "" {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, audEntry := range aud {
+			if audEntry != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"strings"
+	"time"
+)
+
+const (
+	keyPayload     = "payload"
+	keyType        = "typ"
+	keyContentType = "cty"
+	keyJWS         = "jws"
+	keyDetached    = "detached"
+	keyB64         = "b64"
+)
+
+// isTokenType checks if the type ('typ' header) is reserved for tokens; 'JWT', or explicitly typed JWTs
+// ('<type>+jwt'). Payloads of these types must be signed as tokens, enforcing the claim policies.
+func isTokenType(typ string) bool {
+	typ = strings.TrimPrefix(strings.ToLower(typ), "application/")
+	return typ == "jwt" || strings.HasSuffix(typ, "+jwt")
+}
+
+func pathSignPayload(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign-payload/" + framework.GenericNameRegex(keyRoleName),
+		Fields: map[string]*framework.FieldSchema{
+			keyRoleName: {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role",
+				Required:    true,
+			},
+			keyPayload: {
+				Type:        framework.TypeString,
+				Description: `Base64 encoded payload to sign.`,
+				Required:    true,
+			},
+			keyType: {
+				Type:        framework.TypeString,
+				Description: `Type ('typ' header) of the payload; defaults to the first of the role's payload types.`,
+			},
+			keyContentType: {
+				Type:        framework.TypeString,
+				Description: `Content type ('cty' header) of the payload.`,
+			},
+			keyDetached: {
+				Type:        framework.TypeBool,
+				Description: `Whether the payload is detached from the returned JWS.`,
+			},
+			keyB64: {
+				Type:        framework.TypeBool,
+				Description: `Whether the payload is base64url encoded; when false, the payload is signed unencoded (RFC 7797).`,
+				Default:     true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathSignPayloadWrite,
+			},
+		},
+		HelpSynopsis:    pathSignPayloadHelpSyn,
+		HelpDescription: pathSignPayloadHelpDesc,
+	}
+}
+
+func (b *backend) pathSignPayloadWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, roleName, _, err := b.matchRole(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(ErrorCodeUnknownRole, "unknown role"), logical.ErrInvalidRequest
+	}
+	if err := role.checkIssuable(roleName, time.Now()); err != nil {
+		return codedErrorResponse(ErrorCodeRoleNotIssuable, err.Error()), logical.ErrInvalidRequest
+	}
+
+	if len(role.PayloadTypes) == 0 {
+		return logical.ErrorResponse("payload signing not permitted by role"), logical.ErrInvalidRequest
+	}
+
+	payload, err := decodePayload(d.Get(keyPayload).(string))
+	if err != nil {
+		return logical.ErrorResponse("invalid payload: %v", err), logical.ErrInvalidRequest
+	}
+
+	typ := firstNonEmpty(d.Get(keyType).(string), role.PayloadTypes[0])
+	if !stringInSlice(typ, role.PayloadTypes) {
+		return logical.ErrorResponse("payload type '%s' not permitted", typ), logical.ErrInvalidRequest
+	}
+
+	signerOptions := (&jose.SignerOptions{}).WithType(jose.ContentType(typ))
+
+	if cty := d.Get(keyContentType).(string); cty != "" {
+		if !stringInSlice(cty, role.PayloadContentTypes) {
+			return logical.ErrorResponse("payload content type '%s' not permitted", cty), logical.ErrInvalidRequest
+		}
+		signerOptions = signerOptions.WithContentType(jose.ContentType(cty))
+	}
+
+	detached := d.Get(keyDetached).(bool)
+
+	// Unencoded payloads are only allowed in the compact serialization when free of '.'
+	b64 := d.Get(keyB64).(bool)
+	if !b64 {
+		if !detached && bytes.ContainsRune(payload, '.') {
+			return logical.ErrorResponse("unencoded payloads containing '.' must be detached"), logical.ErrInvalidRequest
+		}
+		signerOptions = signerOptions.WithBase64(false)
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keyConfig, err := b.roleKeyConfig(ctx, req.Storage, config, role)
+	if err != nil {
+		return logical.ErrorResponse("error getting key: %v", err), err
+	}
+
+	if !role.allowsAlgorithm(keyConfig.SignatureAlgorithm) {
+		return codedErrorResponse(ErrorCodeAlgorithmNotAllowed, "the role doesn't allow the %s algorithm of its keys", keyConfig.SignatureAlgorithm), logical.ErrInvalidRequest
+	}
+
+	signer, err := b.getSigner(ctx, req.Storage, keyConfig, role.keyring(roleName), req.MountPoint, signerOptions)
+	if err != nil {
+		return logical.ErrorResponse("error getting key: %v", err), err
+	}
+
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return logical.ErrorResponse("error signing payload: %v", err), err
+	}
+
+	jws, err := signature.DetachedCompactSerialize()
+	if err != nil {
+		return logical.ErrorResponse("error serializing jws: %v", err), err
+	}
+
+	if !detached {
+		encodedPayload := string(payload)
+		if b64 {
+			encodedPayload = base64.RawURLEncoding.EncodeToString(payload)
+		}
+		parts := strings.SplitN(jws, ".", 3)
+		jws = parts[0] + "." + encodedPayload + "." + parts[2]
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyJWS: jws,
+		},
+	}, nil
+}
+
+// decodePayload decodes a base64 payload, using either the standard or URL encoding, padded or not.
+func decodePayload(encoded string) ([]byte, error) {
+	encoded = strings.TrimRight(encoded, "=")
+	if strings.ContainsAny(encoded, "-_") {
+		return base64.RawURLEncoding.DecodeString(encoded)
+	}
+	return base64.RawStdEncoding.DecodeString(encoded)
+}
+
+const pathSignPayloadHelpSyn = `
+Sign an arbitrary payload.
+`
+
+const pathSignPayloadHelpDesc = `
+Sign an arbitrary payload, such as a manifest or webhook body, using the role's
+keys; returning the compact JWS.
+
+Payload signing must be enabled on the role by its 'payload_types'; the payload's
+'typ' & 'cty' headers must be allowed by the role's 'payload_types' &
+'payload_content_types' respectively.
+
+payload:  Base64 encoded payload to sign.
+typ:      Type of the payload; defaults to the first of the role's payload types.
+cty:      Content type of the payload.
+detached: Return a detached signature (RFC 7515 Appendix F), omitting the payload.
+b64:      When false, sign the payload unencoded (RFC 7797), adding the 'b64' header
+          and marking it critical ('crit').
+`
@@ -0,0 +1,232 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func signPayload(b *backend, storage *logical.Storage, role string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign-payload/" + role,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func writePayloadRole(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+	data[keyIssuer] = "tester.example.com"
+
+	req := &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "roles/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestSignPayload(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writePayloadRole(b, storage, "manifests", map[string]interface{}{
+		keyPayloadTypes:        "manifest+jws,webhook+jws",
+		keyPayloadContentTypes: "application/json",
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	payload := []byte(`{"artifact":"nimbus","version":"3000"}`)
+
+	resp, err := signPayload(b, storage, "manifests", map[string]interface{}{
+		keyPayload:     base64.StdEncoding.EncodeToString(payload),
+		keyContentType: "application/json",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	jws, err := jose.ParseSigned(resp.Data[keyJWS].(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	header := jws.Signatures[0].Header
+	if diff := deep.Equal("manifest+jws", header.ExtraHeaders[jose.HeaderType]); diff != nil {
+		t.Error("typ", diff)
+	}
+	if diff := deep.Equal("application/json", header.ExtraHeaders[jose.HeaderContentType]); diff != nil {
+		t.Error("cty", diff)
+	}
+
+	keys, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	verified, err := jws.Verify(keys.Key(header.KeyID)[0])
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(payload, verified); diff != nil {
+		t.Error("payload", diff)
+	}
+
+	// Signed payloads are not tokens
+	verifyResp := verifyToken(t, b, storage, map[string]interface{}{keyToken: resp.Data[keyJWS]})
+	if diff := deep.Equal(false, verifyResp.Data[keyValid]); diff != nil {
+		t.Error("payload verified as token", diff)
+	}
+
+	if err := writeRole(b, storage, "tokens", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"type":         {keyPayload: "e30=", keyType: "invoice+jws"},
+		"content type": {keyPayload: "e30=", keyContentType: "text/plain"},
+		"payload":      {keyPayload: "not base64!"},
+	}
+
+	for name, data := range invalid {
+		if resp, err := signPayload(b, storage, "manifests", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	// Payload signing must be enabled on the role
+	if resp, err := signPayload(b, storage, "tokens", map[string]interface{}{keyPayload: "e30="}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("sign without payload types should have failed")
+	}
+
+	// Payloads cannot be signed as tokens
+	if resp, err := writePayloadRole(b, storage, "forged", map[string]interface{}{keyPayloadTypes: "JWT"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("token payload type should have failed")
+	}
+}
+
+func TestSignPayloadDetached(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writePayloadRole(b, storage, "webhooks", map[string]interface{}{keyPayloadTypes: "webhook+jws"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	keys, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	payload := []byte(`{"event":"delivery.completed","ship":"planet-express"}`)
+
+	for _, b64 := range []bool{true, false} {
+		resp, err := signPayload(b, storage, "webhooks", map[string]interface{}{
+			keyPayload:  base64.StdEncoding.EncodeToString(payload),
+			keyDetached: true,
+			keyB64:      b64,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		detached := resp.Data[keyJWS].(string)
+		if diff := deep.Equal("", strings.Split(detached, ".")[1]); diff != nil {
+			t.Error("payload not detached", diff)
+		}
+
+		jws, err := jose.ParseDetached(detached, payload)
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+
+		header := jws.Signatures[0].Protected
+		if !b64 {
+			if diff := deep.Equal(false, header.ExtraHeaders[headerB64]); diff != nil {
+				t.Error("b64", diff)
+			}
+			if diff := deep.Equal([]interface{}{"b64"}, header.ExtraHeaders[headerCritical]); diff != nil {
+				t.Error("crit", diff)
+			}
+		}
+
+		if err := jws.DetachedVerify(payload, keys.Key(header.KeyID)[0]); err != nil {
+			t.Errorf("b64=%v: %s\n", b64, err)
+		}
+	}
+
+	// Unencoded payloads can be attached when free of '.'
+	resp, err := signPayload(b, storage, "webhooks", map[string]interface{}{
+		keyPayload: base64.StdEncoding.EncodeToString([]byte("$.02")),
+		keyB64:     false,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("attached unencoded payload containing '.' should have failed")
+	}
+
+	resp, err = signPayload(b, storage, "webhooks", map[string]interface{}{
+		keyPayload: base64.StdEncoding.EncodeToString([]byte("$0")),
+		keyB64:     false,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	parts := strings.Split(resp.Data[keyJWS].(string), ".")
+	if diff := deep.Equal("$0", parts[1]); diff != nil {
+		t.Error("unencoded payload", diff)
+	}
+
+	jws, err := jose.ParseDetached(parts[0]+".."+parts[2], []byte(parts[1]))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := jws.DetachedVerify([]byte(parts[1]), keys.Key(jws.Signatures[0].Protected.KeyID)[0]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsTokenType(t *testing.T) {
+	for typ, expected := range map[string]bool{
+		"JWT":                true,
+		"application/jwt":    true,
+		"at+jwt":             true,
+		"secevent+jwt":       true,
+		"application/vc+JWT": true,
+		"invoice+jws":        false,
+		"application/json":   false,
+		"jwt-but-not-really": false,
+	} {
+		if diff := deep.Equal(expected, isTokenType(typ)); diff != nil {
+			t.Error(typ, diff)
+		}
+	}
+}
@@ -17,15 +17,47 @@
 package jwtsecrets
 
 import (
+	"encoding/json"
 	"context"
 	"fmt"
 	"github.com/go-test/deep"
 	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
+	"strconv"
 	"testing"
 	"time"
 )
 
+func signData(b *backend, storage *logical.Storage, role string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/" + role,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+// unsafeClaims decodes the claims of the signed token, without verification.
+func unsafeClaims(t *testing.T, signedToken string) map[string]interface{} {
+
+	token, err := jwt.ParseSigned(signedToken)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var claims map[string]interface{}
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	return claims
+}
+
 func getSignedToken(b *backend, storage *logical.Storage, role string, claims map[string]interface{}, headers map[string]interface{}, claimsDest interface{}, headersDest map[string]interface{}) error {
 	data := map[string]interface{}{
 		"claims":  claims,
@@ -145,155 +177,1136 @@ func TestSign(t *testing.T) {
 	}
 }
 
-type customToken struct {
-	Foo string `json:"foo"`
+// benchmarkSign signs tokens of a role with keys of the algorithm, from parallel goroutines when parallel is set.
+// Run with -cpu 1,2,4,8 to compare the throughput across cores.
+func benchmarkSign(bm *testing.B, algorithm jose.SignatureAlgorithm, parallel bool) {
+	b, storage := getTestBackend(bm)
+	b.idGen = friendlyIdGenerator{}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: string(algorithm)}); err != nil {
+		bm.Fatalf("%v\n", err)
+	}
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		bm.Fatalf("%v\n", err)
+	}
+
+	// Errors are reported without FailNow, which parallel goroutines can't call
+	sign := func() {
+		resp, err := signData(b, storage, "tester", map[string]interface{}{})
+		if err != nil || (resp != nil && resp.IsError()) {
+			bm.Errorf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	// Keys are generated by the first request
+	sign()
+
+	bm.ResetTimer()
+
+	if !parallel {
+		for i := 0; i < bm.N; i++ {
+			sign()
+		}
+		return
+	}
+
+	bm.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sign()
+		}
+	})
 }
 
-func TestPrivateClaim(t *testing.T) {
+func BenchmarkSignES256(bm *testing.B) {
+	benchmarkSign(bm, jose.ES256, false)
+}
+
+func BenchmarkSignES256Parallel(bm *testing.B) {
+	benchmarkSign(bm, jose.ES256, true)
+}
+
+func BenchmarkSignRS256(bm *testing.B) {
+	benchmarkSign(bm, jose.RS256, false)
+}
+
+func BenchmarkSignRS256Parallel(bm *testing.B) {
+	benchmarkSign(bm, jose.RS256, true)
+}
+
+func TestSignResponseMetadata(t *testing.T) {
 	b, storage := getTestBackend(t)
 
-	if _, err := writeConfig(b, storage, map[string]interface{}{"allowed_claims": []string{"aud", "foo"}}); err != nil {
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
 		t.Fatalf("%v\n", err)
 	}
 
-	role := "tester"
+	resp, err := signData(b, storage, role, map[string]interface{}{})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
 
-	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{"aud": "an audience"}, map[string]interface{}{}); err != nil {
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
 		t.Fatalf("%v\n", err)
 	}
+	claims := unsafeClaims(t, resp.Data["token"].(string))
 
-	claims := map[string]interface{}{
-		"foo": "bar",
+	if diff := deep.Equal(token.Headers[0].KeyID, resp.Data["kid"]); diff != nil {
+		t.Error("kid", diff)
+	}
+	if diff := deep.Equal(int64(claims["exp"].(float64)), resp.Data["expiration"]); diff != nil {
+		t.Error("expiration", diff)
+	}
+	if diff := deep.Equal(int64(claims["iat"].(float64)), resp.Data["issued_at"]); diff != nil {
+		t.Error("issued_at", diff)
+	}
+	if diff := deep.Equal(claims["jti"], resp.Data["jti"]); diff != nil {
+		t.Error("jti", diff)
+	}
+	if _, ok := resp.Data["claims"]; ok {
+		t.Error("claims should only be included when requested")
 	}
 
-	var decoded customToken
-	if err := getSignedToken(b, storage, role, claims, map[string]interface{}{}, &decoded, nil); err != nil {
-		t.Fatalf("%v\n", err)
+	resp, err = signData(b, storage, role, map[string]interface{}{keyIncludeClaims: true})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
 	}
 
-	expectedClaims := customToken{
-		Foo: "bar",
+	included, err := json.Marshal(resp.Data["claims"])
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(included, &decoded); err != nil {
+		t.Fatalf("%v\n", err)
 	}
 
-	if diff := deep.Equal(expectedClaims, decoded); diff != nil {
-		t.Error(diff)
+	if diff := deep.Equal(unsafeClaims(t, resp.Data["token"].(string)), decoded); diff != nil {
+		t.Error("claims", diff)
 	}
 }
 
-func TestPrivateHeader(t *testing.T) {
+func TestSignDryRun(t *testing.T) {
 	b, storage := getTestBackend(t)
 
-	if _, err := writeConfig(b, storage, map[string]interface{}{"allowed_headers": []string{"tid"}}); err != nil {
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyJTIStrategy: JTIStrategyCounter}); err != nil {
 		t.Fatalf("%v\n", err)
 	}
 
-	role := "tester"
-
-	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{"tid": "12345"}); err != nil {
-		t.Fatalf("%v\n", err)
+	roleData := map[string]interface{}{
+		keyIssuer:             "tester.example.com",
+		keyClaims:             map[string]interface{}{"aud": "Zapp Brannigan"},
+		keyMaxTokensPerMinute: 1,
+		keyNonceReplayWindow:  "1h",
 	}
-
-	headers := map[string]interface{}{
-		"tid": "12345",
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
 	}
 
-	decoded := map[string]interface{}{}
-	if err := getSignedToken(b, storage, role, map[string]interface{}{}, headers, nil, decoded); err != nil {
-		t.Fatalf("%v\n", err)
+	signRequest := map[string]interface{}{keyDryRun: true, keyNonce: "n-0S6_WzA2Mj"}
+
+	// Dry runs neither consume the role's quota, the nonce nor token ids
+	for i := 0; i < 2; i++ {
+		resp, err := signData(b, storage, "tester", signRequest)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if _, ok := resp.Data["token"]; ok {
+			t.Fatal("dry runs should not sign tokens")
+		}
+
+		claims := resp.Data["claims"].(map[string]interface{})
+		for claim, expected := range map[string]interface{}{"iss": "tester.example.com", "aud": "Zapp Brannigan", "nonce": "n-0S6_WzA2Mj", "jti": "1"} {
+			if diff := deep.Equal(expected, claims[claim]); diff != nil {
+				t.Error(claim, diff)
+			}
+		}
 	}
 
-	expectedHeaders := map[string]interface{}{
-		"typ": "JWT",
-		"tid": "12345",
+	signRequest[keyDryRun] = false
+	resp, err := signData(b, storage, "tester", signRequest)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal("1", resp.Data["jti"]); diff != nil {
+		t.Error("jti", diff)
 	}
 
-	if diff := deep.Equal(expectedHeaders, decoded); diff != nil {
-		t.Error(diff)
+	// Dry runs are validated as any other request
+	signRequest[keyDryRun] = true
+	if resp, err := signData(b, storage, "tester", signRequest); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("reused nonce should have failed")
 	}
 }
 
-func TestAudienceAsArray(t *testing.T) {
+func TestSignRoleTTL(t *testing.T) {
 	b, storage := getTestBackend(t)
 
 	role := "tester"
 
-	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+	if resp, err := writeRoleData(b, storage, role, map[string]interface{}{keyIssuer: role + ".example.com", keyTTL: "15m"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, &decoded, nil); err != nil {
 		t.Fatalf("%v\n", err)
 	}
 
-	claims := map[string]interface{}{
-		"aud": []interface{}{"foo", "bar"},
+	if diff := deep.Equal(15*time.Minute, decoded.Expiry.Time().Sub(decoded.IssuedAt.Time())); diff != nil {
+		t.Error("role ttl", diff)
 	}
 
-	var decoded map[string]interface{}
-	if err := getSignedToken(b, storage, role, claims, map[string]interface{}{}, &decoded, nil); err != nil {
-		t.Fatalf("%v\n", err)
+	// A lower config max caps roles' tokens
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyTokenTTL: "1m", keyMaxTokenTTL: "5m"}); err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
 	}
 
-	aud, ok := decoded["aud"].([]interface{})
-	if !ok {
-		t.Fatalf("audience is not a string array")
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
 	}
 
-	if diff := deep.Equal(aud, []interface{}{"foo", "bar"}); diff != nil {
-		t.Error(diff)
+	if diff := deep.Equal(5*time.Minute, decoded.Expiry.Time().Sub(decoded.IssuedAt.Time())); diff != nil {
+		t.Error("capped role ttl", diff)
 	}
 }
 
-func TestRejectReservedClaims(t *testing.T) {
+func TestSignRequestTTL(t *testing.T) {
 	b, storage := getTestBackend(t)
 
 	role := "tester"
 
-	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
-		t.Fatalf("%v\n", err)
+	if resp, err := writeRoleData(b, storage, role, map[string]interface{}{keyIssuer: role + ".example.com", keyTTL: "15m", keyMaxTTL: "30m"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
 	}
 
-	data := map[string]interface{}{
-		"claims": map[string]interface{}{
-			"exp": 1234,
-		},
+	signData := map[string]interface{}{
+		keyTTL: "90s",
 	}
 
 	req := &logical.Request{
 		Operation:  logical.UpdateOperation,
 		Path:       "sign/" + role,
 		Storage:    *storage,
-		Data:       data,
+		Data:       signData,
 		MountPoint: "test",
 	}
 
 	resp, err := b.HandleRequest(context.Background(), req)
-	if err == nil || resp != nil && !resp.IsError() {
-		t.Fatalf("expected to get an error from sign. got:%v\n", resp)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	token, err := jwt.ParseSigned(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal(90*time.Second, decoded.Expiry.Time().Sub(decoded.IssuedAt.Time())); diff != nil {
+		t.Error("requested ttl", diff)
+	}
+	if diff := deep.Equal(90*time.Second, resp.Secret.TTL); diff != nil {
+		t.Error("lease ttl", diff)
+	}
+
+	// The requested ttl can't exceed the role's max ttl
+	for _, ttl := range []string{"45m", "-1m", "soon"} {
+		signData[keyTTL] = ttl
+		if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("ttl %s should have failed", ttl)
+		}
 	}
 }
 
-func TestRejectOverwriteRoleOtherClaim(t *testing.T) {
+func TestSignExpiresAt(t *testing.T) {
 	b, storage := getTestBackend(t)
 
 	role := "tester"
 
-	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{"aud": "an audience"}, map[string]interface{}{}); err != nil {
-		t.Fatalf("%v\n", err)
+	if resp, err := writeRoleData(b, storage, role, map[string]interface{}{keyIssuer: role + ".example.com", keyMaxTTL: "30m"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
 	}
 
-	data := map[string]interface{}{
-		"claims": map[string]interface{}{
-			"aud": 1234,
-		},
-	}
+	signData := map[string]interface{}{}
 
 	req := &logical.Request{
 		Operation:  logical.UpdateOperation,
 		Path:       "sign/" + role,
 		Storage:    *storage,
-		Data:       data,
+		Data:       signData,
 		MountPoint: "test",
 	}
 
-	resp, err := b.HandleRequest(context.Background(), req)
-	if err == nil || resp != nil && !resp.IsError() {
-		t.Fatalf("expected to get an error from sign. got:%v\n", resp)
+	deadline := time.Now().Add(20 * time.Minute).Truncate(time.Second)
+
+	for _, expiresAt := range []string{deadline.Format(time.RFC3339), strconv.FormatInt(deadline.Unix(), 10)} {
+		signData[keyExpiresAt] = expiresAt
+
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		token, err := jwt.ParseSigned(resp.Data["token"].(string))
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+
+		var decoded jwt.Claims
+		if err := token.UnsafeClaimsWithoutVerification(&decoded); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+
+		if diff := deep.Equal(deadline.Unix(), decoded.Expiry.Time().Unix()); diff != nil {
+			t.Error(expiresAt, diff)
+		}
+	}
+
+	invalid := []string{
+		time.Now().Add(time.Hour).Format(time.RFC3339),
+		time.Now().Add(-time.Minute).Format(time.RFC3339),
+		"tomorrow",
+	}
+
+	for _, expiresAt := range invalid {
+		signData[keyExpiresAt] = expiresAt
+		if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("expires_at %s should have failed", expiresAt)
+		}
+	}
+
+	// Only one of ttl & expires_at can be requested
+	signData[keyExpiresAt] = deadline.Format(time.RFC3339)
+	signData[keyTTL] = "5m"
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("ttl with expires_at should have failed")
+	}
+}
+
+func TestSignClockSkew(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyClockSkew: "30s"}); err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Only the issued at & not before claims are back-dated
+	if diff := deep.Equal(3*time.Minute+30*time.Second, decoded.Expiry.Time().Sub(decoded.IssuedAt.Time())); diff != nil {
+		t.Error("iat", diff)
+	}
+	if diff := deep.Equal(decoded.IssuedAt, decoded.NotBefore); diff != nil {
+		t.Error("nbf", diff)
+	}
+	if decoded.Expiry.Time().Before(time.Now().Add(3*time.Minute - time.Second)) {
+		t.Error("expiry was back-dated")
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyClockSkew: "-30s"}); err == nil {
+		t.Errorf("negative skew should have failed: %#v", resp)
+	}
+}
+
+func TestSignTokenType(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	invalid := map[string]map[string]interface{}{
+		"untyped":     {keyTokenType: "invoice"},
+		"payload":     {keyTokenType: "invoice+jws"},
+		"conflicting": {keyTokenType: "secevent+jwt", keyTokenProfile: TokenProfileVerifiableCredential},
+	}
+
+	for name, data := range invalid {
+		data[keyIssuer] = role + ".example.com"
+		if resp, err := writeRoleData(b, storage, role, data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%s token type should have failed", name)
+		}
+	}
+
+	if resp, err := writeRoleData(b, storage, role, map[string]interface{}{keyIssuer: role + ".example.com", keyTokenType: "secevent+jwt"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	headers := map[string]interface{}{}
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, nil, headers); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("secevent+jwt", headers["typ"]); diff != nil {
+		t.Error("typ", diff)
+	}
+
+	// Explicitly typed tokens are verified as tokens
+	token := signToken(t, b, storage, role, map[string]interface{}{})
+	if diff := deep.Equal(true, verifyToken(t, b, storage, map[string]interface{}{keyToken: token}).Data[keyValid]); diff != nil {
+		t.Error("verify", diff)
+	}
+}
+
+func TestSignDefaultClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyDefaultClaims: map[string]interface{}{"iss": "vault.example.com"}}); err == nil {
+		t.Errorf("reserved default claim should have failed: %#v", resp)
+	}
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keyAllowedClaims: []string{"sub", "aud", "env", "cluster"},
+		keyDefaultClaims: map[string]interface{}{"env": "prod", "cluster": "east", "region": "us"},
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{"cluster": "west"}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var claims map[string]interface{}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"env": "staging"}, map[string]interface{}{}, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Role & request claims take precedence over the defaults
+	expected := map[string]string{"env": "staging", "cluster": "west", "region": "us", "iss": "tester.example.com"}
+	for claim, value := range expected {
+		if diff := deep.Equal(value, claims[claim]); diff != nil {
+			t.Error(claim, diff)
+		}
+	}
+}
+
+func TestSignClaimsSchema(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "deployment"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaimsSchema: `{"type": "objekt"}`}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with invalid schema should have failed")
+	}
+
+	roleData[keyClaimsSchema] = `{"properties": {"sub": {"type": "string", "format": "email"}}}`
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with unsupported schema keyword should have failed")
+	}
+
+	roleData[keyClaimsSchema] = testClaimsSchema
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	claims := map[string]interface{}{"deployment": map[string]interface{}{"env": "prod", "replicas": 2}}
+	if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+
+	claims = map[string]interface{}{"deployment": map[string]interface{}{"env": "dev", "replicas": 2}}
+	if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("claims not satisfying the schema should have failed")
+	}
+}
+
+func TestSignAllowedAudiences(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	config := map[string]interface{}{keyAllowedClaims: []string{"sub", "aud"}, keyAllowedAudiences: []string{"api", "web", "admin"}}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaims: map[string]interface{}{"aud": "mobile"}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with disallowed audience should have failed")
+	}
+
+	roleData = map[string]interface{}{keyIssuer: "tester.example.com", keyAllowedAudiences: []string{"api", "web"}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for _, aud := range []interface{}{"api", []interface{}{"api", "web"}} {
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"aud": aud}, map[string]interface{}{}, nil, nil); err != nil {
+			t.Errorf("%v: %v\n", aud, err)
+		}
+	}
+
+	// Audiences must be allowed by both the role & the config
+	for _, aud := range []interface{}{"admin", "mobile", "ap", []interface{}{"api", "mobile"}} {
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"aud": aud}, map[string]interface{}{}, nil, nil); err == nil {
+			t.Errorf("%v should have failed", aud)
+		}
+	}
+}
+
+func TestSignRequireAudience(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyRequireAudience: true}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for _, aud := range []interface{}{"api", []interface{}{"api", "web"}} {
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"aud": aud}, map[string]interface{}{}, nil, nil); err != nil {
+			t.Errorf("%v: %v\n", aud, err)
+		}
+	}
+
+	denied := []map[string]interface{}{
+		{"sub": "svc-ship"},
+		{"aud": ""},
+		{"aud": []interface{}{}},
+	}
+	for _, claims := range denied {
+		if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err == nil {
+			t.Errorf("%v should have failed", claims)
+		}
+	}
+}
+
+func TestSignClaimPatterns(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope", "level"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for _, patterns := range []map[string]string{{"scope": "("}, {"exp": ".*"}} {
+		roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaimPatterns: patterns}
+		if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("role with claim patterns %v should have failed", patterns)
+		}
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaimPatterns: map[string]string{"scope": "^read:", "aud": "^api$"}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	allowed := []map[string]interface{}{
+		{"scope": "read:ships"},
+		{"scope": []interface{}{"read:ships", "read:crew"}, "aud": "api"},
+		{"sub": "anything"},
+	}
+	for _, claims := range allowed {
+		if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err != nil {
+			t.Errorf("%v: %v\n", claims, err)
+		}
+	}
+
+	denied := []map[string]interface{}{
+		{"scope": "write:ships"},
+		{"scope": []interface{}{"read:ships", "write:crew"}},
+		{"scope": []interface{}{"read:ships", 1}},
+		{"scope": "read:ships", "aud": "web"},
+		{"scope": true},
+	}
+	for _, claims := range denied {
+		if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err == nil {
+			t.Errorf("%v should have failed", claims)
+		}
+	}
+}
+
+func TestSignClaimTypes(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "tenant_id"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for _, types := range []map[string]string{{"tenant_id": "integer"}, {"iat": ClaimTypeNumber}} {
+		roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaimTypes: types}
+		if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("role with claim types %v should have failed", types)
+		}
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyClaimTypes: map[string]string{"tenant_id": ClaimTypeNumber}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for _, tenantID := range []interface{}{"42", 42} {
+		var decoded map[string]interface{}
+		if err := getSignedToken(b, storage, "tester", map[string]interface{}{"tenant_id": tenantID}, map[string]interface{}{}, &decoded, nil); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if diff := deep.Equal(float64(42), decoded["tenant_id"]); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"tenant_id": "forty-two"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("claim not coercible to its type should have failed")
+	}
+}
+
+func TestSignMergeClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "context", "env"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:      "tester.example.com",
+		keyClaims:      map[string]interface{}{"context": map[string]interface{}{"env": "prod", "owner": "hermes"}, "env": "prod"},
+		keyMergeClaims: map[string]string{"env": ClaimMergeRole},
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("merging a non-object claim should have failed")
+	}
+
+	roleData[keyMergeClaims] = map[string]string{"context": "union"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("unknown merge rule should have failed")
+	}
+
+	roleData[keyMergeClaims] = map[string]string{"context": ClaimMergeReject}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var decoded map[string]interface{}
+	claims := map[string]interface{}{"context": map[string]interface{}{"env": "prod", "workflow": "{{identity.entity.id}}"}}
+	if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expected := map[string]interface{}{"env": "prod", "owner": "hermes", "workflow": "{{identity.entity.id}}"}
+	if diff := deep.Equal(expected, decoded["context"]); diff != nil {
+		t.Error(diff)
+	}
+
+	claims = map[string]interface{}{"context": map[string]interface{}{"env": "dev"}}
+	if err := getSignedToken(b, storage, "tester", claims, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("conflicting merge claim should have failed")
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"env": "dev"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("claim provided by role should have failed")
+	}
+}
+
+func TestSignDeniedClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyDeniedClaims: []string{"scope"}, keyExchangeClaims: map[string]string{"scp": "scope"}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role exchanging a denied claim should have failed")
+	}
+
+	delete(roleData, keyExchangeClaims)
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "svc-ship"}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"scope": "admin"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("denied claim should have failed")
+	}
+}
+
+func TestSignPolicyExpression(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyPolicyExpression: `claims.sub.startsWith(`}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with invalid policy expression should have failed")
+	}
+
+	roleData[keyPolicyExpression] = `request.role == "tester" && claims.iss == "tester.example.com" && claims.sub.startsWith("svc-") && claims.exp > claims.iat`
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "svc-ship"}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "bender"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("claims denied by the policy expression should have failed")
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"aud": "planet-express"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("policy expression errors should have failed")
+	}
+}
+
+type customToken struct {
+	Foo string `json:"foo"`
+}
+
+func TestPrivateClaim(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{"allowed_claims": []string{"aud", "foo"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{"aud": "an audience"}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	claims := map[string]interface{}{
+		"foo": "bar",
+	}
+
+	var decoded customToken
+	if err := getSignedToken(b, storage, role, claims, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expectedClaims := customToken{
+		Foo: "bar",
+	}
+
+	if diff := deep.Equal(expectedClaims, decoded); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPrivateHeader(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{"allowed_headers": []string{"tid"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{"tid": "12345"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	headers := map[string]interface{}{
+		"tid": "12345",
+	}
+
+	decoded := map[string]interface{}{}
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, headers, nil, decoded); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expectedHeaders := map[string]interface{}{
+		"typ": "JWT",
+		"tid": "12345",
+	}
+
+	if diff := deep.Equal(expectedHeaders, decoded); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestAudienceAsArray(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	claims := map[string]interface{}{
+		"aud": []interface{}{"foo", "bar"},
+	}
+
+	var decoded map[string]interface{}
+	if err := getSignedToken(b, storage, role, claims, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	aud, ok := decoded["aud"].([]interface{})
+	if !ok {
+		t.Fatalf("audience is not a string array")
+	}
+
+	if diff := deep.Equal(aud, []interface{}{"foo", "bar"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRejectReservedClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	data := map[string]interface{}{
+		"claims": map[string]interface{}{
+			"exp": 1234,
+		},
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/" + role,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err == nil || resp != nil && !resp.IsError() {
+		t.Fatalf("expected to get an error from sign. got:%v\n", resp)
+	}
+}
+
+func TestRejectOverwriteRoleOtherClaim(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{"aud": "an audience"}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	data := map[string]interface{}{
+		"claims": map[string]interface{}{
+			"aud": 1234,
+		},
+	}
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/" + role,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err == nil || resp != nil && !resp.IsError() {
+		t.Fatalf("expected to get an error from sign. got:%v\n", resp)
+	}
+}
+
+func TestAccessTokenProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyAllowedClaims: []string{"sub", "aud", "scope"},
+		keySetIAT:        false,
+		keySetJTI:        false,
+	}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/api",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyIssuer:       "https://as.example.com",
+			keyClaims:       map[string]interface{}{"client_id": "planet-express"},
+			keyTokenProfile: TokenProfileAccessToken,
+		},
+		MountPoint: "test",
+	}
+
+	// 'client_id' must be allowed to be set by the role
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with disallowed claim should have failed")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "scope", "client_id"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var claims map[string]interface{}
+	headers := map[string]interface{}{}
+	if err := getSignedToken(b, storage, "api", map[string]interface{}{"sub": "Leela", "aud": "https://api.example.com", "scope": "deliveries:read"}, nil, &claims, headers); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal(TokenProfileAccessToken, headers["typ"]); diff != nil {
+		t.Error("typ", diff)
+	}
+
+	// Required claims are generated regardless of the config
+	for _, claim := range []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti", "scope"} {
+		if _, ok := claims[claim]; !ok {
+			t.Errorf("missing '%s' claim", claim)
+		}
+	}
+
+	missing := map[string]map[string]interface{}{
+		"scope": {"sub": "Leela", "aud": "https://api.example.com"},
+		"aud":   {"sub": "Leela", "scope": "deliveries:read"},
+		"sub":   {"aud": "https://api.example.com", "scope": "deliveries:read"},
+	}
+
+	for name, claims := range missing {
+		if err := getSignedToken(b, storage, "api", claims, nil, nil, nil); err == nil {
+			t.Errorf("token without '%s' claim should have failed", name)
+		}
+	}
+
+	req.Operation = logical.UpdateOperation
+	req.Data = map[string]interface{}{keyTokenProfile: "id+jwt"}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("unknown token profile should have failed")
+	}
+}
+
+func TestSignResponseWrapping(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	resp, err := signData(b, storage, "tester", map[string]interface{}{})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.WrapInfo != nil {
+		t.Errorf("response should not be wrapped: %#v", resp.WrapInfo)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyResponseWrapTTL: "2m"}); err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = signData(b, storage, "tester", map[string]interface{}{})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.WrapInfo == nil {
+		t.Fatal("response should be wrapped")
+	}
+	if diff := deep.Equal(2*time.Minute, resp.WrapInfo.TTL); diff != nil {
+		t.Error("wrap ttl", diff)
+	}
+
+	// Roles override the configured wrap ttl
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyResponseWrapTTL: "30s"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = signData(b, storage, "tester", map[string]interface{}{})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal(30*time.Second, resp.WrapInfo.TTL); diff != nil {
+		t.Error("role wrap ttl", diff)
+	}
+
+	// Callers requesting wrapping keep their ttl
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyClaims: map[string]interface{}{}},
+		MountPoint: "test",
+		WrapInfo:   &logical.RequestWrapInfo{TTL: 10 * time.Second},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.WrapInfo != nil {
+		t.Errorf("requested wrapping should not be overridden: %#v", resp.WrapInfo)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyResponseWrapTTL: "-1m"}); err == nil {
+		t.Errorf("negative wrap ttl should have failed: %#v", resp)
+	}
+}
+
+func TestSignRoleMaxAudiences(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyMaxAllowedAudiences: 1}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	sign := func(aud []interface{}) *logical.Response {
+		resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": aud}})
+		if err != nil && resp == nil {
+			t.Fatalf("%v\n", err)
+		}
+		return resp
+	}
+
+	if resp := sign([]interface{}{"foo"}); resp.IsError() {
+		t.Errorf("single audience should be allowed: %#v", resp)
+	}
+	if resp := sign([]interface{}{"foo", "bar"}); !resp.IsError() {
+		t.Error("audiences beyond the role's maximum should have failed")
+	}
+
+	// The config's maximum applies when stricter than the role's
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyMaxAllowedAudiences: 3}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyMaxAllowedAudiences: 2}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp := sign([]interface{}{"foo", "bar"}); resp.IsError() {
+		t.Errorf("audiences within both maximums should be allowed: %#v", resp)
+	}
+	if resp := sign([]interface{}{"foo", "bar", "baz"}); !resp.IsError() {
+		t.Error("audiences beyond the config's maximum should have failed")
+	}
+
+	// Roles without a maximum of their own use the config's
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyMaxAllowedAudiences: -1}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp := sign([]interface{}{"foo", "bar", "baz"}); !resp.IsError() {
+		t.Error("audiences beyond the config's maximum should have failed")
+	}
+
+	// Native string lists are checked as lists decoded from JSON
+	resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": []string{"foo", "bar", "baz"}}})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("audience strings beyond the config's maximum should have failed")
+	}
+	if diff := deep.Equal(ErrorCodeTooManyAudiences, errorCode(resp)); diff != nil {
+		t.Error("error code", diff)
+	}
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": []string{"foo", "bar"}}}); err != nil || (resp != nil && resp.IsError()) {
+		t.Errorf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Like the config's, a maximum of zero allows no audiences
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyMaxAllowedAudiences: 0}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp := sign([]interface{}{"foo"}); !resp.IsError() {
+		t.Error("audiences beyond the role's maximum of zero should have failed")
+	}
+}
+
+func TestSignLockedRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{
+		keyIssuer:             "tester.example.com",
+		keyClaims:             map[string]interface{}{"aud": "api"},
+		keyAllowRequestClaims: false,
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := readRole(b, storage, "tester")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if allow := resp.Data[keyAllowRequestClaims]; allow != false {
+		t.Errorf("expected claims to be locked, got %v", allow)
+	}
+
+	claims := map[string]interface{}{}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if claims["aud"] != "api" {
+		t.Errorf("expected role audience, got %v", claims["aud"])
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"aud": "api"}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("providing claims to a locked role should have failed")
+	}
+
+	// Unlocking the role allows request claims again
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyAllowRequestClaims: true}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{"sub": "Kif Kroker"}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestSignAllowedAlgorithms(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{keyIssuer: "tester.example.com", keyAllowedAlgorithms: "RSA"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("unknown algorithm should have failed")
+	}
+
+	if resp, err := writeRoleData(b, storage, "tester", map[string]interface{}{
+		keyIssuer:            "tester.example.com",
+		keyAllowedAlgorithms: "ES256,ES384",
+		keyPayloadTypes:      "manifest+jws",
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if resp, err := signPayload(b, storage, "tester", map[string]interface{}{keyPayload: "e30="}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Migrating the mount to a weaker algorithm doesn't affect the role
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "RS256"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("signing with a disallowed algorithm should have failed")
+	}
+	if resp, err := signPayload(b, storage, "tester", map[string]interface{}{keyPayload: "e30="}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("signing payloads with a disallowed algorithm should have failed")
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES384"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := getSignedToken(b, storage, "tester", map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Errorf("%v\n", err)
 	}
 }
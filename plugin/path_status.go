@@ -0,0 +1,105 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "status",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStatusRead,
+			},
+		},
+		HelpSynopsis:    pathStatusHelpSyn,
+		HelpDescription: pathStatusHelpDesc,
+	}
+}
+
+func (b *backend) pathStatusRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	layoutVersion, err := getStorageVersion(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		keySignerType:     firstNonEmpty(config.SignerType, DefaultSignerType),
+		"storage_version": layoutVersion,
+	}
+
+	// Keys of external signers are managed, and rotated, by the signer
+	if config.usesLocalKeys() {
+		policy, err := b.getLocalPolicy(ctx, req.Storage, config, req.MountPoint)
+		if err != nil {
+			return nil, err
+		}
+
+		policy.Lock(false)
+		defer policy.Unlock()
+
+		now := time.Now()
+		version := signingKeyVersion(policy, config.KeyPrePublishPeriod, now)
+
+		retired := 0
+		for versionKey := range policy.Keys {
+			if keyVersion, err := strconv.Atoi(versionKey); err == nil && keyVersion < version {
+				retired++
+			}
+		}
+
+		data["key_version"] = version
+		data["retired_keys"] = retired
+
+		if latestKey, ok := policy.Keys[strconv.Itoa(policy.LatestVersion)]; ok {
+			data["key_age_seconds"] = int64(now.Sub(latestKey.CreationTime).Seconds())
+			data["next_rotation_seconds"] = int64(durationMax(latestKey.CreationTime.Add(config.KeyRotationPeriod).Sub(now), 0).Seconds())
+		}
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+const pathStatusHelpSyn = `
+Report the status of the backend.
+`
+
+const pathStatusHelpDesc = `
+Report the status of the backend, for monitoring.
+
+signer_type:           Signer holding the keys; key details are only reported for 'local' keys.
+storage_version:       Version of the layout of the backend's storage, upgraded when the
+                       backend is initialized.
+key_version:           Version of the key signing tokens.
+key_age_seconds:       Age of the latest key.
+next_rotation_seconds: Time until the latest key is rotated; 0 when the rotation is due.
+retired_keys:          Number of retired keys, still published to verify unexpired tokens.
+`
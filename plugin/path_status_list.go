@@ -0,0 +1,151 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	keyStatusListID = "list"
+
+	statusListPathPrefix = "status-list/"
+
+	// statusListTokenType is the 'typ' header of status list tokens.
+	statusListTokenType = "statuslist+jwt"
+
+	// statusListTokenTTL is how long relying parties may cache status list tokens ('ttl' claim), and how
+	// long signed tokens are served before being signed again.
+	statusListTokenTTL = 5 * time.Minute
+
+	// statusListTokenLifetime is the lifetime of status list tokens ('exp' claim).
+	statusListTokenLifetime = 24 * time.Hour
+)
+
+func pathStatusList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: statusListPathPrefix + `(?P<` + keyStatusListID + `>[0-9]+)`,
+		Fields: map[string]*framework.FieldSchema{
+			keyStatusListID: {
+				Type:        framework.TypeInt,
+				Description: `Id of the status list.`,
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathStatusListRead,
+			},
+		},
+
+		HelpSynopsis:    pathStatusListHelpSyn,
+		HelpDescription: pathStatusListHelpDesc,
+	}
+}
+
+func (b *backend) pathStatusListRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	list := d.Get(keyStatusListID).(int)
+
+	now := time.Now()
+
+	token := b.statusListTokens.get(list, now)
+	if token == "" {
+		config, err := b.getConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		if !config.hasIssuer() {
+			return logical.ErrorResponse("'%s' must be configured to publish status lists", keyIssuer), nil
+		}
+
+		statuses, err := b.getStatusList(ctx, req.Storage, list)
+		if err != nil {
+			return nil, err
+		}
+		if statuses == nil {
+			return nil, nil
+		}
+
+		issuer, err := b.mountIssuer(config, req)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err = b.signStatusList(ctx, req, config, statusListURI(issuer, list), issuer, statuses, now)
+		if err != nil {
+			return nil, err
+		}
+
+		b.statusListTokens.put(list, token, now.Add(statusListTokenTTL))
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPContentType: "application/" + statusListTokenType,
+			logical.HTTPRawBody:     []byte(token),
+		},
+	}, nil
+}
+
+// signStatusList returns a status list token, signed by the mount's key, holding the statuses of a status list.
+func (b *backend) signStatusList(ctx context.Context, req *logical.Request, config *Config, uri string, issuer string, statuses []byte, now time.Time) (string, error) {
+	lst, err := compressStatusList(statuses)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"sub": uri,
+		"iss": issuer,
+		"iat": jwt.NumericDate(now.Unix()),
+		"exp": jwt.NumericDate(now.Add(statusListTokenLifetime).Unix()),
+		"ttl": int64(statusListTokenTTL.Seconds()),
+		"status_list": map[string]interface{}{
+			"bits": statusListBits,
+			"lst":  lst,
+		},
+	}
+
+	signerOptions := (&jose.SignerOptions{}).WithType(statusListTokenType)
+
+	keySigner, err := b.getSigner(ctx, req.Storage, config, mainKeyName, req.MountPoint, signerOptions)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.Signed(&keyIDSigner{inputSigner: keySigner}).Claims(claims).CompactSerialize()
+}
+
+const pathStatusListHelpSyn = `
+Get a status list token.
+`
+
+const pathStatusListHelpDesc = `
+Get the status list token (IETF Token Status List) holding the statuses of the
+tokens referencing the list by their 'status' claim; tokens revoked through the
+'revoke' endpoint, or by revoking their lease, have their status set. Status
+list tokens are signed by the mount's key, and require the 'issuer' to be
+configured, as the URIs of status lists are relative to it.
+`
@@ -0,0 +1,271 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const testStatusListIssuer = "https://vault.example.com/v1/{{mount_path}}"
+
+func fetchStatusList(t *testing.T, b *backend, storage *logical.Storage, list string) *logical.Response {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "status-list/" + list,
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp
+}
+
+// fetchStatusListClaims returns the claims of the status list token, verified against the published keys.
+func fetchStatusListClaims(t *testing.T, b *backend, storage *logical.Storage, list string) map[string]interface{} {
+	resp := fetchStatusList(t, b, storage, list)
+	if resp == nil {
+		t.Fatal("no status list returned")
+	}
+
+	if diff := deep.Equal("application/statuslist+jwt", resp.Data[logical.HTTPContentType]); diff != nil {
+		t.Error("content type", diff)
+	}
+
+	token, err := jwt.ParseSigned(string(resp.Data[logical.HTTPRawBody].([]byte)))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("statuslist+jwt", token.Headers[0].ExtraHeaders[jose.HeaderType]); diff != nil {
+		t.Error("token type", diff)
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	claims := map[string]interface{}{}
+	if err := token.Claims(jwks.Key(token.Headers[0].KeyID)[0].Key, &claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return claims
+}
+
+func writeStatusListRole(t *testing.T, b *backend, storage *logical.Storage) {
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuer: testStatusListIssuer, keySetJTI: false}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyStatusList: true}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+}
+
+// tokenStatusBit returns the status of the token, referenced by its 'status' claim, in the status list.
+func tokenStatusBit(t *testing.T, b *backend, storage *logical.Storage, token string) byte {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	claims := map[string]interface{}{}
+	if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	status, ok := claimedTokenStatus(claims)
+	if !ok {
+		t.Fatalf("token has no status claim: %v", claims)
+	}
+
+	uri := claims["status"].(map[string]interface{})["status_list"].(map[string]interface{})["uri"].(string)
+	list := uri[strings.LastIndex(uri, "/")+1:]
+
+	listClaims := fetchStatusListClaims(t, b, storage, list)
+	statusList := listClaims["status_list"].(map[string]interface{})
+
+	return statusAt(decompressStatusList(t, statusList["lst"].(string)), status.Index)
+}
+
+func TestStatusList(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	writeStatusListRole(t, b, storage)
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{})
+	otherToken := signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	claims := map[string]interface{}{}
+	if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	expectedStatus := map[string]interface{}{
+		"status_list": map[string]interface{}{
+			"idx": float64(0),
+			"uri": "https://vault.example.com/v1/test/status-list/0",
+		},
+	}
+	if diff := deep.Equal(expectedStatus, claims["status"]); diff != nil {
+		t.Error("status claim", diff)
+	}
+
+	listClaims := fetchStatusListClaims(t, b, storage, "0")
+	if diff := deep.Equal("https://vault.example.com/v1/test/status-list/0", listClaims["sub"]); diff != nil {
+		t.Error("status list subject", diff)
+	}
+	if diff := deep.Equal("https://vault.example.com/v1/test", listClaims["iss"]); diff != nil {
+		t.Error("status list issuer", diff)
+	}
+	if diff := deep.Equal(float64(statusListTokenTTL.Seconds()), listClaims["ttl"]); diff != nil {
+		t.Error("status list ttl", diff)
+	}
+	if diff := deep.Equal(float64(statusListBits), listClaims["status_list"].(map[string]interface{})["bits"]); diff != nil {
+		t.Error("status list bits", diff)
+	}
+
+	if diff := deep.Equal(byte(tokenStatusValid), tokenStatusBit(t, b, storage, token)); diff != nil {
+		t.Error("token status", diff)
+	}
+
+	// Tokens without a 'jti' claim are revoked by their status
+	if resp, err := revokeToken(b, storage, token); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal(byte(tokenStatusInvalid), tokenStatusBit(t, b, storage, token)); diff != nil {
+		t.Error("revoked token status", diff)
+	}
+	if diff := deep.Equal(byte(tokenStatusValid), tokenStatusBit(t, b, storage, otherToken)); diff != nil {
+		t.Error("other token status", diff)
+	}
+
+	resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+	if diff := deep.Equal(false, resp.Data[keyValid]); diff != nil {
+		t.Error("revoked token valid", diff)
+	}
+	resp = verifyToken(t, b, storage, map[string]interface{}{keyToken: otherToken})
+	if diff := deep.Equal(true, resp.Data[keyValid]); diff != nil {
+		t.Error("other token valid", diff)
+	}
+
+	// Unallocated lists are not found
+	if resp := fetchStatusList(t, b, storage, "1"); resp != nil {
+		t.Errorf("unallocated status list returned: %#v", resp)
+	}
+}
+
+func TestStatusListLeaseRevocation(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	writeStatusListRole(t, b, storage)
+
+	resp := signTokenResponse(t, b, storage, "tester")
+	token := resp.Data["token"].(string)
+
+	revokeResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.RevokeOperation,
+		Storage:    *storage,
+		Secret:     resp.Secret,
+		MountPoint: "test",
+	})
+	if err != nil || (revokeResp != nil && revokeResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, revokeResp)
+	}
+
+	if diff := deep.Equal(byte(tokenStatusInvalid), tokenStatusBit(t, b, storage, token)); diff != nil {
+		t.Error("token with revoked lease status", diff)
+	}
+}
+
+func TestStatusListRequiresIssuer(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyStatusList: true}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyClaims: map[string]interface{}{}},
+		MountPoint: "test",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("signing without an issuer should have failed")
+	}
+}
+
+func TestStatusListProvidedStatus(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	writeStatusListRole(t, b, storage)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"status"}}); err == nil {
+		t.Error("allowing the reserved 'status' claim should have failed")
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/tester",
+		Storage:    *storage,
+		Data:       map[string]interface{}{keyClaims: map[string]interface{}{"status": "valid"}},
+		MountPoint: "test",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("providing a 'status' claim should have failed")
+	}
+}
+
+func TestStatusListRevokeForeignList(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	writeStatusListRole(t, b, storage)
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{})
+
+	// Tokens referencing status lists of other issuers can't revoke entries of the mount's lists
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuer: "https://other.example.com/v1/test"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if resp, err := revokeToken(b, storage, token); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("revoking a token of another issuer's status list should have failed")
+	}
+	if diff := deep.Equal(byte(tokenStatusValid), tokenStatusBit(t, b, storage, token)); diff != nil {
+		t.Error("token status", diff)
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func readStatus(t *testing.T, b *backend, storage *logical.Storage) map[string]interface{} {
+
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "status",
+		Storage:    *storage,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp.Data
+}
+
+func TestStatus(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: *storage}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyRotationDuration: "1h"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	status := readStatus(t, b, storage)
+
+	expected := map[string]interface{}{
+		keySignerType:     SignerTypeLocal,
+		"storage_version": storageVersion,
+		"key_version":     1,
+		"retired_keys":    0,
+	}
+	for field, value := range expected {
+		if diff := deep.Equal(value, status[field]); diff != nil {
+			t.Error(field, diff)
+		}
+	}
+
+	if age := status["key_age_seconds"].(int64); age < 0 || age > 5 {
+		t.Errorf("unexpected key age %d", age)
+	}
+	if next := status["next_rotation_seconds"].(int64); next < 3590 || next > 3600 {
+		t.Errorf("unexpected time to next rotation %d", next)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	policy, err := b.getPolicy(context.Background(), *storage, config, "test")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := policy.Rotate(context.Background(), *storage, rand.Reader); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	status = readStatus(t, b, storage)
+	if diff := deep.Equal(2, status["key_version"]); diff != nil {
+		t.Error("key_version", diff)
+	}
+	if diff := deep.Equal(1, status["retired_keys"]); diff != nil {
+		t.Error("retired_keys", diff)
+	}
+}
@@ -0,0 +1,173 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// tidyResult counts the expired state removed by a tidy.
+type tidyResult struct {
+	// RevokedTokens is the number of revocations of expired tokens removed.
+	RevokedTokens int
+
+	// Nonces is the number of used nonces removed, whose replay window ended.
+	Nonces int
+
+	// KeyVersions is the number of retired key versions removed, which can no longer have valid tokens.
+	KeyVersions int
+
+	// Issuances is the number of issuance records removed, beyond the configured size.
+	Issuances int
+}
+
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTidyWrite,
+			},
+		},
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
+
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := b.tidy(ctx, req.Storage, config, req.MountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"revoked_tokens": result.RevokedTokens,
+			"nonces":         result.Nonces,
+			"key_versions":   result.KeyVersions,
+			"issuances":      result.Issuances,
+		},
+	}, nil
+}
+
+// tidy removes expired state; revocations of expired tokens, used nonces, retired keys & excess issuance records.
+func (b *backend) tidy(ctx context.Context, stg logical.Storage, config *Config, mount string) (*tidyResult, error) {
+	var result tidyResult
+	var err error
+
+	if result.RevokedTokens, err = b.tidyRevokedTokens(ctx, stg); err != nil {
+		return nil, fmt.Errorf("error tidying revoked tokens: %w", err)
+	}
+
+	if result.Nonces, err = b.tidyUsedNonces(ctx, stg); err != nil {
+		return nil, fmt.Errorf("error tidying nonces: %w", err)
+	}
+
+	if result.Issuances, err = b.tidyIssuances(ctx, stg, config); err != nil {
+		return nil, fmt.Errorf("error tidying issuances: %w", err)
+	}
+
+	err = b.forEachKeyring(ctx, stg, config, mount, func(policy *keysutil.Policy, keyringConfig *Config) error {
+		removed, err := b.pruneKeyVersions(ctx, stg, policy, keyringConfig, mount)
+		result.KeyVersions += removed
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error tidying keys: %w", err)
+	}
+
+	return &result, nil
+}
+
+// forEachKeyring calls fn with the policy of each local keyring; the mount's, the roles' isolated keyrings & the key
+// sets', along with the keyring's configuration.
+func (b *backend) forEachKeyring(ctx context.Context, stg logical.Storage, config *Config, mount string, fn func(policy *keysutil.Policy, config *Config) error) error {
+
+	policy, err := b.getLocalPolicy(ctx, stg, config, mount)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		if err := fn(policy, config); err != nil {
+			return err
+		}
+	}
+
+	keyrings, err := b.listRoleKeyrings(ctx, stg)
+	if err != nil {
+		return err
+	}
+
+	for _, keyring := range keyrings {
+		policy, err := b.getKeyringPolicy(ctx, stg, config, keyring, mount)
+		if err != nil {
+			return err
+		}
+		if err := fn(policy, config); err != nil {
+			return err
+		}
+	}
+
+	keySetNames, err := b.listKeySets(ctx, stg)
+	if err != nil {
+		return err
+	}
+
+	for _, keySetName := range keySetNames {
+		keySet, err := b.getKeySet(ctx, stg, keySetName)
+		if err != nil {
+			return err
+		}
+		if keySet == nil {
+			continue
+		}
+
+		keySetConfig := keySet.config(config)
+
+		policy, err := b.getKeyringPolicy(ctx, stg, keySetConfig, keySetKeyringName(keySetName), mount)
+		if err != nil {
+			return err
+		}
+		if err := fn(policy, keySetConfig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const pathTidyHelpSyn = `
+Remove expired state.
+`
+
+const pathTidyHelpDesc = `
+Remove expired state; revocations of expired tokens, nonces whose replay window
+ended, retired keys which can no longer have valid tokens, and issuance records
+beyond the configured 'issuance_log_size'. Returns the number of each removed.
+
+Tidying also runs periodically, unless the 'periodic_tidy' configuration is false.
+`
@@ -0,0 +1,87 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTidy(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	entry, err := logical.StorageEntryJSON(revokedTokenPath("expired"), &revokedToken{JTI: "expired", Expiration: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if _, err := b.useNonce(context.Background(), *storage, "tester", "expired", time.Millisecond); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if _, err := b.useNonce(context.Background(), *storage, "tester", "unexpired", time.Hour); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuanceLogSize: 3}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	for i := 0; i < 3; i++ {
+		signToken(t, b, storage, "tester", map[string]interface{}{})
+	}
+
+	// Reducing the log size leaves excess records for tidying
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyIssuanceLogSize: 1}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   *storage,
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	expected := map[string]interface{}{"revoked_tokens": 1, "nonces": 1, "key_versions": 0, "issuances": 2}
+	if diff := deep.Equal(expected, resp.Data); diff != nil {
+		t.Error(diff)
+	}
+
+	// Nothing remains to be tidied
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected = map[string]interface{}{"revoked_tokens": 0, "nonces": 0, "key_versions": 0, "issuances": 0}
+	if diff := deep.Equal(expected, resp.Data); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,320 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"time"
+)
+
+const (
+	keyGrantType          = "grant_type"
+	keySubjectToken       = "subject_token"
+	keySubjectTokenType   = "subject_token_type"
+	keyActorToken         = "actor_token"
+	keyActorTokenType     = "actor_token_type"
+	keyRequestedTokenType = "requested_token_type"
+
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	tokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// Token types accepted as subject & actor tokens; each must be a JWT.
+var exchangeableTokenTypes = map[string]bool{
+	tokenTypeJWT:         true,
+	tokenTypeAccessToken: true,
+	tokenTypeIDToken:     true,
+}
+
+// Claims copied from subject tokens when the role doesn't define its exchange claims.
+var defaultExchangeClaims = map[string]string{"sub": "sub"}
+
+func pathTokenExchange(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "token-exchange/" + framework.GenericNameRegex(keyRoleName),
+		Fields: map[string]*framework.FieldSchema{
+			keyRoleName: {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role",
+				Required:    true,
+			},
+			keyGrantType: {
+				Type:        framework.TypeString,
+				Description: `Grant type; must be '` + grantTypeTokenExchange + `' if provided.`,
+			},
+			keySubjectToken: {
+				Type:         framework.TypeString,
+				Description:  `Token representing the subject on whose behalf the new token is requested.`,
+				Required:     true,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keySubjectTokenType: {
+				Type:        framework.TypeString,
+				Description: `Type of the subject token.`,
+				Default:     tokenTypeJWT,
+			},
+			keyActorToken: {
+				Type:         framework.TypeString,
+				Description:  `Token representing the party acting on behalf of the subject.`,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyActorTokenType: {
+				Type:        framework.TypeString,
+				Description: `Type of the actor token.`,
+				Default:     tokenTypeJWT,
+			},
+			keyAudience: {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Audience of the issued token.`,
+			},
+			keyRequestedTokenType: {
+				Type:        framework.TypeString,
+				Description: `Type of the requested token; must be '` + tokenTypeJWT + `' if provided.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:  b.instrumentIssuance("token_exchange", b.pathTokenExchangeWrite),
+				Responses: tokenResponses("access_token", "Issued token"),
+			},
+		},
+		HelpSynopsis:    pathTokenExchangeHelpSyn,
+		HelpDescription: pathTokenExchangeHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenExchangeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if grantType := d.Get(keyGrantType).(string); grantType != "" && grantType != grantTypeTokenExchange {
+		return logical.ErrorResponse("unsupported grant type '%s'", grantType), logical.ErrInvalidRequest
+	}
+
+	if requestedTokenType := d.Get(keyRequestedTokenType).(string); requestedTokenType != "" && requestedTokenType != tokenTypeJWT {
+		return logical.ErrorResponse("unsupported requested token type '%s'", requestedTokenType), logical.ErrInvalidRequest
+	}
+
+	role, roleName, roleSuffix, err := b.matchRole(ctx, req.Storage, d.Get(keyRoleName).(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(ErrorCodeUnknownRole, "unknown role"), logical.ErrInvalidRequest
+	}
+	if err := role.checkIssuable(roleName, time.Now()); err != nil {
+		return codedErrorResponse(ErrorCodeRoleNotIssuable, err.Error()), logical.ErrInvalidRequest
+	}
+
+	config, err := b.getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectClaims, resp, err := b.exchangedTokenClaims(ctx, req, d, keySubjectToken, keySubjectTokenType)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	exchangeClaims := role.ExchangeClaims
+	if len(exchangeClaims) == 0 {
+		exchangeClaims = defaultExchangeClaims
+	}
+
+	claims := map[string]interface{}{}
+
+	for sourceClaim, claim := range exchangeClaims {
+		value, ok := subjectClaims[sourceClaim]
+		if !ok || (claim == "sub" && role.BindSubjectToEntity) {
+			continue
+		}
+		if allowedClaim, ok := config.allowedClaimsMap[claim]; !ok || !allowedClaim {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted", claim), logical.ErrInvalidRequest
+		}
+		if role.deniesClaim(claim) {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted, denied by role", claim), logical.ErrInvalidRequest
+		}
+		if _, ok := role.Claims[claim]; ok {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim %s not permitted, already provided by role", claim), logical.ErrInvalidRequest
+		}
+		claims[claim] = value
+	}
+
+	if audience := d.Get(keyAudience).([]string); len(audience) > 0 {
+		if role.DenyRequestClaims {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "'%s' cannot be provided to the role", keyAudience), logical.ErrInvalidRequest
+		}
+		if allowedClaim, ok := config.allowedClaimsMap["aud"]; !ok || !allowedClaim {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim aud not permitted"), logical.ErrInvalidRequest
+		}
+		if role.deniesClaim("aud") {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim aud not permitted, denied by role"), logical.ErrInvalidRequest
+		}
+		if _, ok := role.Claims["aud"]; ok {
+			return codedErrorResponse(ErrorCodeClaimNotAllowed, "claim aud not permitted, already provided by role"), logical.ErrInvalidRequest
+		}
+		if len(audience) == 1 {
+			claims["aud"] = audience[0]
+		} else {
+			aud := make([]interface{}, len(audience))
+			for idx := range audience {
+				aud[idx] = audience[idx]
+			}
+			claims["aud"] = aud
+		}
+	}
+
+	// Record the delegation chain; the current actor, followed by any prior actors of the subject token. The
+	// current actor is identified by the actor token when provided, otherwise by the caller's entity.
+	var actor map[string]interface{}
+	if d.Get(keyActorToken).(string) != "" {
+		actorClaims, resp, err := b.exchangedTokenClaims(ctx, req, d, keyActorToken, keyActorTokenType)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+
+		actor = map[string]interface{}{}
+		for _, claim := range []string{"iss", "sub"} {
+			if value, ok := actorClaims[claim]; ok {
+				actor[claim] = value
+			}
+		}
+	} else if req.EntityID != "" {
+		actor = map[string]interface{}{"sub": req.EntityID}
+	}
+
+	act, hasAct := subjectClaims["act"]
+	if actor != nil {
+		if hasAct {
+			actor["act"] = act
+		}
+		act, hasAct = actor, true
+	}
+	if hasAct {
+		claims["act"] = act
+	}
+
+	if err := coerceClaims(claims, role.ClaimTypes); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	options := tokenOptions{}
+	if roleSuffix != "" {
+		options.Parameters = map[string]string{wildcardParameter: roleSuffix}
+	}
+
+	resp, err = b.signRoleToken(ctx, req, roleName, role, config, claims, options)
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	resp.Data = map[string]interface{}{
+		"access_token":      resp.Data["token"],
+		"issued_token_type": tokenTypeJWT,
+		"token_type":        "N_A",
+		"expires_in":        int64(claims["exp"].(jwt.NumericDate)) - time.Now().Unix(),
+	}
+
+	return resp, nil
+}
+
+// exchangedTokenClaims verifies the subject or actor token provided in the named field, returning its claims. Tokens
+// issued by a trusted issuer are verified with the issuer's keys, all others must be signed by this backend.
+func (b *backend) exchangedTokenClaims(ctx context.Context, req *logical.Request, d *framework.FieldData, tokenField string, typeField string) (map[string]interface{}, *logical.Response, error) {
+	rawToken := d.Get(tokenField).(string)
+	if rawToken == "" {
+		return nil, logical.ErrorResponse("'%s' is required", tokenField), logical.ErrInvalidRequest
+	}
+
+	if tokenType := d.Get(typeField).(string); !exchangeableTokenTypes[tokenType] {
+		return nil, logical.ErrorResponse("unsupported %s '%s'", typeField, tokenType), logical.ErrInvalidRequest
+	}
+
+	claims, err := b.verifyExchangeToken(ctx, req.Storage, req.MountPoint, rawToken)
+	if err != nil {
+		var invalid *invalidTokenError
+		if !errors.As(err, &invalid) {
+			return nil, nil, err
+		}
+		return nil, logical.ErrorResponse("invalid %s: %v", tokenField, invalid), logical.ErrInvalidRequest
+	}
+
+	return claims, nil, nil
+}
+
+// verifyExchangeToken verifies a token presented for exchange. Tokens failing verification are reported
+// with an invalidTokenError.
+func (b *backend) verifyExchangeToken(ctx context.Context, stg logical.Storage, mount string, rawToken string) (map[string]interface{}, error) {
+
+	token, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		return nil, &invalidTokenError{reason: fmt.Sprintf("malformed token: %v", err)}
+	}
+
+	var unverifiedClaims jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&unverifiedClaims); err != nil {
+		return nil, &invalidTokenError{reason: fmt.Sprintf("malformed token: %v", err)}
+	}
+
+	issuer, err := b.findTrustedIssuer(ctx, stg, unverifiedClaims.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := jwt.Expected{Time: time.Now()}
+
+	if issuer == nil {
+		claims, _, err := b.verifyToken(ctx, stg, mount, rawToken, expected)
+		return claims, err
+	}
+
+	keys, err := b.issuerKeys(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error getting keys of issuer '%s': %w", issuer.Issuer, err)
+	}
+
+	expected.Issuer = issuer.Issuer
+
+	claims, _, _, err := verifySignedToken(rawToken, token, keys, expected)
+	return claims, err
+}
+
+const pathTokenExchangeHelpSyn = `
+Exchange a token for a token issued by a role.
+`
+
+const pathTokenExchangeHelpDesc = `
+Exchange a subject token for a new token issued by the role, following OAuth 2.0
+Token Exchange (RFC 8693).
+
+The subject token must be a JWT signed by this backend, or by one of the trusted
+issuers (see 'issuers/'). The claims listed in the role's 'exchange_claims' are
+copied from the subject token to the issued token.
+
+When an actor token is provided it is verified in the same way, and the issued
+token's 'act' claim identifies the actor; otherwise the 'act' claim identifies the
+caller's entity, by its id. Any 'act' claim of the subject token is nested within
+it, recording the delegation chain.
+
+audience:             Audience ('aud' claim) of the issued token.
+requested_token_type: Only '` + tokenTypeJWT + `' is supported.
+`
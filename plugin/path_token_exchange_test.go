@@ -0,0 +1,334 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func exchangeToken(b *backend, storage *logical.Storage, role string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "token-exchange/" + role,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func exchangedClaims(t *testing.T, b *backend, storage *logical.Storage, role string, data map[string]interface{}) (string, map[string]interface{}) {
+
+	resp, err := exchangeToken(b, storage, role, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal(tokenTypeJWT, resp.Data["issued_token_type"]); diff != nil {
+		t.Error("issued_token_type", diff)
+	}
+	if diff := deep.Equal("N_A", resp.Data["token_type"]); diff != nil {
+		t.Error("token_type", diff)
+	}
+
+	token := resp.Data["access_token"].(string)
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	var claims map[string]interface{}
+	if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return token, claims
+}
+
+func TestTokenExchange(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := writeRole(b, storage, "exchanger", "exchanger.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	subjectToken := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan", "aud": "nimbus"})
+	actorToken := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Kif Kroker"})
+
+	token, claims := exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{
+		keyGrantType:    grantTypeTokenExchange,
+		keySubjectToken: subjectToken,
+		keyAudience:     "planet-express",
+	})
+
+	expectedClaims := map[string]interface{}{
+		"iss": "exchanger.example.com",
+		"sub": "Zapp Brannigan",
+		"aud": "planet-express",
+	}
+	for claim, value := range expectedClaims {
+		if diff := deep.Equal(value, claims[claim]); diff != nil {
+			t.Error(claim, diff)
+		}
+	}
+	if _, ok := claims["act"]; ok {
+		t.Error("unexpected 'act' claim without actor token")
+	}
+
+	// The actor is recorded, followed by the prior actors of the subject token
+	token, claims = exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{
+		keySubjectToken: signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"}),
+		keyActorToken:   actorToken,
+	})
+
+	expectedAct := map[string]interface{}{"iss": "tester.example.com", "sub": "Kif Kroker"}
+	if diff := deep.Equal(expectedAct, claims["act"]); diff != nil {
+		t.Error("act", diff)
+	}
+
+	_, claims = exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{
+		keySubjectToken: token,
+		keyActorToken:   signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Leela"}),
+	})
+
+	expectedAct = map[string]interface{}{"iss": "tester.example.com", "sub": "Leela", "act": expectedAct}
+	if diff := deep.Equal(expectedAct, claims["act"]); diff != nil {
+		t.Error("nested act", diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"grant type":           {keyGrantType: "client_credentials", keySubjectToken: subjectToken},
+		"requested token type": {keySubjectToken: subjectToken, keyRequestedTokenType: tokenTypeIDToken},
+		"subject token type":   {keySubjectToken: subjectToken, keySubjectTokenType: "urn:ietf:params:oauth:token-type:saml2"},
+		"missing subject":      {},
+		"bad signature":        {keySubjectToken: subjectToken[:len(subjectToken)-4] + "AAAA"},
+		"bad actor":            {keySubjectToken: subjectToken, keyActorToken: "not-a-token"},
+	}
+
+	for name, data := range invalid {
+		if resp, err := exchangeToken(b, storage, "exchanger", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "exchange should have failed")
+		}
+	}
+
+	// Revoked tokens cannot be exchanged
+	if resp, err := revokeToken(b, storage, subjectToken); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := exchangeToken(b, storage, "exchanger", map[string]interface{}{keySubjectToken: subjectToken}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("exchanging a revoked token should have failed")
+	}
+}
+
+func TestTokenExchangeCallerActor(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	exchange := func(subjectToken string) map[string]interface{} {
+		req := &logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "token-exchange/tester",
+			Storage:    *storage,
+			Data:       map[string]interface{}{keySubjectToken: subjectToken},
+			MountPoint: "test",
+			EntityID:   "entity-1",
+		}
+
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		return unsafeClaims(t, resp.Data["access_token"].(string))
+	}
+
+	// Without an actor token the caller's entity is the actor, followed by the prior actors of the subject token
+	claims := exchange(signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"}))
+
+	expectedAct := map[string]interface{}{"sub": "entity-1"}
+	if diff := deep.Equal(expectedAct, claims["act"]); diff != nil {
+		t.Error("act", diff)
+	}
+
+	delegatedToken, _ := exchangedClaims(t, b, storage, "tester", map[string]interface{}{
+		keySubjectToken: signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"}),
+		keyActorToken:   signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Kif Kroker"}),
+	})
+	claims = exchange(delegatedToken)
+
+	expectedAct["act"] = map[string]interface{}{"iss": "tester.example.com", "sub": "Kif Kroker"}
+	if diff := deep.Equal(expectedAct, claims["act"]); diff != nil {
+		t.Error("nested act", diff)
+	}
+	if diff := deep.Equal("Zapp Brannigan", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+}
+
+func TestTokenExchangeClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "email"}}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/exchanger",
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyIssuer:         "exchanger.example.com",
+			keyExchangeClaims: map[string]interface{}{"sub": "email", "aud": "sub"},
+		},
+		MountPoint: "test",
+	}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	_, claims := exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{
+		keySubjectToken: signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan", "aud": "nimbus"}),
+	})
+
+	if diff := deep.Equal("Zapp Brannigan", claims["email"]); diff != nil {
+		t.Error("email", diff)
+	}
+	if diff := deep.Equal("nimbus", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+
+	// Exchanged claims must be allowed
+	req.Operation = logical.UpdateOperation
+	req.Data = map[string]interface{}{keyExchangeClaims: map[string]interface{}{"sub": "name"}}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("disallowed exchange claim should have failed")
+	}
+
+	// Claims denied by the role can't be exchanged
+	req.Data = map[string]interface{}{keyExchangeClaims: map[string]interface{}{"sub": "email"}, keyDeniedClaims: []string{"aud"}}
+
+	if resp, err := b.HandleRequest(context.Background(), req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err := exchangeToken(b, storage, "exchanger", map[string]interface{}{
+		keySubjectToken: signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"}),
+		keyAudience:     "nimbus",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("denied exchange claim should have failed")
+	}
+}
+
+func TestTokenExchangeTrustedIssuer(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "exchanger", "exchanger.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	privateKey, jwks := newIssuerKey(t, "idp-1")
+
+	if resp, err := writeIssuer(b, storage, "idp", map[string]interface{}{keyIssuer: "https://idp.example.com", keyJWKS: jwks}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: privateKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "idp-1"),
+	)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	issue := func(claims jwt.Claims) string {
+		token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+		if err != nil {
+			t.Fatalf("%s\n", err)
+		}
+		return token
+	}
+
+	now := time.Now()
+
+	_, claims := exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{
+		keySubjectToken: issue(jwt.Claims{Issuer: "https://idp.example.com", Subject: "Zapp Brannigan", Expiry: jwt.NewNumericDate(now.Add(time.Minute))}),
+	})
+
+	if diff := deep.Equal("Zapp Brannigan", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+	if diff := deep.Equal("exchanger.example.com", claims["iss"]); diff != nil {
+		t.Error("iss", diff)
+	}
+
+	invalid := map[string]string{
+		"expired":          issue(jwt.Claims{Issuer: "https://idp.example.com", Subject: "Zapp Brannigan", Expiry: jwt.NewNumericDate(now.Add(-time.Hour))}),
+		"untrusted issuer": issue(jwt.Claims{Issuer: "https://other.example.com", Subject: "Zapp Brannigan"}),
+	}
+
+	for name, token := range invalid {
+		if resp, err := exchangeToken(b, storage, "exchanger", map[string]interface{}{keySubjectToken: token}); err == nil && (resp == nil || !resp.IsError()) {
+			t.Error(name, "exchange should have failed")
+		}
+	}
+}
+
+func TestTokenExchangeLockedRole(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	roleData := map[string]interface{}{keyIssuer: "exchanger.example.com", keyAllowRequestClaims: false}
+	if resp, err := writeRoleData(b, storage, "exchanger", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	subjectToken := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan"})
+
+	if resp, err := exchangeToken(b, storage, "exchanger", map[string]interface{}{keySubjectToken: subjectToken, keyAudience: "planet-express"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("requesting an audience from a locked role should have failed")
+	}
+
+	_, claims := exchangedClaims(t, b, storage, "exchanger", map[string]interface{}{keySubjectToken: subjectToken})
+	if claims["sub"] != "Zapp Brannigan" {
+		t.Errorf("unexpected subject %v", claims["sub"])
+	}
+}
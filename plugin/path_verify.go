@@ -0,0 +1,264 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"time"
+)
+
+const (
+	keyToken    = "token"
+	keyAudience = "audience"
+	keyValid    = "valid"
+	keyError    = "error"
+)
+
+func pathVerify(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "verify",
+		Fields: map[string]*framework.FieldSchema{
+			keyToken: {
+				Type:         framework.TypeString,
+				Description:  `Token to verify.`,
+				Required:     true,
+				DisplayAttrs: sensitiveDisplayAttrs,
+			},
+			keyIssuer: {
+				Type:        framework.TypeString,
+				Description: `Expected 'iss' claim of the token.`,
+			},
+			keyAudience: {
+				Type:        framework.TypeString,
+				Description: `Audience which must be present in the 'aud' claim of the token.`,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifyWrite,
+			},
+		},
+		HelpSynopsis:    pathVerifyHelpSyn,
+		HelpDescription: pathVerifyHelpDesc,
+	}
+}
+
+func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rawToken := d.Get(keyToken).(string)
+	if rawToken == "" {
+		return logical.ErrorResponse("'%s' is required", keyToken), logical.ErrInvalidRequest
+	}
+
+	expected := jwt.Expected{
+		Issuer: d.Get(keyIssuer).(string),
+		Time:   time.Now(),
+	}
+	if audience := d.Get(keyAudience).(string); audience != "" {
+		expected.Audience = jwt.Audience{audience}
+	}
+
+	claims, kid, err := b.verifyToken(ctx, req.Storage, req.MountPoint, rawToken, expected)
+	if err != nil {
+		var invalid *invalidTokenError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				keyValid: false,
+				keyError: invalid.Error(),
+			},
+		}, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			keyValid:  true,
+			keyKeyID:  kid,
+			keyClaims: claims,
+		},
+	}, nil
+}
+
+// invalidTokenError reports why a token failed verification.
+type invalidTokenError struct {
+	reason string
+}
+
+func (e *invalidTokenError) Error() string {
+	return e.reason
+}
+
+// verifyToken verifies the token's signature against the published keys, and its claims against
+// the expected values; returning the token's claims and the id of the key that verified it. Tokens
+// failing verification are reported with an invalidTokenError.
+func (b *backend) verifyToken(ctx context.Context, stg logical.Storage, mount string, rawToken string, expected jwt.Expected) (map[string]interface{}, string, error) {
+
+	token, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		return nil, "", &invalidTokenError{reason: fmt.Sprintf("malformed token: %v", err)}
+	}
+	// Reject signed payloads (see 'sign-payload') presented as tokens
+	if len(token.Headers) > 0 {
+		if typ, ok := token.Headers[0].ExtraHeaders[jose.HeaderType].(string); ok && !isTokenType(typ) {
+			return nil, "", &invalidTokenError{reason: fmt.Sprintf("unexpected type '%s'", typ)}
+		}
+	}
+
+	jwkSet, err := b.getVerificationKeys(ctx, stg, mount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	claims, registeredClaims, kid, err := verifySignedToken(rawToken, token, jwkSet, expected)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if registeredClaims.ID != "" {
+		revoked, err := b.isTokenRevoked(ctx, stg, registeredClaims.ID)
+		if err != nil {
+			return nil, "", err
+		}
+		if revoked {
+			return nil, "", &invalidTokenError{reason: "token has been revoked"}
+		}
+	}
+
+	if status, ok := claimedTokenStatus(claims); ok {
+		invalid, err := b.isTokenStatusInvalid(ctx, stg, status)
+		if err != nil {
+			return nil, "", err
+		}
+		if invalid {
+			return nil, "", &invalidTokenError{reason: "token has been revoked"}
+		}
+	}
+
+	return claims, kid, nil
+}
+
+// verifySignedToken verifies the signature of the token, parsed from its compact serialization, against the
+// keys of the set, and its claims against the expected values; returning the token's claims and the id of the
+// key that verified it.
+func verifySignedToken(rawToken string, token *jwt.JSONWebToken, jwkSet *jose.JSONWebKeySet, expected jwt.Expected) (map[string]interface{}, *jwt.Claims, string, error) {
+	if len(token.Headers) != 1 {
+		return nil, nil, "", &invalidTokenError{reason: "token must have a single signature"}
+	}
+	header := token.Headers[0]
+
+	keys := jwkSet.Keys
+	if header.KeyID != "" {
+		keys = jwkSet.Key(header.KeyID)
+	}
+
+	for _, key := range keys {
+		// Prevent algorithm substitution
+		if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+			continue
+		}
+
+		var claims map[string]interface{}
+		var registeredClaims jwt.Claims
+		if header.Algorithm == string(ES256K) {
+			// go-jose doesn't support secp256k1, the signature is verified by the plugin
+			if !verifyES256KToken(rawToken, key.Key) {
+				continue
+			}
+			if err := token.UnsafeClaimsWithoutVerification(&claims, &registeredClaims); err != nil {
+				continue
+			}
+		} else if err := token.Claims(key, &claims, &registeredClaims); err != nil {
+			continue
+		}
+
+		if err := registeredClaims.ValidateWithLeeway(expected, jwt.DefaultLeeway); err != nil {
+			return nil, nil, "", &invalidTokenError{reason: err.Error()}
+		}
+
+		return claims, &registeredClaims, key.KeyID, nil
+	}
+
+	return nil, nil, "", &invalidTokenError{reason: "no published key verifies the token"}
+}
+
+// getVerificationKeys returns all keys able to verify tokens; the mount-wide keys, including
+// those of key sets, and the keys of isolated role keyrings, along with their shared secrets.
+func (b *backend) getVerificationKeys(ctx context.Context, stg logical.Storage, mount string) (*jose.JSONWebKeySet, error) {
+
+	jwkSet, err := b.getPublicKeys(ctx, stg, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := b.getConfig(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	keyrings, err := b.listRoleKeyrings(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shared secrets aren't published, but verify tokens signed with the HMAC algorithms
+	policy, err := b.getLocalPolicy(ctx, stg, config, mount)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		jwkSet.Keys = append(jwkSet.Keys, b.policySecretKeys(policy, config)...)
+	}
+
+	for _, keyring := range keyrings {
+		keyringSet, err := b.getKeyringPublicKeys(ctx, stg, config, keyring, mount)
+		if err != nil {
+			return nil, err
+		}
+		jwkSet.Keys = append(jwkSet.Keys, keyringSet.Keys...)
+
+		policy, err := b.getKeyringPolicy(ctx, stg, config, keyring, mount)
+		if err != nil {
+			return nil, err
+		}
+		jwkSet.Keys = append(jwkSet.Keys, b.policySecretKeys(policy, config)...)
+	}
+
+	return jwkSet, nil
+}
+
+const pathVerifyHelpSyn = `
+Verify a token.
+`
+
+const pathVerifyHelpDesc = `
+Verify a token signed by this backend. The token's signature is checked against
+all published keys, its 'exp' & 'nbf' claims against the current time, and its
+'jti' claim against the revoked tokens.
+
+issuer:   Expected 'iss' claim of the token.
+audience: Audience which must be present in the 'aud' claim of the token.
+
+Returns whether the token is valid; for valid tokens the decoded claims and the
+key id (kid) of the verifying key, otherwise the reason verification failed.
+`
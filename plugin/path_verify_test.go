@@ -0,0 +1,112 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func signToken(t *testing.T, b *backend, storage *logical.Storage, role string, claims map[string]interface{}) string {
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign/" + role,
+		Storage:   *storage,
+		Data: map[string]interface{}{
+			keyClaims: claims,
+		},
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp.Data["token"].(string)
+}
+
+func verifyToken(t *testing.T, b *backend, storage *logical.Storage, data map[string]interface{}) *logical.Response {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "verify",
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp
+}
+
+func TestVerify(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "Zapp Brannigan", "aud": "nimbus"})
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp := verifyToken(t, b, storage, map[string]interface{}{
+		keyToken:    token,
+		keyIssuer:   "tester.example.com",
+		keyAudience: "nimbus",
+	})
+
+	if diff := deep.Equal(true, resp.Data[keyValid]); diff != nil {
+		t.Fatal("valid", diff, resp.Data[keyError])
+	}
+	if diff := deep.Equal(parsed.Headers[0].KeyID, resp.Data[keyKeyID]); diff != nil {
+		t.Error("kid", diff)
+	}
+	if diff := deep.Equal("Zapp Brannigan", resp.Data[keyClaims].(map[string]interface{})["sub"]); diff != nil {
+		t.Error("sub claim", diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"issuer mismatch":   {keyToken: token, keyIssuer: "other.example.com"},
+		"audience mismatch": {keyToken: token, keyAudience: "planet-express"},
+		"bad signature":     {keyToken: token[:len(token)-4] + "AAAA"},
+		"malformed":         {keyToken: "not-a-token"},
+	}
+
+	for name, data := range invalid {
+		resp := verifyToken(t, b, storage, data)
+		if diff := deep.Equal(false, resp.Data[keyValid]); diff != nil {
+			t.Error(name, diff)
+		}
+		if resp.Data[keyError] == "" {
+			t.Error(name, "no error reported")
+		}
+	}
+}
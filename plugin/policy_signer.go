@@ -17,15 +17,18 @@
 package jwtsecrets
 
 import (
-	"bytes"
 	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"gopkg.in/square/go-jose.v2"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type PolicySigner struct {
@@ -33,58 +36,83 @@ type PolicySigner struct {
 	SignatureAlgorithm jose.SignatureAlgorithm
 	Policy             *keysutil.Policy
 	SignerOptions      *jose.SignerOptions
+
+	// KeyIDConfig selects the key id strategy; the hash strategy is used when nil.
+	KeyIDConfig *Config
+
+	// PrePublishPeriod is how long new keys are published before they are used for signing.
+	PrePublishPeriod time.Duration
+
+	// Signed, when set, is called with the version of the signing key after each signature, once the policy is
+	// unlocked; an error fails the signature.
+	Signed func(keyVersion int) error
 }
 
 func (ps *PolicySigner) Sign(payload []byte) (*jose.JSONWebSignature, error) {
 
 	// Lock for entire sign operation to ensure no changes to versions happens
 	ps.Policy.Lock(false)
-	defer ps.Policy.Unlock()
 
-	kid := createKeyId(ps.BackendId, ps.Policy.Name, ps.Policy.LatestVersion)
+	keyVersion, kid := ps.signingKey()
 
-	protected := map[jose.HeaderKey]string{
-		"kid": kid,
-		"alg": string(ps.SignatureAlgorithm),
-	}
-	for k, v := range ps.SignerOptions.ExtraHeaders {
-		protected[k] = fmt.Sprintf("%s", v)
-	}
+	jws, err := signJWS(kid, ps.SignatureAlgorithm, ps.SignerOptions, payload, func(input []byte) ([]byte, error) {
+		return ps.sign(keyVersion, input)
+	})
+
+	ps.Policy.Unlock()
 
-	serializedProtected, err := json.Marshal(protected)
 	if err != nil {
 		return nil, err
 	}
 
-	var input bytes.Buffer
+	return jws, ps.signed(keyVersion)
+}
+
+// SignInput signs the input, produced for the id of the current signing key, returning the signature.
+func (ps *PolicySigner) SignInput(input func(kid string) ([]byte, error)) ([]byte, error) {
+
+	ps.Policy.Lock(false)
+
+	keyVersion, kid := ps.signingKey()
+
+	signature, err := func() ([]byte, error) {
+		signingInput, err := input(kid)
+		if err != nil {
+			return nil, err
+		}
+		return ps.sign(keyVersion, signingInput)
+	}()
 
-	input.WriteString(base64.RawURLEncoding.EncodeToString(serializedProtected))
-	input.WriteByte('.')
-	input.WriteString(base64.RawURLEncoding.EncodeToString(payload))
+	ps.Policy.Unlock()
 
-	signature, err := ps.sign(input.Bytes())
 	if err != nil {
 		return nil, err
 	}
 
-	encodedSignature, err := json.Marshal(map[string]interface{}{
-		"payload":   base64.RawURLEncoding.EncodeToString(payload),
-		"protected": base64.RawURLEncoding.EncodeToString(serializedProtected),
-		"signatures": []map[string]interface{}{
-			{
-				"protected": base64.RawURLEncoding.EncodeToString(serializedProtected),
-				"signature": base64.RawURLEncoding.EncodeToString(signature),
-			},
-		},
-	})
-	if err != nil {
-		return nil, err
+	return signature, ps.signed(keyVersion)
+}
+
+// signed notifies Signed, if set, of a signature by the key version.
+func (ps *PolicySigner) signed(keyVersion int) error {
+	if ps.Signed == nil {
+		return nil
+	}
+	return ps.Signed(keyVersion)
+}
+
+// signingKey returns the version & id of the current signing key. The caller must hold a lock on the policy.
+func (ps *PolicySigner) signingKey() (int, string) {
+	keyVersion := signingKeyVersion(ps.Policy, ps.PrePublishPeriod, time.Now())
+
+	kid := createKeyId(ps.BackendId, ps.Policy.Name, keyVersion)
+	if ps.KeyIDConfig != nil {
+		kid = localKeyId(ps.BackendId, ps.KeyIDConfig, ps.Policy, keyVersion)
 	}
 
-	return jose.ParseSigned(bytes.NewBuffer(encodedSignature).String())
+	return keyVersion, kid
 }
 
-func (ps *PolicySigner) sign(input []byte) ([]byte, error) {
+func (ps *PolicySigner) sign(keyVersion int, input []byte) ([]byte, error) {
 
 	var hash crypto.Hash
 	var hashType keysutil.HashType
@@ -114,19 +142,28 @@ func (ps *PolicySigner) sign(input []byte) ([]byte, error) {
 		hashType = keysutil.HashTypeSHA2512
 		hash = crypto.SHA512
 		sigAlg = ""
+	case jose.EdDSA:
+		// Ed25519 hashes the input itself
+		hashType = keysutil.HashTypeNone
+		sigAlg = ""
+	case jose.HS256, jose.HS384, jose.HS512:
+		return ps.signHMAC(keyVersion, input)
+	case ES256K:
+		return ps.signSecp256k1(keyVersion, input)
 	default:
 		return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported signature algorithm: %s", ps.SignatureAlgorithm)}
 	}
 
-	keyVersion := ps.Policy.LatestVersion
-
-	hasher := hash.New()
+	signedInput := input
+	if hash != 0 {
+		hasher := hash.New()
 
-	// According to documentation, Write() on hash never fails
-	_, _ = hasher.Write(input)
-	hashedInput := hasher.Sum(nil)
+		// According to documentation, Write() on hash never fails
+		_, _ = hasher.Write(input)
+		signedInput = hasher.Sum(nil)
+	}
 
-	result, err := ps.Policy.Sign(keyVersion, nil, hashedInput, hashType, sigAlg, keysutil.MarshalingTypeJWS)
+	result, err := ps.Policy.Sign(keyVersion, nil, signedInput, hashType, sigAlg, keysutil.MarshalingTypeJWS)
 	if err != nil {
 		return nil, err
 	}
@@ -144,3 +181,68 @@ func (ps *PolicySigner) sign(input []byte) ([]byte, error) {
 func (ps *PolicySigner) Options() jose.SignerOptions {
 	return *ps.SignerOptions
 }
+
+// signingKeyVersion returns the version of the policy's keys used for signing. The latest key
+// is only used once it has been published for prePublishPeriod, unless no previous key is
+// available. The caller must hold a lock on the policy.
+func signingKeyVersion(policy *keysutil.Policy, prePublishPeriod time.Duration, now time.Time) int {
+	if prePublishPeriod <= 0 {
+		return policy.LatestVersion
+	}
+
+	latestKey, ok := policy.Keys[strconv.Itoa(policy.LatestVersion)]
+	if !ok || !latestKey.CreationTime.Add(prePublishPeriod).After(now) {
+		return policy.LatestVersion
+	}
+
+	if _, ok := policy.Keys[strconv.Itoa(policy.LatestVersion-1)]; !ok {
+		return policy.LatestVersion
+	}
+
+	return policy.LatestVersion - 1
+}
+
+// localKeyId returns the key id of a version of the policy's keys. The caller must hold a lock on the policy.
+func localKeyId(backendId string, config *Config, policy *keysutil.Policy, version int) string {
+	hashedId := createKeyId(backendId, policy.Name, version)
+
+	var publicKey crypto.PublicKey
+	if config.KeyIDStrategy == KeyIDStrategyThumbprint {
+		if key, ok := policy.Keys[strconv.Itoa(version)]; ok {
+			publicKey, _ = keyEntryPublicKey(key, config.Secp256k1Keys)
+		}
+	}
+
+	// Counter ids are only unique within a keyring
+	if config.KeyIDStrategy == KeyIDStrategyCounter && policy.Name != mainKeyName {
+		counterConfig := *config
+		counterConfig.KeyIDPrefix += strings.ReplaceAll(policy.Name, "/", "-") + "-"
+		config = &counterConfig
+	}
+
+	return keyId(config, publicKey, version, hashedId)
+}
+
+// keyEntryPublicKey returns the public key of a policy key entry; symmetric keys are only secp256k1 private keys
+// when the keyring is configured as holding them.
+func keyEntryPublicKey(key keysutil.KeyEntry, secp256k1Keys bool) (crypto.PublicKey, error) {
+	if key.FormattedPublicKey != "" {
+		block, _ := pem.Decode([]byte(key.FormattedPublicKey))
+		if block == nil {
+			// Ed25519 public keys are formatted as base64
+			if publicKey, err := base64.StdEncoding.DecodeString(key.FormattedPublicKey); err == nil && len(publicKey) == ed25519.PublicKeySize {
+				return ed25519.PublicKey(publicKey), nil
+			}
+			return nil, errutil.InternalError{Err: "invalid public key"}
+		}
+
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	} else if key.RSAKey != nil {
+		return &key.RSAKey.PublicKey, nil
+	} else if secp256k1Keys && len(key.Key) == secp256k1PrivateKeySize && keyEntrySecret(key) == nil {
+		// secp256k1 private keys are stored as symmetric keys, see secp256k1KeyType
+		return secp256k1PublicKey(key.Key), nil
+	}
+
+	return nil, errutil.InternalError{Err: "key has no public key"}
+}
@@ -0,0 +1,230 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	activeTokensPath = "active-tokens/"
+
+	// Window of the 'max_tokens_per_minute' rate limit
+	rateLimitWindow = time.Minute
+)
+
+// issuanceRates tracks the recent issuance times of each role, in memory, for rate limiting; rates are tracked by
+// each node, so the limit applies per node rather than per cluster.
+type issuanceRates struct {
+	lock    sync.Mutex
+	entries map[string][]time.Time
+}
+
+// allow records an issuance by the role if fewer than limit tokens were issued by the role within the rate limit
+// window, returning false otherwise.
+func (r *issuanceRates) allow(roleName string, limit int, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.entries == nil {
+		r.entries = map[string][]time.Time{}
+	}
+
+	recent := r.entries[roleName][:0]
+	for _, issuedAt := range r.entries[roleName] {
+		if now.Sub(issuedAt) < rateLimitWindow {
+			recent = append(recent, issuedAt)
+		}
+	}
+
+	if len(recent) >= limit {
+		r.entries[roleName] = recent
+		return false
+	}
+
+	r.entries[roleName] = append(recent, now)
+	return true
+}
+
+// release removes an issuance by the role recorded at issuedAt, for tokens that weren't issued.
+func (r *issuanceRates) release(roleName string, issuedAt time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entries := r.entries[roleName]
+	for i, entry := range entries {
+		if entry.Equal(issuedAt) {
+			r.entries[roleName] = append(entries[:i], entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// reserveActiveToken records a token of the role expiring at expiration if the role has fewer than limit unexpired
+// tokens, returning false otherwise.
+func (b *backend) reserveActiveToken(ctx context.Context, stg logical.Storage, roleName string, limit int, expiration time.Time) (bool, error) {
+	b.activeTokensLock.Lock()
+	defer b.activeTokensLock.Unlock()
+
+	entry, err := stg.Get(ctx, activeTokensPath+roleName)
+	if err != nil {
+		return false, err
+	}
+
+	var expirations []time.Time
+	if entry != nil {
+		if err := entry.DecodeJSON(&expirations); err != nil {
+			return false, err
+		}
+	}
+
+	now := time.Now()
+
+	active := expirations[:0]
+	for _, activeExpiration := range expirations {
+		if activeExpiration.After(now) {
+			active = append(active, activeExpiration)
+		}
+	}
+
+	if len(active) >= limit {
+		return false, nil
+	}
+
+	entry, err = logical.StorageEntryJSON(activeTokensPath+roleName, append(active, expiration))
+	if err != nil {
+		return false, err
+	}
+
+	return true, stg.Put(ctx, entry)
+}
+
+// releaseActiveToken removes a token of the role expiring at expiration, for tokens that weren't issued.
+func (b *backend) releaseActiveToken(ctx context.Context, stg logical.Storage, roleName string, expiration time.Time) error {
+	b.activeTokensLock.Lock()
+	defer b.activeTokensLock.Unlock()
+
+	entry, err := stg.Get(ctx, activeTokensPath+roleName)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	var expirations []time.Time
+	if err := entry.DecodeJSON(&expirations); err != nil {
+		return err
+	}
+
+	for i, activeExpiration := range expirations {
+		if activeExpiration.Equal(expiration) {
+			expirations = append(expirations[:i], expirations[i+1:]...)
+			break
+		}
+	}
+
+	entry, err = logical.StorageEntryJSON(activeTokensPath+roleName, expirations)
+	if err != nil {
+		return err
+	}
+
+	return stg.Put(ctx, entry)
+}
+
+// deleteActiveTokens removes the active tokens of the role, including those of the names matched by a wildcard role.
+func (b *backend) deleteActiveTokens(ctx context.Context, stg logical.Storage, roleName string) error {
+	b.activeTokensLock.Lock()
+	defer b.activeTokensLock.Unlock()
+
+	if isWildcardRoleName(roleName) {
+		suffixes, err := stg.List(ctx, activeTokensPath+roleName+"/")
+		if err != nil {
+			return err
+		}
+		for _, suffix := range suffixes {
+			if err := stg.Delete(ctx, activeTokensPath+quotaName(roleName, suffix)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return stg.Delete(ctx, activeTokensPath+roleName)
+}
+
+// quotaName returns the name the quotas of the role are tracked by; roles matched by a wildcard role are tracked
+// by the requested name (e.g. 'team-*/payments'), so each name has its own quotas.
+func quotaName(roleName string, roleSuffix string) string {
+	if roleSuffix == "" {
+		return roleName
+	}
+	return roleName + "/" + roleSuffix
+}
+
+// quotaReservation is an issuance reserved by checkQuotas, which is released if the token isn't issued.
+type quotaReservation struct {
+	name       string
+	issuedAt   time.Time
+	expiration time.Time
+	rate       bool
+	active     bool
+}
+
+// checkQuotas enforces the role's rate limit & active token quota on a token expiring at expiration, reserving the
+// issuance. Exceeding either is reported as logical.ErrRateLimitQuotaExceeded, which Vault responds to with a 429
+// status.
+func (b *backend) checkQuotas(ctx context.Context, req *logical.Request, name string, role *Role, expiration time.Time) (*quotaReservation, *logical.Response, error) {
+	reservation := &quotaReservation{name: name, issuedAt: time.Now(), expiration: expiration}
+
+	if role.MaxTokensPerMinute > 0 {
+		if !b.issuanceRates.allow(name, role.MaxTokensPerMinute, reservation.issuedAt) {
+			return nil, logical.ErrorResponse("role token rate limit (%d per minute) exceeded", role.MaxTokensPerMinute), logical.ErrRateLimitQuotaExceeded
+		}
+		reservation.rate = true
+	}
+
+	if role.MaxActiveTokens > 0 {
+		reserved, err := b.reserveActiveToken(ctx, req.Storage, name, role.MaxActiveTokens, expiration)
+		if err != nil || !reserved {
+			b.releaseQuotas(ctx, req.Storage, reservation)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !reserved {
+			return nil, logical.ErrorResponse("role active token quota (%d) exceeded", role.MaxActiveTokens), logical.ErrRateLimitQuotaExceeded
+		}
+		reservation.active = true
+	}
+
+	return reservation, nil, nil
+}
+
+// releaseQuotas releases the issuance reserved by checkQuotas, when the token wasn't issued. Failures are logged;
+// an active token that can't be released expires with the token that wasn't issued.
+func (b *backend) releaseQuotas(ctx context.Context, stg logical.Storage, reservation *quotaReservation) {
+	if reservation.rate {
+		b.issuanceRates.release(reservation.name, reservation.issuedAt)
+	}
+
+	if reservation.active {
+		if err := b.releaseActiveToken(ctx, stg, reservation.name, reservation.expiration); err != nil {
+			b.Logger().Warn("Failed to release active token", "role", reservation.name, "error", err)
+		}
+	}
+}
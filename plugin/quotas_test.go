@@ -0,0 +1,138 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestIssuanceRates(t *testing.T) {
+	var rates issuanceRates
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !rates.allow("tester", 2, now) {
+			t.Fatal("issuance within the limit should be allowed")
+		}
+	}
+	if rates.allow("tester", 2, now.Add(30*time.Second)) {
+		t.Error("issuance beyond the limit should be denied")
+	}
+	if !rates.allow("other", 2, now) {
+		t.Error("limits should be per role")
+	}
+	if !rates.allow("tester", 2, now.Add(rateLimitWindow)) {
+		t.Error("issuance after the window should be allowed")
+	}
+
+	// Released issuances don't count towards the limit
+	later := now.Add(rateLimitWindow + time.Second)
+	if !rates.allow("tester", 2, later) {
+		t.Fatal("issuance within the limit should be allowed")
+	}
+	rates.release("tester", later)
+	if !rates.allow("tester", 2, later) {
+		t.Error("issuance within the limit should be allowed after a release")
+	}
+}
+
+func TestSignQuotas(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyMaxTokensPerMinute: -1}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("negative quota should have failed")
+	}
+
+	roleData[keyMaxTokensPerMinute] = 2
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, err := signData(b, storage, "tester", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+	if _, err := signData(b, storage, "tester", map[string]interface{}{}); !errors.Is(err, logical.ErrRateLimitQuotaExceeded) {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+
+	roleData = map[string]interface{}{keyIssuer: "active.example.com", keyMaxActiveTokens: 1, keyTTL: "1s"}
+	if resp, err := writeRoleData(b, storage, "active", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := signData(b, storage, "active", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, err := signData(b, storage, "active", map[string]interface{}{}); !errors.Is(err, logical.ErrRateLimitQuotaExceeded) {
+		t.Errorf("expected active token quota error, got %v", err)
+	}
+
+	// Tokens that fail to sign don't count towards the quota
+	roleData = map[string]interface{}{keyIssuer: "failing.example.com", keyMaxActiveTokens: 1, keyMaxTokensPerMinute: 1, keyAllowedAlgorithms: "ES384"}
+	if resp, err := writeRoleData(b, storage, "failing", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, err := signData(b, storage, "failing", map[string]interface{}{}); err == nil || errors.Is(err, logical.ErrRateLimitQuotaExceeded) {
+		t.Fatalf("expected signing error, got %v", err)
+	}
+	roleData[keyAllowedAlgorithms] = "ES256"
+	if resp, err := writeRoleData(b, storage, "failing", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp, err := signData(b, storage, "failing", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Names matched by wildcard roles have their own quotas
+	roleData = map[string]interface{}{keyIssuer: "team.example.com", keyMaxActiveTokens: 1}
+	if resp, err := writeRoleData(b, storage, "team-*", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	for _, name := range []string{"team-payments", "team-billing"} {
+		if resp, err := signData(b, storage, name, map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+	if _, err := signData(b, storage, "team-payments", map[string]interface{}{}); !errors.Is(err, logical.ErrRateLimitQuotaExceeded) {
+		t.Errorf("expected active token quota error, got %v", err)
+	}
+
+	if resp, err := deleteRole(b, storage, "team-*"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	entries, err := (*storage).List(context.Background(), activeTokensPath+"team-*/")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("active tokens of deleted wildcard role should be removed, got %v", entries)
+	}
+
+	// Expired tokens are no longer active
+	time.Sleep(1100 * time.Millisecond)
+	if resp, err := signData(b, storage, "active", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+}
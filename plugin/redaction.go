@@ -0,0 +1,176 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// redactionSaltPath is the storage location of the salt of the HMACs replacing redacted claim values.
+const redactionSaltPath = "redaction-salt"
+
+// claimRedactor replaces the values of the configured claims by their HMAC, e.g. "hmac-sha256:…", as Vault's audit
+// devices do; equal values have equal HMACs within a mount, so redacted values can still be correlated.
+type claimRedactor struct {
+	salt   *salt.Salt
+	claims []string
+}
+
+// getRedactionSalt returns the salt of the HMACs replacing redacted claim values, generating it when first used.
+func (b *backend) getRedactionSalt(ctx context.Context, stg logical.Storage) (*salt.Salt, error) {
+	b.redactionSaltLock.Lock()
+	defer b.redactionSaltLock.Unlock()
+
+	if b.redactionSalt == nil {
+		redactionSalt, err := salt.NewSalt(ctx, stg, &salt.Config{
+			HashFunc: salt.SHA256Hash,
+			Location: redactionSaltPath,
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.redactionSalt = redactionSalt
+	}
+
+	return b.redactionSalt, nil
+}
+
+// claimRedactor returns the redactor of the config's redacted claims, or nil when no claims are redacted.
+func (b *backend) claimRedactor(ctx context.Context, stg logical.Storage, config *Config) (*claimRedactor, error) {
+	if len(config.RedactedClaims) == 0 {
+		return nil, nil
+	}
+
+	redactionSalt, err := b.getRedactionSalt(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claimRedactor{salt: redactionSalt, claims: config.RedactedClaims}, nil
+}
+
+// redact returns the value of the claim, or its HMAC when the claim is redacted.
+func (r *claimRedactor) redact(claim string, value string) string {
+	if r == nil || value == "" || !stringInSlice(claim, r.claims) {
+		return value
+	}
+	return r.salt.GetIdentifiedHMAC(value)
+}
+
+// redactIssuance redacts the subject & audiences of the issuance record.
+func (r *claimRedactor) redactIssuance(issuance *Issuance) {
+	issuance.Subject = r.redact("sub", issuance.Subject)
+	for i, audience := range issuance.Audience {
+		issuance.Audience[i] = r.redact("aud", audience)
+	}
+}
+
+// redactMessage replaces the values of the redacted claims, found in the message, by their HMAC.
+func (r *claimRedactor) redactMessage(message string, claims map[string]interface{}) string {
+	if r == nil {
+		return message
+	}
+
+	var values []string
+	for _, claim := range r.claims {
+		values = append(values, claimStrings(claims[claim])...)
+	}
+
+	// Longer values are replaced first, so values containing others are replaced whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	var replacements []string
+	for _, value := range values {
+		if value != "" {
+			replacements = append(replacements, value, r.salt.GetIdentifiedHMAC(value))
+		}
+	}
+	if len(replacements) == 0 {
+		return message
+	}
+
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// claimStrings returns the strings of a claim value; the value itself, or the strings of an array.
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		var values []string
+		for _, entry := range value {
+			if entry, ok := entry.(string); ok {
+				values = append(values, entry)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// redactClaimErrors wraps an operation issuing tokens, redacting the values of the requested claims from its error
+// messages; audit devices record errors in plain text.
+func (b *backend) redactClaimErrors(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		resp, err := callback(ctx, req, d)
+		if err == nil && (resp == nil || !resp.IsError()) {
+			return resp, err
+		}
+
+		claims, ok := d.GetOk(keyClaims)
+		if !ok {
+			return resp, err
+		}
+
+		config, configErr := b.getConfig(ctx, req.Storage)
+		if configErr != nil {
+			return resp, err
+		}
+		redactor, redactorErr := b.claimRedactor(ctx, req.Storage, config)
+		if redactorErr != nil || redactor == nil {
+			return resp, err
+		}
+
+		if resp != nil && resp.IsError() {
+			resp.Data["error"] = redactor.redactMessage(resp.Error().Error(), claims.(map[string]interface{}))
+		}
+
+		if err != nil {
+			if message := redactor.redactMessage(err.Error(), claims.(map[string]interface{})); message != err.Error() {
+				if errors.As(err, &errutil.UserError{}) {
+					err = errutil.UserError{Err: message}
+				} else {
+					err = errutil.InternalError{Err: message}
+				}
+			}
+		}
+
+		return resp, err
+	}
+}
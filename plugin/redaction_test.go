@@ -0,0 +1,99 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestRedactedClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	config := map[string]interface{}{
+		keyAllowedClaims:    []string{"sub", "aud", "email", "amr"},
+		keyAllowedAMRValues: "pwd",
+		keyRedactedClaims:   []string{"sub", "amr"},
+		keyIssuanceLogSize:  5,
+	}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Tokens carry the claims as requested
+	claims := map[string]interface{}{"sub": "fry@planetexpress.com", "aud": "nimbus"}
+	token := signToken(t, b, storage, "tester", claims)
+	if sub := unsafeClaims(t, token)["sub"]; sub != "fry@planetexpress.com" {
+		t.Errorf("unexpected 'sub' claim %v", sub)
+	}
+
+	redactionSalt, err := b.getRedactionSalt(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Issuance records only hold the HMAC of redacted claims
+	resp := listIssuances(t, b, storage, nil)
+	key := resp.Data["keys"].([]string)[0]
+	issuance := resp.Data["key_info"].(map[string]interface{})[key].(map[string]interface{})
+	if diff := deep.Equal(redactionSalt.GetIdentifiedHMAC("fry@planetexpress.com"), issuance["sub"]); diff != nil {
+		t.Error(diff)
+	}
+	if !strings.HasPrefix(issuance["sub"].(string), "hmac-sha256:") {
+		t.Errorf("unexpected 'sub' record %v", issuance["sub"])
+	}
+
+	// Error messages only hold the HMAC of redacted claims
+	data := map[string]interface{}{keyClaims: map[string]interface{}{"amr": []interface{}{"face-of-fry"}}}
+	resp, err = signData(b, storage, "tester", data)
+	if err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+	if message := resp.Error().Error(); strings.Contains(message, "face-of-fry") || !strings.Contains(message, redactionSalt.GetIdentifiedHMAC("face-of-fry")) {
+		t.Errorf("unexpected error message %s", message)
+	}
+
+	// Other claims are left as they are
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyRedactedClaims: []string{"email"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	resp, _ = signData(b, storage, "tester", data)
+	if message := resp.Error().Error(); !strings.Contains(message, "face-of-fry") {
+		t.Errorf("unexpected error message %s", message)
+	}
+
+	// The salt is kept in storage
+	b.invalidate(context.Background(), redactionSaltPath)
+	reloadedSalt, err := b.getRedactionSalt(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal(redactionSalt.GetIdentifiedHMAC("value"), reloadedSalt.GetIdentifiedHMAC("value")); diff != nil {
+		t.Error(diff)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyRedactedClaims: []string{""}}); err == nil && !resp.IsError() {
+		t.Error("expected empty claim names to be rejected")
+	}
+}
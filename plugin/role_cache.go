@@ -0,0 +1,139 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"regexp"
+	"sync"
+)
+
+// roleCache caches roles, resolved with their templates, by their name, along with the names of the wildcard roles
+// and the compiled patterns of roles & the config. Only roles that exist are cached; names requested by callers
+// are unbounded.
+type roleCache struct {
+	lock       sync.RWMutex
+	roles      map[string]*Role
+	wildcards  []string
+	patterns   map[string]*regexp.Regexp
+	generation uint64
+}
+
+// get returns the cached role, and whether it is cached; with the generation of the cache, which roles loaded
+// after a miss are put with. Roles are shared; callers must not modify them.
+func (c *roleCache) get(name string) (*Role, bool, uint64) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	role, ok := c.roles[name]
+	return role, ok, c.generation
+}
+
+// put caches the role of the name; roles that don't exist (nil) are not cached. Roles loaded before the cache was
+// cleared (i.e. of an older generation) are not cached.
+func (c *roleCache) put(name string, role *Role, generation uint64) {
+	if role == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if c.roles == nil {
+		c.roles = map[string]*Role{}
+	}
+	c.roles[name] = role
+}
+
+// getWildcards returns the cached names of the wildcard roles, and whether they are cached; with the
+// generation of the cache.
+func (c *roleCache) getWildcards() ([]string, bool, uint64) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.wildcards, c.wildcards != nil, c.generation
+}
+
+// putWildcards caches the names of the wildcard roles, unless the cache was cleared since they were loaded.
+func (c *roleCache) putWildcards(names []string, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.wildcards = append([]string{}, names...)
+}
+
+// clear removes all cached roles & patterns. Roles are resolved with their template & validated against the
+// config, so changes to any of them clear the cache entirely.
+func (c *roleCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.roles = nil
+	c.wildcards = nil
+	c.patterns = nil
+	c.generation++
+}
+
+// compilePattern returns the compiled regular expression of the pattern, caching it until the cache is cleared;
+// only patterns of roles & the config are compiled, never those of requests.
+func (c *roleCache) compilePattern(pattern string) (*regexp.Regexp, error) {
+	c.lock.RLock()
+	compiled, ok := c.patterns[pattern]
+	c.lock.RUnlock()
+	if ok {
+		return compiled, nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.patterns == nil {
+		c.patterns = map[string]*regexp.Regexp{}
+	}
+	c.patterns[pattern] = compiled
+
+	return compiled, nil
+}
+
+// matchPattern checks if the value matches the pattern, compiled by the cache; invalid patterns match no values.
+func (c *roleCache) matchPattern(pattern string, value string) bool {
+	compiled, err := c.compilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return compiled.MatchString(value)
+}
+
+// matchPattern checks if the value matches the pattern, compiling it; invalid patterns match no values. Patterns
+// checked by every sign request are matched by the role cache.
+func matchPattern(pattern string, value string) bool {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return compiled.MatchString(value)
+}
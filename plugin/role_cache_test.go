@@ -0,0 +1,145 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRoleCache(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"aud", "team"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	signedTeam := func(role string) interface{} {
+		resp, err := signData(b, storage, role, map[string]interface{}{})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return unsafeClaims(t, resp.Data["token"].(string))["team"]
+	}
+
+	writeTeam := func(role string, team string) {
+		roleData := map[string]interface{}{keyClaims: map[string]interface{}{"team": team}}
+		if resp, err := writeRoleData(b, storage, role, roleData); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	writeTeam("tester", "planet-express")
+	if diff := deep.Equal("planet-express", signedTeam("tester")); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok, _ := b.cachedRoles.get("tester"); !ok {
+		t.Error("role should be cached")
+	}
+
+	// Writes are visible immediately
+	writeTeam("tester", "nimbus")
+	if diff := deep.Equal("nimbus", signedTeam("tester")); diff != nil {
+		t.Error(diff)
+	}
+
+	// Names without roles are not cached, so roles written later match them
+	if resp, err := signData(b, storage, "team-payments", map[string]interface{}{}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("unknown role should have failed")
+	}
+	writeTeam("team-*", "{{.role_suffix}}")
+	if diff := deep.Equal("payments", signedTeam("team-payments")); diff != nil {
+		t.Error(diff)
+	}
+
+	// Entries written by other nodes are visible once invalidated
+	entry, err := logical.StorageEntryJSON(path.Join(keyStorageRolePath, "tester"), &Role{Claims: map[string]interface{}{"team": "omicron"}})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	b.invalidate(context.Background(), path.Join(keyStorageRolePath, "tester"))
+
+	if diff := deep.Equal("omicron", signedTeam("tester")); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRoleCacheGeneration(t *testing.T) {
+	var cache roleCache
+
+	_, _, generation := cache.get("tester")
+
+	// Roles loaded before the cache is cleared may be stale
+	cache.clear()
+	cache.put("tester", &Role{}, generation)
+
+	if _, ok, _ := cache.get("tester"); ok {
+		t.Error("role of an older generation should not be cached")
+	}
+
+	// Names are unbounded; only roles that exist are cached
+	_, _, generation = cache.get("tester")
+	cache.put("tester", nil, generation)
+
+	if _, ok, _ := cache.get("tester"); ok {
+		t.Error("missing role should not be cached")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	if !matchPattern(`^team-\w+$`, "team-payments") {
+		t.Error("pattern should match")
+	}
+	if matchPattern(`^team-\w+$`, "payments") {
+		t.Error("pattern should not match")
+	}
+	if matchPattern(`(`, "(") {
+		t.Error("invalid patterns should match no values")
+	}
+
+	var cache roleCache
+
+	if !cache.matchPattern(`^team-\w+$`, "team-payments") {
+		t.Error("cached pattern should match")
+	}
+	if cache.matchPattern(`(`, "(") {
+		t.Error("invalid cached patterns should match no values")
+	}
+
+	first, err := cache.compilePattern(`^team-\w+$`)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	second, _ := cache.compilePattern(`^team-\w+$`)
+	if first != second {
+		t.Error("compiled patterns should be cached")
+	}
+
+	// Patterns are released with the roles they belong to
+	cache.clear()
+	third, _ := cache.compilePattern(`^team-\w+$`)
+	if first == third {
+		t.Error("compiled patterns should be cleared with the cache")
+	}
+}
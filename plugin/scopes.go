@@ -0,0 +1,51 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// scopeTokenPattern matches RFC 6749 scope tokens; printable ASCII, excluding spaces, '"' & '\'.
+var scopeTokenPattern = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// validateScopes checks the scopes are valid scope tokens.
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !scopeTokenPattern.MatchString(scope) {
+			return fmt.Errorf("invalid scope '%s'", scope)
+		}
+	}
+	return nil
+}
+
+// scopeClaim returns the space-delimited 'scope' claim of the requested scopes, each of which must be allowed.
+// Duplicate scopes are removed, otherwise the requested order is kept.
+func scopeClaim(requested []string, allowed []string) (string, error) {
+	var scopes []string
+	for _, scope := range requested {
+		if !stringInSlice(scope, allowed) {
+			return "", fmt.Errorf("scope %s not permitted", scope)
+		}
+		if !stringInSlice(scope, scopes) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
@@ -0,0 +1,86 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestScopeClaim(t *testing.T) {
+	allowed := []string{"read:ships", "write:ships", "openid"}
+
+	scope, err := scopeClaim([]string{"openid", "read:ships", "openid"}, allowed)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal("openid read:ships", scope); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := scopeClaim([]string{"read:ships", "admin"}, allowed); err == nil {
+		t.Error("disallowed scope should have failed")
+	}
+
+	if err := validateScopes(allowed); err != nil {
+		t.Error(err)
+	}
+	for _, scope := range []string{"read ships", `read"ships`, `read\ships`, "", "lecture:navires:é"} {
+		if err := validateScopes([]string{scope}); err == nil {
+			t.Errorf("'%s' should have failed", scope)
+		}
+	}
+}
+
+func TestSignScopes(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "scope"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{keyIssuer: "tester.example.com", keyAllowedScopes: []string{"read ships"}}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role with invalid scope should have failed")
+	}
+
+	roleData[keyAllowedScopes] = []string{"read:ships", "write:ships"}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	data := map[string]interface{}{keyScopes: []string{"read:ships", "write:ships"}}
+	resp, err := signData(b, storage, "tester", data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if diff := deep.Equal("read:ships write:ships", unsafeClaims(t, resp.Data["token"].(string))["scope"]); diff != nil {
+		t.Error(diff)
+	}
+
+	denied := []map[string]interface{}{
+		{keyScopes: []string{"admin"}},
+		{keyScopes: []string{"read:ships"}, keyClaims: map[string]interface{}{"scope": "admin"}},
+	}
+	for _, data := range denied {
+		if resp, err := signData(b, storage, "tester", data); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%v should have failed", data)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ES256K is the RFC 8812 algorithm signing with ECDSA over the secp256k1 curve & SHA-256; go-jose
+// doesn't support the curve, so keys are handled by the plugin.
+const ES256K = jose.SignatureAlgorithm("ES256K")
+
+// secp256k1KeyType is the keysutil key type holding secp256k1 private keys. keysutil has no secp256k1
+// keys, so the random 256 bit keys of AES-256 policies are used as private keys, reduced modulo the
+// order of the curve; keeping versioning, rotation & backups of the keys to keysutil. Keyrings only hold
+// secp256k1 keys when their configuration's Secp256k1Keys is set, never by the type of their keys alone.
+const secp256k1KeyType = keysutil.KeyType_AES256_GCM96
+
+// secp256k1PrivateKeySize is the size, in bytes, of secp256k1 private keys.
+const secp256k1PrivateKeySize = 32
+
+// secp256k1PublicKey returns the public key of a secp256k1 private key.
+func secp256k1PublicKey(privateKey []byte) *ecdsa.PublicKey {
+	return secp256k1.PrivKeyFromBytes(privateKey).PubKey().ToECDSA()
+}
+
+// isSecp256k1Key checks if the public key is a secp256k1 key.
+func isSecp256k1Key(publicKey interface{}) bool {
+	key, ok := publicKey.(*ecdsa.PublicKey)
+	return ok && key.Curve == secp256k1.S256()
+}
+
+// signES256K signs the input with the secp256k1 private key, returning the R || S signature. Signatures
+// are deterministic (RFC 6979) with a low S value.
+func signES256K(privateKey []byte, input []byte) []byte {
+	digest := sha256.Sum256(input)
+
+	// Compact signatures are prefixed with a public key recovery code
+	return secp256k1ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(privateKey), digest[:], false)[1:]
+}
+
+// verifyES256K verifies the R || S signature of the input with the secp256k1 public key.
+func verifyES256K(publicKey *ecdsa.PublicKey, input []byte, signature []byte) bool {
+	if len(signature) != 2*secp256k1PrivateKeySize {
+		return false
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:secp256k1PrivateKeySize]) || s.SetByteSlice(signature[secp256k1PrivateKeySize:]) {
+		return false
+	}
+
+	var x, y secp256k1.FieldVal
+	if x.SetByteSlice(publicKey.X.Bytes()) || y.SetByteSlice(publicKey.Y.Bytes()) {
+		return false
+	}
+
+	digest := sha256.Sum256(input)
+
+	return secp256k1ecdsa.NewSignature(&r, &s).Verify(digest[:], secp256k1.NewPublicKey(&x, &y))
+}
+
+// verifyES256KToken verifies the signature of the compact serialized token with the secp256k1 public key.
+func verifyES256KToken(rawToken string, publicKey interface{}) bool {
+	key, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok || !isSecp256k1Key(key) {
+		return false
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	return verifyES256K(key, []byte(parts[0]+"."+parts[1]), signature)
+}
+
+// secp256k1JWK returns the JSON form of a JSON Web Key holding a secp256k1 public key, which go-jose
+// can't marshal.
+func secp256k1JWK(key jose.JSONWebKey) map[string]interface{} {
+	publicKey := key.Key.(*ecdsa.PublicKey)
+
+	jwk := secp256k1JWKMembers(publicKey)
+	jwk["kid"] = key.KeyID
+	jwk["alg"] = key.Algorithm
+	jwk["use"] = key.Use
+
+	return jwk
+}
+
+// secp256k1JWKMembers returns the required members of the JSON Web Key of a secp256k1 public key.
+func secp256k1JWKMembers(publicKey *ecdsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "secp256k1",
+		"x":   secp256k1Coordinate(publicKey.X),
+		"y":   secp256k1Coordinate(publicKey.Y),
+	}
+}
+
+// secp256k1Thumbprint returns the RFC 7638 (SHA-256) thumbprint of a secp256k1 public key.
+func secp256k1Thumbprint(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	// Members are marshaled in lexicographic order, without whitespace, as the thumbprint requires
+	members, err := json.Marshal(secp256k1JWKMembers(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint := sha256.Sum256(members)
+
+	return thumbprint[:], nil
+}
+
+// secp256k1Coordinate encodes a coordinate of a secp256k1 point, padded to the size of the field.
+func secp256k1Coordinate(coordinate *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(coordinate.FillBytes(make([]byte, secp256k1PrivateKeySize)))
+}
+
+// signSecp256k1 signs the input with the secp256k1 private key of the key version.
+func (ps *PolicySigner) signSecp256k1(keyVersion int, input []byte) ([]byte, error) {
+	if ps.Policy.Type != secp256k1KeyType {
+		return nil, errutil.InternalError{Err: "keyring has no secp256k1 keys"}
+	}
+
+	key, ok := ps.Policy.Keys[strconv.Itoa(keyVersion)]
+	if !ok || len(key.Key) != secp256k1PrivateKeySize {
+		return nil, errutil.InternalError{Err: "invalid secp256k1 key version"}
+	}
+
+	return signES256K(key.Key, input), nil
+}
@@ -0,0 +1,217 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// fetchRawJWKS returns the keys of the JWKS as JSON objects; go-jose can't parse secp256k1 keys.
+func fetchRawJWKS(t *testing.T, b *backend, storage *logical.Storage) []map[string]interface{} {
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "jwks",
+		Storage:    *storage,
+		MountPoint: "test",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return jwks.Keys
+}
+
+func decodeCoordinate(t *testing.T, value interface{}) *big.Int {
+	encoded, err := base64.RawURLEncoding.DecodeString(value.(string))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if len(encoded) != 32 {
+		t.Errorf("expected 32 byte coordinate, got %d", len(encoded))
+	}
+	return new(big.Int).SetBytes(encoded)
+}
+
+func TestES256KRequiresOptIn(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES256K"}); err == nil {
+		t.Errorf("expected ES256K to require opting in, got %#v", resp)
+	}
+
+	if resp, err := writeKeySet(b, storage, "did", map[string]interface{}{keySignatureAlgorithm: "ES256K"}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Errorf("expected ES256K key set to require opting in, got %#v", resp)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES256K", keyAllowNonFIPS: true}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyAllowNonFIPS: false}); err == nil {
+		t.Errorf("expected opting out to be rejected while signing with ES256K, got %#v", resp)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES256"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if resp, err := writeKeySet(b, storage, "did", map[string]interface{}{keySignatureAlgorithm: "ES256K"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if resp, err := writeConfig(b, storage, map[string]interface{}{keyAllowNonFIPS: false}); err == nil {
+		t.Errorf("expected opting out to be rejected while a key set uses ES256K, got %#v", resp)
+	}
+}
+
+func TestES256KSigning(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keySignatureAlgorithm: "ES256K",
+		keyAllowNonFIPS:       true,
+		keyKeyIDStrategy:      KeyIDStrategyThumbprint,
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "did:example:123"})
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if parsed.Headers[0].Algorithm != string(ES256K) {
+		t.Errorf("expected alg ES256K, got %s", parsed.Headers[0].Algorithm)
+	}
+
+	var publicKey *ecdsa.PublicKey
+	for _, key := range fetchRawJWKS(t, b, storage) {
+		if key["kid"] != parsed.Headers[0].KeyID {
+			continue
+		}
+		if key["kty"] != "EC" || key["crv"] != "secp256k1" || key["alg"] != "ES256K" {
+			t.Errorf("unexpected key %#v", key)
+		}
+		publicKey = &ecdsa.PublicKey{Curve: secp256k1.S256(), X: decodeCoordinate(t, key["x"]), Y: decodeCoordinate(t, key["y"])}
+	}
+	if publicKey == nil {
+		t.Fatalf("signing key %s not published", parsed.Headers[0].KeyID)
+	}
+
+	thumbprint, err := secp256k1Thumbprint(publicKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if kid := base64.RawURLEncoding.EncodeToString(thumbprint); kid != parsed.Headers[0].KeyID {
+		t.Errorf("expected thumbprint kid %s, got %s", kid, parsed.Headers[0].KeyID)
+	}
+
+	parts := strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if !verifyES256K(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		t.Error("signature not verified by the published key")
+	}
+
+	resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+	if resp.Data["valid"] != true {
+		t.Errorf("expected token to verify, got %#v", resp.Data)
+	}
+
+	// Tampered tokens fail verification
+	signature[0] ^= 0xff
+	tampered := parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(signature)
+	resp = verifyToken(t, b, storage, map[string]interface{}{keyToken: tampered})
+	if resp.Data["valid"] != false {
+		t.Errorf("expected tampered token to fail verification, got %#v", resp.Data)
+	}
+}
+
+func TestES256KKeysOutliveKeyFormatChange(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES256K", keyAllowNonFIPS: true}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	token := signToken(t, b, storage, "tester", map[string]interface{}{"sub": "did:example:123"})
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES256"}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	// Keys signing with ES256K before the change of key format remain secp256k1 keys
+	resp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+	if resp.Data["valid"] != true {
+		t.Errorf("expected token to verify, got %#v", resp.Data)
+	}
+}
+
+func TestAESKeyringIsNotSecp256k1(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	// e.g. an imported keyring
+	_, _, err := b.lockManager.GetPolicy(context.Background(), keysutil.PolicyRequest{
+		Upsert:  true,
+		Storage: *storage,
+		Name:    mainKeyName,
+		KeyType: keysutil.KeyType_AES256_GCM96,
+	}, rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	config, err := b.getConfig(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if _, err := b.getPolicy(context.Background(), *storage, config, "test"); err == nil {
+		t.Error("expected an AES-256 keyring not configured as secp256k1 keys to be rejected")
+	}
+}
@@ -0,0 +1,112 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// validateSessionClaims validates the OIDC session claims ('auth_time', 'sid', 'amr' & 'acr') present in the
+// claims, normalizing 'auth_time' to a NumericDate. The authentication cannot be after now, and the 'acr' & 'amr'
+// values must be allowed when their allowlists are not empty.
+func validateSessionClaims(claims map[string]interface{}, now time.Time, allowedACRs []string, allowedAMRs []string) error {
+
+	if rawAuthTime, ok := claims["auth_time"]; ok {
+		authTime, err := numericDate(rawAuthTime)
+		if err != nil {
+			return fmt.Errorf("'auth_time' claim %v", err)
+		}
+		if authTime.Time().After(now) {
+			return fmt.Errorf("'auth_time' claim cannot be in the future")
+		}
+		claims["auth_time"] = authTime
+	}
+
+	if rawSID, ok := claims["sid"]; ok {
+		if sid, ok := rawSID.(string); !ok || sid == "" {
+			return fmt.Errorf("'sid' claim must be a non-empty string")
+		}
+	}
+
+	if rawACR, ok := claims["acr"]; ok {
+		acr, ok := rawACR.(string)
+		if !ok || acr == "" {
+			return fmt.Errorf("'acr' claim must be a non-empty string")
+		}
+		if len(allowedACRs) > 0 && !stringInSlice(acr, allowedACRs) {
+			return fmt.Errorf("'acr' claim '%s' is not allowed", acr)
+		}
+	}
+
+	if rawAMR, ok := claims["amr"]; ok {
+		var amr []interface{}
+		switch value := rawAMR.(type) {
+		case []interface{}:
+			amr = value
+		case []string:
+			for _, method := range value {
+				amr = append(amr, method)
+			}
+		default:
+			return fmt.Errorf("'amr' claim must be an array of strings")
+		}
+		for _, rawMethod := range amr {
+			method, ok := rawMethod.(string)
+			if !ok || method == "" {
+				return fmt.Errorf("'amr' claim must be an array of non-empty strings")
+			}
+			if len(allowedAMRs) > 0 && !stringInSlice(method, allowedAMRs) {
+				return fmt.Errorf("'amr' claim value '%s' is not allowed", method)
+			}
+		}
+		claims["amr"] = amr
+	}
+
+	return nil
+}
+
+// numericDate converts a claim value holding seconds since the epoch to a NumericDate.
+func numericDate(value interface{}) (jwt.NumericDate, error) {
+	var seconds float64
+	switch value := value.(type) {
+	case jwt.NumericDate:
+		return value, nil
+	case int:
+		seconds = float64(value)
+	case int64:
+		seconds = float64(value)
+	case float64:
+		seconds = value
+	case json.Number:
+		parsed, err := value.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("must be a number")
+		}
+		seconds = parsed
+	default:
+		return 0, fmt.Errorf("must be a number, not %T", value)
+	}
+	if seconds <= 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, fmt.Errorf("must be a positive number")
+	}
+	return jwt.NumericDate(int64(seconds)), nil
+}
@@ -0,0 +1,104 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestValidateSessionClaims(t *testing.T) {
+	now := time.Now()
+
+	claims := map[string]interface{}{
+		"auth_time": json.Number("1600000000"),
+		"sid":       "session-1",
+		"acr":       "urn:mace:incommon:iap:silver",
+		"amr":       []string{"pwd", "otp"},
+	}
+	if err := validateSessionClaims(claims, now, []string{"urn:mace:incommon:iap:silver"}, []string{"pwd", "otp"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	expected := map[string]interface{}{
+		"auth_time": jwt.NumericDate(1600000000),
+		"sid":       "session-1",
+		"acr":       "urn:mace:incommon:iap:silver",
+		"amr":       []interface{}{"pwd", "otp"},
+	}
+	if diff := deep.Equal(expected, claims); diff != nil {
+		t.Error(diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"future auth_time": {"auth_time": now.Add(time.Hour).Unix()},
+		"string auth_time": {"auth_time": "yesterday"},
+		"zero auth_time":   {"auth_time": 0},
+		"empty sid":        {"sid": ""},
+		"numeric acr":      {"acr": 2},
+		"disallowed acr":   {"acr": "urn:mace:incommon:iap:bronze"},
+		"string amr":       {"amr": "pwd"},
+		"disallowed amr":   {"amr": []interface{}{"pwd", "sms"}},
+	}
+	for name, claims := range invalid {
+		if err := validateSessionClaims(claims, now, []string{"urn:mace:incommon:iap:silver"}, []string{"pwd", "otp"}); err == nil {
+			t.Errorf("%s should have failed", name)
+		}
+	}
+}
+
+func TestSignSessionClaims(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	config := map[string]interface{}{
+		keyAllowedClaims:    []string{"sub", "auth_time", "sid", "amr", "acr"},
+		keyAllowedACRValues: "gold",
+		keyAllowedAMRValues: "pwd,hwk",
+	}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{"acr": "gold"}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	authTime := time.Now().Add(-time.Minute).Unix()
+	data := map[string]interface{}{keyClaims: map[string]interface{}{"auth_time": json.Number(strconv.FormatInt(authTime, 10)), "sid": "session-1", "amr": []interface{}{"hwk"}}}
+	resp, err := signData(b, storage, "tester", data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	claims := unsafeClaims(t, resp.Data["token"].(string))
+	expected := map[string]interface{}{"auth_time": float64(authTime), "sid": "session-1", "amr": []interface{}{"hwk"}, "acr": "gold"}
+	for claim, value := range expected {
+		if diff := deep.Equal(value, claims[claim]); diff != nil {
+			t.Error(claim, diff)
+		}
+	}
+
+	data = map[string]interface{}{keyClaims: map[string]interface{}{"amr": []interface{}{"sms"}}}
+	if resp, err := signData(b, storage, "tester", data); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("disallowed amr should have failed")
+	}
+}
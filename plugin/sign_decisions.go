@@ -0,0 +1,98 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// signDecisions logs the decisions of a sign request as structured debug logs, when the config's
+// 'log_sign_decisions' is enabled; values of redacted claims are logged as their HMAC. A nil signDecisions logs
+// nothing.
+type signDecisions struct {
+	logger   hclog.Logger
+	redactor *claimRedactor
+}
+
+// signDecisions returns the decision log of a sign request for the role, or nil when disabled.
+func (b *backend) signDecisions(ctx context.Context, req *logical.Request, config *Config, roleName string) (*signDecisions, error) {
+	if !config.LogSignDecisions || !b.Logger().IsDebug() {
+		return nil, nil
+	}
+
+	redactor, err := b.claimRedactor(ctx, req.Storage, config)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := b.Logger().Named("sign").With("mount", req.MountPoint, "request_id", req.ID, "role", roleName)
+
+	return &signDecisions{logger: logger, redactor: redactor}, nil
+}
+
+// log logs the decision with its structured fields, as key & value pairs.
+func (s *signDecisions) log(decision string, fields ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.logger.Debug(decision, fields...)
+}
+
+// rejectClaim logs the rejection of the claim's value by the restriction (e.g. "role audience_pattern"), and its
+// pattern or allowed values.
+func (s *signDecisions) rejectClaim(claim string, value string, restriction string, rule interface{}) {
+	if s == nil {
+		return
+	}
+	s.log("claim rejected", "claim", claim, "value", s.redactor.redact(claim, value), "restriction", restriction, "rule", fmt.Sprint(rule))
+}
+
+// resolveTTL logs the effective TTL of the token, along with the requested TTL or expiration & the limits capping it.
+func (s *signDecisions) resolveTTL(ttl time.Duration, maxTTL time.Duration, options tokenOptions, role *Role, expiry time.Time) {
+	if s == nil {
+		return
+	}
+
+	fields := []interface{}{"ttl", ttl.String(), "max_ttl", maxTTL.String(), "expires_at", expiry.Format(time.RFC3339)}
+	if options.TTL > 0 {
+		fields = append(fields, "requested_ttl", options.TTL.String())
+	}
+	if !options.ExpiresAt.IsZero() {
+		fields = append(fields, "requested_expires_at", options.ExpiresAt.Format(time.RFC3339))
+	}
+	if !role.NotAfter.IsZero() {
+		fields = append(fields, "not_after", formatRoleTime(role.NotAfter))
+	}
+
+	s.log("ttl resolved", fields...)
+}
+
+// claimNames returns the sorted names of the claims; decisions log names, as values can hold personal data.
+func claimNames(claims map[string]interface{}) []string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,141 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// getLoggedTestBackend returns a test backend logging to the buffer, as JSON.
+func getLoggedTestBackend(t *testing.T, output *bytes.Buffer) (*backend, *logical.Storage) {
+
+	config := logical.TestBackendConfig()
+	config.StorageView = new(logical.InmemStorage)
+	config.BackendUUID = uuid.New().String()
+	config.Logger = hclog.New(&hclog.LoggerOptions{Output: output, Level: hclog.Debug, JSONFormat: true})
+
+	b, err := createBackend(config)
+	if err != nil {
+		t.Fatalf("unable to create backend: %v", err)
+	}
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatalf("unable to create backend: %v", err)
+	}
+
+	_ = b.clearConfig(context.Background(), config.StorageView)
+
+	return b, &config.StorageView
+}
+
+// loggedDecisions returns the logged sign decisions, by their message.
+func loggedDecisions(t *testing.T, output *bytes.Buffer) map[string]map[string]interface{} {
+	decisions := map[string]map[string]interface{}{}
+
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if entry["@module"] == "sign" {
+			decisions[entry["@message"].(string)] = entry
+		}
+	}
+
+	return decisions
+}
+
+func TestSignDecisions(t *testing.T) {
+	var output bytes.Buffer
+	b, storage := getLoggedTestBackend(t, &output)
+
+	config := map[string]interface{}{
+		keyAllowedClaims:  []string{"sub", "aud", "email"},
+		keyRedactedClaims: []string{"email"},
+	}
+	if _, err := writeConfig(b, storage, config); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:          "tester.example.com",
+		keyAudiencePattern: "^api-",
+		keyClaimPatterns:   map[string]interface{}{"email": "@planetexpress\\.com$"},
+		keyTTL:             "10m",
+	}
+	if resp, err := writeRoleData(b, storage, "tester", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Nothing is logged by default
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "nimbus"}}); err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+	if decisions := loggedDecisions(t, &output); len(decisions) != 0 {
+		t.Errorf("unexpected decisions %v", decisions)
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyLogSignDecisions: true}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"aud": "nimbus"}}); err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+	decisions := loggedDecisions(t, &output)
+	if decisions["role matched"]["role"] != "tester" {
+		t.Errorf("unexpected role decision %v", decisions["role matched"])
+	}
+	rejected := decisions["claim rejected"]
+	if rejected["claim"] != "aud" || rejected["value"] != "nimbus" || rejected["restriction"] != "role audience_pattern" || rejected["rule"] != "^api-" {
+		t.Errorf("unexpected rejection %v", rejected)
+	}
+
+	// Values of redacted claims are logged as their HMAC
+	claims := map[string]interface{}{"aud": "api-nimbus", "email": "kif@nimbus.doop"}
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: claims}); err == nil && !resp.IsError() {
+		t.Fatalf("expected failure, got resp:%#v\n", resp)
+	}
+	redactionSalt, err := b.getRedactionSalt(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	rejected = loggedDecisions(t, &output)["claim rejected"]
+	if rejected["claim"] != "email" || rejected["value"] != redactionSalt.GetIdentifiedHMAC("kif@nimbus.doop") || rejected["restriction"] != "role claim_patterns" {
+		t.Errorf("unexpected rejection %v", rejected)
+	}
+
+	claims = map[string]interface{}{"aud": "api-nimbus", "email": "fry@planetexpress.com"}
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: claims}); err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	decisions = loggedDecisions(t, &output)
+	if decisions["ttl resolved"]["ttl"] != "10m0s" {
+		t.Errorf("unexpected ttl decision %v", decisions["ttl resolved"])
+	}
+	if _, ok := decisions["token issued"]; !ok {
+		t.Errorf("expected issuance decision, got %v", decisions)
+	}
+}
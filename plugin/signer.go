@@ -0,0 +1,490 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Supported signer types.
+const (
+	// SignerTypeLocal signs using keys generated and stored by the plugin.
+	SignerTypeLocal = "local"
+
+	// SignerTypeTransit signs using a key held by a Vault Transit secrets engine.
+	SignerTypeTransit = "transit"
+
+	// SignerTypeAWSKMS signs using an asymmetric AWS KMS key.
+	SignerTypeAWSKMS = "awskms"
+
+	// SignerTypeGCPKMS signs using an asymmetric Google Cloud KMS key.
+	SignerTypeGCPKMS = "gcpkms"
+
+	// SignerTypeAzureKV signs using a key held by Azure Key Vault or Managed HSM.
+	SignerTypeAzureKV = "azurekv"
+
+	// SignerTypePKCS11 signs using a key held by an HSM, accessed through its PKCS#11 module.
+	SignerTypePKCS11 = "pkcs11"
+)
+
+var AllowedSignerTypes = []string{SignerTypeLocal, SignerTypeTransit, SignerTypeAWSKMS, SignerTypeGCPKMS, SignerTypeAzureKV, SignerTypePKCS11}
+
+// JWS headers of unencoded payloads (RFC 7797).
+const (
+	headerB64      jose.HeaderKey = "b64"
+	headerCritical jose.HeaderKey = "crit"
+)
+
+// externalKey identifies the key an external signer will use to produce a signature.
+type externalKey struct {
+	// ID is the key id (kid) published in the JWKS.
+	ID string
+
+	// Version is the signer specific version of the key.
+	Version string
+
+	// PublicKey is the public half of the key, used to check algorithm compatibility.
+	PublicKey crypto.PublicKey
+
+	// Algorithms restricts the signature algorithms of keys bound to a single algorithm;
+	// when empty, the algorithms are derived from the public key.
+	Algorithms []jose.SignatureAlgorithm
+}
+
+// supports checks if the key can produce signatures using the algorithm.
+func (k *externalKey) supports(alg jose.SignatureAlgorithm) bool {
+	if len(k.Algorithms) == 0 {
+		return algorithmSupported(k.PublicKey, alg)
+	}
+	for _, keyAlg := range k.Algorithms {
+		if keyAlg == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// externalSigner is implemented by signing backends that hold private keys outside the plugin's storage.
+type externalSigner interface {
+	// currentKey returns the key currently used to sign new tokens.
+	currentKey(ctx context.Context) (*externalKey, error)
+
+	// sign produces a JWS signature of the signing input using the given key.
+	sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error)
+
+	// publicKeys returns the public keys available for verification; keys without an
+	// algorithm are published with the configured algorithm, when compatible.
+	publicKeys(ctx context.Context) ([]jose.JSONWebKey, error)
+}
+
+// newExternalSigner creates the signer selected by the configuration, or nil when using local keys.
+func newExternalSigner(backendId string, config *Config) (externalSigner, error) {
+	switch config.SignerType {
+	case "", SignerTypeLocal:
+		return nil, nil
+	case SignerTypeTransit:
+		return newTransitSigner(backendId, config.Transit)
+	case SignerTypeAWSKMS:
+		return newAWSKMSSigner(backendId, config.AWSKMS)
+	case SignerTypeGCPKMS:
+		return newGCPKMSSigner(backendId, config.GCPKMS)
+	case SignerTypeAzureKV:
+		return newAzureKeyVaultSigner(backendId, config.AzureKV)
+	case SignerTypePKCS11:
+		return newPKCS11Signer(backendId, config.PKCS11)
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unknown/unsupported signer type: %s", config.SignerType)}
+	}
+}
+
+// getExternalSigner returns the (cached) external signer for the configuration, or nil when using local keys.
+func (b *backend) getExternalSigner(config *Config) (externalSigner, error) {
+	if config.usesLocalKeys() {
+		return nil, nil
+	}
+
+	b.cachedConfigLock.RLock()
+	if b.cachedSigner != nil {
+		defer b.cachedConfigLock.RUnlock()
+		return b.cachedSigner, nil
+	}
+
+	b.cachedConfigLock.RUnlock()
+	b.cachedConfigLock.Lock()
+	defer b.cachedConfigLock.Unlock()
+
+	// Double check somebody else didn't already cache it
+	if b.cachedSigner != nil {
+		return b.cachedSigner, nil
+	}
+
+	signer, err := newExternalSigner(b.id, config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.cachedSigner = signer
+
+	return signer, nil
+}
+
+// getSigner returns a signer for new tokens using the key source selected by the configuration. Tokens
+// are signed with the mount-wide keys, unless keyring names a keyring isolated to a role.
+func (b *backend) getSigner(ctx context.Context, stg logical.Storage, config *Config, keyring string, mount string, options *jose.SignerOptions) (inputSigner, error) {
+
+	extSigner, err := b.getExternalSigner(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if extSigner != nil && keyring != mainKeyName {
+		return nil, errutil.UserError{Err: "isolated keyrings are only supported by the local signer"}
+	}
+
+	if extSigner != nil {
+		return &ExternalSigner{
+			Context:            ctx,
+			SignatureAlgorithm: config.SignatureAlgorithm,
+			Signer:             extSigner,
+			SignerOptions:      options,
+			KeyIDConfig:        config,
+		}, nil
+	}
+
+	policy, err := b.getKeyringPolicy(ctx, stg, config, keyring, mount)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &PolicySigner{
+		BackendId:          b.id,
+		SignatureAlgorithm: config.SignatureAlgorithm,
+		Policy:             policy,
+		SignerOptions:      options,
+		KeyIDConfig:        config,
+		PrePublishPeriod:   config.KeyPrePublishPeriod,
+	}
+
+	if config.MaxSignaturesPerKey > 0 {
+		signer.Signed = func(keyVersion int) error {
+			return b.countKeySignature(ctx, stg, policy, config, keyVersion, mount)
+		}
+	}
+
+	return signer, nil
+}
+
+// inputSigner is implemented by signers able to sign arbitrary input, for token formats other than JWS.
+type inputSigner interface {
+	jose.Signer
+
+	// SignInput signs the input, produced for the id of the current signing key, returning the signature.
+	SignInput(input func(kid string) ([]byte, error)) ([]byte, error)
+}
+
+// keyIDSigner records the id (kid) of the key that signed with the wrapped signer.
+type keyIDSigner struct {
+	inputSigner
+
+	// KeyID is the id of the key of the last signature.
+	KeyID string
+}
+
+func (s *keyIDSigner) Sign(payload []byte) (*jose.JSONWebSignature, error) {
+	jws, err := s.inputSigner.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jws.Signatures) > 0 {
+		s.KeyID = jws.Signatures[0].Protected.KeyID
+	}
+
+	return jws, nil
+}
+
+// SignInput signs the input, produced for the id of the current signing key, returning the signature.
+func (s *keyIDSigner) SignInput(input func(kid string) ([]byte, error)) ([]byte, error) {
+	return s.inputSigner.SignInput(func(kid string) ([]byte, error) {
+		s.KeyID = kid
+		return input(kid)
+	})
+}
+
+// ExternalSigner is a jose.Signer that produces signatures with an external signer.
+type ExternalSigner struct {
+	Context            context.Context
+	SignatureAlgorithm jose.SignatureAlgorithm
+	Signer             externalSigner
+	SignerOptions      *jose.SignerOptions
+
+	// KeyIDConfig selects the key id strategy; the signer's key ids are used when nil.
+	KeyIDConfig *Config
+}
+
+func (es *ExternalSigner) Sign(payload []byte) (*jose.JSONWebSignature, error) {
+
+	// Resolve the key up front so the kid header matches the key that signs
+	key, kid, err := es.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return signJWS(kid, es.SignatureAlgorithm, es.SignerOptions, payload, func(input []byte) ([]byte, error) {
+		return es.Signer.sign(es.Context, key, es.SignatureAlgorithm, input)
+	})
+}
+
+// SignInput signs the input, produced for the id of the current signing key, returning the signature.
+func (es *ExternalSigner) SignInput(input func(kid string) ([]byte, error)) ([]byte, error) {
+
+	key, kid, err := es.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signingInput, err := input(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	return es.Signer.sign(es.Context, key, es.SignatureAlgorithm, signingInput)
+}
+
+// signingKey returns the current signing key and its id.
+func (es *ExternalSigner) signingKey() (*externalKey, string, error) {
+	key, err := es.Signer.currentKey(es.Context)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !key.supports(es.SignatureAlgorithm) {
+		return nil, "", errutil.UserError{Err: fmt.Sprintf("signing key '%s' does not support the %s algorithm", key.ID, es.SignatureAlgorithm)}
+	}
+
+	kid := key.ID
+	if es.KeyIDConfig != nil {
+		kid = keyId(es.KeyIDConfig, key.PublicKey, 0, key.ID)
+	}
+
+	return key, kid, nil
+}
+
+func (es *ExternalSigner) Options() jose.SignerOptions {
+	return *es.SignerOptions
+}
+
+// signJWS assembles a JWS for the payload, using sign to produce the signature over the signing input.
+func signJWS(kid string, alg jose.SignatureAlgorithm, options *jose.SignerOptions, payload []byte, sign func([]byte) ([]byte, error)) (*jose.JSONWebSignature, error) {
+
+	protected := map[jose.HeaderKey]interface{}{
+		"kid": kid,
+		"alg": string(alg),
+	}
+	for k, v := range options.ExtraHeaders {
+		switch k {
+		case headerB64, headerCritical:
+			// RFC 7797 unencoded payload headers keep their types
+			protected[k] = v
+		default:
+			protected[k] = fmt.Sprintf("%s", v)
+		}
+	}
+
+	serializedProtected, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	var input bytes.Buffer
+
+	input.WriteString(base64.RawURLEncoding.EncodeToString(serializedProtected))
+	input.WriteByte('.')
+	if b64, ok := options.ExtraHeaders[headerB64].(bool); ok && !b64 {
+		input.Write(payload)
+	} else {
+		input.WriteString(base64.RawURLEncoding.EncodeToString(payload))
+	}
+
+	signature, err := sign(input.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	encodedSignature, err := json.Marshal(map[string]interface{}{
+		"payload":   base64.RawURLEncoding.EncodeToString(payload),
+		"protected": base64.RawURLEncoding.EncodeToString(serializedProtected),
+		"signatures": []map[string]interface{}{
+			{
+				"protected": base64.RawURLEncoding.EncodeToString(serializedProtected),
+				"signature": base64.RawURLEncoding.EncodeToString(signature),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jose.ParseSigned(bytes.NewBuffer(encodedSignature).String())
+}
+
+// keyAlgorithms returns the signature algorithms that can be used with a public key.
+func keyAlgorithms(publicKey crypto.PublicKey) []jose.SignatureAlgorithm {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return []jose.SignatureAlgorithm{jose.ES256}
+		case elliptic.P384():
+			return []jose.SignatureAlgorithm{jose.ES384}
+		case elliptic.P521():
+			return []jose.SignatureAlgorithm{jose.ES512}
+		case secp256k1.S256():
+			return []jose.SignatureAlgorithm{ES256K}
+		}
+	case ed25519.PublicKey:
+		return []jose.SignatureAlgorithm{jose.EdDSA}
+	}
+	return nil
+}
+
+// algorithmSupported checks if the signature algorithm can be used with the public key.
+func algorithmSupported(publicKey crypto.PublicKey, alg jose.SignatureAlgorithm) bool {
+	for _, keyAlg := range keyAlgorithms(publicKey) {
+		if keyAlg == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureDigest hashes the signing input with the hash function used by the signature algorithm.
+func signatureDigest(alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+	hash, err := signatureHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := hash.New()
+
+	// According to documentation, Write() on hash never fails
+	_, _ = hasher.Write(input)
+
+	return hasher.Sum(nil), nil
+}
+
+// jwsSignature converts a signature produced by an external signer to its JWS form; ECDSA
+// signatures are converted from ASN.1 DER to the fixed size R || S format.
+func jwsSignature(publicKey crypto.PublicKey, signature []byte) ([]byte, error) {
+	ecKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return signature, nil
+	}
+
+	var derSignature struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(signature, &derSignature); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("invalid ecdsa signature: %v", err)}
+	}
+
+	size := (ecKey.Curve.Params().BitSize + 7) / 8
+
+	jwsSig := make([]byte, 2*size)
+	derSignature.R.FillBytes(jwsSig[:size])
+	derSignature.S.FillBytes(jwsSig[size:])
+
+	return jwsSig, nil
+}
+
+// signatureHash returns the hash function used by a signature algorithm.
+func signatureHash(alg jose.SignatureAlgorithm) (crypto.Hash, error) {
+	switch alg {
+	case jose.RS256, jose.ES256, jose.HS256, ES256K:
+		return crypto.SHA256, nil
+	case jose.RS384, jose.ES384, jose.HS384:
+		return crypto.SHA384, nil
+	case jose.RS512, jose.ES512, jose.HS512:
+		return crypto.SHA512, nil
+	default:
+		return 0, errutil.InternalError{Err: fmt.Sprintf("unsupported signature algorithm: %s", alg)}
+	}
+}
+
+// cachedToken caches the access token used to authenticate to a cloud KMS.
+type cachedToken struct {
+	lock   sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// get returns the cached token, using fetch to obtain a new one when missing or about to expire.
+func (ct *cachedToken) get(fetch func() (string, time.Time, error)) (string, error) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+
+	if ct.token != "" && time.Now().Add(time.Minute).Before(ct.expiry) {
+		return ct.token, nil
+	}
+
+	token, expiry, err := fetch()
+	if err != nil {
+		return "", err
+	}
+
+	ct.token = token
+	ct.expiry = expiry
+
+	return token, nil
+}
+
+// maxResponseSize bounds the responses read from external services (KMS, OPA & issuers); responses are small JSON
+// documents, so larger responses are rejected rather than buffered.
+const maxResponseSize = 1 << 20
+
+// readResponse reads the body of a response from an external service, failing when it exceeds maxResponseSize.
+func readResponse(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxResponseSize)
+	}
+	return body, nil
+}
@@ -0,0 +1,194 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"gopkg.in/square/go-jose.v2"
+	"path"
+	"sync"
+)
+
+// AWSKMSConfig holds the configuration of the AWS KMS signer.
+type AWSKMSConfig struct {
+	// KeyID is the id or ARN of the asymmetric KMS key used to sign tokens.
+	KeyID string
+
+	// Region of the KMS key; defaults to the region of the AWS SDK's default configuration (e.g. AWS_REGION).
+	Region string
+
+	// AccessKeyID used to authenticate, instead of the AWS SDK's default credential chain.
+	AccessKeyID string
+
+	// SecretAccessKey used to authenticate, with AccessKeyID.
+	SecretAccessKey string
+
+	// SessionToken used to authenticate with temporary credentials, with AccessKeyID.
+	SessionToken string
+
+	// Endpoint overrides the KMS endpoint (e.g. for VPC endpoints).
+	Endpoint string
+}
+
+// awsKMSSigner signs using an asymmetric AWS KMS key.
+type awsKMSSigner struct {
+	backendId string
+	keyID     string
+	client    *kms.Client
+
+	// KMS public keys are immutable; cache after first retrieval
+	publicKeyLock sync.Mutex
+	publicKey     *externalKey
+}
+
+func newAWSKMSSigner(backendId string, config *AWSKMSConfig) (externalSigner, error) {
+	if config == nil || config.KeyID == "" {
+		return nil, errutil.UserError{Err: "awskms signer requires a key id"}
+	}
+
+	var options []func(*awsconfig.LoadOptions) error
+	if config.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Region))
+	}
+
+	// explicit keys override the default credential chain (environment, shared files, web identity,
+	// container & instance roles), whose credentials are refreshed by the SDK as they expire
+	if config.AccessKeyID != "" || config.SecretAccessKey != "" {
+		if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+			return nil, errutil.UserError{Err: "awskms signer requires both an access key id and secret access key"}
+		}
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, config.SessionToken),
+		))
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("awskms signer failed to load the AWS configuration: %s", err)}
+	}
+
+	if awsConfig.Region == "" {
+		return nil, errutil.UserError{Err: "awskms signer requires a region"}
+	}
+
+	client := kms.NewFromConfig(awsConfig, func(o *kms.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+
+	return &awsKMSSigner{
+		backendId: backendId,
+		keyID:     config.KeyID,
+		client:    client,
+	}, nil
+}
+
+func (ks *awsKMSSigner) currentKey(ctx context.Context) (*externalKey, error) {
+	ks.publicKeyLock.Lock()
+	defer ks.publicKeyLock.Unlock()
+
+	if ks.publicKey != nil {
+		return ks.publicKey, nil
+	}
+
+	output, err := ks.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(ks.keyID)})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.KeyUsage != kmstypes.KeyUsageTypeSignVerify {
+		return nil, errutil.UserError{Err: fmt.Sprintf("kms key '%s' is not an asymmetric signing key", ks.keyID)}
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(output.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// KMS keys are identified by their ARN, which is stable and unique
+	keyArn := firstNonEmpty(aws.ToString(output.KeyId), ks.keyID)
+
+	ks.publicKey = &externalKey{
+		ID:        createKeyId(ks.backendId, path.Join(SignerTypeAWSKMS, keyArn), 1),
+		Version:   keyArn,
+		PublicKey: publicKey,
+	}
+
+	return ks.publicKey, nil
+}
+
+func (ks *awsKMSSigner) sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+
+	var signingAlgorithm kmstypes.SigningAlgorithmSpec
+	switch alg {
+	case jose.RS256:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecRsassaPkcs1V15Sha256
+	case jose.RS384:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecRsassaPkcs1V15Sha384
+	case jose.RS512:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecRsassaPkcs1V15Sha512
+	case jose.ES256:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecEcdsaSha256
+	case jose.ES384:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecEcdsaSha384
+	case jose.ES512:
+		signingAlgorithm = kmstypes.SigningAlgorithmSpecEcdsaSha512
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported signature algorithm: %s", alg)}
+	}
+
+	digest, err := signatureDigest(alg, input)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := ks.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(key.Version),
+		Message:          digest,
+		MessageType:      kmstypes.MessageTypeDigest,
+		SigningAlgorithm: signingAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// KMS produces ASN.1 DER encoded ECDSA signatures
+	return jwsSignature(key.PublicKey, output.Signature)
+}
+
+func (ks *awsKMSSigner) publicKeys(ctx context.Context) ([]jose.JSONWebKey, error) {
+	key, err := ks.currentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []jose.JSONWebKey{
+		{
+			Key:   key.PublicKey,
+			KeyID: key.ID,
+		},
+	}, nil
+}
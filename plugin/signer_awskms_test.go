@@ -0,0 +1,184 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const testKMSKeyArn = "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+// newFakeKMS starts a server emulating the KMS GetPublicKey & Sign operations for an ECC_NIST_P256 key.
+func newFakeKMS(t *testing.T) *httptest.Server {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"KeyId":     testKMSKeyArn,
+				"KeyUsage":  "SIGN_VERIFY",
+				"PublicKey": base64.StdEncoding.EncodeToString(publicKeyDER),
+			})
+		case "TrentService.Sign":
+			if body["MessageType"] != "DIGEST" || body["SigningAlgorithm"] != "ECDSA_SHA_256" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			digest, err := base64.StdEncoding.DecodeString(body["Message"])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"KeyId":     testKMSKeyArn,
+				"Signature": base64.StdEncoding.EncodeToString(signature),
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	kms := newFakeKMS(t)
+	defer kms.Close()
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:        SignerTypeAWSKMS,
+		keyAWSKMSKeyID:       "alias/jwt",
+		keyAWSKMSRegion:      "us-east-1",
+		keyAWSKMSAccessKeyID: "AKIDEXAMPLE",
+		keyAWSKMSSecretKey:   "secret",
+		keyAWSKMSEndpoint:    kms.URL,
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if _, ok := resp.Data[keyAWSKMSSecretKey]; ok {
+		t.Error("secret access key should not be returned")
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{"sub": "Zapp Brannigan"}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("Zapp Brannigan", decoded.Subject); diff != nil {
+		t.Error(diff)
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+}
+
+func TestAWSKMSSignerDefaultCredentials(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	kms := newFakeKMS(t)
+	defer kms.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:     SignerTypeAWSKMS,
+		keyAWSKMSKeyID:    "alias/jwt",
+		keyAWSKMSEndpoint: kms.URL,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{"sub": "Zapp Brannigan"}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+}
+
+func TestAWSKMSSignerRequiresKeyID(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:   SignerTypeAWSKMS,
+		keyAWSKMSRegion: "us-east-1",
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+}
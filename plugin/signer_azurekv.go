@@ -0,0 +1,404 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"gopkg.in/square/go-jose.v2"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureKeyVaultAPIVersion = "7.4"
+
+	azureDefaultAuthorityHost = "https://login.microsoftonline.com/"
+	azureIMDSTokenEndpoint    = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	azureKeyVaultResource   = "https://vault.azure.net"
+	azureManagedHSMResource = "https://managedhsm.azure.net"
+)
+
+// AzureKeyVaultConfig holds the configuration of the Azure Key Vault signer.
+type AzureKeyVaultConfig struct {
+	// VaultURL is the URL of the Key Vault or Managed HSM (e.g. https://myvault.vault.azure.net).
+	VaultURL string
+
+	// KeyName is the name of the key used to sign tokens.
+	KeyName string
+
+	// TenantID of the service principal; defaults to the AZURE_TENANT_ID environment variable.
+	TenantID string
+
+	// ClientID of the service principal or user assigned managed identity; defaults to the
+	// AZURE_CLIENT_ID environment variable.
+	ClientID string
+
+	// ClientSecret of the service principal; defaults to the AZURE_CLIENT_SECRET environment
+	// variable. When not available, the managed identity of the Vault server is used.
+	ClientSecret string
+}
+
+// azureKeyVaultSigner signs using a key held by Azure Key Vault or Managed HSM; the current
+// version of the key signs new tokens.
+type azureKeyVaultSigner struct {
+	backendId    string
+	vaultURL     string
+	keyName      string
+	resource     string
+	tenantID     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	token        cachedToken
+
+	// Key versions are immutable; cache after first retrieval
+	keyCacheLock sync.Mutex
+	keyCache     map[string]*externalKey
+}
+
+func newAzureKeyVaultSigner(backendId string, config *AzureKeyVaultConfig) (externalSigner, error) {
+	if config == nil || config.VaultURL == "" || config.KeyName == "" {
+		return nil, errutil.UserError{Err: "azurekv signer requires a vault url and key name"}
+	}
+
+	vaultURL, err := url.Parse(config.VaultURL)
+	if err != nil || vaultURL.Scheme == "" || vaultURL.Host == "" {
+		return nil, errutil.UserError{Err: fmt.Sprintf("invalid azurekv vault url: %s", config.VaultURL)}
+	}
+
+	resource := azureKeyVaultResource
+	if strings.HasSuffix(vaultURL.Hostname(), ".managedhsm.azure.net") {
+		resource = azureManagedHSMResource
+	}
+
+	signer := &azureKeyVaultSigner{
+		backendId:    backendId,
+		vaultURL:     strings.TrimSuffix(config.VaultURL, "/"),
+		keyName:      config.KeyName,
+		resource:     resource,
+		tenantID:     firstNonEmpty(config.TenantID, os.Getenv("AZURE_TENANT_ID")),
+		clientID:     firstNonEmpty(config.ClientID, os.Getenv("AZURE_CLIENT_ID")),
+		clientSecret: firstNonEmpty(config.ClientSecret, os.Getenv("AZURE_CLIENT_SECRET")),
+		client:       cleanhttp.DefaultPooledClient(),
+		keyCache:     map[string]*externalKey{},
+	}
+
+	if signer.clientSecret != "" && (signer.tenantID == "" || signer.clientID == "") {
+		return nil, errutil.UserError{Err: "azurekv client credentials require a tenant id and client id"}
+	}
+
+	return signer, nil
+}
+
+// accessToken returns a token authorizing calls to Key Vault; using client credentials
+// when configured, otherwise the managed identity.
+func (as *azureKeyVaultSigner) accessToken(ctx context.Context) (string, error) {
+	return as.token.get(func() (string, time.Time, error) {
+		var req *http.Request
+		var err error
+
+		if as.clientSecret != "" {
+			authorityHost := firstNonEmpty(os.Getenv("AZURE_AUTHORITY_HOST"), azureDefaultAuthorityHost)
+
+			form := url.Values{}
+			form.Set("grant_type", "client_credentials")
+			form.Set("client_id", as.clientID)
+			form.Set("client_secret", as.clientSecret)
+			form.Set("scope", as.resource+"/.default")
+
+			req, err = http.NewRequestWithContext(ctx, http.MethodPost,
+				strings.TrimSuffix(authorityHost, "/")+"/"+url.PathEscape(as.tenantID)+"/oauth2/v2.0/token",
+				strings.NewReader(form.Encode()))
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			query := url.Values{}
+			query.Set("api-version", "2018-02-01")
+			query.Set("resource", as.resource)
+			if as.clientID != "" {
+				query.Set("client_id", as.clientID)
+			}
+
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSTokenEndpoint+"?"+query.Encode(), nil)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			req.Header.Set("Metadata", "true")
+		}
+
+		// IMDS returns expires_in as a string, the identity platform as a number
+		var output struct {
+			AccessToken string      `json:"access_token"`
+			ExpiresIn   json.Number `json:"expires_in"`
+		}
+		if err := as.do(req, &output); err != nil {
+			return "", time.Time{}, fmt.Errorf("unable to obtain azurekv credentials: %w", err)
+		}
+
+		expiresIn, err := output.ExpiresIn.Int64()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		return output.AccessToken, time.Now().Add(time.Duration(expiresIn) * time.Second), nil
+	})
+}
+
+// call invokes a Key Vault API operation on the resource, relative to the key (when not absolute).
+func (as *azureKeyVaultSigner) call(ctx context.Context, method string, resource string, input interface{}, output interface{}) error {
+
+	token, err := as.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if input != nil {
+		encodedInput, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encodedInput)
+	}
+
+	if !strings.HasPrefix(resource, "https://") && !strings.HasPrefix(resource, "http://") {
+		resource = as.vaultURL + "/keys/" + url.PathEscape(as.keyName) + resource
+	}
+
+	resourceURL, err := url.Parse(resource)
+	if err != nil {
+		return err
+	}
+	query := resourceURL.Query()
+	query.Set("api-version", azureKeyVaultAPIVersion)
+	resourceURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, resourceURL.String(), body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return as.do(req, output)
+}
+
+func (as *azureKeyVaultSigner) do(req *http.Request, output interface{}) error {
+	resp, err := as.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var azureErr struct {
+			Error json.RawMessage `json:"error"`
+		}
+		_ = json.Unmarshal(respBody, &azureErr)
+		return fmt.Errorf("azurekv request failed (%d): %s", resp.StatusCode, azureErr.Error)
+	}
+
+	return json.Unmarshal(respBody, output)
+}
+
+// azureKeyBundle is the subset of a Key Vault key bundle used by the signer.
+type azureKeyBundle struct {
+	Key struct {
+		KeyID string `json:"kid"`
+		Kty   string `json:"kty"`
+		Crv   string `json:"crv"`
+		N     string `json:"n"`
+		E     string `json:"e"`
+		X     string `json:"x"`
+		Y     string `json:"y"`
+	} `json:"key"`
+	Attributes struct {
+		Enabled bool  `json:"enabled"`
+		Created int64 `json:"created"`
+	} `json:"attributes"`
+}
+
+// bundleKey converts a key bundle to a key, caching the result.
+func (as *azureKeyVaultSigner) bundleKey(bundle *azureKeyBundle) (*externalKey, error) {
+	as.keyCacheLock.Lock()
+	defer as.keyCacheLock.Unlock()
+
+	if key, ok := as.keyCache[bundle.Key.KeyID]; ok {
+		return key, nil
+	}
+
+	decode := func(value string) *big.Int {
+		decoded, _ := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		return new(big.Int).SetBytes(decoded)
+	}
+
+	var publicKey interface{}
+	switch bundle.Key.Kty {
+	case "RSA", "RSA-HSM":
+		publicKey = &rsa.PublicKey{N: decode(bundle.Key.N), E: int(decode(bundle.Key.E).Int64())}
+	case "EC", "EC-HSM":
+		var curve elliptic.Curve
+		switch bundle.Key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errutil.UserError{Err: fmt.Sprintf("azurekv key curve '%s' is not supported", bundle.Key.Crv)}
+		}
+		publicKey = &ecdsa.PublicKey{Curve: curve, X: decode(bundle.Key.X), Y: decode(bundle.Key.Y)}
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("azurekv key type '%s' is not supported", bundle.Key.Kty)}
+	}
+
+	key := &externalKey{
+		ID:        createKeyId(as.backendId, path.Join(SignerTypeAzureKV, bundle.Key.KeyID), 1),
+		Version:   bundle.Key.KeyID,
+		PublicKey: publicKey,
+	}
+
+	as.keyCache[bundle.Key.KeyID] = key
+
+	return key, nil
+}
+
+func (as *azureKeyVaultSigner) currentKey(ctx context.Context) (*externalKey, error) {
+	var bundle azureKeyBundle
+	if err := as.call(ctx, http.MethodGet, "", nil, &bundle); err != nil {
+		return nil, err
+	}
+
+	if !bundle.Attributes.Enabled {
+		return nil, errutil.UserError{Err: fmt.Sprintf("azurekv key '%s' is disabled", as.keyName)}
+	}
+
+	return as.bundleKey(&bundle)
+}
+
+func (as *azureKeyVaultSigner) sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+
+	digest, err := signatureDigest(alg, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key Vault uses the JWA algorithm names & produces JWS formatted signatures
+	var output struct {
+		Value string `json:"value"`
+	}
+	err = as.call(ctx, http.MethodPost, key.Version+"/sign", map[string]string{
+		"alg":   string(alg),
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(output.Value, "="))
+}
+
+func (as *azureKeyVaultSigner) publicKeys(ctx context.Context) ([]jose.JSONWebKey, error) {
+
+	type keyItem struct {
+		KeyID      string `json:"kid"`
+		Attributes struct {
+			Enabled bool  `json:"enabled"`
+			Created int64 `json:"created"`
+		} `json:"attributes"`
+	}
+
+	var items []keyItem
+
+	nextLink := "/versions"
+	for nextLink != "" {
+		var output struct {
+			Value    []keyItem `json:"value"`
+			NextLink string    `json:"nextLink"`
+		}
+		if err := as.call(ctx, http.MethodGet, nextLink, nil, &output); err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Value {
+			if item.Attributes.Enabled {
+				items = append(items, item)
+			}
+		}
+
+		nextLink = output.NextLink
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Attributes.Created < items[j].Attributes.Created
+	})
+
+	keys := make([]jose.JSONWebKey, 0, len(items))
+	for _, item := range items {
+		as.keyCacheLock.Lock()
+		key, ok := as.keyCache[item.KeyID]
+		as.keyCacheLock.Unlock()
+
+		if !ok {
+			var bundle azureKeyBundle
+			if err := as.call(ctx, http.MethodGet, item.KeyID, nil, &bundle); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if key, err = as.bundleKey(&bundle); err != nil {
+				return nil, err
+			}
+		}
+
+		keys = append(keys, jose.JSONWebKey{
+			Key:   key.PublicKey,
+			KeyID: key.ID,
+		})
+	}
+
+	return keys, nil
+}
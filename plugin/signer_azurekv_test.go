@@ -0,0 +1,203 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// newFakeAzureKeyVault starts a server emulating the identity platform token endpoint and the
+// Key Vault key endpoints for an EC P-256 key.
+func newFakeAzureKeyVault(t *testing.T, keyName string) *httptest.Server {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	server := httptest.NewUnstartedServer(nil)
+
+	keyVersion := "0123456789abcdef"
+	keyPath := "/keys/" + keyName
+
+	keyBundle := func() map[string]interface{} {
+		return map[string]interface{}{
+			"key": map[string]interface{}{
+				"kid": "http://" + server.Listener.Addr().String() + keyPath + "/" + keyVersion,
+				"kty": "EC-HSM",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))),
+			},
+			"attributes": map[string]interface{}{
+				"enabled": true,
+				"created": 1600000000,
+			},
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-token",
+			"expires_in":   3600,
+		})
+	})
+
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("api-version") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}
+	}
+
+	mux.HandleFunc(keyPath, authorized(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keyBundle())
+	}))
+
+	mux.HandleFunc(keyPath+"/versions", authorized(func(w http.ResponseWriter, r *http.Request) {
+		bundle := keyBundle()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"value": []map[string]interface{}{
+				{
+					"kid":        bundle["key"].(map[string]interface{})["kid"],
+					"attributes": bundle["attributes"],
+				},
+			},
+		})
+	}))
+
+	mux.HandleFunc(keyPath+"/"+keyVersion, authorized(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keyBundle())
+	}))
+
+	mux.HandleFunc(keyPath+"/"+keyVersion+"/sign", authorized(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Alg   string `json:"alg"`
+			Value string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Alg != "ES256" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		digest, err := base64.RawURLEncoding.DecodeString(body.Value)
+		if err != nil || len(digest) != crypto.SHA256.Size() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sigR, sigS, err := ecdsa.Sign(rand.Reader, privateKey, digest)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		signature := make([]byte, 64)
+		sigR.FillBytes(signature[:32])
+		sigS.FillBytes(signature[32:])
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"kid":   keyBundle()["key"].(map[string]interface{})["kid"],
+			"value": base64.RawURLEncoding.EncodeToString(signature),
+		})
+	}))
+
+	server.Config.Handler = mux
+	server.Start()
+
+	return server
+}
+
+func TestAzureKeyVaultSigner(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	keyVault := newFakeAzureKeyVault(t, "jwt")
+	defer keyVault.Close()
+
+	t.Setenv("AZURE_AUTHORITY_HOST", keyVault.URL)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:          SignerTypeAzureKV,
+		keyAzureKVVaultURL:     keyVault.URL,
+		keyAzureKVKeyName:      "jwt",
+		keyAzureKVTenantID:     "tenant",
+		keyAzureKVClientID:     "client",
+		keyAzureKVClientSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if _, ok := resp.Data[keyAzureKVClientSecret]; ok {
+		t.Error("client secret should not be returned")
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{"sub": "Zapp Brannigan"}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("Zapp Brannigan", decoded.Subject); diff != nil {
+		t.Error(diff)
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+}
+
+func TestAzureKeyVaultSignerRequiresKeyName(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:      SignerTypeAzureKV,
+		keyAzureKVVaultURL: "https://myvault.vault.azure.net",
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+}
@@ -0,0 +1,427 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultGCPKMSEndpoint is the endpoint of the Cloud KMS API.
+	DefaultGCPKMSEndpoint = "https://cloudkms.googleapis.com/"
+
+	gcpMetadataHost = "metadata.google.internal"
+)
+
+// gcpKMSAlgorithms maps the Cloud KMS signing algorithms usable for JWS to their signature algorithm;
+// PSS and raw PKCS#1 keys produce signatures JWS verifiers will not accept.
+var gcpKMSAlgorithms = map[string]jose.SignatureAlgorithm{
+	"RSA_SIGN_PKCS1_2048_SHA256": jose.RS256,
+	"RSA_SIGN_PKCS1_3072_SHA256": jose.RS256,
+	"RSA_SIGN_PKCS1_4096_SHA256": jose.RS256,
+	"RSA_SIGN_PKCS1_4096_SHA512": jose.RS512,
+	"EC_SIGN_P256_SHA256":        jose.ES256,
+	"EC_SIGN_P384_SHA384":        jose.ES384,
+}
+
+// GCPKMSConfig holds the configuration of the Cloud KMS signer.
+type GCPKMSConfig struct {
+	// KeyName is the resource name of the asymmetric signing key
+	// (projects/*/locations/*/keyRings/*/cryptoKeys/*).
+	KeyName string
+
+	// Credentials is a service account key file (JSON); defaults to GOOGLE_APPLICATION_CREDENTIALS,
+	// or the metadata server when running on Google Cloud.
+	Credentials string
+
+	// Endpoint overrides the Cloud KMS endpoint (e.g. for Private Service Connect).
+	Endpoint string
+}
+
+// gcpServiceAccount holds the fields of a service account key file used to authenticate.
+type gcpServiceAccount struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+}
+
+// gcpKMSSigner signs using an asymmetric Cloud KMS key; the latest enabled key version signs new tokens.
+type gcpKMSSigner struct {
+	backendId      string
+	keyName        string
+	endpoint       string
+	serviceAccount *gcpServiceAccount
+	client         *http.Client
+	token          cachedToken
+
+	// Public keys of key versions are immutable; cache after first retrieval
+	keyCacheLock sync.Mutex
+	keyCache     map[string]*externalKey
+}
+
+func newGCPKMSSigner(backendId string, config *GCPKMSConfig) (externalSigner, error) {
+	if config == nil || config.KeyName == "" {
+		return nil, errutil.UserError{Err: "gcpkms signer requires a key name"}
+	}
+
+	credentials := config.Credentials
+	if credentials == "" {
+		if credentialsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); credentialsFile != "" {
+			contents, err := os.ReadFile(credentialsFile)
+			if err != nil {
+				return nil, err
+			}
+			credentials = string(contents)
+		}
+	}
+
+	var serviceAccount *gcpServiceAccount
+	if credentials != "" {
+		serviceAccount = &gcpServiceAccount{}
+		if err := json.Unmarshal([]byte(credentials), serviceAccount); err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("invalid gcpkms credentials: %v", err)}
+		}
+		if serviceAccount.Type != "service_account" || serviceAccount.ClientEmail == "" || serviceAccount.PrivateKey == "" {
+			return nil, errutil.UserError{Err: "gcpkms credentials must be a service account key"}
+		}
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultGCPKMSEndpoint
+	}
+
+	return &gcpKMSSigner{
+		backendId:      backendId,
+		keyName:        strings.Trim(config.KeyName, "/"),
+		endpoint:       strings.TrimSuffix(endpoint, "/"),
+		serviceAccount: serviceAccount,
+		client:         cleanhttp.DefaultPooledClient(),
+		keyCache:       map[string]*externalKey{},
+	}, nil
+}
+
+// accessToken returns a token authorizing calls to Cloud KMS; service accounts use a self-signed
+// JWT, otherwise a token is requested from the metadata server.
+func (gs *gcpKMSSigner) accessToken(ctx context.Context) (string, error) {
+	return gs.token.get(func() (string, time.Time, error) {
+		if gs.serviceAccount != nil {
+			return gs.selfSignedToken()
+		}
+		return gs.metadataToken(ctx)
+	})
+}
+
+func (gs *gcpKMSSigner) selfSignedToken() (string, time.Time, error) {
+	block, _ := pem.Decode([]byte(gs.serviceAccount.PrivateKey))
+	if block == nil {
+		return "", time.Time{}, errutil.UserError{Err: "gcpkms credentials contain an invalid private key"}
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", time.Time{}, errutil.UserError{Err: fmt.Sprintf("gcpkms credentials contain an invalid private key: %v", err)}
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: privateKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", gs.serviceAccount.PrivateKeyID),
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   gs.serviceAccount.ClientEmail,
+		Subject:  gs.serviceAccount.ClientEmail,
+		Audience: jwt.Audience{DefaultGCPKMSEndpoint},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(expiry),
+	}).CompactSerialize()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiry, nil
+}
+
+func (gs *gcpKMSSigner) metadataToken(ctx context.Context) (string, time.Time, error) {
+	host := firstNonEmpty(os.Getenv("GCE_METADATA_HOST"), gcpMetadataHost)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/token", host), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var output struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := gs.do(req, &output); err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to obtain gcpkms credentials from metadata server: %w", err)
+	}
+
+	return output.AccessToken, time.Now().Add(time.Duration(output.ExpiresIn) * time.Second), nil
+}
+
+// call invokes a Cloud KMS API method on the resource.
+func (gs *gcpKMSSigner) call(ctx context.Context, method string, resource string, input interface{}, output interface{}) error {
+
+	token, err := gs.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if input != nil {
+		encodedInput, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encodedInput)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, gs.endpoint+"/v1/"+resource, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return gs.do(req, output)
+}
+
+func (gs *gcpKMSSigner) do(req *http.Request, output interface{}) error {
+	resp, err := gs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var gcpErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(respBody, &gcpErr)
+		return fmt.Errorf("gcpkms request failed (%d): %s %s", resp.StatusCode, gcpErr.Error.Status, gcpErr.Error.Message)
+	}
+
+	return json.Unmarshal(respBody, output)
+}
+
+// keyVersions returns the keys of the enabled versions usable for JWS signatures, ordered by version.
+func (gs *gcpKMSSigner) keyVersions(ctx context.Context) ([]*externalKey, error) {
+
+	type cryptoKeyVersion struct {
+		Name      string `json:"name"`
+		Algorithm string `json:"algorithm"`
+	}
+
+	var versions []cryptoKeyVersion
+
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("filter", "state=ENABLED")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		var output struct {
+			CryptoKeyVersions []cryptoKeyVersion `json:"cryptoKeyVersions"`
+			NextPageToken     string             `json:"nextPageToken"`
+		}
+		if err := gs.call(ctx, http.MethodGet, gs.keyName+"/cryptoKeyVersions?"+query.Encode(), nil, &output); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, output.CryptoKeyVersions...)
+
+		if output.NextPageToken == "" {
+			break
+		}
+		pageToken = output.NextPageToken
+	}
+
+	keys := make([]*externalKey, 0, len(versions))
+	for _, version := range versions {
+		alg, ok := gcpKMSAlgorithms[version.Algorithm]
+		if !ok {
+			continue
+		}
+
+		key, err := gs.publicKey(ctx, version.Name, alg)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return gcpKeyVersion(keys[i].Version) < gcpKeyVersion(keys[j].Version)
+	})
+
+	return keys, nil
+}
+
+// publicKey returns the (cached) key of a key version.
+func (gs *gcpKMSSigner) publicKey(ctx context.Context, versionName string, alg jose.SignatureAlgorithm) (*externalKey, error) {
+	gs.keyCacheLock.Lock()
+	defer gs.keyCacheLock.Unlock()
+
+	if key, ok := gs.keyCache[versionName]; ok {
+		return key, nil
+	}
+
+	var output struct {
+		Pem string `json:"pem"`
+	}
+	if err := gs.call(ctx, http.MethodGet, versionName+"/publicKey", nil, &output); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(output.Pem))
+	if block == nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("gcpkms key version '%s' has an invalid public key", versionName)}
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &externalKey{
+		ID:         createKeyId(gs.backendId, path.Join(SignerTypeGCPKMS, gs.keyName), gcpKeyVersion(versionName)),
+		Version:    versionName,
+		PublicKey:  publicKey,
+		Algorithms: []jose.SignatureAlgorithm{alg},
+	}
+
+	gs.keyCache[versionName] = key
+
+	return key, nil
+}
+
+// gcpKeyVersion extracts the version number from a key version resource name.
+func gcpKeyVersion(versionName string) int {
+	version, _ := strconv.Atoi(path.Base(versionName))
+	return version
+}
+
+func (gs *gcpKMSSigner) currentKey(ctx context.Context) (*externalKey, error) {
+	keys, err := gs.keyVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errutil.UserError{Err: fmt.Sprintf("gcpkms key '%s' has no enabled signing key versions", gs.keyName)}
+	}
+
+	return keys[len(keys)-1], nil
+}
+
+func (gs *gcpKMSSigner) sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+
+	hash, err := signatureHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := signatureDigest(alg, input)
+	if err != nil {
+		return nil, err
+	}
+
+	digestName := strings.ReplaceAll(strings.ToLower(hash.String()), "-", "")
+
+	var output struct {
+		Signature string `json:"signature"`
+	}
+	err = gs.call(ctx, http.MethodPost, key.Version+":asymmetricSign", map[string]interface{}{
+		"digest": map[string]string{
+			digestName: base64.StdEncoding.EncodeToString(digest),
+		},
+	}, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(output.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cloud KMS produces ASN.1 DER encoded ECDSA signatures
+	return jwsSignature(key.PublicKey, signature)
+}
+
+func (gs *gcpKMSSigner) publicKeys(ctx context.Context) ([]jose.JSONWebKey, error) {
+	keys, err := gs.keyVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := make([]jose.JSONWebKey, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, jose.JSONWebKey{
+			Key:       key.PublicKey,
+			KeyID:     key.ID,
+			Algorithm: string(key.Algorithms[0]),
+		})
+	}
+
+	return jwks, nil
+}
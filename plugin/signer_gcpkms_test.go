@@ -0,0 +1,231 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const testGCPKMSKeyName = "projects/test/locations/global/keyRings/jwt/cryptoKeys/signing"
+
+// fakeGCPKMS emulates the Cloud KMS endpoints used by the signer for an EC_SIGN_P256_SHA256 key.
+type fakeGCPKMS struct {
+	*httptest.Server
+
+	lock          sync.Mutex
+	keys          []*ecdsa.PrivateKey
+	signedVersion string
+}
+
+func newFakeGCPKMS(t *testing.T) *fakeGCPKMS {
+	fake := &fakeGCPKMS{}
+	fake.rotate(t)
+
+	versionsPath := "/v1/" + testGCPKMSKeyName + "/cryptoKeyVersions"
+
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+
+		if r.URL.Path == versionsPath {
+			versions := make([]map[string]interface{}, 0, len(fake.keys))
+			for idx := range fake.keys {
+				versions = append(versions, map[string]interface{}{
+					"name":      testGCPKMSKeyName + "/cryptoKeyVersions/" + string(rune('1'+idx)),
+					"state":     "ENABLED",
+					"algorithm": "EC_SIGN_P256_SHA256",
+				})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"cryptoKeyVersions": versions})
+			return
+		}
+
+		versionPath := strings.TrimPrefix(r.URL.Path, versionsPath+"/")
+		version := strings.SplitN(strings.SplitN(versionPath, "/", 2)[0], ":", 2)[0]
+		idx := int(version[0] - '1')
+		if len(version) != 1 || idx < 0 || idx >= len(fake.keys) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		privateKey := fake.keys[idx]
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/publicKey"):
+			publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+			})
+		case strings.HasSuffix(r.URL.Path, ":asymmetricSign"):
+			var body struct {
+				Digest map[string]string `json:"digest"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			digest, err := base64.StdEncoding.DecodeString(body.Digest["sha256"])
+			if err != nil || len(digest) != 32 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			fake.signedVersion = version
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"signature": base64.StdEncoding.EncodeToString(signature),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return fake
+}
+
+// rotate adds a new key version.
+func (f *fakeGCPKMS) rotate(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.keys = append(f.keys, privateKey)
+}
+
+func testGCPCredentials(t *testing.T) string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	privateKeyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	credentials, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "jwt@test.iam.gserviceaccount.com",
+		"private_key_id": "test",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDER})),
+	})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return string(credentials)
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	kms := newFakeGCPKMS(t)
+	defer kms.Close()
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:        SignerTypeGCPKMS,
+		keyGCPKMSKeyName:     testGCPKMSKeyName,
+		keyGCPKMSCredentials: testGCPCredentials(t),
+		keyGCPKMSEndpoint:    kms.URL,
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if _, ok := resp.Data[keyGCPKMSCredentials]; ok {
+		t.Error("credentials should not be returned")
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{"sub": "Zapp Brannigan"}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("Zapp Brannigan", decoded.Subject); diff != nil {
+		t.Error(diff)
+	}
+
+	// New key versions are picked up for signing, with previous versions still published
+	kms.rotate(t)
+
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("2", kms.signedVersion); diff != nil {
+		t.Error("signing version", diff)
+	}
+
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 2); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+}
+
+func TestGCPKMSSignerRequiresKeyName(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType: SignerTypeGCPKMS,
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+}
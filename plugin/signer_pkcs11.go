@@ -0,0 +1,32 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+// PKCS11Config holds the configuration of the PKCS#11 signer.
+type PKCS11Config struct {
+	// Library is the path of the PKCS#11 module (shared library) provided by the HSM vendor.
+	Library string
+
+	// Slot is the id of the slot holding the token containing the key.
+	Slot int
+
+	// PIN of the token's user.
+	PIN string
+
+	// KeyLabel is the label (CKA_LABEL) of the key pair used to sign tokens.
+	KeyLabel string
+}
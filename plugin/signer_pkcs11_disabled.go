@@ -0,0 +1,28 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build !pkcs11
+
+package jwtsecrets
+
+import (
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// newPKCS11Signer fails as PKCS#11 requires cgo; the plugin must be built with the 'pkcs11' tag to use it.
+func newPKCS11Signer(backendId string, config *PKCS11Config) (externalSigner, error) {
+	return nil, errutil.UserError{Err: "pkcs11 signer is not available; the plugin must be built with the 'pkcs11' build tag"}
+}
@@ -0,0 +1,329 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build pkcs11
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/miekg/pkcs11"
+	"gopkg.in/square/go-jose.v2"
+	"math/big"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// PKCS#11 modules may only be initialized once per process; share them between signers
+var (
+	pkcs11ModulesLock sync.Mutex
+	pkcs11Modules     = map[string]*pkcs11.Ctx{}
+)
+
+var pkcs11CurveOIDs = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+// pkcs11Signer signs using a key pair held by an HSM, accessed through its PKCS#11 module.
+type pkcs11Signer struct {
+	backendId string
+	slot      uint
+	pin       string
+	keyLabel  string
+	module    *pkcs11.Ctx
+
+	// PKCS#11 sessions are not safe for concurrent use; operations are serialized
+	sessionLock sync.Mutex
+	session     pkcs11.SessionHandle
+	hasSession  bool
+	key         *externalKey
+	privateKey  pkcs11.ObjectHandle
+}
+
+func newPKCS11Signer(backendId string, config *PKCS11Config) (externalSigner, error) {
+	if config == nil || config.Library == "" || config.KeyLabel == "" {
+		return nil, errutil.UserError{Err: "pkcs11 signer requires a library and key label"}
+	}
+	if config.Slot < 0 {
+		return nil, errutil.UserError{Err: "pkcs11 slot must be a non-negative integer"}
+	}
+
+	module, err := loadPKCS11Module(config.Library)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkcs11Signer{
+		backendId: backendId,
+		slot:      uint(config.Slot),
+		pin:       config.PIN,
+		keyLabel:  config.KeyLabel,
+		module:    module,
+	}, nil
+}
+
+func loadPKCS11Module(library string) (*pkcs11.Ctx, error) {
+	pkcs11ModulesLock.Lock()
+	defer pkcs11ModulesLock.Unlock()
+
+	if module, ok := pkcs11Modules[library]; ok {
+		return module, nil
+	}
+
+	module := pkcs11.New(library)
+	if module == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unable to load pkcs11 library '%s'", library)}
+	}
+
+	if err := module.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		module.Destroy()
+		return nil, fmt.Errorf("unable to initialize pkcs11 library: %w", err)
+	}
+
+	pkcs11Modules[library] = module
+
+	return module, nil
+}
+
+// open opens & logs into a session, locating the key pair; the caller must hold the session lock.
+func (ps *pkcs11Signer) open() error {
+	if ps.hasSession {
+		return nil
+	}
+
+	session, err := ps.module.OpenSession(ps.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("unable to open pkcs11 session: %w", err)
+	}
+
+	if ps.pin != "" {
+		err = ps.module.Login(session, pkcs11.CKU_USER, ps.pin)
+		if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			_ = ps.module.CloseSession(session)
+			return fmt.Errorf("unable to login to pkcs11 token: %w", err)
+		}
+	}
+
+	privateKey, err := ps.findObject(session, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		_ = ps.module.CloseSession(session)
+		return err
+	}
+
+	publicKeyObject, err := ps.findObject(session, pkcs11.CKO_PUBLIC_KEY)
+	if err != nil {
+		_ = ps.module.CloseSession(session)
+		return err
+	}
+
+	publicKey, err := ps.readPublicKey(session, publicKeyObject)
+	if err != nil {
+		_ = ps.module.CloseSession(session)
+		return err
+	}
+
+	ps.session = session
+	ps.hasSession = true
+	ps.privateKey = privateKey
+	ps.key = &externalKey{
+		ID:        createKeyId(ps.backendId, path.Join(SignerTypePKCS11, strconv.Itoa(int(ps.slot)), ps.keyLabel), 1),
+		Version:   ps.keyLabel,
+		PublicKey: publicKey,
+	}
+
+	return nil
+}
+
+// reset closes the session, so the next operation reopens it (e.g. after the HSM was restarted).
+func (ps *pkcs11Signer) reset() {
+	if ps.hasSession {
+		_ = ps.module.CloseSession(ps.session)
+	}
+	ps.hasSession = false
+	ps.key = nil
+}
+
+func (ps *pkcs11Signer) findObject(session pkcs11.SessionHandle, class uint) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, ps.keyLabel),
+	}
+	if err := ps.module.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+
+	objects, _, err := ps.module.FindObjects(session, 1)
+	if finalErr := ps.module.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if len(objects) == 0 {
+		return 0, errutil.UserError{Err: fmt.Sprintf("pkcs11 key pair '%s' not found", ps.keyLabel)}
+	}
+
+	return objects[0], nil
+}
+
+func (ps *pkcs11Signer) readPublicKey(session pkcs11.SessionHandle, object pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attributes, err := ps.module.GetAttributeValue(session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attribute values are natively encoded; compare with the library's encoding of the key types
+	keyType := attributes[0].Value
+	switch {
+	case bytes.Equal(keyType, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA).Value):
+		attributes, err = ps.module.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attributes[0].Value),
+			E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+		}, nil
+
+	case bytes.Equal(keyType, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC).Value):
+		attributes, err = ps.module.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var curveOID asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attributes[0].Value, &curveOID); err != nil {
+			return nil, err
+		}
+
+		curve, ok := pkcs11CurveOIDs[curveOID.String()]
+		if !ok {
+			return nil, errutil.UserError{Err: fmt.Sprintf("pkcs11 key curve '%s' is not supported", curveOID)}
+		}
+
+		// The point is DER encoded as an OCTET STRING
+		var point []byte
+		if _, err := asn1.Unmarshal(attributes[1].Value, &point); err != nil {
+			return nil, err
+		}
+
+		//nolint:staticcheck // Only uncompressed points are supported by PKCS#11
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errutil.InternalError{Err: "pkcs11 key has an invalid ec point"}
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("pkcs11 key '%s' is not an RSA or EC key", ps.keyLabel)}
+	}
+}
+
+func (ps *pkcs11Signer) currentKey(ctx context.Context) (*externalKey, error) {
+	ps.sessionLock.Lock()
+	defer ps.sessionLock.Unlock()
+
+	if err := ps.open(); err != nil {
+		return nil, err
+	}
+
+	return ps.key, nil
+}
+
+func (ps *pkcs11Signer) sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+
+	var mechanism uint
+	var message []byte
+	switch alg {
+	case jose.RS256:
+		mechanism, message = pkcs11.CKM_SHA256_RSA_PKCS, input
+	case jose.RS384:
+		mechanism, message = pkcs11.CKM_SHA384_RSA_PKCS, input
+	case jose.RS512:
+		mechanism, message = pkcs11.CKM_SHA512_RSA_PKCS, input
+	case jose.ES256, jose.ES384, jose.ES512:
+		// Many HSMs lack the combined hash & sign ECDSA mechanisms; hash locally
+		digest, err := signatureDigest(alg, input)
+		if err != nil {
+			return nil, err
+		}
+		mechanism, message = pkcs11.CKM_ECDSA, digest
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported signature algorithm: %s", alg)}
+	}
+
+	ps.sessionLock.Lock()
+	defer ps.sessionLock.Unlock()
+
+	if err := ps.open(); err != nil {
+		return nil, err
+	}
+
+	if ps.key.ID != key.ID {
+		return nil, errutil.InternalError{Err: "pkcs11 key changed while signing"}
+	}
+
+	err := ps.module.SignInit(ps.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, ps.privateKey)
+	if err != nil {
+		ps.reset()
+		return nil, err
+	}
+
+	// PKCS#11 produces ECDSA signatures in the R || S format used by JWS
+	signature, err := ps.module.Sign(ps.session, message)
+	if err != nil {
+		ps.reset()
+		return nil, err
+	}
+
+	return signature, nil
+}
+
+func (ps *pkcs11Signer) publicKeys(ctx context.Context) ([]jose.JSONWebKey, error) {
+	key, err := ps.currentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []jose.JSONWebKey{
+		{
+			Key:   key.PublicKey,
+			KeyID: key.ID,
+		},
+	}, nil
+}
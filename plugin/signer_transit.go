@@ -0,0 +1,249 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"gopkg.in/square/go-jose.v2"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTransitMount is the default mount path of the Transit secrets engine.
+const DefaultTransitMount = "transit"
+
+// TransitConfig holds the configuration of the Transit signer.
+type TransitConfig struct {
+	// Address of the Vault server hosting the Transit secrets engine; defaults to the VAULT_ADDR environment variable.
+	Address string
+
+	// Token used to authenticate to Vault; requires 'read' on the key and 'update' on the sign path.
+	Token string
+
+	// Namespace of the Transit secrets engine, if any.
+	Namespace string
+
+	// Mount is the path the Transit secrets engine is mounted at.
+	Mount string
+
+	// KeyName is the name of the Transit key used to sign tokens.
+	KeyName string
+}
+
+// transitSigner signs using an asymmetric key held by a Vault Transit secrets engine.
+type transitSigner struct {
+	backendId string
+	mount     string
+	keyName   string
+	client    *api.Client
+}
+
+func newTransitSigner(backendId string, config *TransitConfig) (externalSigner, error) {
+	if config == nil || config.KeyName == "" {
+		return nil, errutil.UserError{Err: "transit signer requires a key name"}
+	}
+
+	clientConfig := api.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, clientConfig.Error
+	}
+	if config.Address != "" {
+		clientConfig.Address = config.Address
+	}
+
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	if config.Token != "" {
+		client.SetToken(config.Token)
+	}
+	if config.Namespace != "" {
+		client.SetNamespace(config.Namespace)
+	}
+
+	mount := config.Mount
+	if mount == "" {
+		mount = DefaultTransitMount
+	}
+
+	return &transitSigner{
+		backendId: backendId,
+		mount:     strings.Trim(mount, "/"),
+		keyName:   config.KeyName,
+		client:    client,
+	}, nil
+}
+
+// readKey reads the Transit key returning the latest version and the available public keys.
+func (ts *transitSigner) readKey(ctx context.Context) (int, map[int]crypto.PublicKey, error) {
+	secret, err := ts.client.Logical().ReadWithContext(ctx, path.Join(ts.mount, "keys", ts.keyName))
+	if err != nil {
+		return 0, nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, nil, errutil.InternalError{Err: fmt.Sprintf("transit key '%s' not found", ts.keyName)}
+	}
+
+	latestVersion, err := strconv.Atoi(fmt.Sprint(secret.Data["latest_version"]))
+	if err != nil {
+		return 0, nil, errutil.InternalError{Err: "transit key has invalid latest version"}
+	}
+
+	rawKeys, ok := secret.Data["keys"].(map[string]interface{})
+	if !ok {
+		return 0, nil, errutil.InternalError{Err: "transit key has no key versions"}
+	}
+
+	publicKeys := map[int]crypto.PublicKey{}
+	for rawVersion, rawKey := range rawKeys {
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			continue
+		}
+
+		key, ok := rawKey.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		pemPublicKey, ok := key["public_key"].(string)
+		if !ok || pemPublicKey == "" {
+			return 0, nil, errutil.InternalError{Err: fmt.Sprintf("transit key '%s' is not an asymmetric signing key", ts.keyName)}
+		}
+
+		block, _ := pem.Decode([]byte(pemPublicKey))
+		if block == nil {
+			continue
+		}
+
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		publicKeys[version] = publicKey
+	}
+
+	return latestVersion, publicKeys, nil
+}
+
+func (ts *transitSigner) keyId(version int) string {
+	return createKeyId(ts.backendId, path.Join(SignerTypeTransit, ts.mount, ts.keyName), version)
+}
+
+func (ts *transitSigner) currentKey(ctx context.Context) (*externalKey, error) {
+	latestVersion, publicKeys, err := ts.readKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := publicKeys[latestVersion]
+	if !ok {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("transit key '%s' has no public key for version %d", ts.keyName, latestVersion)}
+	}
+
+	return &externalKey{
+		ID:        ts.keyId(latestVersion),
+		Version:   strconv.Itoa(latestVersion),
+		PublicKey: publicKey,
+	}, nil
+}
+
+func (ts *transitSigner) sign(ctx context.Context, key *externalKey, alg jose.SignatureAlgorithm, input []byte) ([]byte, error) {
+
+	var hashAlgorithm string
+	var sigAlgorithm string
+	switch alg {
+	case jose.RS256:
+		hashAlgorithm = "sha2-256"
+		sigAlgorithm = "pkcs1v15"
+	case jose.RS384:
+		hashAlgorithm = "sha2-384"
+		sigAlgorithm = "pkcs1v15"
+	case jose.RS512:
+		hashAlgorithm = "sha2-512"
+		sigAlgorithm = "pkcs1v15"
+	case jose.ES256:
+		hashAlgorithm = "sha2-256"
+	case jose.ES384:
+		hashAlgorithm = "sha2-384"
+	case jose.ES512:
+		hashAlgorithm = "sha2-512"
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported signature algorithm: %s", alg)}
+	}
+
+	data := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(input),
+		"key_version":          key.Version,
+		"hash_algorithm":       hashAlgorithm,
+		"marshaling_algorithm": "jws",
+	}
+	if sigAlgorithm != "" {
+		data["signature_algorithm"] = sigAlgorithm
+	}
+
+	secret, err := ts.client.Logical().WriteWithContext(ctx, path.Join(ts.mount, "sign", ts.keyName), data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errutil.InternalError{Err: "transit returned no signature"}
+	}
+
+	vaultSignature, ok := secret.Data["signature"].(string)
+	if !ok {
+		return nil, errutil.InternalError{Err: "transit returned no signature"}
+	}
+
+	encodedSignature := strings.TrimPrefix(vaultSignature, fmt.Sprintf("vault:v%s:", key.Version))
+
+	return base64.RawURLEncoding.DecodeString(encodedSignature)
+}
+
+func (ts *transitSigner) publicKeys(ctx context.Context) ([]jose.JSONWebKey, error) {
+	_, publicKeys, err := ts.readKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(publicKeys))
+	for version := range publicKeys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	keys := make([]jose.JSONWebKey, 0, len(versions))
+	for _, version := range versions {
+		keys = append(keys, jose.JSONWebKey{
+			Key:   publicKeys[version],
+			KeyID: ts.keyId(version),
+		})
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,185 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// newFakeTransit starts a server emulating the Transit key read & sign endpoints for an ECDSA P-256 key.
+func newFakeTransit(t *testing.T, keyName string) *httptest.Server {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/transit/keys/"+keyName, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"type":           "ecdsa-p256",
+				"latest_version": 1,
+				"keys": map[string]interface{}{
+					"1": map[string]interface{}{
+						"public_key": string(publicKeyPEM),
+					},
+				},
+			},
+		})
+	})
+
+	mux.HandleFunc("/v1/transit/sign/"+keyName, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		input, err := base64.StdEncoding.DecodeString(body.Input)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hasher := crypto.SHA256.New()
+		hasher.Write(input)
+
+		sigR, sigS, err := ecdsa.Sign(rand.Reader, privateKey, hasher.Sum(nil))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		signature := make([]byte, 64)
+		sigR.FillBytes(signature[:32])
+		sigS.FillBytes(signature[32:])
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"signature": "vault:v1:" + base64.RawURLEncoding.EncodeToString(signature),
+			},
+		})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestTransitSigner(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	transit := newFakeTransit(t, "jwt")
+	defer transit.Close()
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType:     SignerTypeTransit,
+		keyTransitAddress: transit.URL,
+		keyTransitToken:   "test-token",
+		keyTransitKeyName: "jwt",
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if _, ok := resp.Data[keyTransitToken]; ok {
+		t.Error("transit token should not be returned")
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	var decoded jwt.Claims
+	if err := getSignedToken(b, storage, role, map[string]interface{}{"sub": "Zapp Brannigan"}, map[string]interface{}{}, &decoded, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("Zapp Brannigan", decoded.Subject); diff != nil {
+		t.Error(diff)
+	}
+
+	// No local keys should have been generated
+	jwks, err := FetchJWKS(b, storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(len(jwks.Keys), 1); diff != nil {
+		t.Error("jwks key count", diff)
+	}
+}
+
+func TestTransitSignerAlgorithmMismatch(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	transit := newFakeTransit(t, "jwt")
+	defer transit.Close()
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignatureAlgorithm: "RS256",
+		keySignerType:         SignerTypeTransit,
+		keyTransitAddress:     transit.URL,
+		keyTransitKeyName:     "jwt",
+	})
+	if err != nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	role := "tester"
+
+	if err := writeRole(b, storage, role, role+".example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if err := getSignedToken(b, storage, role, map[string]interface{}{}, map[string]interface{}{}, nil, nil); err == nil {
+		t.Error("signing with an incompatible key should have failed")
+	}
+}
+
+func TestTransitSignerRequiresKeyName(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	resp, err := writeConfig(b, storage, map[string]interface{}{
+		keySignerType: SignerTypeTransit,
+	})
+	if err == nil {
+		t.Errorf("Should have errored but got response: %#v", resp)
+	}
+}
@@ -0,0 +1,314 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	statusListsPath     = "status-lists/"
+	statusListIndexPath = "status-list-index"
+
+	// statusListSize is the number of tokens referencing each status list; large enough that a list's
+	// requests reveal little about which token is being checked.
+	statusListSize = 1 << 17
+
+	// statusListBits is the number of bits of each token's status; tokens are either valid or invalid.
+	statusListBits = 1
+)
+
+// Statuses of tokens in status lists.
+const (
+	tokenStatusValid   = 0
+	tokenStatusInvalid = 1
+)
+
+// statusList holds the statuses of the tokens referencing a status list, statusListBits per token.
+type statusList struct {
+	Statuses []byte `json:"statuses"`
+}
+
+// statusListIndex records the next entry of the status lists to be allocated to a token.
+type statusListIndex struct {
+	List int `json:"list"`
+	Next int `json:"next"`
+}
+
+// tokenStatus references the entry of a token in a status list.
+type tokenStatus struct {
+	List  int
+	Index int
+}
+
+// statusListTokens caches signed status list tokens, by list, until they change or their ttl elapses.
+type statusListTokens struct {
+	lock   sync.Mutex
+	tokens map[int]cachedStatusListToken
+}
+
+type cachedStatusListToken struct {
+	token  string
+	expiry time.Time
+}
+
+func (c *statusListTokens) get(list int, now time.Time) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cached, ok := c.tokens[list]; ok && now.Before(cached.expiry) {
+		return cached.token
+	}
+	return ""
+}
+
+func (c *statusListTokens) put(list int, token string, expiry time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.tokens == nil {
+		c.tokens = map[int]cachedStatusListToken{}
+	}
+	c.tokens[list] = cachedStatusListToken{token: token, expiry: expiry}
+}
+
+func (c *statusListTokens) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.tokens = nil
+}
+
+// allocateTokenStatus allocates the next entry of the status lists to a token; entries are never reused.
+func (b *backend) allocateTokenStatus(ctx context.Context, stg logical.Storage) (tokenStatus, error) {
+	b.statusListLock.Lock()
+	defer b.statusListLock.Unlock()
+
+	index, err := getStatusListIndex(ctx, stg)
+	if err != nil {
+		return tokenStatus{}, err
+	}
+
+	if index.Next >= statusListSize {
+		index.List++
+		index.Next = 0
+	}
+
+	status := tokenStatus{List: index.List, Index: index.Next}
+	index.Next++
+
+	entry, err := logical.StorageEntryJSON(statusListIndexPath, index)
+	if err != nil {
+		return tokenStatus{}, err
+	}
+	if err := stg.Put(ctx, entry); err != nil {
+		return tokenStatus{}, err
+	}
+
+	return status, nil
+}
+
+// getStatusListIndex returns the next entry of the status lists to be allocated.
+func getStatusListIndex(ctx context.Context, stg logical.Storage) (*statusListIndex, error) {
+	var index statusListIndex
+
+	entry, err := stg.Get(ctx, statusListIndexPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&index); err != nil {
+			return nil, err
+		}
+	}
+
+	return &index, nil
+}
+
+// getStatusList returns the statuses of a status list, or nil when no entries of the list have been allocated.
+func (b *backend) getStatusList(ctx context.Context, stg logical.Storage, list int) ([]byte, error) {
+	index, err := getStatusListIndex(ctx, stg)
+	if err != nil {
+		return nil, err
+	}
+	if list < 0 || list > index.List || (list == index.List && index.Next == 0) {
+		return nil, nil
+	}
+
+	return loadStatusList(ctx, stg, list)
+}
+
+// loadStatusList returns the statuses of a status list; lists are stored once a token's status changes.
+func loadStatusList(ctx context.Context, stg logical.Storage, list int) ([]byte, error) {
+	entry, err := stg.Get(ctx, statusListsPath+strconv.Itoa(list))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return make([]byte, statusListSize*statusListBits/8), nil
+	}
+
+	var stored statusList
+	if err := entry.DecodeJSON(&stored); err != nil {
+		return nil, err
+	}
+
+	return stored.Statuses, nil
+}
+
+// setTokenStatus changes the status of a token in its status list.
+func (b *backend) setTokenStatus(ctx context.Context, stg logical.Storage, status tokenStatus, value byte) error {
+	if status.Index < 0 || status.Index >= statusListSize {
+		return nil
+	}
+
+	b.statusListLock.Lock()
+	defer b.statusListLock.Unlock()
+
+	statuses, err := loadStatusList(ctx, stg, status.List)
+	if err != nil {
+		return err
+	}
+
+	if statusAt(statuses, status.Index) == value {
+		return nil
+	}
+
+	// The first token's status is held by the least significant bit of the first byte
+	mask := byte(1) << (status.Index % 8)
+	if value == tokenStatusInvalid {
+		statuses[status.Index/8] |= mask
+	} else {
+		statuses[status.Index/8] &^= mask
+	}
+
+	entry, err := logical.StorageEntryJSON(statusListsPath+strconv.Itoa(status.List), &statusList{Statuses: statuses})
+	if err != nil {
+		return err
+	}
+	if err := stg.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	b.statusListTokens.clear()
+
+	return nil
+}
+
+// isTokenStatusInvalid checks if the token's status in its status list is invalid.
+func (b *backend) isTokenStatusInvalid(ctx context.Context, stg logical.Storage, status tokenStatus) (bool, error) {
+	if status.Index < 0 || status.Index >= statusListSize {
+		return false, nil
+	}
+
+	statuses, err := loadStatusList(ctx, stg, status.List)
+	if err != nil {
+		return false, err
+	}
+
+	return statusAt(statuses, status.Index) == tokenStatusInvalid, nil
+}
+
+// statusAt returns the status of the token at the index of the statuses.
+func statusAt(statuses []byte, index int) byte {
+	return (statuses[index/8] >> (index % 8)) & 1
+}
+
+// compressStatusList encodes statuses as the 'lst' member of status list tokens; DEFLATE compressed in
+// the ZLIB format, base64url encoded.
+func compressStatusList(statuses []byte) (string, error) {
+	var compressed bytes.Buffer
+
+	writer, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(statuses); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// statusListURI returns the URI of a status list, relative to the issuer of the mount.
+func statusListURI(issuer string, list int) string {
+	return strings.TrimSuffix(issuer, "/") + "/" + statusListPathPrefix + strconv.Itoa(list)
+}
+
+// statusClaim returns the 'status' claim referencing the token's entry in its status list.
+func statusClaim(issuer string, status tokenStatus) map[string]interface{} {
+	return map[string]interface{}{
+		"status_list": map[string]interface{}{
+			"idx": status.Index,
+			"uri": statusListURI(issuer, status.List),
+		},
+	}
+}
+
+// claimedStatusListURI returns the uri of the status list referenced by the 'status' claim of a token, if any.
+func claimedStatusListURI(claims map[string]interface{}) string {
+	status, _ := claims["status"].(map[string]interface{})
+	reference, _ := status["status_list"].(map[string]interface{})
+	uri, _ := reference["uri"].(string)
+	return uri
+}
+
+// claimedTokenStatus returns the status list entry referenced by the 'status' claim of a token.
+func claimedTokenStatus(claims map[string]interface{}) (tokenStatus, bool) {
+	status, ok := claims["status"].(map[string]interface{})
+	if !ok {
+		return tokenStatus{}, false
+	}
+	reference, ok := status["status_list"].(map[string]interface{})
+	if !ok {
+		return tokenStatus{}, false
+	}
+
+	uri := claimedStatusListURI(claims)
+	separator := strings.LastIndex(uri, "/"+statusListPathPrefix)
+	if separator < 0 {
+		return tokenStatus{}, false
+	}
+	list, err := strconv.Atoi(uri[separator+len(statusListPathPrefix)+1:])
+	if err != nil {
+		return tokenStatus{}, false
+	}
+
+	var index int
+	switch idx := reference["idx"].(type) {
+	case float64:
+		index = int(idx)
+	case int:
+		index = idx
+	default:
+		return tokenStatus{}, false
+	}
+
+	return tokenStatus{List: list, Index: index}, true
+}
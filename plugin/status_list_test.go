@@ -0,0 +1,207 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAllocateTokenStatus(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	first, err := b.allocateTokenStatus(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	second, err := b.allocateTokenStatus(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if diff := deep.Equal(tokenStatus{List: 0, Index: 0}, first); diff != nil {
+		t.Error("first status", diff)
+	}
+	if diff := deep.Equal(tokenStatus{List: 0, Index: 1}, second); diff != nil {
+		t.Error("second status", diff)
+	}
+
+	// Full lists roll over to the next list
+	entry, err := logical.StorageEntryJSON(statusListIndexPath, &statusListIndex{List: 0, Next: statusListSize})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if err := (*storage).Put(context.Background(), entry); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	rolled, err := b.allocateTokenStatus(context.Background(), *storage)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(tokenStatus{List: 1, Index: 0}, rolled); diff != nil {
+		t.Error("rolled over status", diff)
+	}
+}
+
+func TestSetTokenStatus(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	status := tokenStatus{List: 0, Index: 9}
+
+	if err := b.setTokenStatus(context.Background(), *storage, status, tokenStatusInvalid); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	statuses, err := loadStatusList(context.Background(), *storage, 0)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(statusListSize/8, len(statuses)); diff != nil {
+		t.Error("status list size", diff)
+	}
+	// Index 9 is the second least significant bit of the second byte
+	if diff := deep.Equal([]byte{0x00, 0x02}, statuses[:2]); diff != nil {
+		t.Error("statuses", diff)
+	}
+
+	invalid, err := b.isTokenStatusInvalid(context.Background(), *storage, status)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if !invalid {
+		t.Error("token status should be invalid")
+	}
+
+	invalid, err = b.isTokenStatusInvalid(context.Background(), *storage, tokenStatus{List: 0, Index: 8})
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if invalid {
+		t.Error("other token status should be valid")
+	}
+
+	if err := b.setTokenStatus(context.Background(), *storage, status, tokenStatusValid); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	invalid, err = b.isTokenStatusInvalid(context.Background(), *storage, status)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if invalid {
+		t.Error("reset token status should be valid")
+	}
+}
+
+func TestGetStatusList(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	// Lists are unknown until an entry is allocated
+	statuses, err := b.getStatusList(context.Background(), *storage, 0)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if statuses != nil {
+		t.Error("unallocated status list returned")
+	}
+
+	if _, err := b.allocateTokenStatus(context.Background(), *storage); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	statuses, err = b.getStatusList(context.Background(), *storage, 0)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if diff := deep.Equal(statusListSize/8, len(statuses)); diff != nil {
+		t.Error("status list size", diff)
+	}
+
+	statuses, err = b.getStatusList(context.Background(), *storage, 1)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	if statuses != nil {
+		t.Error("unallocated status list returned")
+	}
+}
+
+func TestCompressStatusList(t *testing.T) {
+	statuses := make([]byte, statusListSize/8)
+	statuses[3] = 0x81
+
+	lst, err := compressStatusList(statuses)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if decompressed := decompressStatusList(t, lst); !bytes.Equal(statuses, decompressed) {
+		t.Error("decompressed statuses differ")
+	}
+}
+
+func TestClaimedTokenStatus(t *testing.T) {
+	claims := map[string]interface{}{
+		"status": statusClaim("https://vault.example.com/v1/jwt/", tokenStatus{List: 3, Index: 42}),
+	}
+
+	status := claims["status"].(map[string]interface{})["status_list"].(map[string]interface{})
+	if diff := deep.Equal("https://vault.example.com/v1/jwt/status-list/3", status["uri"]); diff != nil {
+		t.Error("status list uri", diff)
+	}
+
+	// Claims of verified tokens are decoded from JSON
+	claims["status"].(map[string]interface{})["status_list"].(map[string]interface{})["idx"] = float64(42)
+
+	claimed, ok := claimedTokenStatus(claims)
+	if !ok {
+		t.Fatal("status claim not parsed")
+	}
+	if diff := deep.Equal(tokenStatus{List: 3, Index: 42}, claimed); diff != nil {
+		t.Error("claimed status", diff)
+	}
+
+	if _, ok := claimedTokenStatus(map[string]interface{}{"status": "valid"}); ok {
+		t.Error("malformed status claim parsed")
+	}
+}
+
+func decompressStatusList(t *testing.T, lst string) []byte {
+	compressed, err := base64.RawURLEncoding.DecodeString(lst)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+	defer reader.Close()
+
+	statuses, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	return statuses
+}
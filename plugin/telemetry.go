@@ -0,0 +1,133 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Names of the metrics emitted to the metrics sink, each prefixed with metricsPrefix.
+const (
+	metricTokensSigned       = "tokens_signed"
+	metricSignLatency        = "sign_latency"
+	metricValidationFailures = "validation_failures"
+	metricKeyAge             = "key_age_seconds"
+	metricKeyRotations       = "key_rotations"
+)
+
+// Reasons of key rotations.
+const (
+	rotationReasonScheduled = "scheduled"
+	rotationReasonKeyFormat = "key_format"
+	rotationReasonUsage     = "usage"
+	rotationReasonImport    = "import"
+)
+
+var metricsPrefix = []string{"secrets", "jwt"}
+
+// instrumentIssuance wraps an operation issuing tokens for a role, counting the tokens issued, measuring the latency
+// of issuance & counting failures by their reason; in metrics, and in the usage statistics of the role.
+func (b *backend) instrumentIssuance(operation string, callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		start := time.Now()
+
+		resp, err := callback(ctx, req, d)
+
+		failed := err != nil || (resp != nil && resp.IsError())
+		dryRun, _ := d.GetOk(keyDryRun)
+		if failed || dryRun != true {
+			b.recordRoleUsage(ctx, req.Storage, d.Get(keyRoleName).(string), !failed)
+		}
+
+		labels := []metrics.Label{
+			{Name: "mount", Value: req.MountPoint},
+			{Name: "role", Value: d.Get(keyRoleName).(string)},
+			{Name: "operation", Value: operation},
+		}
+
+		if failed {
+			labels = append(labels, metrics.Label{Name: "reason", Value: failureReason(err)})
+			metrics.IncrCounterWithLabels(metricName(metricValidationFailures), 1, labels)
+			return resp, err
+		}
+
+		// Dry runs don't issue tokens
+		if dryRun == true {
+			return resp, err
+		}
+
+		metrics.IncrCounterWithLabels(metricName(metricTokensSigned), 1, labels)
+		metrics.MeasureSinceWithLabels(metricName(metricSignLatency), start, labels)
+
+		return resp, err
+	}
+}
+
+// recordRoleUsage records an issuance, or a failure to issue, in the statistics of the role matching the name;
+// requests for unknown roles are not recorded.
+func (b *backend) recordRoleUsage(ctx context.Context, stg logical.Storage, name string, issued bool) {
+	role, roleName, _, err := b.matchRole(ctx, stg, name)
+	if err != nil || role == nil {
+		return
+	}
+	b.roleUsage.record(roleName, issued, time.Now())
+}
+
+// failureReason classifies the error of a failed issuance.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, logical.ErrRateLimitQuotaExceeded):
+		return ErrorCodeRateLimited
+	case errors.Is(err, logical.ErrPermissionDenied):
+		return ErrorCodePermissionDenied
+	case errors.Is(err, logical.ErrInvalidRequest):
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// emitKeyAge reports the age of the latest key of the keyring.
+func emitKeyAge(policy *keysutil.Policy, mount string) {
+	policy.Lock(false)
+	latestKey, ok := policy.Keys[strconv.Itoa(policy.LatestVersion)]
+	policy.Unlock()
+	if !ok {
+		return
+	}
+
+	labels := []metrics.Label{{Name: "mount", Value: mount}, {Name: "keyring", Value: policy.Name}}
+	metrics.SetGaugeWithLabels(metricName(metricKeyAge), float32(time.Since(latestKey.CreationTime).Seconds()), labels)
+}
+
+// emitKeyRotation counts a rotation of the keyring.
+func emitKeyRotation(keyring string, mount string, reason string) {
+	labels := []metrics.Label{{Name: "mount", Value: mount}, {Name: "keyring", Value: keyring}, {Name: "reason", Value: reason}}
+	metrics.IncrCounterWithLabels(metricName(metricKeyRotations), 1, labels)
+}
+
+func metricName(name string) []string {
+	return append(append([]string{}, metricsPrefix...), name)
+}
@@ -0,0 +1,71 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/go-test/deep"
+)
+
+func TestIssuanceMetrics(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	metricsConfig := metrics.DefaultConfig("")
+	metricsConfig.EnableHostname = false
+	metricsConfig.EnableRuntimeMetrics = false
+	if _, err := metrics.NewGlobal(metricsConfig, sink); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer metrics.NewGlobal(metricsConfig, &metrics.BlackholeSink{})
+
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, err := signData(b, storage, "tester", map[string]interface{}{}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+	if resp, err := signData(b, storage, "tester", map[string]interface{}{keyClaims: map[string]interface{}{"denied": true}}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("sign should have failed")
+	}
+
+	data := sink.Data()[0]
+
+	signed := data.Counters["secrets.jwt.tokens_signed;mount=test;role=tester;operation=sign"]
+	if signed.AggregateSample == nil {
+		t.Fatalf("no tokens signed metric in %v\n", data.Counters)
+	}
+	if diff := deep.Equal(2, signed.Count); diff != nil {
+		t.Error("tokens signed", diff)
+	}
+
+	latency := data.Samples["secrets.jwt.sign_latency;mount=test;role=tester;operation=sign"]
+	if latency.AggregateSample == nil || latency.Count != 2 {
+		t.Errorf("expected 2 sign latency samples in %v\n", data.Samples)
+	}
+
+	failures := data.Counters["secrets.jwt.validation_failures;mount=test;role=tester;operation=sign;reason=invalid_request"]
+	if failures.AggregateSample == nil || failures.Count != 1 {
+		t.Errorf("expected 1 validation failure in %v\n", data.Counters)
+	}
+}
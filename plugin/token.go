@@ -18,8 +18,11 @@ package jwtsecrets
 
 import (
 	"context"
+	"fmt"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"time"
 )
 
 const (
@@ -31,15 +34,44 @@ func (b *backend) token() *framework.Secret {
 		Type: jwtSecretsTokenType,
 		Fields: map[string]*framework.FieldSchema{
 			"token": {
-				Type:        framework.TypeString,
-				Description: "Signed JWT",
+				Type:         framework.TypeString,
+				Description:  "Signed JWT",
+				DisplayAttrs: sensitiveDisplayAttrs,
 			},
 		},
-		Revoke: tokenRevoke,
+		Revoke: b.tokenRevoke,
 	}
 }
 
-func tokenRevoke(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
-	// Nothing to do!
+// tokenRevoke adds the token to the revocation list, and sets its status in its status list, when its lease
+// is revoked. Leases expire with their token, in which case there is nothing to revoke.
+func (b *backend) tokenRevoke(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	exp, err := parseutil.ParseInt(req.Secret.InternalData["exp"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token expiration: %w", err)
+	}
+	expiration := time.Unix(exp, 0)
+
+	if jti, ok := req.Secret.InternalData["jti"].(string); ok && jti != "" {
+		if err := b.revokeToken(ctx, req.Storage, jti, expiration); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tokens without a jti or status list entry cannot be revoked
+	if rawList, ok := req.Secret.InternalData["status_list"]; ok && expiration.After(time.Now()) {
+		list, err := parseutil.ParseInt(rawList)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token status list: %w", err)
+		}
+		index, err := parseutil.ParseInt(req.Secret.InternalData["status_idx"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token status list index: %w", err)
+		}
+		if err := b.setTokenStatus(ctx, req.Storage, tokenStatus{List: int(list), Index: int(index)}, tokenStatusInvalid); err != nil {
+			return nil, err
+		}
+	}
+
 	return nil, nil
 }
@@ -0,0 +1,463 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"fmt"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Supported token profiles.
+const (
+	// TokenProfileJWT issues plain JWTs.
+	TokenProfileJWT = "jwt"
+
+	// TokenProfileAccessToken issues OAuth 2.0 access tokens following RFC 9068.
+	TokenProfileAccessToken = "at+jwt"
+
+	// TokenProfileJWTSVID issues SPIFFE JWT-SVIDs.
+	TokenProfileJWTSVID = "jwt-svid"
+
+	// TokenProfileVerifiableCredential issues W3C Verifiable Credentials, encoded as JWTs.
+	TokenProfileVerifiableCredential = "vc+jwt"
+
+	// TokenProfileClientAssertion issues client assertions authenticating to OAuth 2.0 token endpoints
+	// ('private_key_jwt', RFC 7523).
+	TokenProfileClientAssertion = "client-assertion"
+
+	// TokenProfileGCPWorkloadIdentity issues tokens exchangeable for Google Cloud credentials using workload
+	// identity federation.
+	TokenProfileGCPWorkloadIdentity = "gcp-workload-identity"
+
+	// TokenProfileAWSWebIdentity issues web identity tokens for assuming AWS IAM roles (AssumeRoleWithWebIdentity).
+	TokenProfileAWSWebIdentity = "aws-web-identity"
+
+	// TokenProfileKubernetes issues tokens shaped like Kubernetes projected service account tokens.
+	TokenProfileKubernetes = "kubernetes"
+
+	// TokenProfileGitHubActions issues tokens shaped like the OIDC tokens of GitHub Actions, for CI systems sharing
+	// its trust model with cloud federations.
+	TokenProfileGitHubActions = "github-actions"
+)
+
+// AllowedTokenProfiles are the supported token profiles.
+var AllowedTokenProfiles = []string{TokenProfileJWT, TokenProfileAccessToken, TokenProfileJWTSVID, TokenProfileVerifiableCredential, TokenProfileClientAssertion, TokenProfileGCPWorkloadIdentity,
+	TokenProfileAWSWebIdentity, TokenProfileKubernetes, TokenProfileGitHubActions}
+
+// JWTSVIDMaxTTL caps the lifetime of JWT-SVIDs; SPIFFE recommends short-lived JWT-SVIDs, limiting replay.
+const JWTSVIDMaxTTL = 5 * time.Minute
+
+// ClientAssertionMaxTTL caps the lifetime of client assertions, which are only presented once to the token endpoint.
+const ClientAssertionMaxTTL = time.Minute
+
+// GCPWorkloadIdentityMaxTTL caps the lifetime of workload identity tokens, which are only exchanged once for
+// Google Cloud credentials.
+const GCPWorkloadIdentityMaxTTL = time.Hour
+
+// GCPSubjectMaxLength is the maximum length, in bytes, of the 'google.subject' attribute, mapped from the 'sub' claim.
+const GCPSubjectMaxLength = 127
+
+// AWSDefaultAudience is the audience of web identity tokens, unless provided; the client id registered with IAM
+// OIDC identity providers for AWS STS.
+const AWSDefaultAudience = "sts.amazonaws.com"
+
+// Bounds of the 'sub' claim of web identity tokens, following the length constraints of the subject returned by
+// AssumeRoleWithWebIdentity.
+const (
+	AWSSubjectMinLength = 6
+	AWSSubjectMaxLength = 255
+)
+
+// tokenProfile defines the type & claim requirements of a token profile.
+type tokenProfile struct {
+	// Type is the 'typ' header of the profile's tokens.
+	Type string
+
+	// RequiredClaims must be present in the profile's tokens.
+	RequiredClaims []string
+
+	// GenerateIDs defines if the 'iat' & 'jti' claims are generated, regardless of the config.
+	GenerateIDs bool
+
+	// MaxTTL caps the lifetime of the profile's tokens, when non-zero.
+	MaxTTL time.Duration
+
+	// SignatureAlgorithms restricts the algorithms the profile's tokens can be signed with, when not empty.
+	SignatureAlgorithms []jose.SignatureAlgorithm
+
+	// Parameters are the parameters of sign requests accepted by the profile, populating its claims.
+	Parameters []string
+
+	// parameterClaims returns the claims populated from the parameters of a sign request, which can't be
+	// provided by the role or the request.
+	parameterClaims func(role *Role, parameters map[string]string) (map[string]interface{}, error)
+
+	// apply checks the claims meet the profile's requirements, in addition to the required claims, and
+	// maps claims defined by the profile.
+	applyClaims func(role *Role, claims map[string]interface{}) error
+}
+
+var tokenProfiles = map[string]*tokenProfile{
+	TokenProfileJWT: {
+		Type: "JWT",
+	},
+	TokenProfileAccessToken: {
+		Type:           "at+jwt",
+		RequiredClaims: []string{"sub", "aud", "client_id", "scope"},
+		GenerateIDs:    true,
+		applyClaims:    validateAccessTokenClaims,
+	},
+	TokenProfileJWTSVID: {
+		Type:           "JWT",
+		RequiredClaims: []string{"sub", "aud"},
+		MaxTTL:         JWTSVIDMaxTTL,
+		applyClaims:    validateJWTSVIDClaims,
+	},
+	TokenProfileVerifiableCredential: {
+		Type:           "vc+jwt",
+		RequiredClaims: []string{"vc"},
+		applyClaims:    applyVerifiableCredentialClaims,
+	},
+	TokenProfileClientAssertion: {
+		Type:           "JWT",
+		RequiredClaims: []string{"aud"},
+		GenerateIDs:    true,
+		MaxTTL:         ClientAssertionMaxTTL,
+		applyClaims:    applyClientAssertionClaims,
+	},
+	TokenProfileGCPWorkloadIdentity: {
+		Type:                "JWT",
+		RequiredClaims:      []string{"sub", "aud"},
+		GenerateIDs:         true,
+		MaxTTL:              GCPWorkloadIdentityMaxTTL,
+		SignatureAlgorithms: []jose.SignatureAlgorithm{jose.RS256, jose.ES256},
+		applyClaims:         validateGCPWorkloadIdentityClaims,
+	},
+	TokenProfileAWSWebIdentity: {
+		Type:                "JWT",
+		RequiredClaims:      []string{"sub"},
+		GenerateIDs:         true,
+		SignatureAlgorithms: []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512},
+		applyClaims:         applyAWSWebIdentityClaims,
+	},
+	TokenProfileKubernetes: {
+		Type:            "JWT",
+		RequiredClaims:  []string{"sub", "aud", kubernetesClaim},
+		GenerateIDs:     true,
+		Parameters:      kubernetesProfileParameters,
+		parameterClaims: kubernetesClaims,
+	},
+	TokenProfileGitHubActions: {
+		Type:            "JWT",
+		RequiredClaims:  []string{"sub", "aud"},
+		GenerateIDs:     true,
+		Parameters:      githubActionsParameters,
+		parameterClaims: githubActionsClaims,
+	},
+}
+
+// apply checks the claims meet the profile's requirements, and maps claims defined by the profile.
+func (p *tokenProfile) apply(role *Role, claims map[string]interface{}) error {
+	for _, claim := range p.RequiredClaims {
+		if _, ok := claims[claim]; !ok {
+			return fmt.Errorf("'%s' claim is required by the %s token profile", claim, role.tokenProfile())
+		}
+	}
+
+	if p.applyClaims == nil {
+		return nil
+	}
+
+	return p.applyClaims(role, claims)
+}
+
+// allowsAlgorithm checks if the profile's tokens can be signed with the algorithm.
+func (p *tokenProfile) allowsAlgorithm(alg jose.SignatureAlgorithm) bool {
+	if len(p.SignatureAlgorithms) == 0 {
+		return true
+	}
+	for _, allowed := range p.SignatureAlgorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ttl returns the lifetime of the profile's tokens, capping the requested lifetime.
+func (p *tokenProfile) ttl(ttl time.Duration) time.Duration {
+	if p.MaxTTL > 0 {
+		return durationMin(ttl, p.MaxTTL)
+	}
+	return ttl
+}
+
+func validateAccessTokenClaims(_ *Role, claims map[string]interface{}) error {
+	if _, ok := claims["client_id"].(string); !ok {
+		return fmt.Errorf("'client_id' claim was %T, not string", claims["client_id"])
+	}
+	if _, ok := claims["scope"].(string); !ok {
+		return fmt.Errorf("'scope' claim was %T, not a space-delimited string", claims["scope"])
+	}
+	return nil
+}
+
+func validateJWTSVIDClaims(role *Role, claims map[string]interface{}) error {
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return fmt.Errorf("'sub' claim was %T, not string", claims["sub"])
+	}
+
+	trustDomain, err := parseSPIFFEID(sub)
+	if err != nil {
+		return fmt.Errorf("'sub' claim is not a SPIFFE ID: %w", err)
+	}
+
+	if !matchPattern(anchoredPattern(role.TrustDomainPattern), trustDomain) {
+		return fmt.Errorf("validation of 'sub' claim failed (trust domain doesn't match role restriction)")
+	}
+
+	return nil
+}
+
+// applyClientAssertionClaims sets the subject to the issuer, both being the client id, and requires the
+// audience to be a single token endpoint; which must be allowed by the role (see Role.AllowedAudiences).
+func applyClientAssertionClaims(_ *Role, claims map[string]interface{}) error {
+	if sub, ok := claims["sub"]; ok && sub != claims["iss"] {
+		return fmt.Errorf("'sub' claim must match the role's issuer (the client id)")
+	}
+	claims["sub"] = claims["iss"]
+
+	if _, ok := claims["aud"].(string); !ok {
+		return fmt.Errorf("'aud' claim was %T, not a single token endpoint", claims["aud"])
+	}
+
+	return nil
+}
+
+// gcpWorkloadIdentityAudienceRegex matches the audiences of workload identity pool providers, i.e. the provider's
+// resource name, with or without the 'https:' scheme.
+var gcpWorkloadIdentityAudienceRegex = regexp.MustCompile(`^(https:)?//iam\.googleapis\.com/projects/[0-9]+/locations/global/workloadIdentityPools/[a-z0-9-]+/providers/[a-z0-9-]+$`)
+
+// validateGCPWorkloadIdentityClaims requires the audience to be a single workload identity pool provider, and the
+// subject to fit the 'google.subject' attribute.
+func validateGCPWorkloadIdentityClaims(_ *Role, claims map[string]interface{}) error {
+	aud, ok := claims["aud"].(string)
+	if !ok {
+		return fmt.Errorf("'aud' claim was %T, not a single workload identity pool provider", claims["aud"])
+	}
+	if !gcpWorkloadIdentityAudienceRegex.MatchString(aud) {
+		return fmt.Errorf("'aud' claim is not a workload identity pool provider " +
+			"(//iam.googleapis.com/projects/<number>/locations/global/workloadIdentityPools/<pool>/providers/<provider>)")
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return fmt.Errorf("'sub' claim was %T, not string", claims["sub"])
+	}
+	if len(sub) > GCPSubjectMaxLength {
+		return fmt.Errorf("'sub' claim exceeds %d bytes, the maximum length of 'google.subject'", GCPSubjectMaxLength)
+	}
+
+	return nil
+}
+
+// applyAWSWebIdentityClaims defaults the audience to AWS STS, and requires the issuer to be an HTTPS URL and the
+// subject to be within the bounds accepted by AWS.
+func applyAWSWebIdentityClaims(_ *Role, claims map[string]interface{}) error {
+	if _, ok := claims["aud"]; !ok {
+		claims["aud"] = AWSDefaultAudience
+	}
+
+	iss, _ := claims["iss"].(string)
+	if issuer, err := url.Parse(iss); err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		return fmt.Errorf("'iss' claim must be an https URL, the URL of the IAM OIDC identity provider")
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return fmt.Errorf("'sub' claim was %T, not string", claims["sub"])
+	}
+	if len(sub) < AWSSubjectMinLength || len(sub) > AWSSubjectMaxLength {
+		return fmt.Errorf("'sub' claim must be %d to %d characters", AWSSubjectMinLength, AWSSubjectMaxLength)
+	}
+
+	return nil
+}
+
+var (
+	spiffeTrustDomainRegex = regexp.MustCompile(`^[a-z0-9._-]+$`)
+	spiffePathSegmentRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+// parseSPIFFEID validates a workload SPIFFE ID (spiffe://<trust-domain>/<path>), returning its trust domain.
+func parseSPIFFEID(id string) (string, error) {
+	if !strings.HasPrefix(id, "spiffe://") {
+		return "", fmt.Errorf("scheme must be 'spiffe'")
+	}
+
+	parsed, err := url.Parse(id)
+	if err != nil {
+		return "", err
+	}
+
+	if parsed.User != nil || parsed.Port() != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.RawPath != "" {
+		return "", fmt.Errorf("user info, port, query, fragment & escapes are not permitted")
+	}
+
+	if !spiffeTrustDomainRegex.MatchString(parsed.Host) {
+		return "", fmt.Errorf("invalid trust domain '%s'", parsed.Host)
+	}
+
+	if parsed.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	for _, segment := range strings.Split(strings.TrimPrefix(parsed.Path, "/"), "/") {
+		if segment == "." || segment == ".." || !spiffePathSegmentRegex.MatchString(segment) {
+			return "", fmt.Errorf("invalid path segment '%s'", segment)
+		}
+	}
+
+	return parsed.Host, nil
+}
+
+// anchoredPattern anchors the regular expression, requiring it to match the entire value.
+func anchoredPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// W3C Verifiable Credentials contexts, one of which must be the first context of credentials.
+var verifiableCredentialContexts = []string{
+	"https://www.w3.org/2018/credentials/v1",
+	"https://www.w3.org/ns/credentials/v2",
+}
+
+// applyVerifiableCredentialClaims validates the structure of the 'vc' claim, and maps the credential's
+// properties to the registered claims following the JWT encoding of the VC data model; the issuer to
+// 'iss', the credential subject's id to 'sub', the issuance & expiration dates to 'nbf' & 'exp' and
+// the credential's id to 'jti'.
+func applyVerifiableCredentialClaims(role *Role, claims map[string]interface{}) error {
+	vc, ok := claims["vc"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("'vc' claim was %T, not object", claims["vc"])
+	}
+
+	contexts, ok := vc["@context"].([]interface{})
+	if !ok || len(contexts) == 0 {
+		return fmt.Errorf("'vc' claim requires an '@context' array")
+	}
+	if context, ok := contexts[0].(string); !ok || !stringInSlice(context, verifiableCredentialContexts) {
+		return fmt.Errorf("'vc' claim's first '@context' must be one of %s", verifiableCredentialContexts)
+	}
+
+	if !containsValue(vc["type"], "VerifiableCredential") {
+		return fmt.Errorf("'vc' claim's 'type' must include 'VerifiableCredential'")
+	}
+
+	var subjectId string
+	switch subject := vc["credentialSubject"].(type) {
+	case map[string]interface{}:
+		if rawSubjectId, ok := subject["id"]; ok {
+			if subjectId, ok = rawSubjectId.(string); !ok || subjectId == "" {
+				return fmt.Errorf("'vc' claim's credential subject 'id' must be a string")
+			}
+		}
+	case []interface{}:
+		if len(subject) == 0 {
+			return fmt.Errorf("'vc' claim requires a 'credentialSubject'")
+		}
+	default:
+		return fmt.Errorf("'vc' claim requires a 'credentialSubject'")
+	}
+
+	if issuer, ok := vc["issuer"]; ok {
+		rawIssuerId := issuer
+		if issuerObject, ok := issuer.(map[string]interface{}); ok {
+			rawIssuerId = issuerObject["id"]
+		}
+		issuerId, ok := rawIssuerId.(string)
+		if !ok {
+			return fmt.Errorf("'vc' claim's 'issuer' must be a string, or an object with a string 'id'")
+		}
+		if iss, ok := claims["iss"].(string); !ok || issuerId != iss {
+			return fmt.Errorf("'vc' claim's 'issuer' must match the role's issuer")
+		}
+	}
+
+	if subjectId != "" {
+		if rawSub, ok := claims["sub"]; ok {
+			if sub, ok := rawSub.(string); !ok || sub != subjectId {
+				return fmt.Errorf("'sub' claim must match the 'vc' claim's credential subject id")
+			}
+		}
+		claims["sub"] = subjectId
+	}
+
+	if issuanceDate, ok := vc["issuanceDate"]; ok {
+		nbf, err := parseCredentialDate(issuanceDate)
+		if err != nil {
+			return fmt.Errorf("invalid 'issuanceDate' in 'vc' claim: %w", err)
+		}
+		claims["nbf"] = jwt.NumericDate(nbf.Unix())
+	}
+
+	if expirationDate, ok := vc["expirationDate"]; ok {
+		exp, err := parseCredentialDate(expirationDate)
+		if err != nil {
+			return fmt.Errorf("invalid 'expirationDate' in 'vc' claim: %w", err)
+		}
+		// Credentials never outlive the configured lifetime
+		if exp.Unix() < int64(claims["exp"].(jwt.NumericDate)) {
+			claims["exp"] = jwt.NumericDate(exp.Unix())
+		}
+	}
+
+	if id, ok := vc["id"]; ok {
+		claims["jti"] = id
+	}
+
+	return nil
+}
+
+func parseCredentialDate(value interface{}) (time.Time, error) {
+	date, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 date, not %T", value)
+	}
+	return time.Parse(time.RFC3339, date)
+}
+
+// containsValue checks if the string value, or array of values, contains the expected string; values of other
+// types never match.
+func containsValue(value interface{}, expected string) bool {
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if s, ok := v.(string); ok && s == expected {
+				return true
+			}
+		}
+		return false
+	}
+	s, ok := value.(string)
+	return ok && s == expected
+}
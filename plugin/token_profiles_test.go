@@ -0,0 +1,426 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func writeProfileRole(b *backend, storage *logical.Storage, name string, data map[string]interface{}) (*logical.Response, error) {
+
+	req := &logical.Request{
+		Operation:  logical.CreateOperation,
+		Path:       "roles/" + name,
+		Storage:    *storage,
+		Data:       data,
+		MountPoint: "test",
+	}
+
+	return b.HandleRequest(context.Background(), req)
+}
+
+func TestParseSPIFFEID(t *testing.T) {
+	valid := map[string]string{
+		"spiffe://example.org/ns/prod/sa/api": "example.org",
+		"spiffe://planet-express.io/ship":     "planet-express.io",
+	}
+
+	for id, expected := range valid {
+		trustDomain, err := parseSPIFFEID(id)
+		if err != nil {
+			t.Errorf("%s: %s", id, err)
+		}
+		if diff := deep.Equal(expected, trustDomain); diff != nil {
+			t.Error(id, diff)
+		}
+	}
+
+	invalid := []string{
+		"https://example.org/api",
+		"spiffe://example.org",
+		"spiffe://Example.org/api",
+		"spiffe://example.org:8443/api",
+		"spiffe://user@example.org/api",
+		"spiffe://example.org/api?version=1",
+		"spiffe://example.org/api#frag",
+		"spiffe://example.org/ns/../api",
+		"spiffe://example.org/ns//api",
+		"spiffe://example.org/api/",
+	}
+
+	for _, id := range invalid {
+		if _, err := parseSPIFFEID(id); err == nil {
+			t.Errorf("%s: should be invalid", id)
+		}
+	}
+}
+
+func TestJWTSVIDProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyTokenTTL: "1h"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:       "https://spiffe.example.org",
+		keyTokenProfile: TokenProfileJWTSVID,
+	}
+
+	// Trust domain pattern is required
+	if resp, err := writeProfileRole(b, storage, "svid", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role without trust domain pattern should have failed")
+	}
+
+	roleData[keyTrustDomainPattern] = `(prod|staging)\.example\.org`
+
+	if resp, err := writeProfileRole(b, storage, "svid", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var claims jwt.Claims
+	if err := getSignedToken(b, storage, "svid", map[string]interface{}{"sub": "spiffe://prod.example.org/ns/billing/sa/api", "aud": "vault"}, nil, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	// Lifetime is capped
+	if claims.Expiry.Time().After(time.Now().Add(JWTSVIDMaxTTL + time.Second)) {
+		t.Error("JWT-SVID lifetime not capped")
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing aud":          {"sub": "spiffe://prod.example.org/api"},
+		"non spiffe sub":       {"sub": "api", "aud": "vault"},
+		"untrusted domain":     {"sub": "spiffe://evil.example.org/api", "aud": "vault"},
+		"partial domain match": {"sub": "spiffe://prod.example.org.evil.com/api", "aud": "vault"},
+	}
+
+	for name, claims := range invalid {
+		if err := getSignedToken(b, storage, "svid", claims, nil, nil, nil); err == nil {
+			t.Error(name, "sign should have failed")
+		}
+	}
+}
+
+func TestVerifiableCredentialProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud", "vc"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp, err := writeProfileRole(b, storage, "credentials", map[string]interface{}{
+		keyIssuer:       "did:example:planet-express",
+		keyTokenProfile: TokenProfileVerifiableCredential,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	credential := func() map[string]interface{} {
+		return map[string]interface{}{
+			"@context":     []interface{}{"https://www.w3.org/2018/credentials/v1"},
+			"id":           "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5",
+			"type":         []interface{}{"VerifiableCredential", "DeliveryCredential"},
+			"issuer":       "did:example:planet-express",
+			"issuanceDate": "2010-01-01T19:23:24Z",
+			"credentialSubject": map[string]interface{}{
+				"id":     "did:example:fry",
+				"rank":   "delivery boy",
+				"vessel": "Planet Express Ship",
+			},
+		}
+	}
+
+	var claims map[string]interface{}
+	headers := map[string]interface{}{}
+	if err := getSignedToken(b, storage, "credentials", map[string]interface{}{"vc": credential()}, nil, &claims, headers); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal(TokenProfileVerifiableCredential, headers["typ"]); diff != nil {
+		t.Error("typ", diff)
+	}
+
+	expectedClaims := map[string]interface{}{
+		"iss": "did:example:planet-express",
+		"sub": "did:example:fry",
+		"jti": "urn:uuid:3978344f-8596-4c3a-a978-8fcaba3903c5",
+		"nbf": float64(time.Date(2010, 1, 1, 19, 23, 24, 0, time.UTC).Unix()),
+	}
+	for claim, value := range expectedClaims {
+		if diff := deep.Equal(value, claims[claim]); diff != nil {
+			t.Error(claim, diff)
+		}
+	}
+
+	invalid := map[string]func(vc map[string]interface{}){
+		"context":      func(vc map[string]interface{}) { vc["@context"] = []interface{}{"https://example.com/context"} },
+		"type":         func(vc map[string]interface{}) { vc["type"] = []interface{}{"DeliveryCredential"} },
+		"subject":      func(vc map[string]interface{}) { delete(vc, "credentialSubject") },
+		"issuer":       func(vc map[string]interface{}) { vc["issuer"] = "did:example:mom-corp" },
+		"issuanceDate": func(vc map[string]interface{}) { vc["issuanceDate"] = "yesterday" },
+		"object subject id": func(vc map[string]interface{}) {
+			vc["credentialSubject"] = map[string]interface{}{"id": map[string]interface{}{"did": "fry"}}
+		},
+		"object issuer id": func(vc map[string]interface{}) {
+			vc["issuer"] = map[string]interface{}{"id": map[string]interface{}{"did": "planet-express"}}
+		},
+		"object type": func(vc map[string]interface{}) { vc["type"] = []interface{}{map[string]interface{}{}} },
+		"expired":     func(vc map[string]interface{}) { vc["expirationDate"] = "2011-01-01T00:00:00Z" },
+	}
+
+	for name, modify := range invalid {
+		vc := credential()
+		modify(vc)
+		if err := getSignedToken(b, storage, "credentials", map[string]interface{}{"vc": vc}, nil, nil, nil); err == nil {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	// Objects are never compared with the credential subject
+	objectSubject := map[string]interface{}{"vc": credential(), "sub": map[string]interface{}{"did": "fry"}}
+	objectSubject["vc"].(map[string]interface{})["credentialSubject"] = map[string]interface{}{"id": map[string]interface{}{"did": "fry"}}
+	if err := getSignedToken(b, storage, "credentials", objectSubject, nil, nil, nil); err == nil {
+		t.Error("object subject should have failed")
+	}
+
+	// The response & lease expire with the credential
+	expiring := credential()
+	expiration := time.Now().Add(time.Minute).Truncate(time.Second).UTC()
+	expiring["expirationDate"] = expiration.Format(time.RFC3339)
+	resp, err := signData(b, storage, "credentials", map[string]interface{}{keyClaims: map[string]interface{}{"vc": expiring}})
+	if err != nil || resp.IsError() {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if diff := deep.Equal(expiration.Unix(), resp.Data["expiration"]); diff != nil {
+		t.Error("expiration", diff)
+	}
+	if resp.Secret != nil && resp.Secret.TTL > time.Minute {
+		t.Errorf("lease outlives the credential: %s", resp.Secret.TTL)
+	}
+
+	// Subject must match the credential subject
+	if err := getSignedToken(b, storage, "credentials", map[string]interface{}{"vc": credential(), "sub": "did:example:bender"}, nil, nil, nil); err == nil {
+		t.Error("mismatched subject should have failed")
+	}
+
+	// Credentials require the 'vc' claim
+	if err := getSignedToken(b, storage, "credentials", map[string]interface{}{"sub": "did:example:fry"}, nil, nil, nil); err == nil {
+		t.Error("missing 'vc' claim should have failed")
+	}
+}
+
+func TestClientAssertionProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyTokenTTL: "1h"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roleData := map[string]interface{}{
+		keyIssuer:       "s6BhdRkqt3",
+		keyTokenProfile: TokenProfileClientAssertion,
+	}
+
+	// Token endpoints must be allowlisted
+	if resp, err := writeProfileRole(b, storage, "client", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("role without allowed audiences should have failed")
+	}
+
+	roleData[keyAllowedAudiences] = "https://auth.example.com/oauth2/token"
+
+	if resp, err := writeProfileRole(b, storage, "client", roleData); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var claims map[string]interface{}
+	if err := getSignedToken(b, storage, "client", map[string]interface{}{"aud": "https://auth.example.com/oauth2/token"}, nil, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal("s6BhdRkqt3", claims["iss"]); diff != nil {
+		t.Error("iss", diff)
+	}
+	if diff := deep.Equal("s6BhdRkqt3", claims["sub"]); diff != nil {
+		t.Error("sub", diff)
+	}
+	if jti, ok := claims["jti"].(string); !ok || jti == "" {
+		t.Error("jti should be generated")
+	}
+
+	// Lifetime is capped
+	if exp := int64(claims["exp"].(float64)); exp > time.Now().Add(ClientAssertionMaxTTL+time.Second).Unix() {
+		t.Error("client assertion lifetime not capped")
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing aud":       {},
+		"unlisted endpoint": {"aud": "https://evil.example.com/oauth2/token"},
+		"multiple aud":      {"aud": []interface{}{"https://auth.example.com/oauth2/token", "https://auth.example.com"}},
+		"foreign sub":       {"aud": "https://auth.example.com/oauth2/token", "sub": "other-client"},
+	}
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"aud", "sub"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	for name, claims := range invalid {
+		if err := getSignedToken(b, storage, "client", claims, nil, nil, nil); err == nil {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	// Subjects are the client, not the caller's entity
+	if resp, err := writeProfileRole(b, storage, "entity-client", map[string]interface{}{
+		keyIssuer:              "s6BhdRkqt3",
+		keyTokenProfile:        TokenProfileClientAssertion,
+		keyAllowedAudiences:    "https://auth.example.com/oauth2/token",
+		keyBindSubjectToEntity: true,
+	}); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("entity bound client assertions should have failed")
+	}
+}
+
+func TestGCPWorkloadIdentityProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keySignatureAlgorithm: "RS256",
+		keyAllowedClaims:      []string{"sub", "aud"},
+	}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp, err := writeProfileRole(b, storage, "gcp", map[string]interface{}{
+		keyIssuer:       "https://vault.example.com/v1/jwt",
+		keyTokenProfile: TokenProfileGCPWorkloadIdentity,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	audience := "//iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/on-prem/providers/vault"
+
+	var claims map[string]interface{}
+	if err := getSignedToken(b, storage, "gcp", map[string]interface{}{"sub": "billing-api", "aud": audience}, nil, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if _, ok := claims["iat"]; !ok {
+		t.Error("iat should be generated")
+	}
+	if exp := int64(claims["exp"].(float64)); exp > time.Now().Add(GCPWorkloadIdentityMaxTTL+time.Second).Unix() {
+		t.Error("workload identity token lifetime not capped")
+	}
+
+	if err := getSignedToken(b, storage, "gcp", map[string]interface{}{"sub": "billing-api", "aud": "https:" + audience}, nil, nil, nil); err != nil {
+		t.Errorf("audience with scheme should be accepted: %v", err)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing sub":      {"aud": audience},
+		"non provider aud": {"sub": "billing-api", "aud": "https://sts.googleapis.com"},
+		"project id aud":   {"sub": "billing-api", "aud": "//iam.googleapis.com/projects/planet-express/locations/global/workloadIdentityPools/on-prem/providers/vault"},
+		"multiple aud":     {"sub": "billing-api", "aud": []interface{}{audience, "vault"}},
+		"long sub":         {"sub": strings.Repeat("x", GCPSubjectMaxLength+1), "aud": audience},
+	}
+
+	for name, claims := range invalid {
+		if err := getSignedToken(b, storage, "gcp", claims, nil, nil, nil); err == nil {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	// Workload identity federation only verifies RS256 & ES256 signatures
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "ES384"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := getSignedToken(b, storage, "gcp", map[string]interface{}{"sub": "billing-api", "aud": audience}, nil, nil, nil); err == nil {
+		t.Error("ES384 signed token should have failed")
+	}
+}
+
+func TestAWSWebIdentityProfile(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"sub", "aud"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if resp, err := writeProfileRole(b, storage, "aws", map[string]interface{}{
+		keyIssuer:       "https://vault.example.com/v1/jwt",
+		keyTokenProfile: TokenProfileAWSWebIdentity,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	var claims map[string]interface{}
+	if err := getSignedToken(b, storage, "aws", map[string]interface{}{"sub": "billing-api"}, nil, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	if diff := deep.Equal(AWSDefaultAudience, claims["aud"]); diff != nil {
+		t.Error("aud should default to AWS STS", diff)
+	}
+	if _, ok := claims["iat"]; !ok {
+		t.Error("iat should be generated")
+	}
+
+	if err := getSignedToken(b, storage, "aws", map[string]interface{}{"sub": "billing-api", "aud": "my-client"}, nil, &claims, nil); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if diff := deep.Equal("my-client", claims["aud"]); diff != nil {
+		t.Error("provided aud should be kept", diff)
+	}
+
+	invalid := map[string]map[string]interface{}{
+		"missing sub": {},
+		"short sub":   {"sub": "api"},
+		"long sub":    {"sub": strings.Repeat("x", AWSSubjectMaxLength+1)},
+	}
+
+	for name, claims := range invalid {
+		if err := getSignedToken(b, storage, "aws", claims, nil, nil, nil); err == nil {
+			t.Error(name, "sign should have failed")
+		}
+	}
+
+	// IAM OIDC identity providers are identified by an https URL
+	if resp, err := writeProfileRole(b, storage, "aws-urn", map[string]interface{}{
+		keyIssuer:       "urn:example:vault",
+		keyTokenProfile: TokenProfileAWSWebIdentity,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if err := getSignedToken(b, storage, "aws-urn", map[string]interface{}{"sub": "billing-api"}, nil, nil, nil); err == nil {
+		t.Error("non https issuer should have failed")
+	}
+
+	// AWS doesn't verify EdDSA signatures
+	if _, err := writeConfig(b, storage, map[string]interface{}{keySignatureAlgorithm: "EdDSA"}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	if err := getSignedToken(b, storage, "aws", map[string]interface{}{"sub": "billing-api"}, nil, nil, nil); err == nil {
+		t.Error("EdDSA signed token should have failed")
+	}
+}
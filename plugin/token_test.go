@@ -0,0 +1,95 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func signTokenResponse(t *testing.T, b *backend, storage *logical.Storage, role string) *logical.Response {
+
+	req := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign/" + role,
+		Storage:    *storage,
+		Data:       map[string]interface{}{},
+		MountPoint: "test",
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return resp
+}
+
+func TestLeaseRevocation(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp := signTokenResponse(t, b, storage, "tester")
+	if resp.Secret == nil {
+		t.Fatal("token should be returned with a lease")
+	}
+
+	token := resp.Data["token"].(string)
+
+	revokeResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.RevokeOperation,
+		Storage:    *storage,
+		Secret:     resp.Secret,
+		MountPoint: "test",
+	})
+	if err != nil || (revokeResp != nil && revokeResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, revokeResp)
+	}
+
+	verifyResp := verifyToken(t, b, storage, map[string]interface{}{keyToken: token})
+	if diff := deep.Equal(false, verifyResp.Data[keyValid]); diff != nil {
+		t.Error("token with revoked lease valid", diff)
+	}
+}
+
+func TestDisableLeases(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{
+		keyLeaseTokens: false,
+	}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	if err := writeRole(b, storage, "tester", "tester.example.com", map[string]interface{}{}, map[string]interface{}{}); err != nil {
+		t.Fatalf("%s\n", err)
+	}
+
+	resp := signTokenResponse(t, b, storage, "tester")
+	if resp.Secret != nil {
+		t.Error("token should be returned without a lease")
+	}
+	if _, ok := resp.Data["token"].(string); !ok {
+		t.Error("no token returned")
+	}
+}
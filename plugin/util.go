@@ -18,13 +18,17 @@ package jwtsecrets
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"encoding/base64"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/mariuszs/friendlyid-go/friendlyid"
+	"gopkg.in/square/go-jose.v2"
 )
 
 // uniqueIdGenerator is an interface for generating unique ids.
@@ -66,6 +70,13 @@ func intMax(x int, y int) int {
 	return y
 }
 
+func intMin(x int, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
 func durationMin(x time.Duration, y time.Duration) time.Duration {
 	if x < y {
 		return x
@@ -73,6 +84,22 @@ func durationMin(x time.Duration, y time.Duration) time.Duration {
 	return y
 }
 
+func durationMax(x time.Duration, y time.Duration) time.Duration {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 func createKeyId(backendId string, policyName string, version int) string {
 
 	rawId := path.Join(backendId, policyName, strconv.Itoa(version))
@@ -82,3 +109,41 @@ func createKeyId(backendId string, policyName string, version int) string {
 
 	return base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
 }
+
+// keyId returns the key id of a key according to the configured strategy; hashedId is the id
+// used by the (default) hash strategy, or when the strategy cannot be applied to the key.
+func keyId(config *Config, publicKey crypto.PublicKey, version int, hashedId string) string {
+	switch config.KeyIDStrategy {
+	case KeyIDStrategyThumbprint:
+		if publicKey == nil {
+			break
+		}
+		thumbprint, err := keyThumbprint(publicKey)
+		if err != nil {
+			break
+		}
+		return base64.RawURLEncoding.EncodeToString(thumbprint)
+	case KeyIDStrategyCounter:
+		return config.KeyIDPrefix + strconv.Itoa(version)
+	}
+	return hashedId
+}
+
+// keyThumbprint returns the RFC 7638 (SHA-256) JWK thumbprint of the public key.
+func keyThumbprint(publicKey crypto.PublicKey) ([]byte, error) {
+	if key, ok := publicKey.(*ecdsa.PublicKey); ok && isSecp256k1Key(key) {
+		return secp256k1Thumbprint(key)
+	}
+	return (&jose.JSONWebKey{Key: publicKey}).Thumbprint(crypto.SHA256)
+}
+
+// requestHeader returns the first value of the named request header, matched case-insensitively; headers are only
+// passed to plugins when configured as passthrough request headers of the mount.
+func requestHeader(req *logical.Request, name string) string {
+	for header, values := range req.Headers {
+		if strings.EqualFold(header, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
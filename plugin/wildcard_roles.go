@@ -0,0 +1,95 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// wildcardParameter is the template parameter holding the part of the requested role name matched by the '*' of
+// a wildcard role (e.g. 'payments' for 'sign/team-payments' matching 'team-*').
+const wildcardParameter = "role_suffix"
+
+// roleNameRegex returns a regex matching role names in paths; generic names, or wildcard names ending in '*'.
+func roleNameRegex(name string) string {
+	return fmt.Sprintf(`(?P<%s>\w(([\w-.]+)?\w)?|\w[\w-.]*\*)`, name)
+}
+
+// isWildcardRoleName checks if the role name is a wildcard, matching names with its prefix (e.g. 'team-*').
+func isWildcardRoleName(name string) bool {
+	return strings.HasSuffix(name, "*")
+}
+
+// matchRole returns the named role or, if it does not exist, the wildcard role with the longest prefix of the
+// name. The name of the returned role is returned with the suffix matched by a wildcard role's '*'.
+func (b *backend) matchRole(ctx context.Context, stg logical.Storage, name string) (*Role, string, string, error) {
+	role, err := b.getRole(ctx, stg, name)
+	if err != nil || role != nil {
+		return role, name, "", err
+	}
+
+	wildcards, err := b.listWildcardRoles(ctx, stg)
+	if err != nil {
+		return nil, name, "", err
+	}
+
+	prefix := ""
+	for _, roleName := range wildcards {
+		rolePrefix := strings.TrimSuffix(roleName, "*")
+		if len(name) > len(rolePrefix) && strings.HasPrefix(name, rolePrefix) && len(rolePrefix) >= len(prefix) {
+			prefix = rolePrefix
+		}
+	}
+	if prefix == "" {
+		return nil, name, "", nil
+	}
+
+	role, err = b.getRole(ctx, stg, prefix+"*")
+	if err != nil || role == nil {
+		return nil, name, "", err
+	}
+
+	return role, prefix + "*", strings.TrimPrefix(name, prefix), nil
+}
+
+// listWildcardRoles returns the names of the wildcard roles, from the cache or the Vault storage API.
+func (b *backend) listWildcardRoles(ctx context.Context, stg logical.Storage) ([]string, error) {
+	wildcards, ok, generation := b.cachedRoles.getWildcards()
+	if ok {
+		return wildcards, nil
+	}
+
+	roleNames, err := stg.List(ctx, keyStorageRolePath+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	wildcards = []string{}
+	for _, roleName := range roleNames {
+		if isWildcardRoleName(roleName) {
+			wildcards = append(wildcards, roleName)
+		}
+	}
+
+	b.cachedRoles.putWildcards(wildcards, generation)
+
+	return wildcards, nil
+}
@@ -0,0 +1,72 @@
+//
+// Copyright 2021 Outfox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jwtsecrets
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestWildcardRoles(t *testing.T) {
+	b, storage := getTestBackend(t)
+
+	if _, err := writeConfig(b, storage, map[string]interface{}{keyAllowedClaims: []string{"aud", "team"}}); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+
+	roles := map[string]string{
+		"team-*":     "{{.role_suffix}}",
+		"team-pay*":  "pay/{{.role_suffix}}",
+		"team-audit": "audit",
+	}
+	for name, team := range roles {
+		roleData := map[string]interface{}{keyClaims: map[string]interface{}{"team": team}}
+		if resp, err := writeRoleData(b, storage, name, roleData); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	expected := map[string]string{
+		"team-payments": "pay/ments",
+		"team-support":  "support",
+		"team-audit":    "audit",
+	}
+	for role, team := range expected {
+		resp, err := signData(b, storage, role, map[string]interface{}{})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		if diff := deep.Equal(team, unsafeClaims(t, resp.Data["token"].(string))["team"]); diff != nil {
+			t.Error(role, diff)
+		}
+	}
+
+	// Wildcards only match names extending their prefix
+	for _, role := range []string{"team-", "other"} {
+		if resp, err := signData(b, storage, role, map[string]interface{}{}); err == nil && (resp == nil || !resp.IsError()) {
+			t.Errorf("%s should not have matched a role", role)
+		}
+	}
+
+	// The wildcard parameter is reserved
+	roleData := map[string]interface{}{keyTemplateParameters: wildcardParameter}
+	if resp, err := writeRoleData(b, storage, "reserved", roleData); err == nil && (resp == nil || !resp.IsError()) {
+		t.Error("reserved template parameter should have failed")
+	}
+}